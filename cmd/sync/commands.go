@@ -3,18 +3,26 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/bandwidth"
 	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/ocs"
+	"github.com/phaus/nextcloud-sync/internal/progress"
+	"github.com/phaus/nextcloud-sync/internal/secrets"
 	"github.com/phaus/nextcloud-sync/internal/sync"
+	"github.com/phaus/nextcloud-sync/internal/watch"
 	"github.com/phaus/nextcloud-sync/internal/webdav"
 )
 
@@ -32,6 +40,31 @@ var commands = []Command{
 		Description: "Interactive setup wizard for configuration",
 		Handler:     handleSetup,
 	},
+	{
+		Name:        "watch",
+		Description: "Keep source and target in sync continuously",
+		Handler:     handleWatch,
+	},
+	{
+		Name:        "trash",
+		Description: "List, restore or purge deleted files on the server",
+		Handler:     handleTrash,
+	},
+	{
+		Name:        "versions",
+		Description: "List or restore earlier versions of a file on the server",
+		Handler:     handleVersions,
+	},
+	{
+		Name:        "share",
+		Description: "List, create or delete shares on the server",
+		Handler:     handleShare,
+	},
+	{
+		Name:        "secrets",
+		Description: "List secret stores or move the secrets of a server to another store",
+		Handler:     handleSecrets,
+	},
 	{
 		Name:        "update-check",
 		Description: "Check for updates",
@@ -44,10 +77,19 @@ var (
 	dryRun           = flag.Bool("dry-run", false, "Show what would be synced without making changes")
 	force            = flag.Bool("force", false, "Force overwrite conflicting files")
 	bidirectional    = flag.Bool("bidirectional", false, "Enable bidirectional synchronization")
+	checksum         = flag.Bool("checksum", false, "Compare file contents by SHA-256 checksum")
+	deleteExtraneous = flag.Bool("delete", false, "Delete files on the target that are not on the source (one-way sync)")
 	excludePatterns  = multiFlag{}
 	profile          = flag.String("profile", "", "Use predefined sync profile")
+	concurrency      = flag.Int("concurrency", 0, "Number of parallel transfers (default from config)")
+	pollInterval     = flag.Duration("poll-interval", 30*time.Second, "How often watch checks the server for changes")
+	debounce         = flag.Duration("debounce", 2*time.Second, "How long watch waits for local changes to settle")
 	verbose          = flag.Bool("verbose", false, "Detailed logging output")
 	configPath       = flag.String("config", "", "Custom config file location")
+	output           = flag.String("output", outputText, "Output format: text, json or ndjson")
+	bwlimitUp        = flag.String("bwlimit-up", "", "Upload bandwidth limit, e.g. 1M or a timetable like \"08:00,1M 18:00,off\"")
+	bwlimitDown      = flag.String("bwlimit-down", "", "Download bandwidth limit, e.g. 1M or a timetable like \"08:00,1M 18:00,off\"")
+	conflictPolicy   = flag.String("conflict-policy", policySourceWins, "How conflicts are resolved: source_wins, target_wins, skip, keep_both or interactive")
 	configTest       = flag.Bool("config-test", false, "Test configuration")
 	connectivityTest = flag.Bool("connectivity-test", false, "Test connectivity")
 	showHelp         = flag.Bool("help", false, "Show help information")
@@ -107,6 +149,10 @@ func showUsage() {
 	fmt.Println("  agent ~/Documents https://cloud.example.com/apps/files/files/12345?dir=/Documents")
 	fmt.Println("  agent --dry-run --verbose ~/Photos https://cloud.example.com/...")
 	fmt.Println("  agent --profile=documents")
+	fmt.Println("  agent --profile=documents watch")
+	fmt.Println("  agent trash restore Documents/report.txt")
+	fmt.Println("  agent versions list Documents/report.txt")
+	fmt.Println("  agent share create --password=secret --expire=2030-12-31 Photos/Holiday")
 	fmt.Println("  agent setup")
 	fmt.Println()
 
@@ -114,55 +160,155 @@ func showUsage() {
 	fmt.Println("  https://github.com/user/nextcloud-sync/wiki")
 }
 
-// handleSync processes the main sync command
-func handleSync(args []string) error {
-	if len(args) < 2 {
-		return fmt.Errorf("sync command requires source and target arguments")
+// syncSession holds everything needed to run sync passes for one source and target
+type syncSession struct {
+	appConfig   *config.Config
+	configPath  string
+	profileName string
+	profile     config.SyncProfile
+	config      *sync.SyncConfig
+	client      webdav.Client
+	source      webdav.Client // Client for the source server when syncing between two servers
+	engine      *sync.SyncEngine
+	events      *ndjsonWriter // Streams sync events with --output=ndjson
+}
+
+// Close releases the resources held by the session
+func (s *syncSession) Close() {
+	if s.client != nil {
+		s.client.Close()
+	}
+	if s.source != nil {
+		s.source.Close()
+	}
+}
+
+// recordLastSync remembers when the profile was last synced successfully
+func (s *syncSession) recordLastSync(result *sync.SyncResult) {
+	if s.profileName == "" || !result.Success || result.DryRun {
+		return
+	}
+
+	now := time.Now()
+	s.profile.LastSync = &now
+	s.appConfig.SyncProfiles[s.profileName] = s.profile
+	if err := config.SaveConfig(s.appConfig, s.configPath); err != nil {
+		fmt.Fprintf(messages(), "⚠️  Failed to update last sync time for profile '%s': %v\n", s.profileName, err)
+	}
+}
+
+// handleSync processes the main sync command and returns the process exit code
+func handleSync(args []string) (int, error) {
+	session, err := newSyncSession(args)
+	if err != nil {
+		return exitFailure, err
+	}
+	defer session.Close()
+
+	// Execute sync, Ctrl+C stops it after the running transfers
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := session.engine.Sync(ctx)
+	if err != nil {
+		return exitFailure, fmt.Errorf("sync failed: %w", err)
+	}
+
+	// Display results
+	printSyncResult(result, session.events)
+
+	session.recordLastSync(result)
+	if ctx.Err() == nil {
+		session.reconcileShares(ctx, result)
+	}
+
+	return resultExitCode(result), nil
+}
+
+// newSyncSession resolves the source, target and settings from the arguments,
+// profile and flags, and creates the sync engine for them
+func newSyncSession(args []string) (*syncSession, error) {
+	appConfig, configPath, err := loadAppConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var source, target string
+	if len(args) >= 2 {
+		source = args[0]
+		target = args[1]
+	}
+
+	// Resolve settings from a named profile, command-line flags add to them
+	syncBidirectional := *bidirectional
+	syncForce := *force
+	syncExcludes := []string(excludePatterns)
+	syncBandwidthUp := *bwlimitUp
+	syncBandwidthDown := *bwlimitDown
+
+	var syncProfile config.SyncProfile
+	if *profile != "" {
+		var err error
+		syncProfile, err = loadSyncProfile(appConfig, *profile)
+		if err != nil {
+			return nil, err
+		}
+
+		source = expandHome(syncProfile.Source)
+		target = expandHome(syncProfile.Target)
+		syncBidirectional = syncBidirectional || syncProfile.Bidirectional
+		syncForce = syncForce || syncProfile.ForceOverwrite
+		syncExcludes = append(append([]string{}, syncProfile.ExcludePatterns...), syncExcludes...)
+		if syncBandwidthUp == "" {
+			syncBandwidthUp = syncProfile.BandwidthUp
+		}
+		if syncBandwidthDown == "" {
+			syncBandwidthDown = syncProfile.BandwidthDown
+		}
+
+		if err := validateSyncEndpoints(source, target); err != nil {
+			return nil, fmt.Errorf("invalid sync profile '%s': %w", *profile, err)
+		}
 	}
 
-	source := args[0]
-	target := args[1]
+	if source == "" || target == "" {
+		return nil, fmt.Errorf("sync command requires source and target arguments")
+	}
+
+	uploadSchedule, err := bandwidth.ParseSchedule(syncBandwidthUp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload bandwidth limit: %w", err)
+	}
+	downloadSchedule, err := bandwidth.ParseSchedule(syncBandwidthDown)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download bandwidth limit: %w", err)
+	}
 
 	// Determine sync direction
 	direction := sync.SyncDirectionLocalToRemote
-	if *bidirectional {
+	if syncBidirectional {
 		direction = sync.SyncDirectionBidirectional
 	} else if strings.Contains(source, "://") && !strings.Contains(target, "://") {
 		direction = sync.SyncDirectionRemoteToLocal
-	} else if strings.Contains(source, "://") && strings.Contains(target, "://") {
-		return fmt.Errorf("both source and target cannot be remote URLs")
 	}
 
 	if *verbose {
-		fmt.Printf("Source: %s\n", source)
-		fmt.Printf("Target: %s\n", target)
-		fmt.Printf("Direction: %s\n", getDirectionName(direction))
-		fmt.Printf("Bidirectional: %t\n", *bidirectional)
-		fmt.Printf("Dry run: %t\n", *dryRun)
-		fmt.Printf("Force: %t\n", *force)
-		if len(excludePatterns) > 0 {
-			fmt.Printf("Exclude patterns: %s\n", strings.Join(excludePatterns, ", "))
-		}
 		if *profile != "" {
-			fmt.Printf("Profile: %s\n", *profile)
+			fmt.Fprintf(messages(), "Profile: %s\n", *profile)
 		}
-	}
-
-	// Load configuration
-	configPath := *configPath
-	if configPath == "" {
-		configPath = getDefaultConfigPath()
-	}
-
-	var appConfig *config.Config
-	if _, err := os.Stat(configPath); err == nil {
-		appConfig, err = config.LoadConfig(configPath)
-		if err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
+		fmt.Fprintf(messages(), "Source: %s\n", source)
+		fmt.Fprintf(messages(), "Target: %s\n", target)
+		fmt.Fprintf(messages(), "Direction: %s\n", getDirectionName(direction))
+		fmt.Fprintf(messages(), "Bidirectional: %t\n", syncBidirectional)
+		fmt.Fprintf(messages(), "Dry run: %t\n", *dryRun)
+		fmt.Fprintf(messages(), "Force: %t\n", syncForce)
+		fmt.Fprintf(messages(), "Conflict policy: %s\n", *conflictPolicy)
+		fmt.Fprintf(messages(), "Checksums: %t\n", *checksum)
+		fmt.Fprintf(messages(), "Delete: %t\n", *deleteExtraneous)
+		fmt.Fprintf(messages(), "Upload limit: %s\n", uploadSchedule)
+		fmt.Fprintf(messages(), "Download limit: %s\n", downloadSchedule)
+		if len(syncExcludes) > 0 {
+			fmt.Fprintf(messages(), "Exclude patterns: %s\n", strings.Join(syncExcludes, ", "))
 		}
-	} else {
-		// Create default config if none exists
-		appConfig = config.NewConfig()
 	}
 
 	// Create sync configuration
@@ -170,61 +316,185 @@ func handleSync(args []string) error {
 		Source:          source,
 		Target:          target,
 		Direction:       direction,
-		Bidirectional:   *bidirectional,
+		Bidirectional:   syncBidirectional,
 		DryRun:          *dryRun,
-		Force:           *force,
-		ExcludePatterns: []string(excludePatterns),
+		Force:           syncForce,
+		ExcludePatterns: syncExcludes,
 		MaxRetries:      3,
 		Timeout:         30 * time.Second,
-		ChunkSize:       1024 * 1024, // 1MB
-		ConflictPolicy:  "source_wins",
+		ChunkSize:       10 * 1024 * 1024, // 10MB
+		ConflictPolicy:  *conflictPolicy,
+		Concurrency:     appConfig.GlobalSettings.MaxConcurrentTransfers,
+		Checksums:       *checksum,
+		Delete:          *deleteExtraneous,
 	}
 
-	// Create authentication provider
-	var authProvider auth.AuthProvider
-	var err error
+	if *concurrency > 0 {
+		syncConfig.Concurrency = *concurrency
+	}
 
-	if strings.Contains(target, "://") || strings.Contains(source, "://") {
-		// Determine server URL from remote target/source
-		serverURL := extractServerURL(source, target)
-		username, password, err := getCredentials(appConfig, serverURL)
+	// The limiters are shared by all transfers of the sync
+	if !uploadSchedule.IsUnlimited() {
+		syncConfig.UploadLimiter = bandwidth.NewLimiter(uploadSchedule)
+	}
+	if !downloadSchedule.IsUnlimited() {
+		syncConfig.DownloadLimiter = bandwidth.NewLimiter(downloadSchedule)
+	}
+
+	if *conflictPolicy == policyInteractive {
+		syncConfig.ConflictPrompt = newConflictPrompter().prompt
+	}
+
+	// Stream operations and conflicts while the sync runs
+	var events *ndjsonWriter
+	if *output == outputNDJSON {
+		events = newNDJSONWriter(os.Stdout)
+		syncConfig.Events = events.handleEvent
+	}
+
+	// Bidirectional syncs need the last synced state to propagate deletions
+	if syncBidirectional {
+		journalPath, err := sync.DefaultJournalPath(sync.JournalName(*profile, source, target))
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine journal path: %w", err)
+		}
+		journal, err := sync.OpenJournal(journalPath)
 		if err != nil {
-			return fmt.Errorf("failed to get credentials: %w", err)
+			return nil, fmt.Errorf("failed to open sync journal: %w", err)
 		}
+		syncConfig.Journal = journal
+	}
 
-		authProvider, err = auth.NewAppPasswordAuth(serverURL, username, password)
+	// Checksum mode keeps local checksums between runs so unchanged files are not hashed again
+	if *checksum {
+		cachePath, err := sync.DefaultChecksumCachePath(sync.JournalName(*profile, source, target))
 		if err != nil {
-			return fmt.Errorf("failed to create auth provider: %w", err)
+			return nil, fmt.Errorf("failed to determine checksum cache path: %w", err)
 		}
+		cache, err := sync.OpenChecksumCache(cachePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open checksum cache: %w", err)
+		}
+		syncConfig.ChecksumCache = cache
 	}
 
-	// Create WebDAV client
-	var webdavClient webdav.Client
-	if authProvider != nil {
-		webdavClient, err = webdav.NewClient(authProvider)
+	// The remote tree is kept between runs so only remote changes since then are fetched
+	if strings.Contains(target, "://") && !strings.Contains(source, "://") {
+		statePath, err := sync.DefaultRemoteStatePath(sync.JournalName(*profile, source, target))
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine remote state path: %w", err)
+		}
+		state, err := sync.OpenRemoteState(statePath)
 		if err != nil {
-			return fmt.Errorf("failed to create WebDAV client: %w", err)
+			return nil, fmt.Errorf("failed to open remote state: %w", err)
 		}
-		defer webdavClient.Close()
+		syncConfig.RemoteState = state
+	}
+
+	// Interrupted downloads continue from their partial files on the next run
+	resumeManager, err := progress.NewResumeManager("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open resume state: %w", err)
+	}
+	syncConfig.ResumeManager = resumeManager
+
+	// Create WebDAV clients, one per server when syncing between two servers
+	var webdavClient, sourceClient webdav.Client
+	if strings.Contains(target, "://") || strings.Contains(source, "://") {
+		webdavClient, err = newWebDAVClient(appConfig, extractServerURL(source, target))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strings.Contains(source, "://") && strings.Contains(target, "://") {
+		sourceClient, err = newWebDAVClient(appConfig, extractBaseURL(source))
+		if err != nil {
+			webdavClient.Close()
+			return nil, err
+		}
+	}
+
+	// Two local directories or two servers are synced through storage backends
+	if strings.Contains(source, "://") == strings.Contains(target, "://") {
+		syncConfig.SourceBackend = sync.NewEndpointBackend(source, sourceClient, syncConfig)
+		syncConfig.TargetBackend = sync.NewEndpointBackend(target, webdavClient, syncConfig)
 	}
 
 	// Create sync engine
 	engine, err := sync.NewSyncEngine(webdavClient, syncConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create sync engine: %w", err)
+		if webdavClient != nil {
+			webdavClient.Close()
+		}
+		if sourceClient != nil {
+			sourceClient.Close()
+		}
+		return nil, fmt.Errorf("failed to create sync engine: %w", err)
 	}
 
-	// Execute sync
-	ctx := context.Background()
-	result, err := engine.Sync(ctx)
+	return &syncSession{
+		appConfig:   appConfig,
+		configPath:  configPath,
+		profileName: *profile,
+		profile:     syncProfile,
+		config:      syncConfig,
+		client:      webdavClient,
+		source:      sourceClient,
+		engine:      engine,
+		events:      events,
+	}, nil
+}
+
+// appConfigPath returns the path of the configuration, from --config or the default location
+func appConfigPath() string {
+	if *configPath != "" {
+		return *configPath
+	}
+	return getDefaultConfigPath()
+}
+
+// loadAppConfig loads the configuration from --config or the default location and
+// returns it with its path. A default configuration is returned if none exists.
+func loadAppConfig() (*config.Config, string, error) {
+	configPath := appConfigPath()
+
+	if _, err := os.Stat(configPath); err != nil {
+		return config.NewConfig(), configPath, nil
+	}
+
+	appConfig, err := config.LoadConfig(configPath)
 	if err != nil {
-		return fmt.Errorf("sync failed: %w", err)
+		return nil, "", fmt.Errorf("failed to load config: %w", err)
 	}
+	return appConfig, configPath, nil
+}
 
-	// Display results
-	displaySyncResult(result)
+// loadSyncProfile looks up and validates a named sync profile
+func loadSyncProfile(appConfig *config.Config, name string) (config.SyncProfile, error) {
+	syncProfile, exists := appConfig.SyncProfiles[name]
+	if !exists {
+		return syncProfile, fmt.Errorf("sync profile '%s' not found in configuration", name)
+	}
 
-	return nil
+	if err := config.ValidateSyncProfile(name, syncProfile); err != nil {
+		return syncProfile, fmt.Errorf("invalid sync profile '%s': %w", name, err)
+	}
+
+	return syncProfile, nil
+}
+
+// expandHome expands a leading ~ in a local path to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
 }
 
 // Command handlers
@@ -277,7 +547,7 @@ func handleSetup(args []string) error {
 			continue
 		}
 
-		server, err := setupServer(reader)
+		server, err := setupServer(reader, serverName)
 		if err != nil {
 			return fmt.Errorf("failed to setup server: %w", err)
 		}
@@ -355,6 +625,82 @@ func handleSetup(args []string) error {
 	return nil
 }
 
+func handleWatch(args []string) error {
+	if len(args) == 0 && *profile == "" {
+		return fmt.Errorf("watch requires source and target arguments or --profile")
+	}
+	if err := validateSyncArgs(args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if err := validateFlags(); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+	if *conflictPolicy == policyInteractive {
+		return fmt.Errorf("watch cannot resolve conflicts interactively, use another --conflict-policy")
+	}
+
+	session, err := newSyncSession(args)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if !isLocalPath(session.config.Source) || !isURL(session.config.Target) {
+		return fmt.Errorf("watch requires a local source and a remote target")
+	}
+
+	matcher := session.engine.GetExcludeMatcher()
+	localWatcher, err := watch.NewFileWatcher(session.config.Source, matcher.ShouldExclude)
+	if err != nil {
+		if !errors.Is(err, watch.ErrUnsupported) {
+			return fmt.Errorf("failed to watch %s: %w", session.config.Source, err)
+		}
+		fmt.Fprintln(messages(), "⚠️  Local file system events are not supported on this platform, only remote changes are watched")
+		localWatcher = nil
+	} else {
+		defer localWatcher.Close()
+	}
+
+	poller := watch.NewRemotePoller(session.client, session.engine.RemoteRoot())
+
+	syncSubtrees := func(ctx context.Context, subtrees []string) error {
+		if *verbose {
+			fmt.Fprintf(messages(), "🔄 Syncing %s\n", strings.Join(subtrees, ", "))
+		}
+
+		result, err := session.engine.SyncSubtrees(ctx, subtrees)
+		if err != nil {
+			return fmt.Errorf("sync failed: %w", err)
+		}
+
+		if result.ProcessedFiles > 0 || len(result.Errors) > 0 || len(result.Conflicts) > 0 {
+			printSyncResult(result, session.events)
+		}
+		session.recordLastSync(result)
+		if ctx.Err() == nil {
+			session.reconcileShares(ctx, result)
+		}
+
+		return nil
+	}
+
+	options := watch.DefaultOptions()
+	options.Quiet = *debounce
+	options.MaxDelay = 15 * *debounce
+	options.PollInterval = *pollInterval
+	options.OnError = func(err error) {
+		fmt.Fprintf(messages(), "❌ %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(messages(), "👀 Watching %s and %s (Ctrl+C to stop)\n", session.config.Source, session.config.Target)
+
+	watcher := watch.NewWatcher(localWatcher, poller, syncSubtrees, options)
+	return watcher.Run(ctx)
+}
+
 func handleUpdateCheck(args []string) error {
 	fmt.Println("Update check not yet implemented")
 	return nil
@@ -366,10 +712,7 @@ func handleConfigTest() error {
 	fmt.Println()
 
 	// Get config path
-	configPath := *configPath
-	if configPath == "" {
-		configPath = getDefaultConfigPath()
-	}
+	configPath := appConfigPath()
 
 	fmt.Printf("Testing configuration at: %s\n", configPath)
 	fmt.Println()
@@ -416,29 +759,58 @@ func handleConfigTest() error {
 			}
 			fmt.Printf("   ✅ Username: %s\n", server.Username)
 
-			// Test password decryption
-			password, err := config.DecryptPassword(server.AppPassword)
-			if err != nil {
-				fmt.Printf("   ❌ Password decryption failed: %v\n", err)
-				continue
+			// Test credential decryption
+			var authProvider auth.AuthProvider
+			if server.OAuth2 != nil {
+				provider, err := oauth2Provider(name, server)
+				if err != nil {
+					fmt.Printf("   ❌ OAuth2 settings failed: %v\n", err)
+					continue
+				}
+				fmt.Printf("   ✅ OAuth2 client '%s' decrypted successfully\n", server.OAuth2.ClientID)
+				authProvider = provider
+			} else {
+				store, err := openSecretStore(name, &server)
+				if err != nil {
+					fmt.Printf("   ❌ Secret store failed: %v\n", err)
+					continue
+				}
+				password, err := store.Get(secrets.AppPassword)
+				if err != nil {
+					fmt.Printf("   ❌ Password decryption failed: %v\n", err)
+					continue
+				}
+				fmt.Printf("   ✅ App password read from the %s store\n", server.SecretStoreType())
+
+				provider, err := auth.NewAppPasswordAuth(server.URL, server.Username, password)
+				if err != nil {
+					fmt.Printf("   ⚠️  Could not create auth provider: %v\n", err)
+				} else {
+					authProvider = provider
+				}
+
+				// Clear password from memory
+				password = ""
 			}
-			fmt.Printf("   ✅ App password decrypted successfully\n")
 
 			// Test authentication (optional connectivity test)
-			authProvider, err := auth.NewAppPasswordAuth(server.URL, server.Username, password)
-			if err != nil {
-				fmt.Printf("   ⚠️  Could not create auth provider: %v\n", err)
-			} else {
+			if authProvider != nil {
 				// Validate credentials
 				if err := authProvider.ValidateCredentials(context.Background()); err != nil {
 					fmt.Printf("   ❌ Credential validation failed: %v\n", err)
 				} else {
 					fmt.Printf("   ✅ Credentials validated successfully\n")
+
+					if client, err := ocs.NewClient(authProvider); err == nil {
+						if caps, err := client.Capabilities(context.Background()); err != nil {
+							fmt.Printf("   ⚠️  Could not determine server capabilities: %v\n", err)
+						} else {
+							fmt.Printf("   ✅ %s\n", describeCapabilities(caps))
+						}
+					}
 				}
 			}
 
-			// Clear password from memory
-			password = ""
 			fmt.Println()
 		}
 	}
@@ -594,6 +966,40 @@ func extractServerURL(source, target string) string {
 	return ""
 }
 
+// newWebDAVClient creates a WebDAV client for a server with the stored credentials
+func newWebDAVClient(appConfig *config.Config, serverURL string) (webdav.Client, error) {
+	authProvider, err := newAuthProvider(appConfig, serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := webdav.NewClient(authProvider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WebDAV client: %w", err)
+	}
+
+	return client, nil
+}
+
+// newAuthProvider creates an authenticator for a server with the stored credentials
+func newAuthProvider(appConfig *config.Config, serverURL string) (auth.AuthProvider, error) {
+	if name, server, found := findServer(appConfig, serverURL); found && server.OAuth2 != nil {
+		return oauth2Provider(name, server)
+	}
+
+	username, password, err := getCredentials(appConfig, serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+
+	authProvider, err := auth.NewAppPasswordAuth(serverURL, username, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth provider: %w", err)
+	}
+
+	return authProvider, nil
+}
+
 // extractBaseURL extracts base URL from a Nextcloud URL
 func extractBaseURL(url string) string {
 	if idx := strings.Index(url, "/apps/"); idx != -1 {
@@ -605,20 +1011,44 @@ func extractBaseURL(url string) string {
 	return strings.TrimSuffix(url, "/")
 }
 
+// findServer looks up the configured server of a Nextcloud URL, preferring an
+// exact base URL match
+func findServer(appConfig *config.Config, serverURL string) (string, config.Server, bool) {
+	if appConfig == nil || appConfig.Servers == nil {
+		return "", config.Server{}, false
+	}
+
+	baseURL := strings.TrimSuffix(extractBaseURL(serverURL), "/")
+	for name, server := range appConfig.Servers {
+		if strings.TrimSuffix(server.URL, "/") == baseURL {
+			return name, server, true
+		}
+	}
+
+	for name, server := range appConfig.Servers {
+		if strings.Contains(server.URL, extractBaseURL(serverURL)) || extractBaseURL(serverURL) == server.URL {
+			return name, server, true
+		}
+	}
+
+	return "", config.Server{}, false
+}
+
 // getCredentials retrieves credentials for the given server URL
 func getCredentials(appConfig *config.Config, serverURL string) (string, string, error) {
-	// Try to find matching server in config
-	if appConfig != nil && appConfig.Servers != nil {
-		for name, server := range appConfig.Servers {
-			if strings.Contains(server.URL, extractBaseURL(serverURL)) || extractBaseURL(serverURL) == server.URL {
-				// Decrypt password
-				password, err := config.DecryptPassword(server.AppPassword)
-				if err != nil {
-					return "", "", fmt.Errorf("failed to decrypt password for server %s: %w", name, err)
-				}
-				return server.Username, password, nil
-			}
+	if name, server, found := findServer(appConfig, serverURL); found {
+		if server.OAuth2 != nil {
+			return "", "", fmt.Errorf("server %s uses OAuth2 and has no app password", name)
+		}
+		store, err := openSecretStore(name, &server)
+		if err != nil {
+			return "", "", err
 		}
+		password, err := store.Get(secrets.AppPassword)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read password for server %s: %w", name, err)
+		}
+		return server.Username, password, nil
 	}
 
 	// Fallback to environment variables or prompt user
@@ -649,6 +1079,9 @@ func displaySyncResult(result *sync.SyncResult) {
 	fmt.Printf("Created: %d files\n", len(result.CreatedFiles))
 	fmt.Printf("Updated: %d files\n", len(result.UpdatedFiles))
 	fmt.Printf("Deleted: %d files\n", len(result.DeletedFiles))
+	if len(result.MovedFiles) > 0 {
+		fmt.Printf("Moved: %d files\n", len(result.MovedFiles))
+	}
 
 	if len(result.SkippedFiles) > 0 {
 		fmt.Printf("Skipped: %d files\n", len(result.SkippedFiles))
@@ -676,7 +1109,13 @@ func displaySyncResult(result *sync.SyncResult) {
 	if len(result.Conflicts) > 0 {
 		fmt.Printf("Conflicts: %d\n", len(result.Conflicts))
 		for _, conflict := range result.Conflicts {
-			fmt.Printf("  - %s\n", conflict.Description)
+			fmt.Printf("  - %s: %s\n", conflict.LocalPath, conflict.Description)
+			if resolution := conflict.Resolution; resolution.Action != "" {
+				fmt.Printf("    resolved: %s (%s)\n", resolution.Action, resolution.Reason)
+				if resolution.CopyPath != "" {
+					fmt.Printf("    conflicted copy: %s\n", resolution.CopyPath)
+				}
+			}
 		}
 	}
 
@@ -696,7 +1135,7 @@ func displaySyncResult(result *sync.SyncResult) {
 }
 
 // setupServer configures a new server with user input
-func setupServer(reader *bufio.Reader) (config.Server, error) {
+func setupServer(reader *bufio.Reader, name string) (config.Server, error) {
 	var server config.Server
 
 	// Server URL
@@ -719,10 +1158,54 @@ func setupServer(reader *bufio.Reader) (config.Server, error) {
 		break
 	}
 
+	// Companies may enforce OAuth2 through the oauth2 app
+	useOAuth2, err := promptYesNo(reader, "Log in with an OAuth2 client registered by your administrator? (y/n): ", false)
+	if err != nil {
+		return server, err
+	}
+	if useOAuth2 {
+		if err := loginWithOAuth2(reader, name, &server); err != nil {
+			return server, fmt.Errorf("OAuth2 login failed: %w", err)
+		}
+	} else {
+		// Login Flow v2 fills in the username and an app password
+		manual, err := promptYesNo(reader, "Enter username and app password by hand instead of logging in with your browser? (y/n): ", false)
+		if err != nil {
+			return server, err
+		}
+		if !manual {
+			if err := loginWithBrowser(&server); err != nil {
+				fmt.Printf("⚠️  Browser login failed: %v\n", err)
+				fmt.Println("Enter an app password by hand instead.")
+				manual = true
+			}
+		}
+		if manual {
+			if err := enterAppPassword(reader, &server); err != nil {
+				return server, err
+			}
+		}
+	}
+
+	// Root path (optional)
+	rootPath, err := promptString(reader, "Enter root path (optional, press Enter for default): ", false)
+	if err != nil {
+		return server, err
+	}
+	if rootPath != "" {
+		server.RootPath = strings.TrimPrefix(rootPath, "/")
+	}
+
+	return server, nil
+}
+
+// enterAppPassword asks for the username and an app password created by hand in
+// the web interface
+func enterAppPassword(reader *bufio.Reader, server *config.Server) error {
 	// Username
 	username, err := promptString(reader, "Enter your Nextcloud username: ", true)
 	if err != nil {
-		return server, err
+		return err
 	}
 	server.Username = username
 
@@ -738,7 +1221,7 @@ func setupServer(reader *bufio.Reader) (config.Server, error) {
 	for {
 		password, err := promptPassword(reader, "Enter app password: ")
 		if err != nil {
-			return server, err
+			return err
 		}
 
 		if password == "" {
@@ -749,7 +1232,7 @@ func setupServer(reader *bufio.Reader) (config.Server, error) {
 		// Encrypt password
 		encrypted, err := config.EncryptPassword(password)
 		if err != nil {
-			return server, fmt.Errorf("failed to encrypt password: %w", err)
+			return fmt.Errorf("failed to encrypt password: %w", err)
 		}
 
 		server.AppPassword = encrypted
@@ -760,16 +1243,7 @@ func setupServer(reader *bufio.Reader) (config.Server, error) {
 		break
 	}
 
-	// Root path (optional)
-	rootPath, err := promptString(reader, "Enter root path (optional, press Enter for default): ", false)
-	if err != nil {
-		return server, err
-	}
-	if rootPath != "" {
-		server.RootPath = strings.TrimPrefix(rootPath, "/")
-	}
-
-	return server, nil
+	return nil
 }
 
 // setupSyncProfile configures a new sync profile with user input
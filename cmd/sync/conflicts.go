@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/sync"
+)
+
+// Conflict policies selected with --conflict-policy
+const (
+	policySourceWins  = "source_wins"
+	policyTargetWins  = "target_wins"
+	policySkip        = "skip"
+	policyKeepBoth    = "keep_both"
+	policyInteractive = "interactive"
+)
+
+// isValidConflictPolicy checks if a conflict policy is supported
+func isValidConflictPolicy(policy string) bool {
+	switch policy {
+	case policySourceWins, policyTargetWins, policySkip, policyKeepBoth, policyInteractive:
+		return true
+	default:
+		return false
+	}
+}
+
+// conflictChoices maps the answers to the conflict prompt to resolution actions
+var conflictChoices = map[string]string{
+	"l": "local_wins",
+	"r": "remote_wins",
+	"b": "keep_both",
+	"s": "skip",
+}
+
+// conflictPrompter asks on the terminal how conflicts are resolved
+type conflictPrompter struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+// newConflictPrompter creates a prompter that reads answers from stdin
+func newConflictPrompter() *conflictPrompter {
+	return &conflictPrompter{
+		reader: bufio.NewReader(os.Stdin),
+		out:    messages(),
+	}
+}
+
+// prompt shows a conflict and reads the choice, it is used as sync.ConflictPromptFunc
+func (p *conflictPrompter) prompt(details *sync.ConflictDetails) (sync.ConflictChoice, error) {
+	conflict := details.Conflict
+
+	fmt.Fprintf(p.out, "\n⚠️  Conflict: %s\n", conflict.LocalPath)
+	fmt.Fprintf(p.out, "   %s\n\n", conflict.Description)
+	fmt.Fprintf(p.out, "   %-10s %-28s %s\n", "", "Local", "Remote")
+	fmt.Fprintf(p.out, "   %-10s %-28s %s\n", "Size:", metaSize(conflict.LocalMeta), metaSize(conflict.RemoteMeta))
+	fmt.Fprintf(p.out, "   %-10s %-28s %s\n", "Modified:", metaModified(conflict.LocalMeta), metaModified(conflict.RemoteMeta))
+	fmt.Fprintf(p.out, "   %-10s %-28s %s\n", "ETag:", metaETag(conflict.LocalMeta), metaETag(conflict.RemoteMeta))
+
+	if details.Diff != "" {
+		fmt.Fprintln(p.out)
+		fmt.Fprintln(p.out, "   --- local")
+		fmt.Fprintln(p.out, "   +++ remote")
+		for _, line := range strings.Split(strings.TrimSuffix(details.Diff, "\n"), "\n") {
+			fmt.Fprintf(p.out, "   %s\n", line)
+		}
+	}
+
+	for {
+		fmt.Fprint(p.out, "\nKeep [l]ocal, [r]emote, [b]oth or [s]kip? Upper case applies to all remaining conflicts: ")
+		input, err := p.reader.ReadString('\n')
+		if err != nil {
+			return sync.ConflictChoice{}, err
+		}
+
+		input = strings.TrimSpace(input)
+		if action, ok := conflictChoices[strings.ToLower(input)]; ok {
+			return sync.ConflictChoice{
+				Action:     action,
+				ApplyToAll: input != strings.ToLower(input),
+			}, nil
+		}
+		fmt.Fprintln(p.out, "Please enter 'l', 'r', 'b' or 's'.")
+	}
+}
+
+// metaSize formats the size of one side of a conflict
+func metaSize(meta *sync.FileMetadata) string {
+	switch {
+	case meta == nil:
+		return "(deleted)"
+	case meta.IsDirectory:
+		return "(directory)"
+	default:
+		return formatBytes(meta.Size)
+	}
+}
+
+// metaModified formats the modification time of one side of a conflict
+func metaModified(meta *sync.FileMetadata) string {
+	if meta == nil || meta.Modified.IsZero() {
+		return "-"
+	}
+	return meta.Modified.Local().Format(time.RFC3339)
+}
+
+// metaETag formats the ETag of one side of a conflict
+func metaETag(meta *sync.FileMetadata) string {
+	if meta == nil || meta.ETag == "" {
+		return "-"
+	}
+	return meta.ETag
+}
@@ -6,6 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/phaus/nextcloud-sync/internal/bandwidth"
+	"github.com/phaus/nextcloud-sync/internal/config"
 )
 
 // ParseAndValidate handles command-line argument parsing and validation
@@ -54,7 +57,7 @@ func ParseAndValidate() error {
 	}
 
 	// Otherwise, treat as sync command
-	if len(args) == 0 {
+	if len(args) == 0 && *profile == "" {
 		showUsage()
 		os.Exit(1)
 	}
@@ -74,13 +77,23 @@ func ParseAndValidate() error {
 
 // validateSyncArgs validates the main sync arguments
 func validateSyncArgs(args []string) error {
+	// Source and target come from the profile when one is given
+	if *profile != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("source and target cannot be combined with --profile")
+		}
+		return nil
+	}
+
 	if len(args) < 2 {
 		return fmt.Errorf("sync command requires at least source and target arguments")
 	}
 
-	source := args[0]
-	target := args[1]
+	return validateSyncEndpoints(args[0], args[1])
+}
 
+// validateSyncEndpoints validates a sync source and target
+func validateSyncEndpoints(source, target string) error {
 	// Validate source path
 	if !isValidPath(source) {
 		return fmt.Errorf("invalid source path: %s", source)
@@ -91,11 +104,6 @@ func validateSyncArgs(args []string) error {
 		return fmt.Errorf("invalid target path: %s", target)
 	}
 
-	// Check if both are local paths (invalid)
-	if isLocalPath(source) && isLocalPath(target) {
-		return fmt.Errorf("at least one of source or target must be a remote URL")
-	}
-
 	return nil
 }
 
@@ -108,6 +116,29 @@ func validateFlags() error {
 		}
 	}
 
+	// Validate concurrency
+	if *concurrency < 0 || *concurrency > config.MaxConcurrentTransfersLimit {
+		return fmt.Errorf("concurrency must be between 0 and %d", config.MaxConcurrentTransfersLimit)
+	}
+
+	// Validate output format
+	if !isValidOutputFormat(*output) {
+		return fmt.Errorf("invalid output format: %s (use text, json or ndjson)", *output)
+	}
+
+	// Validate conflict policy
+	if !isValidConflictPolicy(*conflictPolicy) {
+		return fmt.Errorf("invalid conflict policy: %s (use source_wins, target_wins, skip, keep_both or interactive)", *conflictPolicy)
+	}
+
+	// Validate bandwidth limits
+	if _, err := bandwidth.ParseSchedule(*bwlimitUp); err != nil {
+		return fmt.Errorf("invalid --bwlimit-up: %w", err)
+	}
+	if _, err := bandwidth.ParseSchedule(*bwlimitDown); err != nil {
+		return fmt.Errorf("invalid --bwlimit-down: %w", err)
+	}
+
 	// Validate profile name
 	if *profile != "" {
 		if !isValidProfileName(*profile) {
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
+	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+)
+
+// Usage of the trash and versions commands
+const (
+	trashUsage    = "trash list | trash restore <name|path>... | trash purge [<name|path>...]"
+	versionsUsage = "versions list <path> | versions restore <path> <version>"
+)
+
+// handleTrash lists, restores and purges the items of the Nextcloud trashbin
+func handleTrash(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", trashUsage)
+	}
+	switch args[0] {
+	case "list", "purge":
+	case "restore":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s", trashUsage)
+		}
+	default:
+		return fmt.Errorf("unknown trash command %q, usage: %s", args[0], trashUsage)
+	}
+	if err := validateFlags(); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+
+	client, err := newRemoteClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := requireCapability(ctx, client, "the trashbin", func(caps *capabilities.Capabilities) bool { return caps.Trashbin }); err != nil {
+		return err
+	}
+
+	items, err := client.ListTrash(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Most recently deleted first
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletionTime.After(items[j].DeletionTime) })
+
+	switch args[0] {
+	case "list":
+		return printTrash(items)
+	case "restore":
+		for _, ref := range args[1:] {
+			item, err := findTrashItem(items, ref)
+			if err != nil {
+				return err
+			}
+			if err := client.RestoreTrashItem(ctx, item.Name); err != nil {
+				return err
+			}
+			fmt.Fprintf(messages(), "♻️  Restored %s\n", item.OriginalLocation)
+		}
+		return nil
+	default:
+		return purgeTrash(ctx, client, items, args[1:])
+	}
+}
+
+// purgeTrash permanently deletes items of the trashbin, or all of them after
+// confirmation if no item is given
+func purgeTrash(ctx context.Context, client webdav.Client, items []*webdav.TrashItem, refs []string) error {
+	if len(refs) == 0 {
+		if len(items) == 0 {
+			fmt.Fprintln(messages(), "The trashbin is empty")
+			return nil
+		}
+
+		if !*force {
+			prompt := fmt.Sprintf("Permanently delete all %d items in the trashbin? [y/N]: ", len(items))
+			confirmed, err := promptYesNo(bufio.NewReader(os.Stdin), prompt, false)
+			if err != nil {
+				return fmt.Errorf("failed to read confirmation: %w", err)
+			}
+			if !confirmed {
+				return nil
+			}
+		}
+
+		if err := client.EmptyTrash(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages(), "🗑️  Deleted %d items permanently\n", len(items))
+		return nil
+	}
+
+	for _, ref := range refs {
+		item, err := findTrashItem(items, ref)
+		if err != nil {
+			return err
+		}
+		if err := client.DeleteTrashItem(ctx, item.Name); err != nil {
+			return err
+		}
+		fmt.Fprintf(messages(), "🗑️  Deleted %s permanently\n", item.OriginalLocation)
+	}
+	return nil
+}
+
+// findTrashItem finds an item of the trashbin by its name in the trashbin or by its
+// original location. Of several items deleted from the same location, the most
+// recently deleted one is returned; items are sorted accordingly.
+func findTrashItem(items []*webdav.TrashItem, ref string) (*webdav.TrashItem, error) {
+	for _, item := range items {
+		if item.Name == ref {
+			return item, nil
+		}
+	}
+
+	location := strings.Trim(ref, "/")
+	for _, item := range items {
+		if item.OriginalLocation == location {
+			return item, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s is not in the trashbin", ref)
+}
+
+// printTrash prints the items of the trashbin in the selected output format
+func printTrash(items []*webdav.TrashItem) error {
+	if *output != outputText {
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = item
+		}
+		return printJSONList(values)
+	}
+
+	if len(items) == 0 {
+		fmt.Println("The trashbin is empty")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DELETED\tSIZE\tORIGINAL LOCATION\tNAME")
+	for _, item := range items {
+		location := item.OriginalLocation
+		size := formatBytes(item.Size)
+		if item.IsDirectory {
+			location += "/"
+			size = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.DeletionTime.Format("2006-01-02 15:04"), size, location, item.Name)
+	}
+	return w.Flush()
+}
+
+// handleVersions lists and restores earlier versions of a file
+func handleVersions(args []string) error {
+	if len(args) < 2 || (args[0] == "list" && len(args) != 2) || (args[0] == "restore" && len(args) != 3) {
+		return fmt.Errorf("usage: %s", versionsUsage)
+	}
+	if args[0] != "list" && args[0] != "restore" {
+		return fmt.Errorf("unknown versions command %q, usage: %s", args[0], versionsUsage)
+	}
+	if err := validateFlags(); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+
+	client, err := newRemoteClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := requireCapability(ctx, client, "file versions", func(caps *capabilities.Capabilities) bool { return caps.Versioning }); err != nil {
+		return err
+	}
+
+	filePath := "/" + strings.TrimPrefix(args[1], "/")
+	versions, err := client.ListVersions(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
+	// Newest first
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].LastModified.After(versions[j].LastModified) })
+
+	if args[0] == "list" {
+		return printVersions(versions)
+	}
+
+	for _, version := range versions {
+		if version.Name == args[2] {
+			if err := client.RestoreVersion(ctx, version); err != nil {
+				return err
+			}
+			fmt.Fprintf(messages(), "♻️  Restored %s to the version of %s\n", args[1], version.LastModified.Format("2006-01-02 15:04:05"))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s has no version %s, see 'versions list %s'", args[1], args[2], args[1])
+}
+
+// printVersions prints the versions of a file in the selected output format
+func printVersions(versions []*webdav.FileVersion) error {
+	if *output != outputText {
+		values := make([]interface{}, len(versions))
+		for i, version := range versions {
+			values[i] = version
+		}
+		return printJSONList(values)
+	}
+
+	if len(versions) == 0 {
+		fmt.Println("No earlier versions")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tMODIFIED\tSIZE\tLABEL")
+	for _, version := range versions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", version.Name, version.LastModified.Local().Format("2006-01-02 15:04:05"), formatBytes(version.Size), version.Label)
+	}
+	return w.Flush()
+}
+
+// requireCapability fails if the server reports that a feature is disabled. If the
+// capabilities are unknown, the feature is assumed to be there.
+func requireCapability(ctx context.Context, client interface{}, feature string, enabled func(*capabilities.Capabilities) bool) error {
+	provider, ok := client.(interface {
+		Capabilities(ctx context.Context) (*capabilities.Capabilities, error)
+	})
+	if !ok {
+		return nil
+	}
+	caps, err := provider.Capabilities(ctx)
+	if err != nil || enabled(caps) {
+		return nil
+	}
+	return fmt.Errorf("the server does not support %s, the app providing it may be disabled", feature)
+}
+
+// describeCapabilities summarizes the capabilities of a server in one line
+func describeCapabilities(caps *capabilities.Capabilities) string {
+	features := []string{}
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"chunked uploads", caps.ChunkingV2},
+		{"bulk uploads", caps.BulkUpload},
+		{"trashbin", caps.Trashbin},
+		{"versions", caps.Versioning},
+		{"sharing", caps.Sharing},
+	} {
+		if feature.enabled {
+			features = append(features, feature.name)
+		}
+	}
+	if caps.MaxChunkSize > 0 {
+		features = append(features, "chunks up to "+formatBytes(caps.MaxChunkSize))
+	}
+	if len(caps.ChecksumTypes) > 0 {
+		features = append(features, "checksums "+strings.Join(caps.ChecksumTypes, ", "))
+	}
+
+	if len(features) == 0 {
+		return "Nextcloud " + caps.Version.String
+	}
+	return fmt.Sprintf("Nextcloud %s: %s", caps.Version.String, strings.Join(features, ", "))
+}
+
+// printJSONList prints values as a JSON array, or one per line with --output=ndjson
+func printJSONList(values []interface{}) error {
+	if *output == outputNDJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, value := range values {
+			if err := encoder.Encode(value); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(values); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// newRemoteClient creates a WebDAV client for the server of --profile or, without
+// a profile, for the only configured server
+func newRemoteClient() (webdav.Client, error) {
+	appConfig, _, err := loadAppConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := remoteServerURL(appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWebDAVClient(appConfig, serverURL)
+}
+
+// remoteServerURL returns the URL of the server commands outside a sync work on
+func remoteServerURL(appConfig *config.Config) (string, error) {
+	if *profile != "" {
+		syncProfile, err := loadSyncProfile(appConfig, *profile)
+		if err != nil {
+			return "", err
+		}
+		serverURL := extractServerURL(syncProfile.Source, syncProfile.Target)
+		if serverURL == "" {
+			return "", fmt.Errorf("profile '%s' does not sync with a Nextcloud server", *profile)
+		}
+		return serverURL, nil
+	}
+
+	if len(appConfig.Servers) == 1 {
+		for _, server := range appConfig.Servers {
+			return server.URL, nil
+		}
+	}
+	if len(appConfig.Servers) == 0 {
+		return "", fmt.Errorf("no server configured, run 'agent setup' first")
+	}
+	return "", fmt.Errorf("%d servers are configured, choose one with --profile", len(appConfig.Servers))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/config"
+)
+
+// loginWithBrowser lets the user grant an app password in the browser through
+// Login Flow v2 and fills in the server URL, username and app password from it
+func loginWithBrowser(server *config.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Nextcloud names the app password after the user agent
+	userAgent := "nextcloud-sync"
+	if hostname, err := os.Hostname(); err == nil {
+		userAgent = fmt.Sprintf("nextcloud-sync (%s)", hostname)
+	}
+
+	flow, err := auth.StartLoginFlow(ctx, server.URL, userAgent)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n🌐 Log in to Nextcloud and grant access in your browser:")
+	fmt.Printf("   %s\n", flow.LoginURL)
+	if err := openBrowser(flow.LoginURL); err != nil {
+		fmt.Println("   Open the link above if no browser window appeared.")
+	}
+	fmt.Println("Waiting for the login to be approved (Ctrl+C to cancel)...")
+
+	credentials, err := flow.Wait(ctx, auth.DefaultLoginPollInterval)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := auth.NewAppPasswordManager(nil).EncryptAndStoreAppPassword(credentials.AppPassword)
+	if err != nil {
+		return err
+	}
+
+	// Behind a TLS terminating proxy Nextcloud may report an http URL, which
+	// would be a downgrade of the URL that was entered
+	if credentials.Server != "" && (strings.HasPrefix(credentials.Server, "https://") || !strings.HasPrefix(server.URL, "https://")) {
+		server.URL = credentials.Server
+	}
+	server.Username = credentials.LoginName
+	server.AppPassword = encrypted
+	fmt.Printf("✅ Logged in as %s\n", credentials.LoginName)
+	return nil
+}
+
+// openBrowser opens a URL in the default browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
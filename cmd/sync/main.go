@@ -17,16 +17,21 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Get sync arguments
-	source, target, _ := GetSyncArgs()
+	// Get sync arguments, empty when a profile provides them
+	var syncArgs []string
+	if source, target, _ := GetSyncArgs(); source != "" {
+		syncArgs = []string{source, target}
+	}
 
 	// Setup logging based on verbose flag
 	setupLogging()
 
 	// Handle sync command
-	if err := handleSync([]string{source, target}); err != nil {
+	exitCode, err := handleSync(syncArgs)
+	if err != nil {
 		log.Fatalf("Sync failed: %v", err)
 	}
+	os.Exit(exitCode)
 }
 
 // setupLogging configures logging based on flags
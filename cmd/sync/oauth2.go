@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	stdsync "sync"
+	"syscall"
+
+	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/secrets"
+)
+
+// defaultOAuth2RedirectURL is the suggested redirection URI of the OAuth2 client
+const defaultOAuth2RedirectURL = "http://localhost:8765/callback"
+
+// oauth2Providers are the OAuth2 authenticators of this run keyed by server name
+var (
+	oauth2ProvidersMu stdsync.Mutex
+	oauth2Providers   = make(map[string]*auth.OAuth2Auth)
+)
+
+// loginWithOAuth2 authorizes an OAuth2 client registered in the oauth2 app of the
+// server and fills in the username and OAuth2 settings. The client secret and
+// refresh token are kept in the secret store of the server.
+func loginWithOAuth2(reader *bufio.Reader, name string, server *config.Server) error {
+	fmt.Println("\n🔑 OAuth2 Setup:")
+	fmt.Println("An administrator registers the client in Nextcloud:")
+	fmt.Println("1. Go to Administration settings → Security → OAuth 2.0 clients")
+	fmt.Println("2. Enter a name (e.g., 'CLI Sync Tool')")
+	fmt.Printf("3. Enter the redirection URI, e.g. %s\n", defaultOAuth2RedirectURL)
+	fmt.Println("4. Copy the client identifier and secret")
+
+	clientID, err := promptString(reader, "Enter client identifier: ", true)
+	if err != nil {
+		return err
+	}
+
+	clientSecret, err := promptPassword(reader, "Enter client secret: ")
+	if err != nil {
+		return err
+	}
+	if clientSecret == "" {
+		return fmt.Errorf("client secret cannot be empty")
+	}
+
+	redirectURL, err := promptString(reader, fmt.Sprintf("Enter redirection URI (press Enter for %s): ", defaultOAuth2RedirectURL), false)
+	if err != nil {
+		return err
+	}
+	if redirectURL == "" {
+		redirectURL = defaultOAuth2RedirectURL
+	}
+	if err := config.ValidateRedirectURL(redirectURL); err != nil {
+		return fmt.Errorf("invalid redirection URI: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := auth.OAuth2Client{ServerURL: server.URL, ClientID: clientID, ClientSecret: clientSecret, RedirectURL: redirectURL}
+	token, err := client.Authorize(ctx, func(link string) {
+		fmt.Println("\n🌐 Log in to Nextcloud and grant access in your browser:")
+		fmt.Printf("   %s\n", link)
+		if err := openBrowser(link); err != nil {
+			fmt.Println("   Open the link above if no browser window appeared.")
+		}
+		fmt.Println("Waiting for access to be granted (Ctrl+C to cancel)...")
+	})
+	if err != nil {
+		return err
+	}
+	if token.UserID == "" {
+		return fmt.Errorf("the server did not report the user who granted access")
+	}
+
+	// The server is only changed once its secrets are stored
+	configured := *server
+	configured.Username = token.UserID
+	configured.OAuth2 = &config.OAuth2Settings{
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+	}
+
+	store, err := openSecretStore(name, &configured)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(secrets.OAuth2ClientSecret, clientSecret); err != nil {
+		return fmt.Errorf("failed to store client secret: %w", err)
+	}
+	if err := store.Set(secrets.OAuth2RefreshToken, token.RefreshToken); err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	*server = configured
+	fmt.Printf("✅ Logged in as %s\n", token.UserID)
+	return nil
+}
+
+// oauth2Provider returns the OAuth2 authenticator of a configured server. Nextcloud
+// rotates refresh tokens, so all clients of a server share one authenticator that
+// stores each new refresh token in the secret store of the server.
+func oauth2Provider(name string, server config.Server) (*auth.OAuth2Auth, error) {
+	oauth2ProvidersMu.Lock()
+	defer oauth2ProvidersMu.Unlock()
+
+	if provider, exists := oauth2Providers[name]; exists {
+		return provider, nil
+	}
+
+	store, err := openSecretStore(name, &server)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := auth.NewOAuth2AuthFromStore(server, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OAuth2 auth provider for server %s: %w", name, err)
+	}
+
+	provider.OnRefresh(func(token *auth.OAuth2Token) error {
+		// Stores kept in the configuration update the shared settings, which the
+		// loaded configuration may save again later in this run
+		if err := store.Set(secrets.OAuth2RefreshToken, token.RefreshToken); err != nil {
+			return fmt.Errorf("failed to store refresh token: %w", err)
+		}
+		if !secrets.KeptInConfig(&server) {
+			return nil
+		}
+		return storeRefreshToken(name, server.OAuth2.RefreshToken)
+	})
+
+	oauth2Providers[name] = provider
+	return provider, nil
+}
+
+// storeRefreshToken saves a renewed refresh token of a server in the configuration file
+func storeRefreshToken(name string, refreshToken config.EncryptedData) error {
+	configPath := appConfigPath()
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	server, exists := appConfig.Servers[name]
+	if !exists || server.OAuth2 == nil {
+		return fmt.Errorf("server %s is no longer configured for OAuth2", name)
+	}
+	server.OAuth2.RefreshToken = refreshToken
+
+	return config.SaveConfig(appConfig, configPath)
+}
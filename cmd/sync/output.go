@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	stdsync "sync"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/sync"
+)
+
+// Output formats selected with --output
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// Process exit codes of a sync run
+const (
+	exitSuccess   = 0
+	exitFailure   = 1 // The sync could not run at all
+	exitErrors    = 2 // Some operations failed
+	exitConflicts = 3 // Conflicts were skipped or left for manual resolution
+)
+
+// isValidOutputFormat checks if an output format is supported
+func isValidOutputFormat(format string) bool {
+	switch format {
+	case outputText, outputJSON, outputNDJSON:
+		return true
+	default:
+		return false
+	}
+}
+
+// messages returns where human-readable messages are written. They go to stderr
+// when stdout carries machine-readable output.
+func messages() io.Writer {
+	if *output != outputText {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// ndjsonWriter writes one JSON document per line, safe for concurrent use
+type ndjsonWriter struct {
+	mu      stdsync.Mutex
+	encoder *json.Encoder
+}
+
+// newNDJSONWriter creates a writer that writes to w
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{encoder: json.NewEncoder(w)}
+}
+
+// write encodes a single line
+func (w *ndjsonWriter) write(v interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+	}
+}
+
+// handleEvent streams a sync event, it is used as sync.EventHandler
+func (w *ndjsonWriter) handleEvent(event sync.SyncEvent) {
+	w.write(event)
+}
+
+// resultEvent is the last NDJSON line of a sync run
+type resultEvent struct {
+	Type   string           `json:"type"`
+	Time   time.Time        `json:"time"`
+	Result *sync.SyncResult `json:"result"`
+}
+
+// printSyncResult prints the result of a sync run in the selected output format
+func printSyncResult(result *sync.SyncResult, events *ndjsonWriter) {
+	switch *output {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+		}
+	case outputNDJSON:
+		if events == nil {
+			events = newNDJSONWriter(os.Stdout)
+		}
+		events.write(resultEvent{Type: "result", Time: time.Now(), Result: result})
+	default:
+		displaySyncResult(result)
+	}
+}
+
+// resultExitCode returns the process exit code for the result of a sync run
+func resultExitCode(result *sync.SyncResult) int {
+	if !result.Success || len(result.Errors) > 0 {
+		return exitErrors
+	}
+
+	for _, conflict := range result.Conflicts {
+		switch conflict.Resolution.Action {
+		case "", "skip", "manual":
+			return exitConflicts
+		}
+	}
+
+	return exitSuccess
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	stdsync "sync"
+	"text/tabwriter"
+
+	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/secrets"
+)
+
+// secretsUsage is the usage of the secrets command
+const secretsUsage = "secrets list | secrets migrate [--password-command=<command>] [--passphrase-env=<variable>] <server> config|secret_service|command|passphrase"
+
+// passphrases are the passphrases entered in this run keyed by server name
+var (
+	passphrasesMu stdsync.Mutex
+	passphrases   = make(map[string]string)
+)
+
+// serverSecrets describes where the secrets of a server are kept
+type serverSecrets struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Username string   `json:"username"`
+	Store    string   `json:"store"`
+	Secrets  []string `json:"secrets"`
+}
+
+// handleSecrets lists the secret stores of the servers and migrates secrets
+// between them
+func handleSecrets(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", secretsUsage)
+	}
+	if err := validateFlags(); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s", secretsUsage)
+		}
+		appConfig, _, err := loadAppConfig()
+		if err != nil {
+			return err
+		}
+		return printServerSecrets(appConfig)
+	case "migrate":
+		return handleSecretsMigrate(args[1:])
+	default:
+		return fmt.Errorf("unknown secrets command %q, usage: %s", args[0], secretsUsage)
+	}
+}
+
+// handleSecretsMigrate moves the secrets of a server into another store and
+// saves the configuration
+func handleSecretsMigrate(args []string) error {
+	flags := flag.NewFlagSet("secrets migrate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	passwordCommand := flags.String("password-command", "", "Command that prints the app password")
+	passphraseEnv := flags.String("passphrase-env", "", "Environment variable holding the passphrase")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w, usage: %s", err, secretsUsage)
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: %s", secretsUsage)
+	}
+	name, storeType := flags.Arg(0), flags.Arg(1)
+
+	target := config.SecretStore{Type: storeType}
+	switch storeType {
+	case config.SecretStoreCommand:
+		target.PasswordCommand = *passwordCommand
+	case config.SecretStorePassphrase:
+		target.PassphraseEnv = *passphraseEnv
+	}
+	if *passwordCommand != "" && storeType != config.SecretStoreCommand {
+		return fmt.Errorf("--password-command is only used with the command store")
+	}
+	if *passphraseEnv != "" && storeType != config.SecretStorePassphrase {
+		return fmt.Errorf("--passphrase-env is only used with the passphrase store")
+	}
+
+	appConfig, configPath, err := loadAppConfig()
+	if err != nil {
+		return err
+	}
+	server, exists := appConfig.Servers[name]
+	if !exists {
+		return fmt.Errorf("server %s is not configured", name)
+	}
+
+	previous := server
+	cleanup, err := migrateSecrets(name, &server, target)
+	if err != nil {
+		return err
+	}
+
+	appConfig.Servers[name] = server
+	if err := config.SaveConfig(appConfig, configPath); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	// The old secrets are only removed once the configuration points to the new store
+	if err := cleanup(); err != nil {
+		fmt.Fprintf(messages(), "⚠️  Could not remove the secrets from the %s store: %v\n", previous.SecretStoreType(), err)
+	}
+
+	fmt.Fprintf(messages(), "✅ Moved the secrets of server %s to the %s store\n", name, server.SecretStoreType())
+	return nil
+}
+
+// migrateSecrets moves the secrets of a server into the target store and updates
+// the server, which has to be saved before the returned cleanup removes the
+// secrets from an external previous store. The server is left unchanged on errors.
+func migrateSecrets(name string, server *config.Server, target config.SecretStore) (func() error, error) {
+	if target.Type == server.SecretStoreType() && target.Type != config.SecretStorePassphrase {
+		return nil, fmt.Errorf("the secrets of server %s are already kept in the %s store", name, target.Type)
+	}
+
+	source, err := openSecretStore(name, server)
+	if err != nil {
+		return nil, err
+	}
+	names := secrets.Names(server)
+	values := make(map[string]string, len(names))
+	for _, secretName := range names {
+		value, err := source.Get(secretName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of server %s: %w", secretName, name, err)
+		}
+		values[secretName] = value
+	}
+
+	migrated := *server
+	if server.OAuth2 != nil {
+		settings := *server.OAuth2
+		migrated.OAuth2 = &settings
+	}
+	secrets.ClearConfig(&migrated)
+	migrated.SecretStore = &target
+	if target.Type == config.SecretStoreConfig {
+		migrated.SecretStore = nil
+	}
+
+	destination, err := secrets.Open(&migrated, func(*config.Server) (string, error) {
+		return promptNewPassphrase(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, secretName := range names {
+		if target.Type == config.SecretStoreCommand {
+			// The password manager owns the secret, check that it has the same one
+			value, err := destination.Get(secretName)
+			if err != nil {
+				return nil, err
+			}
+			if value != values[secretName] {
+				return nil, fmt.Errorf("password command %q does not print the app password of server %s", target.PasswordCommand, name)
+			}
+			continue
+		}
+		if err := destination.Set(secretName, values[secretName]); err != nil {
+			return nil, fmt.Errorf("failed to store %s of server %s: %w", secretName, name, err)
+		}
+	}
+
+	if err := config.ValidateServer(name, migrated); err != nil {
+		return nil, err
+	}
+
+	keptInConfig := secrets.KeptInConfig(server)
+	*server = migrated
+	return func() error {
+		if keptInConfig {
+			return nil
+		}
+		for _, secretName := range names {
+			if err := source.Delete(secretName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// openSecretStore opens the secret store of a configured server, asking for its
+// passphrase once per run if it is not set in the environment
+func openSecretStore(name string, server *config.Server) (secrets.Store, error) {
+	return secrets.Open(server, func(*config.Server) (string, error) {
+		passphrasesMu.Lock()
+		defer passphrasesMu.Unlock()
+
+		if passphrase, exists := passphrases[name]; exists {
+			return passphrase, nil
+		}
+		passphrase, err := promptPassphrase(fmt.Sprintf("Enter passphrase for server %s: ", name))
+		if err != nil {
+			return "", err
+		}
+		passphrases[name] = passphrase
+		return passphrase, nil
+	})
+}
+
+// promptNewPassphrase asks for a new passphrase of a server twice
+func promptNewPassphrase(name string) (string, error) {
+	passphrase, err := promptPassphrase(fmt.Sprintf("Enter new passphrase for server %s: ", name))
+	if err != nil {
+		return "", err
+	}
+	repeated, err := promptPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != repeated {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// promptPassphrase reads a passphrase from standard input, keeping the prompt out
+// of JSON output
+func promptPassphrase(prompt string) (string, error) {
+	fmt.Fprint(messages(), prompt)
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(input, "\r\n"), nil
+}
+
+// printServerSecrets prints the secret store and secrets of each server
+func printServerSecrets(appConfig *config.Config) error {
+	names := make([]string, 0, len(appConfig.Servers))
+	for name := range appConfig.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		server := appConfig.Servers[name]
+		values[i] = serverSecrets{
+			Name:     name,
+			URL:      server.URL,
+			Username: server.Username,
+			Store:    server.SecretStoreType(),
+			Secrets:  secrets.Names(&server),
+		}
+	}
+	if *output != outputText {
+		return printJSONList(values)
+	}
+
+	if len(values) == 0 {
+		fmt.Println("No servers configured")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tURL\tUSERNAME\tSTORE\tSECRETS")
+	for _, value := range values {
+		entry := value.(serverSecrets)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.URL, entry.Username, entry.Store, strings.Join(entry.Secrets, ","))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
+	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/ocs"
+	"github.com/phaus/nextcloud-sync/internal/sync"
+)
+
+// shareUsage is the usage of the share command
+const shareUsage = "share list [<path>] | share create [--type=link|user|group] [--with=<name>] [--password=<password>] [--expire=YYYY-MM-DD] [--permissions=<permissions>] [--label=<label>] [--public-upload] <path> | share delete <id>..."
+
+// handleShare lists, creates and deletes shares on the server
+func handleShare(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", shareUsage)
+	}
+
+	var options *ocs.ShareOptions
+	switch args[0] {
+	case "list":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: %s", shareUsage)
+		}
+	case "create":
+		var err error
+		options, err = parseShareOptions(args[1:])
+		if err != nil {
+			return err
+		}
+	case "delete":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s", shareUsage)
+		}
+	default:
+		return fmt.Errorf("unknown share command %q, usage: %s", args[0], shareUsage)
+	}
+	if err := validateFlags(); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+
+	appConfig, _, err := loadAppConfig()
+	if err != nil {
+		return err
+	}
+	serverURL, err := remoteServerURL(appConfig)
+	if err != nil {
+		return err
+	}
+	client, err := newOCSClient(appConfig, serverURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := requireCapability(ctx, client, "sharing", func(caps *capabilities.Capabilities) bool { return caps.Sharing }); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		filePath := ""
+		if len(args) == 2 {
+			filePath = args[1]
+		}
+		shares, err := client.ListShares(ctx, filePath)
+		if err != nil {
+			return err
+		}
+		return printShares(shares)
+	case "create":
+		share, err := client.CreateShare(ctx, *options)
+		if err != nil {
+			return err
+		}
+		if *output != outputText {
+			return printJSONList([]interface{}{share})
+		}
+		printCreatedShare(os.Stdout, share)
+		return nil
+	default:
+		for _, id := range args[1:] {
+			if err := client.DeleteShare(ctx, id); err != nil {
+				return err
+			}
+			fmt.Fprintf(messages(), "🗑️  Deleted share %s\n", id)
+		}
+		return nil
+	}
+}
+
+// parseShareOptions parses the flags and path of share create
+func parseShareOptions(args []string) (*ocs.ShareOptions, error) {
+	flags := flag.NewFlagSet("share create", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	shareType := flags.String("type", "link", "Share type: link, user or group")
+	shareWith := flags.String("with", "", "User or group to share with")
+	password := flags.String("password", "", "Password of a public link")
+	expire := flags.String("expire", "", "Expiry date as YYYY-MM-DD")
+	permissions := flags.String("permissions", "", "Permissions, e.g. read,update or edit")
+	label := flags.String("label", "", "Label of a public link")
+	publicUpload := flags.Bool("public-upload", false, "Allow uploads to a public link of a folder")
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w, usage: %s", err, shareUsage)
+	}
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("usage: %s", shareUsage)
+	}
+
+	options := &ocs.ShareOptions{
+		Path:         flags.Arg(0),
+		ShareWith:    *shareWith,
+		Password:     *password,
+		PublicUpload: *publicUpload,
+		Label:        *label,
+	}
+
+	var err error
+	options.ShareType, err = ocs.ParseShareType(*shareType)
+	if err != nil {
+		return nil, err
+	}
+	if options.ShareType == ocs.ShareTypePublicLink {
+		if options.ShareWith != "" {
+			return nil, fmt.Errorf("--with cannot be used for a public link")
+		}
+	} else {
+		if options.ShareWith == "" {
+			return nil, fmt.Errorf("a %s share needs --with", options.ShareType)
+		}
+		if options.Password != "" || options.PublicUpload {
+			return nil, fmt.Errorf("--password and --public-upload only apply to public links")
+		}
+	}
+
+	if *expire != "" {
+		options.ExpireDate, err = time.ParseInLocation("2006-01-02", *expire, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry date %q: use YYYY-MM-DD", *expire)
+		}
+	}
+	if *permissions != "" {
+		options.Permissions, err = ocs.ParsePermissions(*permissions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+// printCreatedShare prints a share that was just created
+func printCreatedShare(w io.Writer, share *ocs.Share) {
+	if share.ShareType == ocs.ShareTypePublicLink {
+		fmt.Fprintf(w, "🔗 Shared %s: %s\n", share.Path, share.URL)
+		return
+	}
+	fmt.Fprintf(w, "🔗 Shared %s with %s %s (%s)\n", share.Path, share.ShareType, share.ShareWith, ocs.FormatPermissions(share.Permissions))
+}
+
+// printShares prints shares in the selected output format
+func printShares(shares []*ocs.Share) error {
+	if *output != outputText {
+		values := make([]interface{}, len(shares))
+		for i, share := range shares {
+			values[i] = share
+		}
+		return printJSONList(values)
+	}
+
+	if len(shares) == 0 {
+		fmt.Println("No shares")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPATH\tTYPE\tWITH\tPERMISSIONS\tEXPIRES")
+	for _, share := range shares {
+		with := share.ShareWith
+		if share.ShareType == ocs.ShareTypePublicLink {
+			with = share.URL
+		}
+		expires := "-"
+		if share.Expiration != "" {
+			expires = strings.SplitN(share.Expiration, " ", 2)[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", share.ID, share.Path, share.ShareType, with, ocs.FormatPermissions(share.Permissions), expires)
+	}
+	return w.Flush()
+}
+
+// newOCSClient creates an OCS client for a server with the stored credentials
+func newOCSClient(appConfig *config.Config, serverURL string) (*ocs.Client, error) {
+	authProvider, err := newAuthProvider(appConfig, serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ocs.NewClient(authProvider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCS client: %w", err)
+	}
+
+	return client, nil
+}
+
+// reconcileShares creates the shares declared by the profile that are missing on
+// the server after a successful sync. Existing shares are left alone.
+func (s *syncSession) reconcileShares(ctx context.Context, result *sync.SyncResult) {
+	if len(s.profile.Shares) == 0 || !result.Success || result.DryRun {
+		return
+	}
+
+	remoteURL := s.config.Target
+	if !strings.Contains(remoteURL, "://") {
+		remoteURL = s.config.Source
+	}
+	if !strings.Contains(remoteURL, "://") {
+		fmt.Fprintf(messages(), "⚠️  Profile '%s' declares shares but does not sync with a Nextcloud server\n", s.profileName)
+		return
+	}
+
+	client, err := newOCSClient(s.appConfig, extractBaseURL(remoteURL))
+	if err != nil {
+		fmt.Fprintf(messages(), "⚠️  Failed to reconcile shares: %v\n", err)
+		return
+	}
+
+	root := sync.RemoteBasePath(remoteURL)
+	existing := make(map[string][]*ocs.Share)
+	for _, declared := range s.profile.Shares {
+		sharePath := path.Join("/", root, declared.Path)
+		if err := ensureShare(ctx, client, sharePath, declared, existing); err != nil {
+			fmt.Fprintf(messages(), "⚠️  Failed to share %s: %v\n", sharePath, err)
+		}
+	}
+}
+
+// ensureShare creates a share declared by a profile unless a matching share exists.
+// existing caches the shares of each path.
+func ensureShare(ctx context.Context, client *ocs.Client, sharePath string, declared config.ProfileShare, existing map[string][]*ocs.Share) error {
+	options := ocs.ShareOptions{Path: sharePath, ShareWith: declared.With, Label: declared.Label}
+
+	var err error
+	options.ShareType, err = ocs.ParseShareType(declared.Type)
+	if err != nil {
+		return err
+	}
+	if declared.Permissions != "" {
+		options.Permissions, err = ocs.ParsePermissions(declared.Permissions)
+		if err != nil {
+			return err
+		}
+	}
+
+	shares, cached := existing[sharePath]
+	if !cached {
+		shares, err = client.ListShares(ctx, sharePath)
+		if err != nil {
+			return err
+		}
+		existing[sharePath] = shares
+	}
+
+	for _, share := range shares {
+		if share.ShareType != options.ShareType {
+			continue
+		}
+		if options.ShareType == ocs.ShareTypePublicLink && (declared.Label == "" || share.Label == declared.Label) {
+			return nil
+		}
+		if options.ShareType != ocs.ShareTypePublicLink && share.ShareWith == declared.With {
+			return nil
+		}
+	}
+
+	share, err := client.CreateShare(ctx, options)
+	if err != nil {
+		return err
+	}
+	existing[sharePath] = append(shares, share)
+	printCreatedShare(messages(), share)
+	return nil
+}
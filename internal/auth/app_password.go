@@ -22,6 +22,9 @@ func NewAppPasswordManager(authProvider AuthProvider) *AppPasswordManager {
 
 // CreateAuthFromServerConfig creates an authenticator from server configuration
 func (m *AppPasswordManager) CreateAuthFromServerConfig(server config.Server) (AuthProvider, error) {
+	if server.OAuth2 != nil {
+		return NewOAuth2AuthFromConfig(server)
+	}
 	return NewAppPasswordAuthFromConfig(server)
 }
 
@@ -31,10 +34,11 @@ func (m *AppPasswordManager) ValidateAppPasswordFormat(password string) error {
 		return fmt.Errorf("app password cannot be empty")
 	}
 
-	// Nextcloud app passwords are typically 20-40 characters long
+	// Nextcloud app passwords are typically 20-40 characters long, those granted
+	// through Login Flow v2 are 72 characters long
 	// Format: xxxxx-xxxxx-xxxxx-xxxxx-xxxxx-xxxxx or similar
-	if len(password) < 15 || len(password) > 50 {
-		return fmt.Errorf("app password appears to be invalid length (expected 15-50 characters, got %d)", len(password))
+	if len(password) < 15 || len(password) > 72 {
+		return fmt.Errorf("app password appears to be invalid length (expected 15-72 characters, got %d)", len(password))
 	}
 
 	// Check for typical Nextcloud app password pattern (groups of alphanumeric characters separated by dashes)
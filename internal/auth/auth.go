@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/secrets"
 )
 
 // AuthProvider defines the interface for authentication providers
@@ -76,10 +77,16 @@ func NewAppPasswordAuth(serverURL, username, appPassword string) (*AppPasswordAu
 	}, nil
 }
 
-// NewAppPasswordAuthFromConfig creates an authenticator from encrypted config data
+// NewAppPasswordAuthFromConfig creates an authenticator from server configuration,
+// reading the app password from the secret store of the server
 func NewAppPasswordAuthFromConfig(server config.Server) (*AppPasswordAuth, error) {
+	store, err := secrets.Open(&server, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	// Decrypt the app password
-	password, err := config.DecryptPassword(server.AppPassword)
+	password, err := store.Get(secrets.AppPassword)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt app password: %w", err)
 	}
@@ -180,6 +180,17 @@ func TestAppPasswordManager_ValidateAppPasswordFormat(t *testing.T) {
 			password:    "abcdefghijklmnopqrstuvwxyz1234",
 			expectError: false,
 		},
+		{
+			name:        "valid Login Flow app password",
+			password:    "yKTVA4zgxjfivy52WqD8kW3M2pKGQr6srmUXMipRdunxjPFripJn0GMfmtNOqOolYSuJ6sCN",
+			expectError: false,
+		},
+		{
+			name:        "too long password",
+			password:    strings.Repeat("a", 73),
+			expectError: true,
+			errorMsg:    "appears to be invalid length",
+		},
 		{
 			name:        "empty password",
 			password:    "",
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Login Flow v2 defaults
+const (
+	// DefaultLoginPollInterval is how often Wait asks whether the login was approved
+	DefaultLoginPollInterval = 2 * time.Second
+
+	// loginFlowTimeout is how long Nextcloud keeps a login flow open
+	loginFlowTimeout = 20 * time.Minute
+)
+
+// LoginFlow is a Nextcloud Login Flow v2. The user approves the login in the
+// browser and the server hands out an app password, so that nobody has to create
+// and paste one by hand.
+type LoginFlow struct {
+	LoginURL     string // Page on which the user logs in and grants access
+	pollEndpoint string
+	pollToken    string
+	userAgent    string
+	httpClient   *http.Client
+}
+
+// LoginCredentials are the credentials granted through a login flow
+type LoginCredentials struct {
+	Server      string `json:"server"`
+	LoginName   string `json:"loginName"`
+	AppPassword string `json:"appPassword"`
+}
+
+// StartLoginFlow starts a login flow on the server. Nextcloud names the app
+// password after the user agent, so it should tell the user which device it is for.
+func StartLoginFlow(ctx context.Context, serverURL, userAgent string) (*LoginFlow, error) {
+	if serverURL == "" {
+		return nil, fmt.Errorf("server URL cannot be empty")
+	}
+
+	flow := &LoginFlow{
+		userAgent:  userAgent,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var started struct {
+		Poll struct {
+			Token    string `json:"token"`
+			Endpoint string `json:"endpoint"`
+		} `json:"poll"`
+		Login string `json:"login"`
+	}
+	status, err := flow.post(ctx, strings.TrimSuffix(serverURL, "/")+"/index.php/login/v2", nil, &started)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start login flow: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to start login flow: server returned status %d, the server may not support Login Flow v2", status)
+	}
+	if started.Login == "" || started.Poll.Token == "" || started.Poll.Endpoint == "" {
+		return nil, fmt.Errorf("failed to start login flow: incomplete response")
+	}
+
+	flow.LoginURL = started.Login
+	flow.pollEndpoint = started.Poll.Endpoint
+	flow.pollToken = started.Poll.Token
+	return flow, nil
+}
+
+// Poll asks once whether the user approved the login. It returns nil credentials
+// while the login is pending. The server hands out the credentials only once.
+func (f *LoginFlow) Poll(ctx context.Context) (*LoginCredentials, error) {
+	var credentials LoginCredentials
+	status, err := f.post(ctx, f.pollEndpoint, url.Values{"token": {f.pollToken}}, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll login flow: %w", err)
+	}
+
+	switch status {
+	case http.StatusOK:
+		if credentials.LoginName == "" || credentials.AppPassword == "" {
+			return nil, fmt.Errorf("failed to poll login flow: incomplete credentials")
+		}
+		credentials.Server = strings.TrimSuffix(credentials.Server, "/")
+		return &credentials, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to poll login flow: server returned status %d", status)
+	}
+}
+
+// Wait polls until the user approved the login, the flow expired or ctx is done
+func (f *LoginFlow) Wait(ctx context.Context, interval time.Duration) (*LoginCredentials, error) {
+	if interval <= 0 {
+		interval = DefaultLoginPollInterval
+	}
+
+	flowCtx, cancel := context.WithTimeout(ctx, loginFlowTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		credentials, err := f.Poll(flowCtx)
+		if err != nil || credentials != nil {
+			if err != nil && ctx.Err() == nil && flowCtx.Err() != nil {
+				return nil, fmt.Errorf("login was not approved within %v", loginFlowTimeout)
+			}
+			return credentials, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-flowCtx.Done():
+			return nil, fmt.Errorf("login was not approved within %v", loginFlowTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// post sends a form to an endpoint of the login flow and decodes a successful
+// JSON response into result. It returns the status code of the response.
+func (f *LoginFlow) post(ctx context.Context, endpoint string, form url.Values, result interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, result); err != nil {
+			return 0, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginFlow(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	ctx := context.Background()
+
+	flow, err := StartLoginFlow(ctx, srv.URL+"/", "nextcloud-sync (laptop)")
+	require.NoError(t, err)
+	assert.Contains(t, flow.LoginURL, srv.URL+"/index.php/login/v2/flow/")
+
+	// Pending until the user approves the login
+	credentials, err := flow.Poll(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, credentials)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		resp, err := http.Get(flow.LoginURL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	credentials, err = flow.Wait(ctx, 5*time.Millisecond)
+	require.NoError(t, err)
+	require.NotNil(t, credentials)
+	assert.Equal(t, srv.URL, credentials.Server)
+	assert.Equal(t, "alice", credentials.LoginName)
+	assert.Len(t, credentials.AppPassword, 72)
+	assert.NoError(t, NewAppPasswordManager(nil).ValidateAppPasswordFormat(credentials.AppPassword))
+	assert.Equal(t, []string{"nextcloud-sync (laptop)"}, srv.AppPasswords())
+
+	// The granted app password works, and is handed out only once
+	authProvider, err := NewAppPasswordAuth(credentials.Server, credentials.LoginName, credentials.AppPassword)
+	require.NoError(t, err)
+	assert.NoError(t, authProvider.ValidateCredentials(ctx))
+
+	credentials, err = flow.Poll(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, credentials)
+}
+
+func TestLoginFlow_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := StartLoginFlow(ctx, "", "nextcloud-sync")
+	assert.Error(t, err)
+
+	// Servers without Login Flow v2
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	_, err = StartLoginFlow(ctx, server.URL, "nextcloud-sync")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Login Flow v2")
+
+	// Waiting stops with the context
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	flow, err := StartLoginFlow(ctx, srv.URL, "nextcloud-sync")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	_, err = flow.Wait(ctx, 5*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,405 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/phaus/nextcloud-sync/internal/secrets"
+)
+
+// Endpoints of the Nextcloud oauth2 app and token renewal settings
+const (
+	oauth2AuthorizePath = "/index.php/apps/oauth2/authorize"
+	oauth2TokenPath     = "/index.php/apps/oauth2/api/v1/token"
+
+	// oauth2RenewalMargin is how long before its expiry an access token is renewed
+	oauth2RenewalMargin = time.Minute
+)
+
+// OAuth2Client is an OAuth2 client registered in the oauth2 app of a server
+type OAuth2Client struct {
+	ServerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Localhost URL on which the authorization code is received
+}
+
+// OAuth2Token is a token granted to an OAuth2 client
+type OAuth2Token struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+	UserID       string
+}
+
+// AuthCodeURL returns the page on which the user grants the client access
+func (c *OAuth2Client) AuthCodeURL(state string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.ClientID},
+		"redirect_uri":  {c.RedirectURL},
+		"state":         {state},
+	}
+	return strings.TrimSuffix(c.ServerURL, "/") + oauth2AuthorizePath + "?" + query.Encode()
+}
+
+// Authorize runs the authorization code flow. It passes the page on which the user
+// grants access to openURL and receives the authorization code on the redirect URL.
+func (c *OAuth2Client) Authorize(ctx context.Context, openURL func(string)) (*OAuth2Token, error) {
+	redirectURL, err := url.Parse(c.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", redirectURL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", redirectURL.Host, err)
+	}
+
+	state, err := config.GenerateRandomBytes(16)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to generate state: %w", err)
+	}
+	stateParam := fmt.Sprintf("%x", state)
+
+	type callback struct {
+		code string
+		err  error
+	}
+	callbacks := make(chan callback, 1)
+
+	mux := http.NewServeMux()
+	callbackPath := redirectURL.Path
+	if callbackPath == "" {
+		callbackPath = "/"
+	}
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var result callback
+		switch {
+		case query.Get("state") != stateParam:
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("authorization denied: %s", query.Get("error"))
+		case query.Get("code") == "":
+			result.err = fmt.Errorf("authorization response without code")
+		default:
+			result.code = query.Get("code")
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if result.err != nil {
+			fmt.Fprintln(w, "<html><body>Authorization failed, you can close this window.</body></html>")
+		} else {
+			fmt.Fprintln(w, "<html><body>Authorization complete, you can close this window.</body></html>")
+		}
+		select {
+		case callbacks <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	openURL(c.AuthCodeURL(stateParam))
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-callbacks:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return c.Exchange(ctx, result.code)
+	}
+}
+
+// Exchange trades an authorization code for a token
+func (c *OAuth2Client) Exchange(ctx context.Context, code string) (*OAuth2Token, error) {
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {c.RedirectURL},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	return token, nil
+}
+
+// Refresh trades a refresh token for a new token. Nextcloud rotates refresh
+// tokens, the old one is invalid afterwards.
+func (c *OAuth2Client) Refresh(ctx context.Context, refreshToken string) (*OAuth2Token, error) {
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh access token: %w", err)
+	}
+	return token, nil
+}
+
+// requestToken sends a request to the token endpoint
+func (c *OAuth2Client) requestToken(ctx context.Context, form url.Values) (*OAuth2Token, error) {
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+
+	tokenURL := strings.TrimSuffix(c.ServerURL, "/") + oauth2TokenPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		UserID       string `json:"user_id"`
+		Error        string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != "" {
+			return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, result.Error)
+		}
+		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" {
+		return nil, fmt.Errorf("incomplete token response")
+	}
+
+	return &OAuth2Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+		UserID:       result.UserID,
+	}, nil
+}
+
+// OAuth2Auth implements AuthProvider with OAuth2 bearer tokens. Access tokens are
+// renewed shortly before they expire and after the server rejected them.
+type OAuth2Auth struct {
+	client     OAuth2Client
+	username   string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     OAuth2Token
+	onRefresh func(token *OAuth2Token) error
+}
+
+// NewOAuth2Auth creates an authenticator for an OAuth2 client. The token needs a
+// refresh token, the access token may be empty and is then requested on first use.
+func NewOAuth2Auth(client OAuth2Client, username string, token OAuth2Token) (*OAuth2Auth, error) {
+	if client.ServerURL == "" {
+		return nil, fmt.Errorf("server URL cannot be empty")
+	}
+
+	if client.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+
+	if username == "" {
+		return nil, fmt.Errorf("username cannot be empty")
+	}
+
+	if token.RefreshToken == "" {
+		return nil, fmt.Errorf("refresh token cannot be empty")
+	}
+
+	client.ServerURL = strings.TrimSuffix(client.ServerURL, "/")
+
+	return &OAuth2Auth{
+		client:     client,
+		username:   username,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		token:      token,
+	}, nil
+}
+
+// NewOAuth2AuthFromConfig creates an authenticator from the OAuth2 settings of a
+// server, reading the client secret and refresh token from its secret store
+func NewOAuth2AuthFromConfig(server config.Server) (*OAuth2Auth, error) {
+	if server.OAuth2 == nil {
+		return nil, fmt.Errorf("server has no OAuth2 settings")
+	}
+
+	store, err := secrets.Open(&server, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewOAuth2AuthFromStore(server, store)
+}
+
+// NewOAuth2AuthFromStore creates an authenticator from the OAuth2 settings of a
+// server and the secrets in an opened store
+func NewOAuth2AuthFromStore(server config.Server, store secrets.Store) (*OAuth2Auth, error) {
+	if server.OAuth2 == nil {
+		return nil, fmt.Errorf("server has no OAuth2 settings")
+	}
+
+	clientSecret, err := store.Get(secrets.OAuth2ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt client secret: %w", err)
+	}
+
+	refreshToken, err := store.Get(secrets.OAuth2RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt refresh token: %w", err)
+	}
+
+	client := OAuth2Client{
+		ServerURL:    server.URL,
+		ClientID:     server.OAuth2.ClientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  server.OAuth2.RedirectURL,
+	}
+	return NewOAuth2Auth(client, server.Username, OAuth2Token{RefreshToken: refreshToken})
+}
+
+// OnRefresh registers a function that is called with every renewed token. The
+// refresh token changes with each renewal and has to be stored again.
+func (a *OAuth2Auth) OnRefresh(fn func(token *OAuth2Token) error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.onRefresh = fn
+}
+
+// GetAuthHeader returns the bearer token header, renewing the access token first
+// if it is about to expire
+func (a *OAuth2Auth) GetAuthHeader() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.expiringLocked() {
+		if err := a.refreshLocked(context.Background()); err != nil {
+			return "", err
+		}
+	}
+
+	return "Bearer " + a.token.AccessToken, nil
+}
+
+// ValidateCredentials validates the access token against the Nextcloud server
+func (a *OAuth2Auth) ValidateCredentials(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		authHeader, err := a.GetAuthHeader()
+		if err != nil {
+			return fmt.Errorf("failed to get auth header: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", a.client.ServerURL+"/remote.php/dav/", nil)
+		if err != nil {
+			return fmt.Errorf("failed to create validation request: %w", err)
+		}
+		req.Header.Set("Authorization", authHeader)
+
+		resp, err := a.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to validate credentials: %w", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			if attempt == 0 && a.RefreshCredentials(ctx) == nil {
+				continue
+			}
+			return fmt.Errorf("invalid credentials: authentication failed")
+		}
+
+		if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected response status during validation: %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// RefreshCredentials renews the access token
+func (a *OAuth2Auth) RefreshCredentials(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.refreshLocked(ctx)
+}
+
+// refreshLocked renews the access token, a.mu must be held
+func (a *OAuth2Auth) refreshLocked(ctx context.Context) error {
+	token, err := a.client.Refresh(ctx, a.token.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	a.token = *token
+
+	if a.onRefresh != nil {
+		if err := a.onRefresh(token); err != nil {
+			return fmt.Errorf("failed to store refresh token: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsExpired returns true if the access token is missing or about to expire
+func (a *OAuth2Auth) IsExpired() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.expiringLocked()
+}
+
+// expiringLocked reports whether the access token has to be renewed, a.mu must be held
+func (a *OAuth2Auth) expiringLocked() bool {
+	return a.token.AccessToken == "" || time.Until(a.token.Expiry) < oauth2RenewalMargin
+}
+
+// GetServerURL returns the configured server URL
+func (a *OAuth2Auth) GetServerURL() string {
+	return a.client.ServerURL
+}
+
+// GetUsername returns the configured username
+func (a *OAuth2Auth) GetUsername() string {
+	return a.username
+}
+
+// Close cleans up resources
+func (a *OAuth2Auth) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Zero out sensitive data
+	a.token = OAuth2Token{}
+	a.client.ClientSecret = ""
+	a.httpClient.CloseIdleConnections()
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOAuth2TestClient registers an OAuth2 client with a redirect URL on a free port
+func newOAuth2TestClient(t *testing.T, srv *webdavtest.Server) OAuth2Client {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURL := fmt.Sprintf("http://%s/callback", listener.Addr())
+	listener.Close()
+
+	srv.RegisterOAuth2Client("client", "client-secret", redirectURL)
+	return OAuth2Client{ServerURL: srv.URL, ClientID: "client", ClientSecret: "client-secret", RedirectURL: redirectURL}
+}
+
+func TestOAuth2Client_Authorize(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	client := newOAuth2TestClient(t, srv)
+	ctx := context.Background()
+
+	var authorizeURL string
+	token, err := client.Authorize(ctx, func(link string) {
+		authorizeURL = link
+		// The browser follows the redirect to the local callback
+		go func() {
+			resp, err := http.Get(link)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authorizeURL, srv.URL+"/index.php/apps/oauth2/authorize?"))
+	assert.Contains(t, authorizeURL, "client_id=client")
+	assert.Equal(t, "alice", token.UserID)
+	assert.NotEmpty(t, token.AccessToken)
+	assert.NotEmpty(t, token.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+
+	// The token works for WebDAV
+	authProvider, err := NewOAuth2Auth(client, token.UserID, *token)
+	require.NoError(t, err)
+	assert.False(t, authProvider.IsExpired())
+	assert.NoError(t, authProvider.ValidateCredentials(ctx))
+	assert.Equal(t, 0, srv.TokenRefreshes())
+
+	header, err := authProvider.GetAuthHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer "+token.AccessToken, header)
+}
+
+func TestOAuth2Client_AuthorizeDenied(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	client := newOAuth2TestClient(t, srv)
+
+	_, err := client.Authorize(context.Background(), func(authorizeURL string) {
+		parsed, err := url.Parse(authorizeURL)
+		require.NoError(t, err)
+		go func() {
+			resp, err := http.Get(client.RedirectURL + "?error=access_denied&state=" + parsed.Query().Get("state"))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "access_denied")
+
+	// Callbacks without the state of the flow are ignored
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.Authorize(ctx, func(string) {
+		go func() {
+			resp, err := http.Get(client.RedirectURL + "?error=access_denied")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestOAuth2Auth_Refresh(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	client := newOAuth2TestClient(t, srv)
+	ctx := context.Background()
+
+	token, err := client.Authorize(ctx, func(link string) {
+		go func() {
+			resp, err := http.Get(link)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	})
+	require.NoError(t, err)
+
+	// Without an access token the first use renews it
+	authProvider, err := NewOAuth2Auth(client, "alice", OAuth2Token{RefreshToken: token.RefreshToken})
+	require.NoError(t, err)
+	var stored []string
+	authProvider.OnRefresh(func(token *OAuth2Token) error {
+		stored = append(stored, token.RefreshToken)
+		return nil
+	})
+	assert.True(t, authProvider.IsExpired())
+
+	header, err := authProvider.GetAuthHeader()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(header, "Bearer "))
+	assert.Equal(t, 1, srv.TokenRefreshes())
+	require.Len(t, stored, 1)
+	assert.NotEqual(t, token.RefreshToken, stored[0])
+
+	// Valid tokens are reused
+	again, err := authProvider.GetAuthHeader()
+	require.NoError(t, err)
+	assert.Equal(t, header, again)
+	assert.Equal(t, 1, srv.TokenRefreshes())
+
+	// A rejected token is renewed once, with the rotated refresh token
+	srv.RevokeAccessTokens()
+	require.NoError(t, authProvider.ValidateCredentials(ctx))
+	assert.Equal(t, 2, srv.TokenRefreshes())
+	assert.Len(t, stored, 2)
+
+	// Tokens about to expire are renewed before they are used
+	srv.SetAccessTokenLifetime(30 * time.Second)
+	require.NoError(t, authProvider.RefreshCredentials(ctx))
+	assert.True(t, authProvider.IsExpired())
+	_, err = authProvider.GetAuthHeader()
+	require.NoError(t, err)
+	assert.Equal(t, 4, srv.TokenRefreshes())
+
+	// The replaced refresh token is invalid
+	_, err = client.Refresh(ctx, token.RefreshToken)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+func TestOAuth2Auth_Errors(t *testing.T) {
+	client := OAuth2Client{ServerURL: "https://cloud.example.com", ClientID: "client", ClientSecret: "secret"}
+	token := OAuth2Token{RefreshToken: "refresh"}
+
+	_, err := NewOAuth2Auth(OAuth2Client{ClientID: "client"}, "alice", token)
+	assert.Error(t, err)
+	_, err = NewOAuth2Auth(OAuth2Client{ServerURL: "https://cloud.example.com"}, "alice", token)
+	assert.Error(t, err)
+	_, err = NewOAuth2Auth(client, "", token)
+	assert.Error(t, err)
+	_, err = NewOAuth2Auth(client, "alice", OAuth2Token{})
+	assert.Error(t, err)
+
+	// Wrong client credentials
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	client.ServerURL = srv.URL
+	authProvider, err := NewOAuth2Auth(client, "alice", token)
+	require.NoError(t, err)
+	_, err = authProvider.GetAuthHeader()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_client")
+	assert.Error(t, authProvider.ValidateCredentials(context.Background()))
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
 )
 
 // CredentialValidator validates Nextcloud credentials and server connectivity
@@ -44,6 +46,9 @@ type ServerInfo struct {
 	Product        string `json:"product,omitempty"`
 	WebDAVEndpoint string `json:"webdav_endpoint,omitempty"`
 	StatusText     string `json:"status_text,omitempty"`
+
+	// Capabilities are the features of the server, nil if they could not be determined
+	Capabilities *capabilities.Capabilities `json:"capabilities,omitempty"`
 }
 
 // ValidateCredentials performs comprehensive credential validation
@@ -89,6 +94,19 @@ func (v *CredentialValidator) ValidateCredentials(ctx context.Context, serverURL
 		result.Warnings = append(result.Warnings, fmt.Sprintf("User access limited: %v", err))
 	}
 
+	// Step 5: Discover the capabilities, which are cached for the rest of the run
+	caps, err := v.discoverCapabilities(ctx, normalizedURL, username, appPassword)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Server capabilities unknown: %v", err))
+	} else {
+		serverInfo.Capabilities = caps
+		serverInfo.Product = "Nextcloud"
+		serverInfo.Version = caps.Version.String
+		if !caps.ChunkingV2 {
+			result.Warnings = append(result.Warnings, "Server does not support chunked uploads, large files are uploaded in one request")
+		}
+	}
+
 	result.Valid = true
 	return result, nil
 }
@@ -133,6 +151,20 @@ func (v *CredentialValidator) checkServerReachability(ctx context.Context, serve
 	return serverInfo, nil
 }
 
+// discoverCapabilities fetches the capabilities of the server as the user
+func (v *CredentialValidator) discoverCapabilities(ctx context.Context, serverURL, username, appPassword string) (*capabilities.Capabilities, error) {
+	auth, err := NewAppPasswordAuth("", username, appPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %w", err)
+	}
+	authHeader, err := auth.GetAuthHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth header: %w", err)
+	}
+
+	return capabilities.Get(ctx, v.httpClient, serverURL, authHeader)
+}
+
 // checkWebDAVEndpoint checks if the WebDAV endpoint is available
 func (v *CredentialValidator) checkWebDAVEndpoint(ctx context.Context, webdavURL string) error {
 	req, err := http.NewRequestWithContext(ctx, "OPTIONS", webdavURL, nil)
@@ -0,0 +1,104 @@
+package bandwidth
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket that limits the combined throughput of all transfers
+// sharing it. The rate follows a schedule and is looked up on every call, so a
+// long running transfer speeds up or slows down when the schedule changes. A nil
+// Limiter does not limit anything.
+type Limiter struct {
+	mu       sync.Mutex
+	schedule Schedule
+	rate     int64     // Rate of the last reservation in bytes per second
+	tokens   float64   // Available bytes, negative while transfers wait for reserved bytes
+	last     time.Time // Time of the last reservation
+	now      func() time.Time
+}
+
+// NewLimiter creates a limiter for a schedule
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{
+		schedule: schedule,
+		now:      time.Now,
+	}
+}
+
+// SetSchedule replaces the schedule of the limiter, transfers in progress
+// continue at the new rate
+func (l *Limiter) SetSchedule(schedule Schedule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.schedule = schedule
+}
+
+// Schedule returns the schedule of the limiter
+func (l *Limiter) Schedule() Schedule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.schedule
+}
+
+// WaitN blocks until n bytes may be transferred or the context is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller has to
+// wait until they are covered. The bucket refills at the current rate and holds
+// at most one second worth of bytes, which bounds the burst after an idle period.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := l.schedule.RateAt(now)
+	if rate != l.rate {
+		if l.rate <= 0 {
+			// A new limiter or the end of an unlimited period starts with a full bucket
+			l.tokens = float64(rate)
+		} else {
+			// Debts incurred at the old rate are not carried over
+			l.tokens = math.Max(l.tokens, 0)
+		}
+		l.rate = rate
+	}
+
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if rate <= 0 {
+		return 0
+	}
+
+	burst := float64(rate)
+	l.tokens = math.Min(l.tokens+elapsed*float64(rate), burst)
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
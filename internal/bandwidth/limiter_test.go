@@ -0,0 +1,80 @@
+package bandwidth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLimiter creates a limiter with a clock the test advances by hand
+func newTestLimiter(t *testing.T, text string) (*Limiter, *time.Time) {
+	schedule, err := ParseSchedule(text)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	limiter := NewLimiter(schedule)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	limiter, now := newTestLimiter(t, "1000")
+
+	// The bucket starts full with one second worth of bytes
+	assert.Equal(t, time.Duration(0), limiter.reserve(1000))
+
+	// Further bytes have to wait for the bucket to refill
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve(500))
+	assert.Equal(t, time.Second, limiter.reserve(500))
+
+	// Time pays off the debt
+	*now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve(0))
+	assert.Equal(t, 100*time.Millisecond, limiter.reserve(100))
+
+	// An idle period refills the bucket, but never above one second worth of bytes
+	*now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), limiter.reserve(1000))
+	assert.Equal(t, time.Second, limiter.reserve(1000))
+}
+
+func TestLimiter_ScheduleChanges(t *testing.T) {
+	limiter, now := newTestLimiter(t, "13:00,off 08:00,1000")
+
+	limiter.reserve(1000)
+	assert.Equal(t, time.Second, limiter.reserve(1000))
+
+	// At 13:00 the limit is lifted and the debt is forgiven
+	*now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), limiter.reserve(1<<30))
+
+	// A new schedule applies to the next reservation
+	limiter.SetSchedule(Schedule{slots: []utils.BandwidthSlot{{Rate: 100}}, text: "100"})
+	assert.Equal(t, "100", limiter.Schedule().String())
+	limiter.reserve(100)
+	assert.Equal(t, time.Second, limiter.reserve(100))
+}
+
+func TestLimiter_WaitN(t *testing.T) {
+	schedule, err := ParseSchedule("10K")
+	require.NoError(t, err)
+	limiter := NewLimiter(schedule)
+
+	// The burst passes without waiting
+	start := time.Now()
+	require.NoError(t, limiter.WaitN(context.Background(), 10*1024))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// Waiting for more bytes gives up when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.WaitN(ctx, 10*1024), context.DeadlineExceeded)
+
+	// A nil limiter does not limit anything
+	var unlimited *Limiter
+	assert.NoError(t, unlimited.WaitN(context.Background(), 1<<30))
+}
@@ -0,0 +1,67 @@
+// Package bandwidth limits the throughput of transfers according to a timetable.
+package bandwidth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/utils"
+)
+
+// Schedule is a bandwidth limit that may change with the time of day and the
+// day of the week. The zero value is unlimited.
+type Schedule struct {
+	slots []utils.BandwidthSlot
+	text  string
+}
+
+// ParseSchedule parses a bandwidth limit, a single rate such as "1M" or a
+// timetable such as "08:00,1M 18:00,off", see utils.ParseBandwidthLimit
+func ParseSchedule(text string) (Schedule, error) {
+	slots, err := utils.ParseBandwidthLimit(text)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if len(slots) == 0 {
+		return Schedule{}, nil
+	}
+	return Schedule{slots: slots, text: strings.TrimSpace(text)}, nil
+}
+
+// IsUnlimited reports whether the schedule never limits the bandwidth
+func (s Schedule) IsUnlimited() bool {
+	for _, slot := range s.slots {
+		if slot.Rate > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RateAt returns the limit in bytes per second at a point in time, 0 for unlimited
+func (s Schedule) RateAt(t time.Time) int64 {
+	if len(s.slots) == 0 {
+		return 0
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := time.Duration(t.Weekday())*24*time.Hour + t.Sub(midnight)
+
+	// Before the first entry of the week, the last one still applies
+	rate := s.slots[len(s.slots)-1].Rate
+	for _, slot := range s.slots {
+		if slot.Start > offset {
+			break
+		}
+		rate = slot.Rate
+	}
+	return rate
+}
+
+// String returns the schedule as it was parsed
+func (s Schedule) String() string {
+	if s.text == "" {
+		return "off"
+	}
+	return s.text
+}
@@ -0,0 +1,87 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// 2024-01-01 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		schedule, err := ParseSchedule("  ")
+		require.NoError(t, err)
+		assert.True(t, schedule.IsUnlimited())
+		assert.Equal(t, int64(0), schedule.RateAt(monday(12, 0)))
+		assert.Equal(t, "off", schedule.String())
+	})
+
+	t.Run("single rate", func(t *testing.T) {
+		schedule, err := ParseSchedule("1M")
+		require.NoError(t, err)
+		assert.False(t, schedule.IsUnlimited())
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(0, 0)))
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(23, 59)))
+		assert.Equal(t, "1M", schedule.String())
+	})
+
+	t.Run("daily timetable", func(t *testing.T) {
+		schedule, err := ParseSchedule("08:00,1M 18:00,off")
+		require.NoError(t, err)
+		assert.False(t, schedule.IsUnlimited())
+
+		assert.Equal(t, int64(0), schedule.RateAt(monday(7, 59)))
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(8, 0)))
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(17, 59)))
+		assert.Equal(t, int64(0), schedule.RateAt(monday(18, 0)))
+		assert.Equal(t, int64(0), schedule.RateAt(monday(0, 0)))
+
+		// Every day of the week follows the same timetable
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(12, 0).AddDate(0, 0, 5)))
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(12, 0).AddDate(0, 0, 6)))
+	})
+
+	t.Run("weekly timetable", func(t *testing.T) {
+		schedule, err := ParseSchedule("Mon-08:00,1M fri-18:00,off Wed-12:00,512K")
+		require.NoError(t, err)
+
+		// Before Monday morning the last entry of the previous week applies
+		assert.Equal(t, int64(0), schedule.RateAt(monday(7, 0)))
+		assert.Equal(t, int64(0), schedule.RateAt(monday(7, 0).AddDate(0, 0, -1)))
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(8, 0)))
+		assert.Equal(t, int64(1<<20), schedule.RateAt(monday(8, 0).AddDate(0, 0, 1)))
+		assert.Equal(t, int64(512<<10), schedule.RateAt(monday(12, 0).AddDate(0, 0, 2)))
+		assert.Equal(t, int64(512<<10), schedule.RateAt(monday(17, 0).AddDate(0, 0, 4)))
+		assert.Equal(t, int64(0), schedule.RateAt(monday(18, 0).AddDate(0, 0, 4)))
+	})
+
+	t.Run("unlimited timetable", func(t *testing.T) {
+		schedule, err := ParseSchedule("08:00,off 18:00,0")
+		require.NoError(t, err)
+		assert.True(t, schedule.IsUnlimited())
+	})
+
+	invalid := []string{
+		"fast",
+		"08:00",
+		"08:00,fast",
+		"25:00,1M",
+		"8,1M",
+		"Mon-08:00,1M 18:00,off",
+		"08:00,1M Mon-18:00,off",
+		"Xyz-08:00,1M",
+		"08:00,1M 08:00,2M",
+	}
+	for _, text := range invalid {
+		t.Run("invalid "+text, func(t *testing.T) {
+			_, err := ParseSchedule(text)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package capabilities discovers what a Nextcloud server supports from the OCS
+// capabilities endpoint, so that clients can adapt to the server instead of
+// finding out by trial and error.
+package capabilities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// endpoint is the OCS capabilities endpoint below the server root
+const endpoint = "/ocs/v1.php/cloud/capabilities"
+
+// Version is the version of a Nextcloud server
+type Version struct {
+	Major  int    `json:"major"`
+	Minor  int    `json:"minor"`
+	Micro  int    `json:"micro"`
+	String string `json:"string"`
+}
+
+// AtLeast reports whether the version is major.minor or newer
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Capabilities are the features of a Nextcloud server relevant to syncing
+type Capabilities struct {
+	Version       Version  `json:"version"`
+	ChunkingV2    bool     `json:"chunking_v2"`              // Chunked uploads below /remote.php/dav/uploads
+	BulkUpload    bool     `json:"bulk_upload"`              // Bundled uploads of small files to /remote.php/dav/bulk
+	ChecksumTypes []string `json:"checksum_types,omitempty"` // Supported upload checksums, empty if the server does not say
+	MaxChunkSize  int64    `json:"max_chunk_size,omitempty"` // Largest upload the server accepts in one request, 0 if unknown
+	Trashbin      bool     `json:"trashbin"`                 // Deleted files are kept in the trashbin
+	Versioning    bool     `json:"versioning"`               // Earlier versions of files are kept
+	Sharing       bool     `json:"sharing"`                  // The sharing API is enabled
+}
+
+// SupportsChecksum reports whether uploads may carry a checksum of an algorithm
+// such as "SHA256". Servers that do not list checksum types store any of them.
+func (c *Capabilities) SupportsChecksum(algorithm string) bool {
+	if len(c.ChecksumTypes) == 0 {
+		return true
+	}
+	for _, supported := range c.ChecksumTypes {
+		if strings.EqualFold(supported, algorithm) {
+			return true
+		}
+	}
+	return false
+}
+
+// payload is the data of a capabilities response, the parts of it that are used
+type payload struct {
+	Version      Version `json:"version"`
+	Capabilities struct {
+		Dav struct {
+			Chunking   string `json:"chunking"`
+			BulkUpload string `json:"bulkupload"`
+		} `json:"dav"`
+		Files struct {
+			Undelete      bool `json:"undelete"`
+			Versioning    bool `json:"versioning"`
+			ChunkedUpload struct {
+				MaxSize int64 `json:"max_size"`
+			} `json:"chunked_upload"`
+		} `json:"files"`
+		Checksums struct {
+			SupportedTypes []string `json:"supportedTypes"`
+		} `json:"checksums"`
+		Sharing struct {
+			APIEnabled bool `json:"api_enabled"`
+		} `json:"files_sharing"`
+	} `json:"capabilities"`
+}
+
+// Parse parses the body of a capabilities response in JSON format
+func Parse(body []byte) (*Capabilities, error) {
+	var envelope struct {
+		OCS struct {
+			Meta struct {
+				Status     string `json:"status"`
+				StatusCode int    `json:"statuscode"`
+				Message    string `json:"message"`
+			} `json:"meta"`
+			Data json.RawMessage `json:"data"`
+		} `json:"ocs"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid capabilities response: %w", err)
+	}
+	if meta := envelope.OCS.Meta; meta.Status != "ok" {
+		return nil, fmt.Errorf("capabilities request failed: %d %s", meta.StatusCode, meta.Message)
+	}
+
+	var data payload
+	if err := json.Unmarshal(envelope.OCS.Data, &data); err != nil {
+		return nil, fmt.Errorf("invalid capabilities response: %w", err)
+	}
+
+	caps := data.Capabilities
+	return &Capabilities{
+		Version:       data.Version,
+		ChunkingV2:    caps.Dav.Chunking >= "1.0",
+		BulkUpload:    caps.Dav.BulkUpload != "",
+		ChecksumTypes: caps.Checksums.SupportedTypes,
+		MaxChunkSize:  caps.Files.ChunkedUpload.MaxSize,
+		Trashbin:      caps.Files.Undelete,
+		Versioning:    caps.Files.Versioning,
+		Sharing:       caps.Sharing.APIEnabled,
+	}, nil
+}
+
+// Fetch requests the capabilities of the server at serverURL, the root of the
+// Nextcloud installation. authHeader may be empty, servers then only report
+// their public capabilities.
+func Fetch(ctx context.Context, httpClient *http.Client, serverURL, authHeader string) (*Capabilities, error) {
+	requestURL := strings.TrimSuffix(serverURL, "/") + endpoint + "?format=json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capabilities request: %w", err)
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	req.Header.Set("OCS-APIRequest", "true")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "nextcloud-sync/1.0")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("capabilities request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("capabilities request failed: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities response: %w", err)
+	}
+
+	return Parse(body)
+}
+
+// cacheEntry is the outcome of fetching the capabilities of a server
+type cacheEntry struct {
+	once sync.Once
+	caps *Capabilities
+	err  error
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*cacheEntry)
+)
+
+// Get returns the capabilities of a server like Fetch, but only asks each server
+// once per run. Failures are remembered as well, so that a server without the OCS
+// API is not asked again for every transfer.
+func Get(ctx context.Context, httpClient *http.Client, serverURL, authHeader string) (*Capabilities, error) {
+	key := strings.TrimSuffix(serverURL, "/") + "\x00" + authHeader
+
+	cacheMu.Lock()
+	entry, exists := cache[key]
+	if !exists {
+		entry = &cacheEntry{}
+		cache[key] = entry
+	}
+	cacheMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.caps, entry.err = Fetch(ctx, httpClient, serverURL, authHeader)
+	})
+	return entry.caps, entry.err
+}
@@ -0,0 +1,88 @@
+package capabilities
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	body := `{"ocs":{"meta":{"status":"ok","statuscode":100,"message":"OK"},"data":{
+		"version":{"major":28,"minor":0,"micro":4,"string":"28.0.4","edition":""},
+		"capabilities":{
+			"dav":{"chunking":"1.0","bulkupload":"1.0"},
+			"files":{"undelete":true,"versioning":false,"chunked_upload":{"max_size":104857600}},
+			"checksums":{"supportedTypes":["SHA1","MD5"],"preferredUploadType":"SHA1"},
+			"files_sharing":{"api_enabled":true}
+		}}}}`
+
+	caps, err := Parse([]byte(body))
+	require.NoError(t, err)
+	assert.Equal(t, Version{Major: 28, Minor: 0, Micro: 4, String: "28.0.4"}, caps.Version)
+	assert.True(t, caps.ChunkingV2)
+	assert.True(t, caps.BulkUpload)
+	assert.Equal(t, int64(100*1024*1024), caps.MaxChunkSize)
+	assert.True(t, caps.Trashbin)
+	assert.False(t, caps.Versioning)
+	assert.True(t, caps.Sharing)
+	assert.True(t, caps.SupportsChecksum("sha1"))
+	assert.False(t, caps.SupportsChecksum("SHA256"))
+
+	// Servers without the apps report nothing
+	caps, err = Parse([]byte(`{"ocs":{"meta":{"status":"ok","statuscode":100},"data":{"version":{"major":20},"capabilities":{}}}}`))
+	require.NoError(t, err)
+	assert.False(t, caps.ChunkingV2)
+	assert.False(t, caps.Trashbin)
+	assert.True(t, caps.SupportsChecksum("SHA256"))
+
+	_, err = Parse([]byte(`{"ocs":{"meta":{"status":"failure","statuscode":997,"message":"Unauthorised"},"data":[]}}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`<html></html>`))
+	assert.Error(t, err)
+}
+
+func TestVersion_AtLeast(t *testing.T) {
+	version := Version{Major: 27, Minor: 1}
+	assert.True(t, version.AtLeast(26, 5))
+	assert.True(t, version.AtLeast(27, 1))
+	assert.False(t, version.AtLeast(27, 2))
+	assert.False(t, version.AtLeast(28, 0))
+}
+
+func TestGet(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	ctx := context.Background()
+	authHeader := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+
+	caps, err := Get(ctx, http.DefaultClient, srv.URL+"/", authHeader)
+	require.NoError(t, err)
+	assert.Equal(t, "28.0.4", caps.Version.String)
+	assert.True(t, caps.ChunkingV2)
+	assert.True(t, caps.Trashbin)
+	assert.True(t, caps.Versioning)
+	assert.True(t, caps.Sharing)
+
+	// The capabilities are only fetched once
+	srv.SetCapabilities("dav", nil)
+	cached, err := Get(ctx, http.DefaultClient, srv.URL, authHeader)
+	require.NoError(t, err)
+	assert.Same(t, caps, cached)
+	assert.Equal(t, 1, srv.RequestCount(http.MethodGet))
+
+	fetched, err := Fetch(ctx, http.DefaultClient, srv.URL, authHeader)
+	require.NoError(t, err)
+	assert.False(t, fetched.ChunkingV2)
+
+	// Failures are remembered as well
+	_, err = Get(ctx, http.DefaultClient, srv.URL, "Basic wrong")
+	require.Error(t, err)
+	_, err = Get(ctx, http.DefaultClient, srv.URL, "Basic wrong")
+	require.Error(t, err)
+	assert.Equal(t, 3, srv.RequestCount(http.MethodGet))
+}
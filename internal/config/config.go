@@ -97,6 +97,7 @@ func NewConfig() *Config {
 			EnableLargeFileSupport:   DefaultEnableLargeFileSupport,
 			EnableCompression:        DefaultEnableCompression,
 			VerifySSL:                DefaultVerifySSL,
+			MaxConcurrentTransfers:   DefaultMaxConcurrentTransfers,
 		},
 	}
 }
@@ -19,6 +19,7 @@ func TestNewConfig(t *testing.T) {
 	assert.Equal(t, DefaultTimeoutSeconds, config.GlobalSettings.TimeoutSeconds)
 	assert.Equal(t, DefaultChunkSizeMB, config.GlobalSettings.ChunkSizeMB)
 	assert.Equal(t, DefaultProgressUpdateIntervalMS, config.GlobalSettings.ProgressUpdateIntervalMS)
+	assert.Equal(t, DefaultMaxConcurrentTransfers, config.GlobalSettings.MaxConcurrentTransfers)
 }
 
 func TestValidateConfig(t *testing.T) {
@@ -61,6 +62,119 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "OAuth2 server without app password",
+			config: &Config{
+				Version: "1.0.0",
+				Servers: map[string]Server{
+					"default": {
+						URL:      "https://cloud.example.com",
+						Username: "user@example.com",
+						OAuth2: &OAuth2Settings{
+							ClientID: "client",
+							ClientSecret: EncryptedData{
+								Encrypted: "test",
+								Salt:      "test",
+								Nonce:     "test",
+								Algorithm: EncryptionAlgorithm,
+							},
+							RedirectURL: "http://localhost:8765/callback",
+							RefreshToken: EncryptedData{
+								Encrypted: "test",
+								Salt:      "test",
+								Nonce:     "test",
+								Algorithm: EncryptionAlgorithm,
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "OAuth2 server without refresh token",
+			config: &Config{
+				Version: "1.0.0",
+				Servers: map[string]Server{
+					"default": {
+						URL:      "https://cloud.example.com",
+						Username: "user@example.com",
+						OAuth2: &OAuth2Settings{
+							ClientID: "client",
+							ClientSecret: EncryptedData{
+								Encrypted: "test",
+								Salt:      "test",
+								Nonce:     "test",
+								Algorithm: EncryptionAlgorithm,
+							},
+							RedirectURL: "http://localhost:8765/callback",
+						},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "invalid refresh token",
+		},
+		{
+			name: "secrets in the Secret Service",
+			config: &Config{
+				Version: "1.0.0",
+				Servers: map[string]Server{
+					"default": {
+						URL:         "https://cloud.example.com",
+						Username:    "user@example.com",
+						SecretStore: &SecretStore{Type: SecretStoreSecretService},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "password command without command",
+			config: &Config{
+				Version: "1.0.0",
+				Servers: map[string]Server{
+					"default": {
+						URL:         "https://cloud.example.com",
+						Username:    "user@example.com",
+						SecretStore: &SecretStore{Type: SecretStoreCommand},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "password command cannot be empty",
+		},
+		{
+			name: "password command for OAuth2",
+			config: &Config{
+				Version: "1.0.0",
+				Servers: map[string]Server{
+					"default": {
+						URL:         "https://cloud.example.com",
+						Username:    "user@example.com",
+						OAuth2:      &OAuth2Settings{ClientID: "client", RedirectURL: "http://localhost:8765/callback"},
+						SecretStore: &SecretStore{Type: SecretStoreCommand, PasswordCommand: "pass show nextcloud"},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "cannot keep OAuth2 secrets",
+		},
+		{
+			name: "unknown secret store",
+			config: &Config{
+				Version: "1.0.0",
+				Servers: map[string]Server{
+					"default": {
+						URL:         "https://cloud.example.com",
+						Username:    "user@example.com",
+						SecretStore: &SecretStore{Type: "vault"},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "unknown type",
+		},
 	}
 
 	for _, tt := range tests {
@@ -122,6 +236,33 @@ func TestValidateServerURL(t *testing.T) {
 	}
 }
 
+func TestValidateRedirectURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "localhost", url: "http://localhost:8765/callback", wantErr: false},
+		{name: "loopback address", url: "http://127.0.0.1:8765/", wantErr: false},
+		{name: "IPv6 loopback address", url: "http://[::1]:8765/callback", wantErr: false},
+		{name: "remote host", url: "http://example.com:8765/callback", wantErr: true},
+		{name: "HTTPS", url: "https://localhost:8765/callback", wantErr: true},
+		{name: "without port", url: "http://localhost/callback", wantErr: true},
+		{name: "empty URL", url: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedirectURL(tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestValidateUsername(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -208,6 +349,55 @@ func TestValidateSyncProfile(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "bandwidth limits",
+			profile: SyncProfile{
+				Source:        "/home/user/Documents",
+				Target:        "https://cloud.example.com/apps/files/files/12345?dir=/Documents",
+				BandwidthUp:   "08:00,1M 18:00,off",
+				BandwidthDown: "512K",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid bandwidth limit",
+			profile: SyncProfile{
+				Source:      "/home/user/Documents",
+				Target:      "https://cloud.example.com/apps/files/files/12345?dir=/Documents",
+				BandwidthUp: "25:00,1M",
+			},
+			wantErr: true,
+		},
+		{
+			name: "shares",
+			profile: SyncProfile{
+				Source: "/home/user/Documents",
+				Target: "https://cloud.example.com/apps/files/files/12345?dir=/Documents",
+				Shares: []ProfileShare{
+					{Type: "group", With: "team", Permissions: "edit"},
+					{Path: "Public", Type: "link", Label: "Website"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "user share without user",
+			profile: SyncProfile{
+				Source: "/home/user/Documents",
+				Target: "https://cloud.example.com/apps/files/files/12345?dir=/Documents",
+				Shares: []ProfileShare{{Type: "user"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "share outside the remote folder",
+			profile: SyncProfile{
+				Source: "/home/user/Documents",
+				Target: "https://cloud.example.com/apps/files/files/12345?dir=/Documents",
+				Shares: []ProfileShare{{Path: "../Private", Type: "link"}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -259,6 +449,13 @@ func TestValidateGlobalSettings(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid max concurrent transfers",
+			settings: GlobalSettings{
+				MaxConcurrentTransfers: MaxConcurrentTransfersLimit + 1,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
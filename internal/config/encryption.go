@@ -14,53 +14,89 @@ import (
 
 // EncryptPassword encrypts a plaintext app password using AES-256-GCM
 func EncryptPassword(password string) (EncryptedData, error) {
+	// Derive key from machine-specific information
+	machineSecret, err := getMachineSecret()
+	if err != nil {
+		return EncryptedData{}, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+
+	return encrypt(password, machineSecret, EncryptionAlgorithm)
+}
+
+// DecryptPassword decrypts an encrypted app password
+func DecryptPassword(data EncryptedData) (string, error) {
+	if data.Algorithm != EncryptionAlgorithm {
+		return "", fmt.Errorf("unsupported encryption algorithm: %s", data.Algorithm)
+	}
+
+	machineSecret, err := getMachineSecret()
+	if err != nil {
+		return "", fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+
+	plaintext, err := decrypt(data, machineSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	return plaintext, nil
+}
+
+// EncryptWithPassphrase encrypts a secret using AES-256-GCM with a key derived from
+// a passphrase instead of the machine, so that reading the configuration file is
+// not enough to decrypt it
+func EncryptWithPassphrase(secret, passphrase string) (EncryptedData, error) {
+	if passphrase == "" {
+		return EncryptedData{}, fmt.Errorf("passphrase cannot be empty")
+	}
+
+	return encrypt(secret, passphrase, PassphraseEncryptionAlgorithm)
+}
+
+// DecryptWithPassphrase decrypts a secret encrypted with EncryptWithPassphrase
+func DecryptWithPassphrase(data EncryptedData, passphrase string) (string, error) {
+	if data.Algorithm != PassphraseEncryptionAlgorithm {
+		return "", fmt.Errorf("unsupported encryption algorithm: %s", data.Algorithm)
+	}
+
+	plaintext, err := decrypt(data, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret, is the passphrase wrong? %w", err)
+	}
+	return plaintext, nil
+}
+
+// encrypt encrypts plaintext with a key derived from secret
+func encrypt(plaintext, secret, algorithm string) (EncryptedData, error) {
 	// Generate random salt
 	salt := make([]byte, SaltSize)
 	if _, err := rand.Read(salt); err != nil {
 		return EncryptedData{}, fmt.Errorf("failed to generate salt: %w", err)
 	}
 
-	// Derive key from machine-specific information
-	key, err := deriveEncryptionKey(salt)
-	if err != nil {
-		return EncryptedData{}, fmt.Errorf("failed to derive encryption key: %w", err)
-	}
-
 	// Generate random nonce
 	nonce := make([]byte, NonceSize)
 	if _, err := rand.Read(nonce); err != nil {
 		return EncryptedData{}, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	// Create cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return EncryptedData{}, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(secret, salt)
 	if err != nil {
-		return EncryptedData{}, fmt.Errorf("failed to create GCM: %w", err)
+		return EncryptedData{}, err
 	}
 
 	// Encrypt password
-	encrypted := gcm.Seal(nil, nonce, []byte(password), nil)
+	encrypted := gcm.Seal(nil, nonce, []byte(plaintext), nil)
 
 	return EncryptedData{
 		Encrypted: base64.StdEncoding.EncodeToString(encrypted),
 		Salt:      base64.StdEncoding.EncodeToString(salt),
 		Nonce:     base64.StdEncoding.EncodeToString(nonce),
-		Algorithm: EncryptionAlgorithm,
+		Algorithm: algorithm,
 	}, nil
 }
 
-// DecryptPassword decrypts an encrypted app password
-func DecryptPassword(data EncryptedData) (string, error) {
-	if data.Algorithm != EncryptionAlgorithm {
-		return "", fmt.Errorf("unsupported encryption algorithm: %s", data.Algorithm)
-	}
-
+// decrypt decrypts data that was encrypted with a key derived from secret
+func decrypt(data EncryptedData, secret string) (string, error) {
 	// Validate integrity first
 	if err := ValidateEncryptedDataIntegrity(data); err != nil {
 		return "", fmt.Errorf("invalid encrypted data: %w", err)
@@ -82,45 +118,39 @@ func DecryptPassword(data EncryptedData) (string, error) {
 		return "", fmt.Errorf("failed to decode nonce: %w", err)
 	}
 
-	// Derive key
-	key, err := deriveEncryptionKey(salt)
-	if err != nil {
-		return "", fmt.Errorf("failed to derive encryption key: %w", err)
-	}
-
-	// Create cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(secret, salt)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", err
 	}
 
 	// Decrypt
 	plaintext, err := gcm.Open(nil, nonce, encrypted, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt password: %w", err)
+		return "", err
 	}
 
 	return string(plaintext), nil
 }
 
-// deriveEncryptionKey derives an encryption key from machine-specific information
-func deriveEncryptionKey(salt []byte) ([]byte, error) {
-	// Get machine-specific secret
-	machineSecret, err := getMachineSecret()
+// newGCM creates an AES-256-GCM cipher with a key derived from secret and salt
+func newGCM(secret string, salt []byte) (cipher.AEAD, error) {
+	// Derive key using PBKDF2
+	key := pbkdf2.Key([]byte(secret), salt, PBKDF2Iterations, 32, sha256.New)
+	defer ZeroBytes(key)
+
+	// Create cipher
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get machine secret: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
-	// Derive key using PBKDF2
-	key := pbkdf2.Key([]byte(machineSecret), salt, PBKDF2Iterations, 32, sha256.New)
+	// Create GCM
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
 
-	return key, nil
+	return gcm, nil
 }
 
 // getMachineSecret creates a machine-specific secret for key derivation
@@ -186,7 +216,7 @@ func ValidateEncryptedDataIntegrity(data EncryptedData) error {
 		return fmt.Errorf("nonce is empty")
 	}
 
-	if data.Algorithm != EncryptionAlgorithm {
+	if data.Algorithm != EncryptionAlgorithm && data.Algorithm != PassphraseEncryptionAlgorithm {
 		return fmt.Errorf("unsupported algorithm: %s", data.Algorithm)
 	}
 
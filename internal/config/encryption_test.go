@@ -29,6 +29,32 @@ func TestEncryptPassword(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestEncryptWithPassphrase(t *testing.T) {
+	encrypted, err := EncryptWithPassphrase("test-app-password-123", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, PassphraseEncryptionAlgorithm, encrypted.Algorithm)
+	assert.NoError(t, ValidateEncryptedDataIntegrity(encrypted))
+
+	decrypted, err := DecryptWithPassphrase(encrypted, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, "test-app-password-123", decrypted)
+
+	// The machine key and other passphrases do not decrypt it
+	_, err = DecryptWithPassphrase(encrypted, "battery staple")
+	assert.Error(t, err)
+	_, err = DecryptPassword(encrypted)
+	assert.Error(t, err)
+
+	// Nor does the passphrase decrypt data encrypted with the machine key
+	machineEncrypted, err := EncryptPassword("test-app-password-123")
+	require.NoError(t, err)
+	_, err = DecryptWithPassphrase(machineEncrypted, "correct horse")
+	assert.Error(t, err)
+
+	_, err = EncryptWithPassphrase("test-app-password-123", "")
+	assert.Error(t, err)
+}
+
 func TestDecryptPasswordInvalidData(t *testing.T) {
 	tests := []struct {
 		name string
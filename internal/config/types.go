@@ -14,10 +14,45 @@ type Config struct {
 
 // Server represents a Nextcloud server configuration
 type Server struct {
-	URL         string        `json:"url"`
-	Username    string        `json:"username"`
-	AppPassword EncryptedData `json:"app_password"`
-	RootPath    string        `json:"root_path,omitempty"`
+	URL         string          `json:"url"`
+	Username    string          `json:"username"`
+	AppPassword EncryptedData   `json:"app_password"`
+	OAuth2      *OAuth2Settings `json:"oauth2,omitempty"`       // Set if the server is accessed through OAuth2 instead of an app password
+	SecretStore *SecretStore    `json:"secret_store,omitempty"` // Where the secrets are kept, encrypted in this file if unset
+	RootPath    string          `json:"root_path,omitempty"`
+}
+
+// SecretStoreType returns the type of the secret store of the server
+func (s Server) SecretStoreType() string {
+	if s.SecretStore == nil || s.SecretStore.Type == "" {
+		return SecretStoreConfig
+	}
+	return s.SecretStore.Type
+}
+
+// SecretStore selects where the app password, OAuth2 client secret and refresh
+// token of a server are kept
+type SecretStore struct {
+	Type            string `json:"type"`                       // One of the SecretStore* constants
+	PasswordCommand string `json:"password_command,omitempty"` // Command printing the app password, e.g. "pass show nextcloud"
+	PassphraseEnv   string `json:"passphrase_env,omitempty"`   // Variable holding the passphrase, DefaultPassphraseEnv if empty
+}
+
+// Secret store types
+const (
+	SecretStoreConfig        = "config"         // Encrypted in the configuration file with a key derived from the machine
+	SecretStoreSecretService = "secret_service" // Secret Service of the desktop, e.g. GNOME Keyring or KWallet
+	SecretStoreCommand       = "command"        // Printed by a password command, only for app passwords
+	SecretStorePassphrase    = "passphrase"     // Encrypted in the configuration file with a key derived from a passphrase
+)
+
+// OAuth2Settings are the OAuth2 client registered in the oauth2 app of a server
+// and the refresh token granted to it
+type OAuth2Settings struct {
+	ClientID     string        `json:"client_id"`
+	ClientSecret EncryptedData `json:"client_secret"`
+	RedirectURL  string        `json:"redirect_url"` // Localhost URL registered as the redirection URI of the client
+	RefreshToken EncryptedData `json:"refresh_token"`
 }
 
 // EncryptedData represents encrypted app password with metadata
@@ -30,12 +65,25 @@ type EncryptedData struct {
 
 // SyncProfile represents a synchronization profile
 type SyncProfile struct {
-	Source          string     `json:"source"`
-	Target          string     `json:"target"`
-	ExcludePatterns []string   `json:"exclude_patterns,omitempty"`
-	Bidirectional   bool       `json:"bidirectional"`
-	LastSync        *time.Time `json:"last_sync,omitempty"`
-	ForceOverwrite  bool       `json:"force_overwrite,omitempty"`
+	Source          string         `json:"source"`
+	Target          string         `json:"target"`
+	ExcludePatterns []string       `json:"exclude_patterns,omitempty"`
+	Bidirectional   bool           `json:"bidirectional"`
+	LastSync        *time.Time     `json:"last_sync,omitempty"`
+	ForceOverwrite  bool           `json:"force_overwrite,omitempty"`
+	BandwidthUp     string         `json:"bwlimit_up,omitempty"`   // Upload limit or timetable, see utils.ParseBandwidthLimit
+	BandwidthDown   string         `json:"bwlimit_down,omitempty"` // Download limit or timetable, see utils.ParseBandwidthLimit
+	Shares          []ProfileShare `json:"shares,omitempty"`       // Shares created after each sync if missing
+}
+
+// ProfileShare is a share of a file or folder below the remote folder of a sync
+// profile. Shares are only ever created, never changed or deleted.
+type ProfileShare struct {
+	Path        string `json:"path,omitempty"`        // Relative to the remote folder, empty for the folder itself
+	Type        string `json:"type"`                  // user, group or link
+	With        string `json:"with,omitempty"`        // User or group, not used for links
+	Permissions string `json:"permissions,omitempty"` // Names or a bit mask, see ocs.ParsePermissions; the server's default if empty
+	Label       string `json:"label,omitempty"`       // Label of a public link, which also tells several links apart
 }
 
 // GlobalSettings represents application-wide settings
@@ -47,6 +95,7 @@ type GlobalSettings struct {
 	EnableLargeFileSupport   bool `json:"enable_large_file_support,omitempty"`
 	EnableCompression        bool `json:"enable_compression,omitempty"`
 	VerifySSL                bool `json:"verify_ssl,omitempty"`
+	MaxConcurrentTransfers   int  `json:"max_concurrent_transfers,omitempty"`
 }
 
 // Constants for default configuration values
@@ -59,7 +108,11 @@ const (
 	DefaultEnableLargeFileSupport   = true
 	DefaultEnableCompression        = false
 	DefaultVerifySSL                = true
+	DefaultMaxConcurrentTransfers   = 4
+	MaxConcurrentTransfersLimit     = 64
 	EncryptionAlgorithm             = "aes-256-gcm"
+	PassphraseEncryptionAlgorithm   = "aes-256-gcm-passphrase"
+	DefaultPassphraseEnv            = "NEXTCLOUD_SYNC_PASSPHRASE"
 	PBKDF2Iterations                = 100000
 	SaltSize                        = 32
 	NonceSize                       = 12
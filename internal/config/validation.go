@@ -5,6 +5,8 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+
+	"github.com/phaus/nextcloud-sync/internal/utils"
 )
 
 // ValidateConfig validates the entire configuration structure
@@ -78,8 +80,95 @@ func ValidateServer(name string, server Server) error {
 		return fmt.Errorf("invalid username: %w", err)
 	}
 
-	if err := ValidateEncryptedData(server.AppPassword); err != nil {
-		return fmt.Errorf("invalid app password: %w", err)
+	if err := ValidateSecretStore(server); err != nil {
+		return fmt.Errorf("invalid secret store: %w", err)
+	}
+
+	// Secrets kept outside the configuration file are not part of it
+	storeType := server.SecretStoreType()
+	inConfig := storeType == SecretStoreConfig || storeType == SecretStorePassphrase
+
+	if server.OAuth2 != nil {
+		if err := ValidateOAuth2Settings(*server.OAuth2, inConfig); err != nil {
+			return fmt.Errorf("invalid OAuth2 settings: %w", err)
+		}
+		return nil
+	}
+
+	if inConfig {
+		if err := ValidateEncryptedData(server.AppPassword); err != nil {
+			return fmt.Errorf("invalid app password: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateSecretStore validates the secret store selected for a server
+func ValidateSecretStore(server Server) error {
+	switch server.SecretStoreType() {
+	case SecretStoreConfig, SecretStoreSecretService, SecretStorePassphrase:
+	case SecretStoreCommand:
+		if server.SecretStore.PasswordCommand == "" {
+			return fmt.Errorf("password command cannot be empty")
+		}
+		if server.OAuth2 != nil {
+			return fmt.Errorf("a password command cannot keep OAuth2 secrets, which change with every token renewal")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected %s, %s, %s or %s", server.SecretStore.Type,
+			SecretStoreConfig, SecretStoreSecretService, SecretStoreCommand, SecretStorePassphrase)
+	}
+
+	return nil
+}
+
+// ValidateOAuth2Settings validates the OAuth2 client and refresh token of a server.
+// The encrypted secrets are only checked if they are kept in the configuration.
+func ValidateOAuth2Settings(settings OAuth2Settings, secretsInConfig bool) error {
+	if settings.ClientID == "" {
+		return fmt.Errorf("client ID cannot be empty")
+	}
+
+	if secretsInConfig {
+		if err := ValidateEncryptedData(settings.ClientSecret); err != nil {
+			return fmt.Errorf("invalid client secret: %w", err)
+		}
+	}
+
+	if err := ValidateRedirectURL(settings.RedirectURL); err != nil {
+		return fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	if secretsInConfig {
+		if err := ValidateEncryptedData(settings.RefreshToken); err != nil {
+			return fmt.Errorf("invalid refresh token: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRedirectURL validates the redirection URI of an OAuth2 client, which
+// must point to this machine so that the authorization code can be received
+func ValidateRedirectURL(redirectURL string) error {
+	parsedURL, err := url.Parse(redirectURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	if parsedURL.Scheme != "http" {
+		return fmt.Errorf("redirect URL must use http")
+	}
+
+	switch parsedURL.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+	default:
+		return fmt.Errorf("redirect URL must point to localhost")
+	}
+
+	if parsedURL.Port() == "" {
+		return fmt.Errorf("redirect URL must have a port")
 	}
 
 	return nil
@@ -138,7 +227,7 @@ func ValidateEncryptedData(data EncryptedData) error {
 		return fmt.Errorf("nonce cannot be empty")
 	}
 
-	if data.Algorithm != EncryptionAlgorithm {
+	if data.Algorithm != EncryptionAlgorithm && data.Algorithm != PassphraseEncryptionAlgorithm {
 		return fmt.Errorf("unsupported encryption algorithm: %s", data.Algorithm)
 	}
 
@@ -178,6 +267,43 @@ func ValidateSyncProfile(name string, profile SyncProfile) error {
 		}
 	}
 
+	// Validate bandwidth limits
+	if _, err := utils.ParseBandwidthLimit(profile.BandwidthUp); err != nil {
+		return fmt.Errorf("invalid upload bandwidth limit: %w", err)
+	}
+	if _, err := utils.ParseBandwidthLimit(profile.BandwidthDown); err != nil {
+		return fmt.Errorf("invalid download bandwidth limit: %w", err)
+	}
+
+	// Validate shares, permissions are checked when the share is created
+	for i, share := range profile.Shares {
+		if err := ValidateProfileShare(share); err != nil {
+			return fmt.Errorf("invalid share %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateProfileShare validates a share declared by a sync profile
+func ValidateProfileShare(share ProfileShare) error {
+	if strings.Contains("/"+share.Path+"/", "/../") {
+		return fmt.Errorf("path '%s' must stay below the remote folder", share.Path)
+	}
+
+	switch share.Type {
+	case "user", "group":
+		if share.With == "" {
+			return fmt.Errorf("a %s share needs a %s to share with", share.Type, share.Type)
+		}
+	case "link":
+		if share.With != "" {
+			return fmt.Errorf("a link share cannot be shared with '%s'", share.With)
+		}
+	default:
+		return fmt.Errorf("unknown share type '%s': use user, group or link", share.Type)
+	}
+
 	return nil
 }
 
@@ -223,6 +349,10 @@ func ValidateGlobalSettings(settings GlobalSettings) error {
 		return fmt.Errorf("progress_update_interval_ms must be between 100 and 60000")
 	}
 
+	if settings.MaxConcurrentTransfers < 0 || settings.MaxConcurrentTransfers > MaxConcurrentTransfersLimit {
+		return fmt.Errorf("max_concurrent_transfers must be between 0 and %d", MaxConcurrentTransfersLimit)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,214 @@
+// Package ocs is a client for the Nextcloud OCS API, which covers what WebDAV
+// does not, such as shares and server capabilities.
+package ocs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
+	"github.com/phaus/nextcloud-sync/internal/utils"
+)
+
+// Client calls OCS v2 endpoints of a Nextcloud server
+type Client struct {
+	auth        auth.AuthProvider
+	baseURL     string
+	userAgent   string
+	httpClient  *http.Client
+	retryConfig *utils.RetryConfig
+}
+
+// Error is an error reported by an OCS endpoint
+type Error struct {
+	HTTPStatus int    // HTTP status code of the response
+	StatusCode int    // OCS status code from the response meta data, 0 if there was none
+	Message    string // Message from the response meta data or the HTTP status text
+	Endpoint   string
+	Method     string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Endpoint, e.status(), e.Message)
+}
+
+// status returns the OCS status code, or the HTTP status code if there was none
+func (e *Error) status() int {
+	if e.StatusCode != 0 {
+		return e.StatusCode
+	}
+	return e.HTTPStatus
+}
+
+// IsTemporary returns true if the error might be resolved by retrying
+func (e *Error) IsTemporary() bool {
+	switch e.HTTPStatus {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsNotFoundError returns true if the endpoint or the requested item does not exist
+func (e *Error) IsNotFoundError() bool {
+	return e.status() == http.StatusNotFound
+}
+
+// response is the envelope of every OCS response
+type response struct {
+	OCS struct {
+		Meta struct {
+			Status     string `json:"status"`
+			StatusCode int    `json:"statuscode"`
+			Message    string `json:"message"`
+		} `json:"meta"`
+		Data json.RawMessage `json:"data"`
+	} `json:"ocs"`
+}
+
+// NewClient creates a new OCS client for the server of an auth provider
+func NewClient(authProvider auth.AuthProvider) (*Client, error) {
+	if authProvider == nil {
+		return nil, fmt.Errorf("auth provider cannot be nil")
+	}
+
+	baseURL := serverBaseURL(authProvider.GetServerURL())
+	if baseURL == "" {
+		return nil, fmt.Errorf("server URL cannot be empty")
+	}
+
+	return &Client{
+		auth:      authProvider,
+		baseURL:   baseURL,
+		userAgent: "nextcloud-sync/1.0",
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		retryConfig: utils.DefaultRetryConfig(),
+	}, nil
+}
+
+// SetRetryConfig sets custom retry configuration
+func (c *Client) SetRetryConfig(config *utils.RetryConfig) {
+	c.retryConfig = config
+}
+
+// Capabilities returns the capabilities of the server, which are fetched once per run
+func (c *Client) Capabilities(ctx context.Context) (*capabilities.Capabilities, error) {
+	authHeader, err := c.auth.GetAuthHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth header: %w", err)
+	}
+	return capabilities.Get(ctx, c.httpClient, c.baseURL, authHeader)
+}
+
+// serverBaseURL strips the path of a files app or WebDAV URL from a server URL
+func serverBaseURL(serverURL string) string {
+	for _, marker := range []string{"/apps/", "/remote.php/", "/index.php", "/ocs/"} {
+		if index := strings.Index(serverURL, marker); index != -1 {
+			serverURL = serverURL[:index]
+		}
+	}
+	return strings.TrimSuffix(serverURL, "/")
+}
+
+// do calls an OCS v2 endpoint such as "/cloud/capabilities" and decodes the data of
+// the response into result, which may be nil. Parameters are sent in the query for
+// GET and DELETE and as a form otherwise. Only GET requests are retried.
+func (c *Client) do(ctx context.Context, method, endpoint string, params url.Values, result interface{}) error {
+	query := url.Values{"format": {"json"}}
+	var body string
+	if method == http.MethodGet || method == http.MethodDelete {
+		for key, values := range params {
+			query[key] = values
+		}
+	} else {
+		body = params.Encode()
+	}
+	requestURL := c.baseURL + "/ocs/v2.php" + endpoint + "?" + query.Encode()
+
+	var data json.RawMessage
+	attempt := func() error {
+		var err error
+		data, err = c.send(ctx, method, requestURL, endpoint, body)
+		return err
+	}
+
+	var err error
+	if method == http.MethodGet {
+		err = utils.RetryWithBackoff(ctx, c.retryConfig, utils.IsTemporaryWebDAVError, attempt)
+	} else {
+		err = attempt()
+	}
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("failed to parse OCS response of %s: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// send sends a single OCS request and returns the data of the response
+func (c *Client) send(ctx context.Context, method, requestURL, endpoint, body string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCS request: %w", err)
+	}
+
+	authHeader, err := c.auth.GetAuthHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth header: %w", err)
+	}
+	req.Header.Set("Authorization", authHeader)
+	req.Header.Set("OCS-APIRequest", "true")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OCS request %s %s failed: %w", method, endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCS response of %s: %w", endpoint, err)
+	}
+
+	// Errors outside the OCS layer, e.g. from authentication, are not JSON
+	var envelope response
+	if err := json.Unmarshal(content, &envelope); err != nil || envelope.OCS.Meta.Status == "" {
+		if resp.StatusCode >= 400 {
+			return nil, &Error{HTTPStatus: resp.StatusCode, Message: http.StatusText(resp.StatusCode), Endpoint: endpoint, Method: method}
+		}
+		return nil, fmt.Errorf("invalid OCS response of %s", endpoint)
+	}
+
+	meta := envelope.OCS.Meta
+	if resp.StatusCode >= 400 || meta.Status != "ok" || (meta.StatusCode != 100 && meta.StatusCode != http.StatusOK) {
+		message := meta.Message
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return nil, &Error{HTTPStatus: resp.StatusCode, StatusCode: meta.StatusCode, Message: message, Endpoint: endpoint, Method: method}
+	}
+
+	return envelope.OCS.Data, nil
+}
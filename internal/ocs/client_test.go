@@ -0,0 +1,103 @@
+package ocs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/utils"
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates an OCS client for a server that retries without delay
+func newTestClient(t *testing.T, serverURL, username, password string) *Client {
+	authProvider, err := auth.NewAppPasswordAuth(serverURL, username, password)
+	require.NoError(t, err)
+	client, err := NewClient(authProvider)
+	require.NoError(t, err)
+	client.SetRetryConfig(&utils.RetryConfig{
+		MaxRetries:   2,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+		Multiplier:   1,
+	})
+	return client
+}
+
+// ocsError extracts the OCS error wrapped in err
+func ocsError(t *testing.T, err error) *Error {
+	var ocsErr *Error
+	require.True(t, errors.As(err, &ocsErr), "expected an OCS error, got %v", err)
+	return ocsErr
+}
+
+func TestServerBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"https://cloud.example.com":                                    "https://cloud.example.com",
+		"https://cloud.example.com/":                                   "https://cloud.example.com",
+		"https://cloud.example.com/nextcloud/apps/files/?dir=/Docs":    "https://cloud.example.com/nextcloud",
+		"https://cloud.example.com/remote.php/dav/files/alice":         "https://cloud.example.com",
+		"https://cloud.example.com/index.php/apps/files":               "https://cloud.example.com",
+		"https://cloud.example.com/ocs/v2.php/cloud/capabilities":      "https://cloud.example.com",
+		"https://cloud.example.com/nextcloud/remote.php/webdav/Photos": "https://cloud.example.com/nextcloud",
+	}
+	for input, expected := range tests {
+		assert.Equal(t, expected, serverBaseURL(input), input)
+	}
+}
+
+func TestClient_Headers(t *testing.T) {
+	var request *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ocs":{"meta":{"status":"ok","statuscode":200,"message":"OK"},"data":[]}}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, "alice", "secret")
+	shares, err := client.ListShares(context.Background(), "Documents/")
+	require.NoError(t, err)
+	assert.Empty(t, shares)
+
+	require.NotNil(t, request)
+	assert.Equal(t, "/ocs/v2.php/apps/files_sharing/api/v1/shares", request.URL.Path)
+	assert.Equal(t, "json", request.URL.Query().Get("format"))
+	assert.Equal(t, "/Documents", request.URL.Query().Get("path"))
+	assert.Equal(t, "true", request.Header.Get("OCS-APIRequest"))
+	username, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "alice", username)
+	assert.Equal(t, "secret", password)
+}
+
+func TestClient_Errors(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	ctx := context.Background()
+
+	// Authentication failures are not OCS responses
+	_, err := newTestClient(t, srv.URL, "alice", "wrong").ListShares(ctx, "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, ocsError(t, err).HTTPStatus)
+
+	// Temporary errors are retried for GET requests
+	srv.AddFault(webdavtest.Unavailable.On(http.MethodGet, "/ocs/").Times(1))
+	client := newTestClient(t, srv.URL, "alice", "secret")
+	_, err = client.ListShares(ctx, "")
+	require.NoError(t, err)
+
+	// OCS errors carry the status and message of the response
+	_, err = client.ListShares(ctx, "missing")
+	require.Error(t, err)
+	ocsErr := ocsError(t, err)
+	assert.True(t, ocsErr.IsNotFoundError())
+	assert.False(t, ocsErr.IsTemporary())
+	assert.Contains(t, ocsErr.Message, "does not exist")
+}
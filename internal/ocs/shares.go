@@ -0,0 +1,204 @@
+package ocs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sharesEndpoint is the OCS endpoint of the files_sharing app
+const sharesEndpoint = "/apps/files_sharing/api/v1/shares"
+
+// ShareType is the kind of recipient of a share
+type ShareType int
+
+// Share types of the sharing API
+const (
+	ShareTypeUser       ShareType = 0
+	ShareTypeGroup      ShareType = 1
+	ShareTypePublicLink ShareType = 3
+	ShareTypeEmail      ShareType = 4
+	ShareTypeFederated  ShareType = 6
+)
+
+// String returns the name of a share type as used on the command line
+func (t ShareType) String() string {
+	switch t {
+	case ShareTypeUser:
+		return "user"
+	case ShareTypeGroup:
+		return "group"
+	case ShareTypePublicLink:
+		return "link"
+	case ShareTypeEmail:
+		return "email"
+	case ShareTypeFederated:
+		return "federated"
+	default:
+		return strconv.Itoa(int(t))
+	}
+}
+
+// ParseShareType parses a share type name: user, group, link, email or federated
+func ParseShareType(name string) (ShareType, error) {
+	for _, t := range []ShareType{ShareTypeUser, ShareTypeGroup, ShareTypePublicLink, ShareTypeEmail, ShareTypeFederated} {
+		if strings.EqualFold(name, t.String()) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid share type %q: use user, group, link, email or federated", name)
+}
+
+// Share permissions, combined as a bit mask
+const (
+	PermissionRead   = 1
+	PermissionUpdate = 2
+	PermissionCreate = 4
+	PermissionDelete = 8
+	PermissionShare  = 16
+	PermissionAll    = 31
+)
+
+// permissionNames maps the names accepted by ParsePermissions to permission bits
+var permissionNames = map[string]int{
+	"read":   PermissionRead,
+	"update": PermissionUpdate,
+	"create": PermissionCreate,
+	"delete": PermissionDelete,
+	"share":  PermissionShare,
+	"all":    PermissionAll,
+	// Shorthands matching the choices of the web interface
+	"edit":   PermissionRead | PermissionUpdate | PermissionCreate | PermissionDelete,
+	"upload": PermissionCreate,
+}
+
+// ParsePermissions parses comma-separated permission names such as "read,update",
+// the shorthands "edit" and "upload" (a file drop), "all", or a bit mask
+func ParsePermissions(text string) (int, error) {
+	if mask, err := strconv.Atoi(text); err == nil {
+		if mask < 1 || mask > PermissionAll {
+			return 0, fmt.Errorf("invalid permissions %d: must be between 1 and %d", mask, PermissionAll)
+		}
+		return mask, nil
+	}
+
+	permissions := 0
+	for _, name := range strings.Split(text, ",") {
+		bits, ok := permissionNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("invalid permission %q: use read, update, create, delete, share, edit, upload or all", name)
+		}
+		permissions |= bits
+	}
+	return permissions, nil
+}
+
+// FormatPermissions returns the names of the permissions in a bit mask
+func FormatPermissions(permissions int) string {
+	var names []string
+	for _, name := range []string{"read", "update", "create", "delete", "share"} {
+		if permissions&permissionNames[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Share is a share of a file or folder
+type Share struct {
+	ID                   string    `json:"id"`
+	ShareType            ShareType `json:"share_type"`
+	Path                 string    `json:"path"`      // Relative to the user's files, with a leading slash
+	ItemType             string    `json:"item_type"` // "file" or "folder"
+	Permissions          int       `json:"permissions"`
+	ShareWith            string    `json:"share_with,omitempty"` // User, group or address the item is shared with
+	ShareWithDisplayName string    `json:"share_with_displayname,omitempty"`
+	Token                string    `json:"token,omitempty"`
+	URL                  string    `json:"url,omitempty"`        // Public link
+	Expiration           string    `json:"expiration,omitempty"` // Expiry date as "YYYY-MM-DD HH:MM:SS"
+	Label                string    `json:"label,omitempty"`
+}
+
+// ShareOptions describes a share to create
+type ShareOptions struct {
+	Path         string // Relative to the user's files
+	ShareType    ShareType
+	ShareWith    string    // User, group or address, not used for public links
+	Password     string    // Password of a public link
+	ExpireDate   time.Time // Zero for no expiry, or the server's default
+	Permissions  int       // Zero for the server's default
+	PublicUpload bool      // Allow uploads to a public link of a folder
+	Label        string    // Label of a public link
+}
+
+// CreateShare creates a share and returns it as created by the server
+func (c *Client) CreateShare(ctx context.Context, options ShareOptions) (*Share, error) {
+	params := url.Values{
+		"path":      {"/" + strings.Trim(options.Path, "/")},
+		"shareType": {strconv.Itoa(int(options.ShareType))},
+	}
+	if options.ShareWith != "" {
+		params.Set("shareWith", options.ShareWith)
+	}
+	if options.Password != "" {
+		params.Set("password", options.Password)
+	}
+	if !options.ExpireDate.IsZero() {
+		params.Set("expireDate", options.ExpireDate.Format("2006-01-02"))
+	}
+	if options.Permissions != 0 {
+		params.Set("permissions", strconv.Itoa(options.Permissions))
+	}
+	if options.PublicUpload {
+		params.Set("publicUpload", "true")
+	}
+	if options.Label != "" {
+		params.Set("label", options.Label)
+	}
+
+	var share Share
+	if err := c.do(ctx, http.MethodPost, sharesEndpoint, params, &share); err != nil {
+		return nil, fmt.Errorf("failed to share %s: %w", params.Get("path"), err)
+	}
+	share.normalize()
+	return &share, nil
+}
+
+// normalize clears the share_with field of public links, where Nextcloud reports
+// the password hash
+func (s *Share) normalize() {
+	if s.ShareType == ShareTypePublicLink {
+		s.ShareWith = ""
+		s.ShareWithDisplayName = ""
+	}
+}
+
+// ListShares lists the shares created by the user, only those of a file or folder
+// if path is not empty
+func (c *Client) ListShares(ctx context.Context, path string) ([]*Share, error) {
+	params := url.Values{}
+	if path != "" {
+		params.Set("path", "/"+strings.Trim(path, "/"))
+	}
+
+	var shares []*Share
+	if err := c.do(ctx, http.MethodGet, sharesEndpoint, params, &shares); err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	for _, share := range shares {
+		share.normalize()
+	}
+	return shares, nil
+}
+
+// DeleteShare deletes a share
+func (c *Client) DeleteShare(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodDelete, sharesEndpoint+"/"+url.PathEscape(id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete share %s: %w", id, err)
+	}
+	return nil
+}
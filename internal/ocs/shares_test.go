@@ -0,0 +1,142 @@
+package ocs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShareType(t *testing.T) {
+	for _, shareType := range []ShareType{ShareTypeUser, ShareTypeGroup, ShareTypePublicLink, ShareTypeEmail, ShareTypeFederated} {
+		parsed, err := ParseShareType(shareType.String())
+		require.NoError(t, err)
+		assert.Equal(t, shareType, parsed)
+	}
+
+	parsed, err := ParseShareType("Link")
+	require.NoError(t, err)
+	assert.Equal(t, ShareTypePublicLink, parsed)
+
+	_, err = ParseShareType("room")
+	assert.Error(t, err)
+}
+
+func TestParsePermissions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		wantErr  bool
+	}{
+		{input: "read", expected: PermissionRead},
+		{input: "read,update", expected: PermissionRead | PermissionUpdate},
+		{input: "Read, Share", expected: PermissionRead | PermissionShare},
+		{input: "edit", expected: 15},
+		{input: "upload", expected: PermissionCreate},
+		{input: "all", expected: PermissionAll},
+		{input: "17", expected: 17},
+		{input: "0", wantErr: true},
+		{input: "32", wantErr: true},
+		{input: "read,write", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			permissions, err := ParsePermissions(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, permissions)
+		})
+	}
+
+	assert.Equal(t, "read,update,create,delete", FormatPermissions(15))
+	assert.Equal(t, "read,share", FormatPermissions(17))
+}
+
+func TestClient_Shares(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv.URL, "alice", "secret")
+	ctx := context.Background()
+
+	require.NoError(t, srv.WriteFile("Documents/report.txt", []byte("hello"), time.Now()))
+	require.NoError(t, srv.Mkdir("Photos"))
+
+	// Public link with password, expiry and permissions
+	expires := time.Now().AddDate(0, 1, 0)
+	link, err := client.CreateShare(ctx, ShareOptions{
+		Path:        "Photos",
+		ShareType:   ShareTypePublicLink,
+		Password:    "correct horse",
+		ExpireDate:  expires,
+		Permissions: PermissionRead | PermissionCreate,
+		Label:       "Holiday",
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, link.ID)
+	assert.Equal(t, ShareTypePublicLink, link.ShareType)
+	assert.Equal(t, "/Photos", link.Path)
+	assert.Equal(t, "folder", link.ItemType)
+	assert.Equal(t, PermissionRead|PermissionCreate, link.Permissions)
+	assert.Equal(t, srv.URL+"/s/"+link.Token, link.URL)
+	assert.Equal(t, expires.Format("2006-01-02")+" 00:00:00", link.Expiration)
+	assert.Equal(t, "Holiday", link.Label)
+	assert.Empty(t, link.ShareWith)
+
+	// User and group shares with the server's default permissions
+	user, err := client.CreateShare(ctx, ShareOptions{Path: "/Documents/report.txt", ShareType: ShareTypeUser, ShareWith: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.ShareWith)
+	assert.Equal(t, "file", user.ItemType)
+	assert.Equal(t, 19, user.Permissions)
+
+	group, err := client.CreateShare(ctx, ShareOptions{Path: "Photos", ShareType: ShareTypeGroup, ShareWith: "family", Permissions: PermissionAll})
+	require.NoError(t, err)
+	assert.Equal(t, ShareTypeGroup, group.ShareType)
+	assert.Equal(t, PermissionAll, group.Permissions)
+
+	// Listing
+	shares, err := client.ListShares(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, shares, 3)
+	assert.Equal(t, []string{link.ID, user.ID, group.ID}, []string{shares[0].ID, shares[1].ID, shares[2].ID})
+
+	shares, err = client.ListShares(ctx, "Photos")
+	require.NoError(t, err)
+	assert.Len(t, shares, 2)
+
+	// Deleting
+	require.NoError(t, client.DeleteShare(ctx, user.ID))
+	assert.Equal(t, 2, srv.ShareCount())
+	err = client.DeleteShare(ctx, user.ID)
+	require.Error(t, err)
+	assert.True(t, ocsError(t, err).IsNotFoundError())
+
+	// Invalid shares
+	_, err = client.CreateShare(ctx, ShareOptions{Path: "missing", ShareType: ShareTypePublicLink})
+	assert.True(t, ocsError(t, err).IsNotFoundError())
+	_, err = client.CreateShare(ctx, ShareOptions{Path: "Photos", ShareType: ShareTypeUser})
+	assert.Error(t, err)
+	_, err = client.CreateShare(ctx, ShareOptions{Path: "Documents/report.txt", ShareType: ShareTypePublicLink, PublicUpload: true})
+	assert.Error(t, err)
+
+	// Enforced link passwords
+	srv.SetCapabilities("files_sharing", map[string]interface{}{
+		"api_enabled": true,
+		"public": map[string]interface{}{
+			"enabled":  true,
+			"password": map[string]interface{}{"enforced": true},
+		},
+	})
+	_, err = client.CreateShare(ctx, ShareOptions{Path: "Photos", ShareType: ShareTypePublicLink})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Passwords are enforced")
+	assert.Equal(t, 2, srv.ShareCount())
+}
@@ -18,6 +18,7 @@ type ResumeState struct {
 	TotalSize       int64     `json:"total_size"`
 	TransferredSize int64     `json:"transferred_size"`
 	Checksum        string    `json:"checksum,omitempty"`
+	ETag            string    `json:"etag,omitempty"` // Remote version the transferred data belongs to
 	LastModified    time.Time `json:"last_modified"`
 	Operation       string    `json:"operation"` // "upload" or "download"
 	CreatedAt       time.Time `json:"created_at"`
@@ -86,6 +87,12 @@ func (rm *ResumeManager) SetMaxAge(maxAge time.Duration) {
 
 // StartTransfer begins tracking a new transfer for potential resume
 func (rm *ResumeManager) StartTransfer(filePath, operation string, totalSize int64, lastModified time.Time) (*ResumeState, error) {
+	return rm.StartTransferWithETag(filePath, operation, totalSize, lastModified, "")
+}
+
+// StartTransferWithETag begins tracking a transfer of a specific remote version.
+// Progress of an earlier attempt is only kept if the ETag is unchanged.
+func (rm *ResumeManager) StartTransferWithETag(filePath, operation string, totalSize int64, lastModified time.Time, etag string) (*ResumeState, error) {
 	if !rm.enabled {
 		return nil, nil
 	}
@@ -99,6 +106,7 @@ func (rm *ResumeManager) StartTransfer(filePath, operation string, totalSize int
 		TotalSize:       totalSize,
 		TransferredSize: 0,
 		LastModified:    lastModified,
+		ETag:            etag,
 		Operation:       operation,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
@@ -109,6 +117,7 @@ func (rm *ResumeManager) StartTransfer(filePath, operation string, totalSize int
 		// Validate that the file hasn't changed
 		if existingState.TotalSize == totalSize &&
 			existingState.LastModified.Equal(lastModified) &&
+			existingState.ETag == etag &&
 			existingState.Operation == operation {
 			state.TransferredSize = existingState.TransferredSize
 			state.CreatedAt = existingState.CreatedAt
@@ -259,3 +259,24 @@ func TestSplitOperation(t *testing.T) {
 		})
 	}
 }
+
+func TestResumeManager_StartTransferWithETag(t *testing.T) {
+	rm, err := NewResumeManager(t.TempDir())
+	require.NoError(t, err)
+
+	modified := time.Now().Truncate(time.Second)
+	_, err = rm.StartTransferWithETag("/test/big.bin", "download", 1000, modified, `"v1"`)
+	require.NoError(t, err)
+	require.NoError(t, rm.UpdateProgress("/test/big.bin", 400, ""))
+
+	// The same version continues where it stopped
+	state, err := rm.StartTransferWithETag("/test/big.bin", "download", 1000, modified, `"v1"`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(400), state.TransferredSize)
+	assert.Equal(t, `"v1"`, state.ETag)
+
+	// A new version starts over
+	state, err = rm.StartTransferWithETag("/test/big.bin", "download", 1000, modified, `"v2"`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), state.TransferredSize)
+}
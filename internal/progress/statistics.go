@@ -31,7 +31,7 @@ type Statistics struct {
 
 	// Performance metrics
 	ThroughputBps float64 `json:"throughput_bps"` // bytes per second
-	peakBps       float64 `json:"peak_bps"`       // peak bytes per second
+	peakBps       float64 // peak bytes per second
 
 	// Current operation tracking
 	currentOperation string
@@ -285,6 +285,25 @@ func (s *Statistics) Copy() *Statistics {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	copy := *s
-	return &copy
+	return &Statistics{
+		StartTime:        s.StartTime,
+		EndTime:          s.EndTime,
+		Duration:         s.Duration,
+		TotalFiles:       s.TotalFiles,
+		ProcessedFiles:   s.ProcessedFiles,
+		TotalBytes:       s.TotalBytes,
+		TransferredBytes: s.TransferredBytes,
+		Uploads:          s.Uploads,
+		Downloads:        s.Downloads,
+		Creates:          s.Creates,
+		Updates:          s.Updates,
+		Deletes:          s.Deletes,
+		Skips:            s.Skips,
+		Conflicts:        s.Conflicts,
+		Errors:           s.Errors,
+		ThroughputBps:    s.ThroughputBps,
+		peakBps:          s.peakBps,
+		currentOperation: s.currentOperation,
+		operationStart:   s.operationStart,
+	}
 }
@@ -3,6 +3,7 @@ package progress
 import (
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 	stdsync "sync"
 	"time"
@@ -15,6 +16,7 @@ type CombinedProgressTracker struct {
 	statistics   *Statistics
 	resumeMgr    *ResumeManager
 	currentState *ResumeState
+	workers      map[int]*WorkerStatus
 
 	mu      stdsync.RWMutex
 	enabled bool
@@ -55,6 +57,7 @@ func NewCombinedProgressTracker(config *Config, resumeDir string) (*CombinedProg
 	pt := &CombinedProgressTracker{
 		enabled:        true,
 		verbose:        config.Verbose,
+		workers:        make(map[int]*WorkerStatus),
 		updateInterval: config.UpdateInterval,
 	}
 
@@ -312,6 +315,124 @@ func (pt *CombinedProgressTracker) GetProgress() float64 {
 	return pt.statistics.GetProgress()
 }
 
+// WorkerStatus is a snapshot of the transfer a parallel worker is currently running
+type WorkerStatus struct {
+	ID          int    `json:"id"`
+	Operation   string `json:"operation"`
+	Transferred int64  `json:"transferred"`
+	Total       int64  `json:"total"`
+}
+
+// WorkerTracker reports the progress of a single parallel worker into the
+// shared statistics of its parent tracker
+type WorkerTracker struct {
+	parent *CombinedProgressTracker
+	id     int
+}
+
+// Worker returns the progress tracker for the worker with the given ID
+func (pt *CombinedProgressTracker) Worker(id int) *WorkerTracker {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if _, exists := pt.workers[id]; !exists {
+		pt.workers[id] = &WorkerStatus{ID: id}
+	}
+
+	return &WorkerTracker{parent: pt, id: id}
+}
+
+// ActiveWorkers returns the status of all workers that are currently busy
+func (pt *CombinedProgressTracker) ActiveWorkers() []WorkerStatus {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	active := make([]WorkerStatus, 0, len(pt.workers))
+	for _, status := range pt.workers {
+		if status.Operation != "" {
+			active = append(active, *status)
+		}
+	}
+
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+	return active
+}
+
+// Start implements sync.ProgressTracker interface
+func (wt *WorkerTracker) Start(total int64) {
+	wt.parent.mu.Lock()
+	defer wt.parent.mu.Unlock()
+
+	status := wt.parent.workers[wt.id]
+	status.Total = total
+	status.Transferred = 0
+}
+
+// Update implements sync.ProgressTracker interface
+func (wt *WorkerTracker) Update(current int64) {
+	wt.parent.mu.Lock()
+	defer wt.parent.mu.Unlock()
+
+	if !wt.parent.enabled {
+		return
+	}
+
+	status := wt.parent.workers[wt.id]
+	wt.parent.statistics.AddBytesTransferred(current - status.Transferred)
+	status.Transferred = current
+}
+
+// Finish implements sync.ProgressTracker interface
+func (wt *WorkerTracker) Finish() {
+	wt.parent.mu.Lock()
+	defer wt.parent.mu.Unlock()
+
+	status := wt.parent.workers[wt.id]
+
+	if wt.parent.enabled {
+		// Bytes were already counted by Update, only the operation is recorded here
+		switch strings.ToLower(splitOperation(status.Operation)[0]) {
+		case "upload":
+			wt.parent.statistics.RecordUpload(0)
+		case "download":
+			wt.parent.statistics.RecordDownload(0)
+		case "create":
+			wt.parent.statistics.RecordCreate(0)
+		case "delete":
+			wt.parent.statistics.RecordDelete()
+		default:
+			wt.parent.statistics.RecordUpdate(0)
+		}
+	}
+
+	status.Operation = ""
+	status.Transferred = 0
+	status.Total = 0
+}
+
+// SetOperation implements sync.ProgressTracker interface
+func (wt *WorkerTracker) SetOperation(operation string) {
+	wt.parent.mu.Lock()
+	defer wt.parent.mu.Unlock()
+
+	wt.parent.workers[wt.id].Operation = operation
+
+	if wt.parent.enabled && wt.parent.verbose {
+		fmt.Printf("[worker %d] %s\n", wt.id, operation)
+	}
+}
+
+// Error implements sync.ProgressTracker interface
+func (wt *WorkerTracker) Error(err error) {
+	wt.parent.mu.Lock()
+	defer wt.parent.mu.Unlock()
+
+	if wt.parent.enabled {
+		wt.parent.statistics.RecordError()
+	}
+	wt.parent.workers[wt.id].Operation = ""
+}
+
 // Helper functions
 
 // splitOperation splits an operation string into type and path
@@ -367,3 +367,39 @@ func TestCombinedProgressTracker(t *testing.T) {
 	err = pt.Cleanup()
 	require.NoError(t, err)
 }
+
+func TestCombinedProgressTracker_Workers(t *testing.T) {
+	config := DefaultConfig()
+	config.ShowStatistics = false
+	config.ResumeEnabled = false
+
+	pt, err := NewCombinedProgressTracker(config, t.TempDir())
+	require.NoError(t, err)
+
+	first := pt.Worker(0)
+	second := pt.Worker(1)
+
+	first.SetOperation("CREATE a.txt")
+	first.Start(100)
+	first.Update(60)
+
+	second.SetOperation("UPDATE b.txt")
+	second.Start(50)
+	second.Update(50)
+
+	active := pt.ActiveWorkers()
+	require.Len(t, active, 2)
+	assert.Equal(t, "CREATE a.txt", active[0].Operation)
+	assert.Equal(t, int64(60), active[0].Transferred)
+	assert.Equal(t, int64(50), active[1].Transferred)
+
+	first.Update(100)
+	first.Finish()
+	second.Error(assert.AnError)
+
+	stats := pt.GetStatistics()
+	assert.Equal(t, int64(150), stats.TransferredBytes)
+	assert.Equal(t, 1, stats.Creates)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Empty(t, pt.ActiveWorkers())
+}
@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// commandStore gets the app password from a password command such as
+// "pass show nextcloud" or "op read op://Private/Nextcloud/password". The command
+// owns the secret, so it cannot be stored or deleted through the store.
+type commandStore struct {
+	command string
+}
+
+// Get implements Store.Get. The first line of the output of the command is the
+// app password, as with pass which prints further details below it.
+func (s *commandStore) Get(name string) (string, error) {
+	if name != AppPassword {
+		return "", fmt.Errorf("a password command only provides the app password, not %s", name)
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", s.command)
+	} else {
+		cmd = exec.Command("sh", "-c", s.command)
+	}
+
+	// Password managers may ask to be unlocked
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("password command %q failed: %w", s.command, err)
+	}
+
+	secret := strings.TrimRight(strings.SplitN(stdout.String(), "\n", 2)[0], "\r")
+	if secret == "" {
+		return "", fmt.Errorf("password command %q printed no password", s.command)
+	}
+	return secret, nil
+}
+
+// Set implements Store.Set
+func (s *commandStore) Set(name, secret string) error {
+	return fmt.Errorf("cannot store the %s through password command %q, store it in the password manager instead", name, s.command)
+}
+
+// Delete implements Store.Delete, the secret stays in the password manager
+func (s *commandStore) Delete(name string) error {
+	return nil
+}
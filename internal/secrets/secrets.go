@@ -0,0 +1,164 @@
+// Package secrets keeps the app passwords, OAuth2 client secrets and refresh
+// tokens of servers in the store selected for each server: encrypted in the
+// configuration file, in the Secret Service of the desktop, behind a password
+// command or encrypted with a passphrase.
+package secrets
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/phaus/nextcloud-sync/internal/config"
+)
+
+// Names of the secrets of a server
+const (
+	AppPassword        = "app_password"
+	OAuth2ClientSecret = "oauth2_client_secret"
+	OAuth2RefreshToken = "oauth2_refresh_token"
+)
+
+// Store keeps the secrets of a server
+type Store interface {
+	// Get returns a secret of the server
+	Get(name string) (string, error)
+
+	// Set stores a secret of the server, replacing an earlier one. Stores that keep
+	// secrets in the configuration update the server, which has to be saved.
+	Set(name, secret string) error
+
+	// Delete removes a secret of the server from the store
+	Delete(name string) error
+}
+
+// PassphraseFunc asks the user for the passphrase of a server
+type PassphraseFunc func(server *config.Server) (string, error)
+
+// Open returns the store selected for a server. passphrase is called for
+// passphrase stores whose passphrase variable is not set, it may be nil.
+func Open(server *config.Server, passphrase PassphraseFunc) (Store, error) {
+	if err := config.ValidateSecretStore(*server); err != nil {
+		return nil, fmt.Errorf("invalid secret store: %w", err)
+	}
+
+	switch server.SecretStoreType() {
+	case config.SecretStoreSecretService:
+		return newSecretServiceStore(server)
+	case config.SecretStoreCommand:
+		return &commandStore{command: server.SecretStore.PasswordCommand}, nil
+	case config.SecretStorePassphrase:
+		env := server.SecretStore.PassphraseEnv
+		if env == "" {
+			env = config.DefaultPassphraseEnv
+		}
+		value := os.Getenv(env)
+		if value == "" {
+			if passphrase == nil {
+				return nil, fmt.Errorf("the secrets of server %s are protected by a passphrase, set %s", server.URL, env)
+			}
+			var err error
+			value, err = passphrase(server)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get passphrase: %w", err)
+			}
+			if value == "" {
+				return nil, fmt.Errorf("passphrase cannot be empty")
+			}
+		}
+		return &configStore{server: server, passphrase: value}, nil
+	default:
+		return &configStore{server: server}, nil
+	}
+}
+
+// Names returns the names of the secrets a server needs
+func Names(server *config.Server) []string {
+	if server.OAuth2 != nil {
+		return []string{OAuth2ClientSecret, OAuth2RefreshToken}
+	}
+	return []string{AppPassword}
+}
+
+// KeptInConfig reports whether the secrets of a server are part of the configuration
+func KeptInConfig(server *config.Server) bool {
+	storeType := server.SecretStoreType()
+	return storeType == config.SecretStoreConfig || storeType == config.SecretStorePassphrase
+}
+
+// ClearConfig removes the encrypted secrets from the configuration of a server
+func ClearConfig(server *config.Server) {
+	server.AppPassword = config.EncryptedData{}
+	if server.OAuth2 != nil {
+		server.OAuth2.ClientSecret = config.EncryptedData{}
+		server.OAuth2.RefreshToken = config.EncryptedData{}
+	}
+}
+
+// encryptedField returns the field of the configuration of a server that holds an
+// encrypted secret
+func encryptedField(server *config.Server, name string) (*config.EncryptedData, error) {
+	switch name {
+	case AppPassword:
+		return &server.AppPassword, nil
+	case OAuth2ClientSecret, OAuth2RefreshToken:
+		if server.OAuth2 == nil {
+			return nil, fmt.Errorf("server %s does not use OAuth2", server.URL)
+		}
+		if name == OAuth2ClientSecret {
+			return &server.OAuth2.ClientSecret, nil
+		}
+		return &server.OAuth2.RefreshToken, nil
+	default:
+		return nil, fmt.Errorf("unknown secret %q", name)
+	}
+}
+
+// configStore keeps secrets in the configuration, encrypted with a key derived
+// from the machine or, if set, from a passphrase
+type configStore struct {
+	server     *config.Server
+	passphrase string
+}
+
+// Get implements Store.Get
+func (s *configStore) Get(name string) (string, error) {
+	field, err := encryptedField(s.server, name)
+	if err != nil {
+		return "", err
+	}
+	if s.passphrase != "" {
+		return config.DecryptWithPassphrase(*field, s.passphrase)
+	}
+	return config.DecryptPassword(*field)
+}
+
+// Set implements Store.Set
+func (s *configStore) Set(name, secret string) error {
+	field, err := encryptedField(s.server, name)
+	if err != nil {
+		return err
+	}
+
+	var encrypted config.EncryptedData
+	if s.passphrase != "" {
+		encrypted, err = config.EncryptWithPassphrase(secret, s.passphrase)
+	} else {
+		encrypted, err = config.EncryptPassword(secret)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", name, err)
+	}
+
+	*field = encrypted
+	return nil
+}
+
+// Delete implements Store.Delete
+func (s *configStore) Delete(name string) error {
+	field, err := encryptedField(s.server, name)
+	if err != nil {
+		return err
+	}
+	*field = config.EncryptedData{}
+	return nil
+}
@@ -0,0 +1,204 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/phaus/nextcloud-sync/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigStore(t *testing.T) {
+	server := &config.Server{URL: "https://cloud.example.com", Username: "alice"}
+	assert.Equal(t, []string{AppPassword}, Names(server))
+	assert.True(t, KeptInConfig(server))
+
+	store, err := Open(server, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(AppPassword, "app-password"))
+	assert.Equal(t, config.EncryptionAlgorithm, server.AppPassword.Algorithm)
+	assert.NoError(t, config.ValidateServer("default", *server))
+
+	secret, err := store.Get(AppPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "app-password", secret)
+
+	_, err = store.Get(OAuth2RefreshToken)
+	assert.Error(t, err)
+	_, err = store.Get("password")
+	assert.Error(t, err)
+
+	require.NoError(t, store.Delete(AppPassword))
+	assert.Empty(t, server.AppPassword.Encrypted)
+
+	// OAuth2 secrets
+	server.OAuth2 = &config.OAuth2Settings{ClientID: "client", RedirectURL: "http://localhost:8765/callback"}
+	assert.Equal(t, []string{OAuth2ClientSecret, OAuth2RefreshToken}, Names(server))
+	require.NoError(t, store.Set(OAuth2ClientSecret, "client-secret"))
+	require.NoError(t, store.Set(OAuth2RefreshToken, "refresh-token"))
+	secret, err = store.Get(OAuth2RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "refresh-token", secret)
+
+	ClearConfig(server)
+	assert.Empty(t, server.OAuth2.ClientSecret.Encrypted)
+	assert.Empty(t, server.OAuth2.RefreshToken.Encrypted)
+}
+
+func TestPassphraseStore(t *testing.T) {
+	server := &config.Server{
+		URL:         "https://cloud.example.com",
+		Username:    "alice",
+		SecretStore: &config.SecretStore{Type: config.SecretStorePassphrase},
+	}
+	assert.True(t, KeptInConfig(server))
+
+	// Without the variable and a prompt there is no passphrase
+	t.Setenv(config.DefaultPassphraseEnv, "")
+	_, err := Open(server, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), config.DefaultPassphraseEnv)
+
+	t.Setenv(config.DefaultPassphraseEnv, "correct horse")
+	store, err := Open(server, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(AppPassword, "app-password"))
+	assert.Equal(t, config.PassphraseEncryptionAlgorithm, server.AppPassword.Algorithm)
+
+	// The machine key alone does not decrypt it
+	_, err = config.DecryptPassword(server.AppPassword)
+	assert.Error(t, err)
+
+	// The prompt is used if the variable is not set
+	server.SecretStore.PassphraseEnv = "NEXTCLOUD_SYNC_TEST_PASSPHRASE"
+	prompts := 0
+	prompt := func(*config.Server) (string, error) {
+		prompts++
+		return "correct horse", nil
+	}
+	store, err = Open(server, prompt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, prompts)
+	secret, err := store.Get(AppPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "app-password", secret)
+
+	// A wrong passphrase fails
+	t.Setenv("NEXTCLOUD_SYNC_TEST_PASSPHRASE", "battery staple")
+	store, err = Open(server, prompt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, prompts)
+	_, err = store.Get(AppPassword)
+	assert.Error(t, err)
+}
+
+func TestCommandStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("password commands are run by sh in this test")
+	}
+
+	server := &config.Server{
+		URL:         "https://cloud.example.com",
+		Username:    "alice",
+		SecretStore: &config.SecretStore{Type: config.SecretStoreCommand, PasswordCommand: `printf 'app-password\nlogin: alice\n'`},
+	}
+	assert.False(t, KeptInConfig(server))
+	assert.NoError(t, config.ValidateServer("default", *server))
+
+	store, err := Open(server, nil)
+	require.NoError(t, err)
+	secret, err := store.Get(AppPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "app-password", secret)
+
+	assert.Error(t, store.Set(AppPassword, "other"))
+	assert.NoError(t, store.Delete(AppPassword))
+	_, err = store.Get(OAuth2RefreshToken)
+	assert.Error(t, err)
+
+	server.SecretStore.PasswordCommand = "exit 3"
+	store, err = Open(server, nil)
+	require.NoError(t, err)
+	_, err = store.Get(AppPassword)
+	assert.Error(t, err)
+
+	server.SecretStore.PasswordCommand = "true"
+	store, err = Open(server, nil)
+	require.NoError(t, err)
+	_, err = store.Get(AppPassword)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no password")
+
+	// OAuth2 refresh tokens change and cannot be kept by a command
+	server.OAuth2 = &config.OAuth2Settings{ClientID: "client"}
+	_, err = Open(server, nil)
+	assert.Error(t, err)
+}
+
+// fakeSecretTool is a stand-in for secret-tool that keeps secrets in files named
+// after their attributes
+const fakeSecretTool = `#!/bin/sh
+command=$1
+shift
+if [ "$command" = store ]; then
+	shift
+fi
+file="$STORE_DIR/$(echo "$*" | tr ' /:' '___')"
+case "$command" in
+store) cat > "$file" ;;
+lookup) [ -f "$file" ] && cat "$file" || exit 1 ;;
+clear) rm -f "$file" ;;
+*) echo "unknown command $command" >&2; exit 2 ;;
+esac
+`
+
+func TestSecretServiceStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("secret-tool is not available on Windows")
+	}
+
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "secret-tool")
+	require.NoError(t, os.WriteFile(tool, []byte(fakeSecretTool), 0755))
+	t.Setenv("STORE_DIR", dir)
+	defer func(previous string) { secretTool = previous }(secretTool)
+	secretTool = tool
+
+	server := &config.Server{
+		URL:         "https://cloud.example.com",
+		Username:    "alice",
+		SecretStore: &config.SecretStore{Type: config.SecretStoreSecretService},
+	}
+	assert.False(t, KeptInConfig(server))
+
+	store, err := Open(server, nil)
+	require.NoError(t, err)
+	_, err = store.Get(AppPassword)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	require.NoError(t, store.Set(AppPassword, "app-password"))
+	assert.Empty(t, server.AppPassword.Encrypted)
+	secret, err := store.Get(AppPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "app-password", secret)
+
+	// Secrets are kept per user
+	other, err := Open(&config.Server{URL: server.URL, Username: "bob", SecretStore: server.SecretStore}, nil)
+	require.NoError(t, err)
+	_, err = other.Get(AppPassword)
+	assert.Error(t, err)
+
+	require.NoError(t, store.Delete(AppPassword))
+	_, err = store.Get(AppPassword)
+	assert.Error(t, err)
+
+	// Without secret-tool the store cannot be opened
+	secretTool = filepath.Join(dir, "missing-secret-tool")
+	_, err = Open(server, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "libsecret-tools")
+}
@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/phaus/nextcloud-sync/internal/config"
+)
+
+// secretTool is the libsecret command line tool through which the store talks to
+// the Secret Service D-Bus API
+var secretTool = "secret-tool"
+
+// secretServiceStore keeps secrets in the Secret Service of the desktop, such as
+// GNOME Keyring or KWallet. Secrets are looked up by server, username and name.
+type secretServiceStore struct {
+	server *config.Server
+	tool   string // Path of secret-tool
+}
+
+// newSecretServiceStore opens the Secret Service store of a server. The store
+// needs secret-tool, which is packaged separately from the keyring itself.
+func newSecretServiceStore(server *config.Server) (*secretServiceStore, error) {
+	tool, err := exec.LookPath(secretTool)
+	if err != nil {
+		return nil, fmt.Errorf("the secret_service store talks to the Secret Service through %s, install it with libsecret-tools (Debian, Ubuntu) or libsecret (Fedora, Arch): %w", secretTool, err)
+	}
+	return &secretServiceStore{server: server, tool: tool}, nil
+}
+
+// attributes returns the attributes that identify a secret in the Secret Service
+func (s *secretServiceStore) attributes(name string) []string {
+	return []string{"service", "nextcloud-sync", "server", s.server.URL, "username", s.server.Username, "secret", name}
+}
+
+// Get implements Store.Get
+func (s *secretServiceStore) Get(name string) (string, error) {
+	out, err := s.run(nil, append([]string{"lookup"}, s.attributes(name)...)...)
+	if err != nil {
+		return "", err
+	}
+
+	// secret-tool fails without a message if no secret matches
+	secret := strings.TrimSuffix(out, "\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s of %s on %s not found in the Secret Service", name, s.server.Username, s.server.URL)
+	}
+	return secret, nil
+}
+
+// Set implements Store.Set
+func (s *secretServiceStore) Set(name, secret string) error {
+	label := fmt.Sprintf("--label=nextcloud-sync %s of %s on %s", name, s.server.Username, s.server.URL)
+	args := append([]string{"store", label}, s.attributes(name)...)
+	if _, err := s.run(strings.NewReader(secret), args...); err != nil {
+		return fmt.Errorf("failed to store %s in the Secret Service: %w", name, err)
+	}
+	return nil
+}
+
+// Delete implements Store.Delete
+func (s *secretServiceStore) Delete(name string) error {
+	if _, err := s.run(nil, append([]string{"clear"}, s.attributes(name)...)...); err != nil {
+		return fmt.Errorf("failed to delete %s from the Secret Service: %w", name, err)
+	}
+	return nil
+}
+
+// run runs secret-tool and returns its output. A failure without a message is not
+// an error, secret-tool reports missing secrets that way.
+func (s *secretServiceStore) run(stdin io.Reader, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.tool, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s: %s", secretTool, message)
+		}
+		if _, exited := err.(*exec.ExitError); !exited {
+			return "", fmt.Errorf("%s failed: %w", secretTool, err)
+		}
+	}
+	return stdout.String(), nil
+}
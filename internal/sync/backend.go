@@ -0,0 +1,842 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
+	"github.com/phaus/nextcloud-sync/internal/progress"
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+)
+
+// Backend is a storage location that files are synchronized from or to. Paths are
+// slash separated and relative to the root of the backend, "" is the root itself.
+type Backend interface {
+	// List calls fn for every file and directory below dir, in no particular order.
+	// If fn returns fs.SkipDir for a directory, the backend may leave out its contents.
+	List(ctx context.Context, dir string, fn func(meta *FileMetadata) error) error
+
+	// Stat returns the metadata of a file or directory, the error wraps
+	// fs.ErrNotExist if there is none
+	Stat(ctx context.Context, path string) (*FileMetadata, error)
+
+	// Open opens a file for reading
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// Create writes a file with the given content, creating missing parent
+	// directories and replacing an existing file. A non-zero modified time is
+	// kept as modification time where the storage allows it.
+	Create(ctx context.Context, path string, content io.Reader, size int64, modified time.Time) error
+
+	// Mkdir creates a directory and any missing parents
+	Mkdir(ctx context.Context, path string) error
+
+	// Remove deletes a file or a directory with its contents, missing paths are not an error
+	Remove(ctx context.Context, path string) error
+
+	// Rename moves a file or directory, creating missing parent directories of the new path
+	Rename(ctx context.Context, oldPath, newPath string) error
+}
+
+// Hasher is implemented by backends that can compute the SHA-256 of a file's content
+type Hasher interface {
+	// Hash returns the hex encoded SHA-256 of a file
+	Hash(ctx context.Context, path string) (string, error)
+}
+
+// RangeOpener is implemented by backends that can open a file at an offset
+type RangeOpener interface {
+	// OpenRange opens a file for reading from offset. A non-empty etag is the version
+	// the file must still have, otherwise it is read from the start. It returns the
+	// offset the content starts at.
+	OpenRange(ctx context.Context, path string, offset int64, etag string) (io.ReadCloser, int64, error)
+}
+
+// ResumableCreator is implemented by backends that keep the written part of a file
+// when writing it is interrupted, so that a later attempt can continue from there
+type ResumableCreator interface {
+	// CreateResumable writes the file of a transfer like Create, continuing an
+	// interrupted earlier attempt to write the same content
+	CreateResumable(ctx context.Context, path string, transfer *Transfer) error
+}
+
+// Transfer is a file that is copied to a ResumableCreator
+type Transfer struct {
+	Size     int64
+	Modified time.Time
+
+	// ETag is the version of the source file, empty if the source has none
+	ETag string
+
+	// Checksum returns the hex encoded SHA-256 of the content, it is nil if the
+	// source cannot tell
+	Checksum func() (string, error)
+
+	// StoreChecksum asks the target to keep the checksum with the file where it can
+	StoreChecksum bool
+
+	// Resumes records interrupted transfers, without it nothing is resumed
+	Resumes *progress.ResumeManager
+
+	// Open returns the content from offset on and the offset it actually starts at,
+	// which is 0 if the source cannot skip ahead. It is called at most once.
+	Open func(offset int64) (io.Reader, int64, error)
+
+	// Verify fails if the source changed while it was read, it is nil if the
+	// source cannot tell. The target calls it once all content is written.
+	Verify func() error
+}
+
+// verify calls Verify if the source can tell whether it changed
+func (t *Transfer) verify() error {
+	if t.Verify == nil {
+		return nil
+	}
+	return t.Verify()
+}
+
+// transferReader opens the content of a transfer on the first read, at the offset it
+// was seeked to before. This lets an upload skip what the server already has
+// without reading it from the source.
+type transferReader struct {
+	transfer *Transfer
+	offset   int64
+	content  io.Reader
+}
+
+func (r *transferReader) Read(p []byte) (int, error) {
+	if r.content == nil {
+		content, start, err := r.transfer.Open(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(io.Discard, content, r.offset-start); err != nil {
+			return 0, fmt.Errorf("failed to skip to offset %d: %w", r.offset, err)
+		}
+		r.content = content
+	}
+	return r.content.Read(p)
+}
+
+// Seek implements io.Seeker for absolute offsets before the first read
+func (r *transferReader) Seek(offset int64, whence int) (int64, error) {
+	if r.content != nil || whence != io.SeekStart || offset < 0 {
+		return 0, fmt.Errorf("cannot seek transfer content to %d once it is read", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// LocalBackend stores files in a local directory
+type LocalBackend struct {
+	root      string
+	checksums *ChecksumCache
+}
+
+// NewLocalBackend creates a backend for the local directory root
+func NewLocalBackend(root string) *LocalBackend {
+	return &LocalBackend{root: root}
+}
+
+// SetChecksumCache keeps the checksums computed by Hash in cache
+func (b *LocalBackend) SetChecksumCache(cache *ChecksumCache) {
+	b.checksums = cache
+}
+
+// path returns the local path of a backend path
+func (b *LocalBackend) path(p string) string {
+	return filepath.Join(b.root, filepath.FromSlash(p))
+}
+
+// List implements Backend.List
+func (b *LocalBackend) List(ctx context.Context, dir string, fn func(meta *FileMetadata) error) error {
+	dirPath := b.path(dir)
+	return filepath.Walk(dirPath, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if localPath == dirPath || (!info.IsDir() && !info.Mode().IsRegular()) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dirPath, localPath)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path for %s: %w", localPath, err)
+		}
+
+		return fn(localFileMetadata(path.Join(dir, filepath.ToSlash(relPath)), info))
+	})
+}
+
+// Stat implements Backend.Stat
+func (b *LocalBackend) Stat(ctx context.Context, p string) (*FileMetadata, error) {
+	info, err := os.Stat(b.path(p))
+	if err != nil {
+		return nil, err
+	}
+	return localFileMetadata(p, info), nil
+}
+
+// Hash implements Hasher, files are only hashed again when they changed
+// since they were last hashed
+func (b *LocalBackend) Hash(ctx context.Context, p string) (string, error) {
+	localPath := b.path(p)
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	return b.checksums.Checksum(localPath, info)
+}
+
+// Open implements Backend.Open
+func (b *LocalBackend) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	return os.Open(b.path(p))
+}
+
+// OpenRange implements RangeOpener, local files have no ETag to check
+func (b *LocalBackend) OpenRange(ctx context.Context, p string, offset int64, etag string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(b.path(p))
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to seek %s: %w", b.path(p), err)
+	}
+	return file, offset, nil
+}
+
+// Create implements Backend.Create. The content is written to a partial file
+// first, so an interrupted write never leaves a truncated file behind.
+func (b *LocalBackend) Create(ctx context.Context, p string, content io.Reader, size int64, modified time.Time) error {
+	localPath := b.path(p)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", localPath, err)
+	}
+
+	partPath := localPath + partialFileSuffix
+	file, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", partPath, err)
+	}
+
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		os.Remove(partPath)
+		return fmt.Errorf("failed to write %s: %w", partPath, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to write %s: %w", partPath, err)
+	}
+
+	if !modified.IsZero() {
+		if err := os.Chtimes(partPath, modified, modified); err != nil {
+			os.Remove(partPath)
+			return fmt.Errorf("failed to set modification time of %s: %w", partPath, err)
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to move %s into place: %w", localPath, err)
+	}
+
+	return nil
+}
+
+// CreateResumable implements ResumableCreator. Like Create, the content is written to
+// a partial file first. With resume state, the partial file of an interrupted write is
+// kept and continued by the next attempt, as long as the source has the same ETag.
+func (b *LocalBackend) CreateResumable(ctx context.Context, p string, transfer *Transfer) error {
+	localPath := b.path(p)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", localPath, err)
+	}
+
+	partPath := localPath + partialFileSuffix
+	resumeKey := resumeStateKey(localPath)
+	resumes := transfer.Resumes
+
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create partial file %s: %w", partPath, err)
+	}
+	defer file.Close()
+
+	discard := func() {
+		file.Close()
+		os.Remove(partPath)
+		if resumes != nil {
+			_ = resumes.CompleteTransfer(resumeKey)
+		}
+	}
+
+	// Continue an interrupted write of the same source version
+	var offset int64
+	if resumes != nil {
+		state, err := resumes.StartTransferWithETag(resumeKey, "download", transfer.Size, transfer.Modified, transfer.ETag)
+		if err != nil {
+			return err
+		}
+		if state != nil && transfer.ETag != "" {
+			offset = state.TransferredSize
+		}
+	}
+
+	content, offset, err := b.openPartial(file, transfer, offset)
+	if err != nil {
+		if resumes == nil {
+			discard()
+		}
+		return err
+	}
+
+	checkpoints := &checkpointWriter{
+		file:    file,
+		written: offset,
+		next:    offset + resumeCheckpointInterval,
+		checkpoint: func(written int64) error {
+			if resumes == nil {
+				return nil
+			}
+			return resumes.UpdateProgress(resumeKey, written, "")
+		},
+	}
+
+	// The checksum cache learns the checksum of the written file, including the part
+	// that is already on disk
+	var writer io.Writer = checkpoints
+	var hasher hash.Hash
+	if b.checksums != nil {
+		hasher = sha256.New()
+		if err := hashPrefix(hasher, file, offset); err != nil {
+			return fmt.Errorf("failed to read partial file %s: %w", partPath, err)
+		}
+		writer = io.MultiWriter(checkpoints, hasher)
+	}
+
+	if _, err := io.Copy(writer, content); err != nil {
+		// Keep what was written for the next attempt
+		if resumes != nil {
+			if syncErr := file.Sync(); syncErr == nil {
+				_ = resumes.UpdateProgress(resumeKey, checkpoints.written, "")
+			}
+		} else {
+			discard()
+		}
+		return fmt.Errorf("failed to write %s: %w", partPath, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		discard()
+		return fmt.Errorf("failed to flush %s: %w", partPath, err)
+	}
+	if err := file.Close(); err != nil {
+		discard()
+		return fmt.Errorf("failed to close %s: %w", partPath, err)
+	}
+	if err := transfer.verify(); err != nil {
+		discard()
+		return err
+	}
+	if transfer.Size > 0 && checkpoints.written != transfer.Size {
+		discard()
+		return fmt.Errorf("wrote %d of %d bytes to %s", checkpoints.written, transfer.Size, partPath)
+	}
+
+	if !transfer.Modified.IsZero() {
+		if err := os.Chtimes(partPath, transfer.Modified, transfer.Modified); err != nil {
+			discard()
+			return fmt.Errorf("failed to set modification time of %s: %w", partPath, err)
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", localPath, err)
+	}
+
+	if resumes != nil {
+		if err := resumes.CompleteTransfer(resumeKey); err != nil {
+			return err
+		}
+	}
+
+	// The written file does not need to be hashed again by the next sync
+	if hasher != nil {
+		if info, err := os.Stat(localPath); err == nil {
+			b.checksums.Put(localPath, info, hex.EncodeToString(hasher.Sum(nil)))
+		}
+	}
+
+	return nil
+}
+
+// openPartial opens the content of a transfer to continue the partial file at offset,
+// as far as the file holds that much data and the source can skip ahead. It returns
+// the offset the content starts at, with the partial file truncated and positioned there.
+func (b *LocalBackend) openPartial(file *os.File, transfer *Transfer, offset int64) (io.Reader, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat partial file: %w", err)
+	}
+	if info.Size() < offset {
+		offset = info.Size()
+	}
+
+	content, offset, err := transfer.Open(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return nil, 0, fmt.Errorf("failed to truncate partial file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("failed to seek partial file: %w", err)
+	}
+
+	return content, offset, nil
+}
+
+// hashPrefix hashes the first n bytes of a file and leaves it positioned after them
+func hashPrefix(hasher hash.Hash, file *os.File, n int64) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(hasher, file, n)
+	return err
+}
+
+// Mkdir implements Backend.Mkdir
+func (b *LocalBackend) Mkdir(ctx context.Context, p string) error {
+	return os.MkdirAll(b.path(p), 0755)
+}
+
+// Remove implements Backend.Remove
+func (b *LocalBackend) Remove(ctx context.Context, p string) error {
+	if p == "" {
+		return fmt.Errorf("refusing to remove the backend root %s", b.root)
+	}
+	return os.RemoveAll(b.path(p))
+}
+
+// Rename implements Backend.Rename
+func (b *LocalBackend) Rename(ctx context.Context, oldPath, newPath string) error {
+	destination := b.path(newPath)
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory for %s: %w", destination, err)
+	}
+	return os.Rename(b.path(oldPath), destination)
+}
+
+// localFileMetadata converts local file info to file metadata
+func localFileMetadata(relPath string, info os.FileInfo) *FileMetadata {
+	metadata := &FileMetadata{
+		Path:        relPath,
+		Name:        info.Name(),
+		Size:        info.Size(),
+		Modified:    info.ModTime(),
+		IsDirectory: info.IsDir(),
+	}
+	if id, ok := fileID(info); ok {
+		metadata.FileID = id
+	}
+	return metadata
+}
+
+// mtimeUploader is implemented by clients that can set the modification time of uploaded files
+type mtimeUploader interface {
+	UploadFileWithMtime(ctx context.Context, path string, content io.Reader, size int64, modified time.Time) error
+}
+
+// checksumUploader is implemented by clients that can store a checksum with an upload
+type checksumUploader interface {
+	UploadFileWithChecksum(ctx context.Context, path string, content io.Reader, size int64, checksum string) error
+}
+
+// capabilitiesProvider is implemented by clients that know the capabilities of their server
+type capabilitiesProvider interface {
+	Capabilities(ctx context.Context) (*capabilities.Capabilities, error)
+}
+
+// chunkedUploadResumer is implemented by clients that can tell how much of an interrupted chunked upload
+// the server already received
+type chunkedUploadResumer interface {
+	ChunkedUploadOffset(ctx context.Context, path string, size int64, chunkSize int64) (int64, error)
+}
+
+// rangeDownloader is implemented by clients that can continue a download at an offset
+type rangeDownloader interface {
+	DownloadFileRange(ctx context.Context, path string, offset int64, etag string) (io.ReadCloser, int64, error)
+}
+
+// WebDAVBackend stores files in a directory on a WebDAV server
+type WebDAVBackend struct {
+	client             webdav.Client
+	root               string
+	chunkSize          int64
+	largeFileThreshold int64
+}
+
+// NewWebDAVBackend creates a backend for the remote directory root
+func NewWebDAVBackend(client webdav.Client, root string) *WebDAVBackend {
+	if root == "" {
+		root = "/"
+	}
+	return &WebDAVBackend{
+		client:             client,
+		root:               root,
+		chunkSize:          10 * 1024 * 1024, // 10MB
+		largeFileThreshold: 50 * 1024 * 1024, // 50MB
+	}
+}
+
+// SetChunking uploads files larger than threshold in chunks of chunkSize bytes,
+// values that are not positive keep the defaults
+func (b *WebDAVBackend) SetChunking(threshold, chunkSize int64) {
+	if threshold > 0 {
+		b.largeFileThreshold = threshold
+	}
+	if chunkSize > 0 {
+		b.chunkSize = chunkSize
+	}
+}
+
+// path returns the remote path of a backend path
+func (b *WebDAVBackend) path(p string) string {
+	return path.Join(b.root, p)
+}
+
+// List implements Backend.List. Servers that can list a whole tree at once are
+// asked for everything below dir in as few requests as possible.
+func (b *WebDAVBackend) List(ctx context.Context, dir string, fn func(meta *FileMetadata) error) error {
+	lister, ok := b.client.(treeLister)
+	if !ok {
+		return b.listDirectory(ctx, dir, fn)
+	}
+
+	err := lister.ListTree(ctx, b.path(dir), func(relPath string, file *webdav.WebDAVFile) error {
+		err := fn(remoteFileMetadata(path.Join(dir, relPath), file))
+		if err == fs.SkipDir {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list remote tree %s: %w", b.path(dir), err)
+	}
+	return nil
+}
+
+// listDirectory lists a directory and its subdirectories one request at a time
+func (b *WebDAVBackend) listDirectory(ctx context.Context, dir string, fn func(meta *FileMetadata) error) error {
+	files, err := b.client.ListDirectory(ctx, b.path(dir))
+	if err != nil {
+		return fmt.Errorf("failed to list remote directory %s: %w", b.path(dir), err)
+	}
+
+	for _, file := range files {
+		relPath := path.Join(dir, file.Name)
+		if err := fn(remoteFileMetadata(relPath, file)); err == fs.SkipDir {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if file.IsDirectory {
+			if err := b.listDirectory(ctx, relPath, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Stat implements Backend.Stat
+func (b *WebDAVBackend) Stat(ctx context.Context, p string) (*FileMetadata, error) {
+	props, err := b.client.GetProperties(ctx, b.path(p))
+	if err != nil {
+		var webdavErr *webdav.WebDAVError
+		if errors.As(err, &webdavErr) && webdavErr.IsNotFoundError() {
+			return nil, &fs.PathError{Op: "stat", Path: b.path(p), Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+
+	return &FileMetadata{
+		Path:        p,
+		Name:        path.Base(p),
+		Size:        props.Size,
+		Modified:    props.LastModified,
+		ETag:        props.ETag,
+		IsDirectory: props.IsDirectory,
+		Checksum:    webdav.ChecksumValue(props.Checksums, webdav.ChecksumSHA256),
+		FileID:      props.FileID,
+	}, nil
+}
+
+// Open implements Backend.Open
+func (b *WebDAVBackend) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	return b.client.DownloadFile(ctx, b.path(p))
+}
+
+// OpenRange implements RangeOpener, clients without range requests read from the start
+func (b *WebDAVBackend) OpenRange(ctx context.Context, p string, offset int64, etag string) (io.ReadCloser, int64, error) {
+	if downloader, ok := b.client.(rangeDownloader); ok && offset > 0 {
+		return downloader.DownloadFileRange(ctx, b.path(p), offset, etag)
+	}
+	content, err := b.client.DownloadFile(ctx, b.path(p))
+	return content, 0, err
+}
+
+// Create implements Backend.Create. The content is streamed to the server, large
+// files are uploaded in chunks. Modification times are kept for files uploaded at once.
+func (b *WebDAVBackend) Create(ctx context.Context, p string, content io.Reader, size int64, modified time.Time) error {
+	if err := b.mkdirParent(ctx, p); err != nil {
+		return err
+	}
+
+	remotePath := b.path(p)
+	if b.chunked(b.capabilities(ctx), size) {
+		return b.client.UploadFileChunked(ctx, remotePath, content, size, b.chunkSize)
+	}
+	return b.upload(ctx, remotePath, content, size, modified)
+}
+
+// CreateResumable implements ResumableCreator. A chunked upload continues after the
+// chunks the server received in an interrupted attempt, as long as the content has
+// the same checksum. Files uploaded at once keep their checksum if the transfer asks for it.
+func (b *WebDAVBackend) CreateResumable(ctx context.Context, p string, transfer *Transfer) error {
+	if err := b.mkdirParent(ctx, p); err != nil {
+		return err
+	}
+
+	remotePath := b.path(p)
+	caps := b.capabilities(ctx)
+	if b.chunked(caps, transfer.Size) {
+		return b.uploadChunked(ctx, remotePath, transfer)
+	}
+
+	content, _, err := transfer.Open(0)
+	if err != nil {
+		return err
+	}
+
+	uploader, ok := b.client.(checksumUploader)
+	if ok && transfer.StoreChecksum && transfer.Checksum != nil && (caps == nil || caps.SupportsChecksum(webdav.ChecksumSHA256)) {
+		// Let the server store the checksum so that later comparisons can use it
+		checksum, err := transfer.Checksum()
+		if err != nil {
+			return err
+		}
+		err = uploader.UploadFileWithChecksum(ctx, remotePath, content, transfer.Size, webdav.FormatChecksum(webdav.ChecksumSHA256, checksum))
+		if err != nil {
+			return err
+		}
+	} else if err := b.upload(ctx, remotePath, content, transfer.Size, transfer.Modified); err != nil {
+		return err
+	}
+
+	return transfer.verify()
+}
+
+// uploadChunked uploads a large file in chunks. With resume state, an upload that was interrupted in an
+// earlier attempt continues after the chunks the server already received, as long as the content is unchanged.
+func (b *WebDAVBackend) uploadChunked(ctx context.Context, remotePath string, transfer *Transfer) error {
+	content := &transferReader{transfer: transfer}
+	resumes := transfer.Resumes
+	if resumes == nil || transfer.Checksum == nil {
+		if err := b.client.UploadFileChunked(ctx, remotePath, content, transfer.Size, b.chunkSize); err != nil {
+			return err
+		}
+		return transfer.verify()
+	}
+
+	checksum, err := transfer.Checksum()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if resumableUpload(resumes, remotePath, transfer, checksum) {
+		if resumer, ok := b.client.(chunkedUploadResumer); ok {
+			received, err := resumer.ChunkedUploadOffset(ctx, remotePath, transfer.Size, b.chunkSize)
+			if err == nil {
+				offset = received
+			}
+		}
+	} else {
+		// Remember the content so that a later attempt can tell whether it may resume
+		if _, err := resumes.StartTransfer(remotePath, "upload", transfer.Size, transfer.Modified); err != nil {
+			return err
+		}
+		if err := resumes.UpdateProgress(remotePath, 0, checksum); err != nil {
+			return err
+		}
+	}
+
+	if offset > 0 {
+		err = b.client.ResumeChunkedUpload(ctx, remotePath, content, transfer.Size, offset, b.chunkSize)
+	} else {
+		err = b.client.UploadFileChunked(ctx, remotePath, content, transfer.Size, b.chunkSize)
+	}
+	if err != nil {
+		// The resume state stays behind for the next attempt
+		return err
+	}
+	if err := transfer.verify(); err != nil {
+		return err
+	}
+
+	return resumes.CompleteTransfer(remotePath)
+}
+
+// resumableUpload reports whether an interrupted upload to remotePath can be continued, because the
+// content still has the size, modification time and checksum it had when the upload started
+func resumableUpload(resumes *progress.ResumeManager, remotePath string, transfer *Transfer, checksum string) bool {
+	for _, state := range resumes.GetActiveTransfers() {
+		if state.FilePath != remotePath || state.Operation != "upload" {
+			continue
+		}
+		return state.TotalSize == transfer.Size && state.LastModified.Equal(transfer.Modified) && state.Checksum == checksum
+	}
+	return false
+}
+
+// upload sends a file in one request, keeping its modification time if the client can
+func (b *WebDAVBackend) upload(ctx context.Context, remotePath string, content io.Reader, size int64, modified time.Time) error {
+	if uploader, ok := b.client.(mtimeUploader); ok {
+		return uploader.UploadFileWithMtime(ctx, remotePath, content, size, modified)
+	}
+	return b.client.UploadFile(ctx, remotePath, content, size)
+}
+
+// mkdirParent creates the parent directories of a file
+func (b *WebDAVBackend) mkdirParent(ctx context.Context, p string) error {
+	if dir := path.Dir(p); dir != "." {
+		return b.Mkdir(ctx, dir)
+	}
+	return nil
+}
+
+// capabilities returns the capabilities of the server, or nil if they are unknown
+func (b *WebDAVBackend) capabilities(ctx context.Context) *capabilities.Capabilities {
+	provider, ok := b.client.(capabilitiesProvider)
+	if !ok {
+		return nil
+	}
+	caps, err := provider.Capabilities(ctx)
+	if err != nil {
+		return nil
+	}
+	return caps
+}
+
+// chunked reports whether a file is uploaded in chunks: files larger than the server
+// accepts in one request always are, unless it cannot chunk at all
+func (b *WebDAVBackend) chunked(caps *capabilities.Capabilities, size int64) bool {
+	threshold := b.largeFileThreshold
+	if caps != nil && caps.MaxChunkSize > 0 && caps.MaxChunkSize < threshold {
+		threshold = caps.MaxChunkSize
+	}
+	return size > threshold && (caps == nil || caps.ChunkingV2)
+}
+
+// Mkdir implements Backend.Mkdir
+func (b *WebDAVBackend) Mkdir(ctx context.Context, p string) error {
+	return makeRemoteDirectory(ctx, b.client, b.path(p))
+}
+
+// Remove implements Backend.Remove
+func (b *WebDAVBackend) Remove(ctx context.Context, p string) error {
+	if strings.Trim(p, "/") == "" {
+		return fmt.Errorf("refusing to remove the backend root %s", b.root)
+	}
+
+	err := b.client.DeleteFile(ctx, b.path(p))
+	var webdavErr *webdav.WebDAVError
+	if err != nil && errors.As(err, &webdavErr) && webdavErr.IsNotFoundError() {
+		return nil
+	}
+	return err
+}
+
+// Root returns the remote directory the backend stores its files in
+func (b *WebDAVBackend) Root() string {
+	return b.root
+}
+
+// SyncCollection returns the changes below the root since a sync token, or everything for an empty token
+func (b *WebDAVBackend) SyncCollection(ctx context.Context, token string) (*webdav.SyncCollectionResult, error) {
+	return b.client.SyncCollection(ctx, b.root, token)
+}
+
+// Rename implements Backend.Rename
+func (b *WebDAVBackend) Rename(ctx context.Context, oldPath, newPath string) error {
+	if err := b.mkdirParent(ctx, newPath); err != nil {
+		return err
+	}
+	return b.client.MoveFile(ctx, b.path(oldPath), b.path(newPath))
+}
+
+// NewEndpointBackend creates the backend for a sync source or target, a local
+// directory or a remote URL on the server client connects to
+func NewEndpointBackend(endpoint string, client webdav.Client, config *SyncConfig) Backend {
+	if !strings.Contains(endpoint, "://") {
+		backend := NewLocalBackend(endpoint)
+		backend.SetChecksumCache(config.ChecksumCache)
+		return backend
+	}
+
+	backend := NewWebDAVBackend(client, RemoteBasePath(endpoint))
+	backend.SetChunking(config.LargeFileThreshold, config.ChunkSize)
+	return backend
+}
+
+// syncSides returns the backends of the local and the remote side of a sync and
+// the direction the changes of the source propagate in. The source is the local
+// side, unless a remote source is synced to a local target.
+func syncSides(client webdav.Client, config *SyncConfig) (local, remote Backend, sourceDirection ChangeDirection) {
+	source, target := config.SourceBackend, config.TargetBackend
+	if source == nil && config.Source != "" {
+		source = NewEndpointBackend(config.Source, client, config)
+	}
+	if target == nil && config.Target != "" {
+		target = NewEndpointBackend(config.Target, client, config)
+	}
+
+	local, remote, sourceDirection = source, target, LocalToRemote
+	_, remoteSource := source.(*WebDAVBackend)
+	_, remoteTarget := target.(*WebDAVBackend)
+	if remoteSource && !remoteTarget {
+		local, remote, sourceDirection = target, source, RemoteToLocal
+	}
+
+	// Without endpoints, operations carry absolute paths
+	if local == nil {
+		local = NewLocalBackend("")
+	}
+	if remote == nil {
+		backend := NewWebDAVBackend(client, "/")
+		backend.SetChunking(config.LargeFileThreshold, config.ChunkSize)
+		remote = backend
+	}
+
+	return local, remote, sourceDirection
+}
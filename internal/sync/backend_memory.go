@@ -0,0 +1,250 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	stdsync "sync"
+	"time"
+)
+
+// memoryFile is a file or directory kept by a MemoryBackend
+type memoryFile struct {
+	content  []byte
+	modified time.Time
+	isDir    bool
+	version  int
+}
+
+// MemoryBackend keeps files in memory, it is meant for tests
+type MemoryBackend struct {
+	mu      stdsync.Mutex
+	files   map[string]*memoryFile
+	version int
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		files: map[string]*memoryFile{
+			"": {isDir: true},
+		},
+	}
+}
+
+// cleanPath normalizes a backend path, the root is ""
+func (b *MemoryBackend) cleanPath(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return ""
+	}
+	return p[1:]
+}
+
+// metadata returns the metadata of a file, the caller holds b.mu
+func (b *MemoryBackend) metadata(p string, file *memoryFile) *FileMetadata {
+	meta := &FileMetadata{
+		Path:        p,
+		Name:        path.Base(p),
+		Modified:    file.modified,
+		ETag:        fmt.Sprintf(`"%d"`, file.version),
+		IsDirectory: file.isDir,
+	}
+	if !file.isDir {
+		meta.Size = int64(len(file.content))
+	}
+	return meta
+}
+
+// List implements Backend.List, entries are listed in lexical order
+func (b *MemoryBackend) List(ctx context.Context, dir string, fn func(meta *FileMetadata) error) error {
+	dir = b.cleanPath(dir)
+
+	b.mu.Lock()
+	var entries []*FileMetadata
+	for p, file := range b.files {
+		if p != dir && withinSubtree(p, dir) {
+			entries = append(entries, b.metadata(p, file))
+		}
+	}
+	b.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	var skipped []string
+	for _, meta := range entries {
+		if len(skipped) > 0 && withinSubtree(meta.Path, skipped[len(skipped)-1]) {
+			continue
+		}
+		if err := fn(meta); err == fs.SkipDir && meta.IsDirectory {
+			skipped = append(skipped, meta.Path)
+		} else if err != nil && err != fs.SkipDir {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stat implements Backend.Stat
+func (b *MemoryBackend) Stat(ctx context.Context, p string) (*FileMetadata, error) {
+	p = b.cleanPath(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	file, exists := b.files[p]
+	if !exists {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return b.metadata(p, file), nil
+}
+
+// Hash implements Hasher
+func (b *MemoryBackend) Hash(ctx context.Context, p string) (string, error) {
+	content, err := b.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Open implements Backend.Open
+func (b *MemoryBackend) Open(ctx context.Context, p string) (io.ReadCloser, error) {
+	content, err := b.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// ReadFile returns the content of a file
+func (b *MemoryBackend) ReadFile(p string) ([]byte, error) {
+	p = b.cleanPath(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	file, exists := b.files[p]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	if file.isDir {
+		return nil, fmt.Errorf("%s is a directory", p)
+	}
+	return append([]byte(nil), file.content...), nil
+}
+
+// WriteFile creates or replaces a file, it is a shorthand for Create in tests
+func (b *MemoryBackend) WriteFile(p string, content []byte, modified time.Time) error {
+	return b.Create(context.Background(), p, bytes.NewReader(content), int64(len(content)), modified)
+}
+
+// Create implements Backend.Create
+func (b *MemoryBackend) Create(ctx context.Context, p string, content io.Reader, size int64, modified time.Time) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	p = b.cleanPath(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, exists := b.files[p]; exists && existing.isDir {
+		return fmt.Errorf("%s is a directory", p)
+	}
+	if err := b.mkdirAll(parentPath(p), modified); err != nil {
+		return err
+	}
+	b.put(p, &memoryFile{content: data, modified: modified})
+	return nil
+}
+
+// Mkdir implements Backend.Mkdir
+func (b *MemoryBackend) Mkdir(ctx context.Context, p string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.mkdirAll(b.cleanPath(p), time.Now())
+}
+
+// mkdirAll creates a directory and its parents, the caller holds b.mu
+func (b *MemoryBackend) mkdirAll(dir string, modified time.Time) error {
+	if dir == "" {
+		return nil
+	}
+	if existing, exists := b.files[dir]; exists {
+		if !existing.isDir {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if err := b.mkdirAll(parentPath(dir), modified); err != nil {
+		return err
+	}
+	b.put(dir, &memoryFile{isDir: true, modified: modified})
+	return nil
+}
+
+// put stores a file with a new version, the caller holds b.mu
+func (b *MemoryBackend) put(p string, file *memoryFile) {
+	b.version++
+	file.version = b.version
+	b.files[p] = file
+}
+
+// Remove implements Backend.Remove
+func (b *MemoryBackend) Remove(ctx context.Context, p string) error {
+	p = b.cleanPath(p)
+	if p == "" {
+		return fmt.Errorf("refusing to remove the backend root")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for existing := range b.files {
+		if withinSubtree(existing, p) {
+			delete(b.files, existing)
+		}
+	}
+	return nil
+}
+
+// Rename implements Backend.Rename
+func (b *MemoryBackend) Rename(ctx context.Context, oldPath, newPath string) error {
+	oldPath, newPath = b.cleanPath(oldPath), b.cleanPath(newPath)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.files[oldPath]; !exists {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: fs.ErrNotExist}
+	}
+	if withinSubtree(newPath, oldPath) {
+		return fmt.Errorf("cannot move %s into itself", oldPath)
+	}
+	if err := b.mkdirAll(parentPath(newPath), time.Now()); err != nil {
+		return err
+	}
+
+	for existing, file := range b.files {
+		if withinSubtree(existing, oldPath) {
+			delete(b.files, existing)
+			b.files[newPath+existing[len(oldPath):]] = file
+		}
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBackend(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	backend := NewLocalBackend(root)
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Files are created with their parents and keep the modification time
+	require.NoError(t, backend.Create(ctx, "docs/a.txt", strings.NewReader("hello"), 5, modified))
+	meta, err := backend.Stat(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), meta.Size)
+	assert.True(t, meta.Modified.Equal(modified))
+	_, err = os.Stat(filepath.Join(root, "docs", "a.txt"+partialFileSuffix))
+	assert.True(t, os.IsNotExist(err), "no partial file is left behind")
+
+	reader, err := backend.Open(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	require.NoError(t, backend.Rename(ctx, "docs/a.txt", "archive/2024/a.txt"))
+	_, err = backend.Stat(ctx, "docs/a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	var listed []string
+	require.NoError(t, backend.List(ctx, "", func(meta *FileMetadata) error {
+		listed = append(listed, meta.Path)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"archive", "archive/2024", "archive/2024/a.txt", "docs"}, listed)
+
+	require.NoError(t, backend.Remove(ctx, "archive"))
+	require.NoError(t, backend.Remove(ctx, "archive"), "removing a missing path is not an error")
+	assert.Error(t, backend.Remove(ctx, ""))
+}
+
+func TestWebDAVBackend_StreamsBetweenServers(t *testing.T) {
+	sourceClient := newMockWebDAVClient()
+	sourceClient.files["/old/docs/a.txt"] = &mockFile{content: []byte("hello"), modTime: time.Now()}
+	targetClient := newMockWebDAVClient()
+
+	executor := NewOperationExecutor(nil, &SyncConfig{
+		Source:        "https://old.example.com/files?dir=/old",
+		Target:        "https://new.example.com/files?dir=/new",
+		SourceBackend: NewWebDAVBackend(sourceClient, "/old"),
+		TargetBackend: NewWebDAVBackend(targetClient, "/new"),
+	})
+
+	err := executor.ExecuteOperation(&SyncOperation{
+		Type:       ChangeCreate,
+		Direction:  LocalToRemote,
+		SourcePath: "docs/a.txt",
+		TargetPath: "docs/a.txt",
+	})
+	require.NoError(t, err)
+	require.Contains(t, targetClient.files, "/new/docs/a.txt")
+	assert.Equal(t, "hello", string(targetClient.files["/new/docs/a.txt"].content))
+	assert.True(t, targetClient.directories["/new/docs"], "parent directories are created")
+
+	_, err = NewWebDAVBackend(targetClient, "/new").Stat(context.Background(), "missing.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// newFakeServerClient starts a fake Nextcloud server and a client logged in to it
+func newFakeServerClient(t *testing.T) (*webdavtest.Server, *webdav.WebDAVClient) {
+	srv := webdavtest.NewServer("alice", "secret")
+	t.Cleanup(srv.Close)
+	authProvider, err := auth.NewAppPasswordAuth(srv.URL, "alice", "secret")
+	require.NoError(t, err)
+	client, err := webdav.NewClient(authProvider)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return srv, client
+}
+
+func TestSyncEngine_SyncBetweenServers(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Now().Add(-time.Minute).Truncate(time.Second)
+	oldServer, oldClient := newFakeServerClient(t)
+	newServer, newClient := newFakeServerClient(t)
+	require.NoError(t, oldServer.WriteFile("Old/docs/a.txt", []byte("hello"), modified))
+	require.NoError(t, oldServer.WriteFile("Old/b.txt", []byte("bye"), modified))
+	require.NoError(t, newServer.Mkdir("New"))
+
+	engine, err := NewSyncEngine(nil, &SyncConfig{
+		Source:        oldServer.URL + "/apps/files/?dir=/Old",
+		Target:        newServer.URL + "/apps/files/?dir=/New",
+		SourceBackend: NewWebDAVBackend(oldClient, "/Old"),
+		TargetBackend: NewWebDAVBackend(newClient, "/New"),
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+	content, err := newServer.ReadFile("New/docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// The copies keep their modification times and are not transferred again,
+	// although the ETags of the two servers differ
+	puts := newServer.RequestCount("PUT")
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, result.Plan.Operations)
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, puts, newServer.RequestCount("PUT"))
+}
+
+func TestSyncEngine_SyncLocalDirectories(t *testing.T) {
+	source, target := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "docs", "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "skip.tmp"), []byte("temp"), 0644))
+
+	config := &SyncConfig{
+		Source:          source,
+		Target:          target,
+		ExcludePatterns: []string{"*.tmp"},
+		SourceBackend:   NewLocalBackend(source),
+		TargetBackend:   NewLocalBackend(target),
+	}
+	engine, err := NewSyncEngine(nil, config)
+	require.NoError(t, err)
+
+	result, err := engine.Sync(context.Background())
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	content, err := os.ReadFile(filepath.Join(target, "docs", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	_, err = os.Stat(filepath.Join(target, "skip.tmp"))
+	assert.True(t, os.IsNotExist(err), "excluded files are not copied")
+
+	// Nothing is left to do once both sides match
+	result, err = engine.Sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Plan.TotalFiles)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, backend.WriteFile("docs/a.txt", []byte("hello"), modified))
+	require.NoError(t, backend.WriteFile("build/out.bin", []byte("x"), modified))
+
+	meta, err := backend.Stat(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), meta.Size)
+	assert.True(t, meta.Modified.Equal(modified))
+	assert.NotEmpty(t, meta.ETag)
+
+	hash, err := backend.Hash(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, helloSHA256, hash)
+
+	// Skipped directories are listed without their contents
+	var listed []string
+	require.NoError(t, backend.List(ctx, "", func(meta *FileMetadata) error {
+		listed = append(listed, meta.Path)
+		if meta.Path == "build" {
+			return fs.SkipDir
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"build", "docs", "docs/a.txt"}, listed)
+
+	require.NoError(t, backend.Rename(ctx, "docs", "archive/docs"))
+	content, err := backend.ReadFile("archive/docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	_, err = backend.Stat(ctx, "docs")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, backend.Remove(ctx, "archive"))
+	_, err = backend.Stat(ctx, "archive/docs/a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSyncEngine_SyncMemoryBackends(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	source, target := NewMemoryBackend(), NewMemoryBackend()
+	require.NoError(t, source.WriteFile("docs/a.txt", []byte("hello"), modified))
+	require.NoError(t, source.WriteFile("docs/b.txt", []byte("bye"), modified))
+	require.NoError(t, target.WriteFile("notes.txt", []byte("remote"), modified))
+
+	engine, err := NewSyncEngine(nil, &SyncConfig{
+		Direction:     SyncDirectionBidirectional,
+		Journal:       NewJournal(""),
+		SourceBackend: source,
+		TargetBackend: target,
+	})
+	require.NoError(t, err)
+
+	// New files are copied in both directions
+	_, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	content, err := target.ReadFile("docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	content, err = source.ReadFile("notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "remote", string(content))
+
+	// Deletions and edits are propagated with the journal as common baseline
+	require.NoError(t, source.Remove(ctx, "docs/b.txt"))
+	require.NoError(t, target.WriteFile("notes.txt", []byte("edited"), modified.Add(time.Hour)))
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, result.Conflicts)
+	_, err = target.Stat(ctx, "docs/b.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	content, err = source.ReadFile("notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "edited", string(content))
+
+	// Nothing is left to do once both sides match
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Plan.TotalFiles)
+}
+
+func TestSyncEngine_OneWaySyncIsStable(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Now().Add(-time.Minute)
+
+	// ETags of different backends never match, copies are equal by size and time
+	source, target := NewMemoryBackend(), NewMemoryBackend()
+	require.NoError(t, source.WriteFile("docs/a.txt", []byte("hello"), modified))
+	require.NoError(t, source.WriteFile("b.txt", []byte("bye"), modified))
+
+	engine, err := NewSyncEngine(nil, &SyncConfig{
+		SourceBackend: source,
+		TargetBackend: target,
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+
+	// The second run without a journal has nothing to do
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, result.Plan.Operations)
+	assert.Empty(t, result.Conflicts)
+
+	// A later edit on the source is copied again
+	require.NoError(t, source.WriteFile("b.txt", []byte("bye!"), modified.Add(time.Minute)))
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	require.Len(t, result.Plan.Operations, 1)
+	assert.Equal(t, "b.txt", result.Plan.Operations[0].SourcePath)
+}
+
+func TestSyncEngine_OneWayRenameIsMoved(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Now().Add(-time.Minute)
+
+	source, target := NewMemoryBackend(), NewMemoryBackend()
+	require.NoError(t, source.WriteFile("docs/a.txt", []byte("hello"), modified))
+	require.NoError(t, source.WriteFile("docs/sub/b.txt", []byte("bye"), modified))
+
+	engine, err := NewSyncEngine(nil, &SyncConfig{
+		SourceBackend: source,
+		TargetBackend: target,
+		Delete:        true,
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+
+	// Without a journal the renamed directory is found by its contents
+	require.NoError(t, source.Rename(ctx, "docs", "papers"))
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+	require.Len(t, result.Plan.Operations, 1)
+	assert.Equal(t, ChangeMove, result.Plan.Operations[0].Type)
+	assert.Equal(t, "docs", result.Plan.Operations[0].SourcePath)
+	assert.Equal(t, "papers", result.Plan.Operations[0].TargetPath)
+
+	content, err := target.ReadFile("papers/sub/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "bye", string(content))
+	_, err = target.Stat(ctx, "docs")
+	assert.Error(t, err)
+
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, result.Plan.Operations)
+}
+
+func TestSyncEngine_OneWayTargetOnlyDuplicateIsKept(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Now().Add(-time.Minute)
+
+	// A file that only ever existed on the target has the same content as a new source file
+	source, target := NewMemoryBackend(), NewMemoryBackend()
+	require.NoError(t, source.WriteFile("report.txt", []byte("hello"), modified))
+	require.NoError(t, target.WriteFile("colleague/report.txt", []byte("hello"), modified))
+
+	engine, err := NewSyncEngine(nil, &SyncConfig{
+		SourceBackend: source,
+		TargetBackend: target,
+		Checksums:     true,
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+	for _, op := range result.Plan.Operations {
+		assert.NotEqual(t, ChangeMove, op.Type)
+		assert.NotEqual(t, ChangeDelete, op.Type)
+	}
+
+	// Without delete mode the target copy is left where it is
+	for _, p := range []string{"report.txt", "colleague/report.txt"} {
+		content, err := target.ReadFile(p)
+		require.NoError(t, err, p)
+		assert.Equal(t, "hello", string(content))
+	}
+}
+
+func TestSyncEngine_CancelMidPlan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	modified := time.Now().Add(-time.Minute)
+
+	source, target := NewMemoryBackend(), NewMemoryBackend()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, source.WriteFile(fmt.Sprintf("file%d.txt", i), []byte("content"), modified))
+	}
+
+	// The sync is cancelled while its first operation runs
+	engine, err := NewSyncEngine(nil, &SyncConfig{
+		SourceBackend: source,
+		TargetBackend: target,
+		Concurrency:   1,
+		Events: func(event SyncEvent) {
+			if event.Type == EventOperationStart {
+				cancel()
+			}
+		},
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, 1, result.ProcessedFiles)
+	assert.Len(t, result.SkippedFiles, 4)
+
+	copied := 0
+	for i := 0; i < 5; i++ {
+		if _, err := target.ReadFile(fmt.Sprintf("file%d.txt", i)); err == nil {
+			copied++
+		}
+	}
+	assert.Equal(t, 1, copied)
+}
+
+func TestSyncEngine_SyncWithFakeServer(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	authProvider, err := auth.NewAppPasswordAuth(srv.URL, "alice", "secret")
+	require.NoError(t, err)
+	client, err := webdav.NewClient(authProvider)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	local := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(local, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(local, "docs", "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(local, "docs", "a.txt"), modified, modified))
+	require.NoError(t, srv.WriteFile("Backup/remote.txt", []byte("from the server"), modified))
+
+	engine, err := NewSyncEngine(client, &SyncConfig{
+		Source:             local,
+		Target:             srv.URL + "/apps/files/?dir=/Backup",
+		Direction:          SyncDirectionBidirectional,
+		Journal:            NewJournal(""),
+		LargeFileThreshold: 4,
+		ChunkSize:          2,
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+
+	// a.txt exceeds the large file threshold and goes through a chunked upload
+	uploaded, err := srv.ReadFile("Backup/docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(uploaded))
+	assert.Equal(t, 1, srv.RequestCount("MOVE"), "the chunks are assembled with a MOVE")
+	downloaded, err := os.ReadFile(filepath.Join(local, "remote.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "from the server", string(downloaded))
+
+	// A deletion on the server is propagated with the journal as common baseline
+	srv.Remove("Backup/remote.txt")
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+	_, err = os.Stat(filepath.Join(local, "remote.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// A locked file fails the upload without affecting the server copy
+	require.NoError(t, os.WriteFile(filepath.Join(local, "docs", "a.txt"), []byte("hi"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(local, "docs", "a.txt"), modified.Add(time.Hour), modified.Add(time.Hour)))
+	srv.AddFault(webdavtest.Locked.On("PUT", "/docs/a.txt"))
+	result, err = engine.Sync(ctx)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	uploaded, err = srv.ReadFile("Backup/docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(uploaded))
+}
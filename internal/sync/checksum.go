@@ -0,0 +1,202 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	stdsync "sync"
+)
+
+// checksumCacheVersion is the on-disk format version of the checksum cache
+const checksumCacheVersion = 1
+
+// checksumCacheEntry is a cached checksum together with the file state it belongs to
+type checksumCacheEntry struct {
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"` // Modification time in nanoseconds
+	Checksum string `json:"checksum"`
+}
+
+// checksumCacheFile is the serialized form of a checksum cache
+type checksumCacheFile struct {
+	Version int                            `json:"version"`
+	Entries map[string]*checksumCacheEntry `json:"entries"`
+}
+
+// ChecksumCache caches SHA-256 checksums of local files keyed by inode. A cached
+// checksum is only used while the size and modification time are unchanged.
+type ChecksumCache struct {
+	path    string
+	entries map[string]*checksumCacheEntry
+	used    map[string]bool
+	mu      stdsync.Mutex
+}
+
+// DefaultChecksumCachePath returns the checksum cache file path for the given journal name
+func DefaultChecksumCachePath(name string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".nextcloud-sync", "checksums", name+".json"), nil
+}
+
+// NewChecksumCache creates an empty cache that saves to the given path.
+// An empty path creates a cache that is never persisted.
+func NewChecksumCache(path string) *ChecksumCache {
+	return &ChecksumCache{
+		path:    path,
+		entries: make(map[string]*checksumCacheEntry),
+		used:    make(map[string]bool),
+	}
+}
+
+// OpenChecksumCache loads a checksum cache from disk, or creates an empty one.
+// A cache in an unknown format is discarded since it can always be rebuilt.
+func OpenChecksumCache(path string) (*ChecksumCache, error) {
+	cache := NewChecksumCache(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("failed to read checksum cache %s: %w", path, err)
+	}
+
+	var file checksumCacheFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != checksumCacheVersion {
+		return cache, nil
+	}
+
+	if file.Entries != nil {
+		cache.entries = file.Entries
+	}
+
+	return cache, nil
+}
+
+// Checksum returns the SHA-256 of a local file, computing it only if the file
+// changed since it was last hashed. A nil cache always computes the checksum.
+func (c *ChecksumCache) Checksum(path string, info os.FileInfo) (string, error) {
+	if c == nil {
+		return fileChecksum(path)
+	}
+
+	key := checksumCacheKey(path, info)
+
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	c.used[key] = true
+	c.mu.Unlock()
+
+	if exists && entry.Size == info.Size() && entry.Modified == info.ModTime().UnixNano() {
+		return entry.Checksum, nil
+	}
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.Put(path, info, checksum)
+
+	return checksum, nil
+}
+
+// Put records the checksum of a local file, e.g. one computed while transferring it
+func (c *ChecksumCache) Put(path string, info os.FileInfo, checksum string) {
+	key := checksumCacheKey(path, info)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &checksumCacheEntry{
+		Size:     info.Size(),
+		Modified: info.ModTime().UnixNano(),
+		Checksum: checksum,
+	}
+	c.used[key] = true
+}
+
+// PruneUnused drops entries that were not looked up since the cache was opened.
+// It should only be called after all files of the sync root were hashed.
+func (c *ChecksumCache) PruneUnused() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Len returns the number of cached checksums
+func (c *ChecksumCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save writes the cache to disk atomically
+func (c *ChecksumCache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	data, err := json.Marshal(checksumCacheFile{
+		Version: checksumCacheVersion,
+		Entries: c.entries,
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to serialize checksum cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create checksum cache directory: %w", err)
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checksum cache: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace checksum cache: %w", err)
+	}
+
+	return nil
+}
+
+// checksumCacheKey identifies a file by device and inode where the platform provides
+// them, so that renamed files keep their checksum, and by path otherwise
+func checksumCacheKey(path string, info os.FileInfo) string {
+	if id, ok := fileID(info); ok {
+		return id
+	}
+	return "path:" + path
+}
+
+// fileChecksum computes the SHA-256 of a local file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,181 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestChecksumCache_UsesCachedValueUntilFileChanges(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello"), 0644))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+
+	cache := NewChecksumCache("")
+	checksum, err := cache.Checksum(filePath, info)
+	require.NoError(t, err)
+	assert.Equal(t, helloSHA256, checksum)
+
+	// A cached value is returned without reading the file again
+	cache.Put(filePath, info, "cached")
+	checksum, err = cache.Checksum(filePath, info)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", checksum)
+
+	// A new modification time invalidates the entry
+	later := info.ModTime().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filePath, later, later))
+	info, err = os.Stat(filePath)
+	require.NoError(t, err)
+
+	checksum, err = cache.Checksum(filePath, info)
+	require.NoError(t, err)
+	assert.Equal(t, helloSHA256, checksum)
+}
+
+func TestChecksumCache_SaveOpenAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "profile.json")
+
+	var infos []os.FileInfo
+	for _, name := range []string{"a.txt", "b.txt"} {
+		filePath := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(filePath, []byte(name), 0644))
+		info, err := os.Stat(filePath)
+		require.NoError(t, err)
+		infos = append(infos, info)
+	}
+
+	cache := NewChecksumCache(cachePath)
+	cache.Put(filepath.Join(dir, "a.txt"), infos[0], "a")
+	cache.Put(filepath.Join(dir, "b.txt"), infos[1], "b")
+	require.NoError(t, cache.Save())
+
+	loaded, err := OpenChecksumCache(cachePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded.Len())
+
+	checksum, err := loaded.Checksum(filepath.Join(dir, "a.txt"), infos[0])
+	require.NoError(t, err)
+	assert.Equal(t, "a", checksum)
+
+	loaded.PruneUnused()
+	assert.Equal(t, 1, loaded.Len())
+}
+
+func TestOpenChecksumCache_DiscardsUnreadableCache(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	require.NoError(t, os.WriteFile(cachePath, []byte("not json"), 0600))
+
+	cache, err := OpenChecksumCache(cachePath)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCompareFiles_Checksums(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+	opts.CompareChecksums = true
+
+	// Restored from a backup: same content, different modification time
+	local := createTestFile("a.txt", 5, now.Add(-time.Hour), "")
+	local.Checksum = helloSHA256
+	remote := createTestFile("a.txt", 5, now, `"e1"`)
+	remote.Checksum = helloSHA256
+
+	assert.Equal(t, ChangeNone, CompareFiles(local, remote, opts).Type)
+
+	// Without checksum mode the newer remote file wins
+	assert.Equal(t, ChangeUpdate, CompareFiles(local, remote, DefaultComparisonOptions()).Type)
+
+	// Different content with identical metadata is still detected
+	remote = createTestFile("a.txt", 5, local.Modified, `"e2"`)
+	remote.Checksum = "other"
+	assert.False(t, local.IsEqual(remote, opts))
+}
+
+func TestJournalEntry_LocalChangedWithChecksums(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+	opts.CompareChecksums = true
+
+	synced := createTestFile("a.txt", 5, now, "")
+	synced.Checksum = helloSHA256
+	entry := NewJournalEntry("a.txt", synced, createTestFile("a.txt", 5, now, `"e1"`))
+	assert.Equal(t, helloSHA256, entry.Hash)
+
+	touched := createTestFile("a.txt", 5, now.Add(time.Hour), "")
+	touched.Checksum = helloSHA256
+	assert.False(t, entry.LocalChanged(touched, opts))
+	assert.True(t, entry.LocalChanged(touched, DefaultComparisonOptions()))
+
+	edited := createTestFile("a.txt", 5, now, "")
+	edited.Checksum = "other"
+	assert.True(t, entry.LocalChanged(edited, opts))
+}
+
+func TestSyncEngine_BuildLocalFileTreeChecksums(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "dir"), 0755))
+
+	cache := NewChecksumCache("")
+	engine, err := NewSyncEngine(newMockWebDAVClient(), &SyncConfig{
+		Source:        tmpDir,
+		Target:        "https://cloud.example.com/files/test?dir=/remote",
+		Checksums:     true,
+		ChecksumCache: cache,
+	})
+	require.NoError(t, err)
+
+	tree, err := engine.BuildLocalFileTree(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, helloSHA256, tree.PathMap["a.txt"].Metadata.Checksum)
+	assert.Empty(t, tree.PathMap["dir"].Metadata.Checksum)
+	assert.Equal(t, 1, cache.Len())
+}
+
+// checksumMockClient records checksums sent with uploads
+type checksumMockClient struct {
+	*mockWebDAVClient
+	checksums map[string]string
+}
+
+func (m *checksumMockClient) UploadFileWithChecksum(ctx context.Context, path string, content io.Reader, size int64, checksum string) error {
+	m.checksums[path] = checksum
+	return m.UploadFile(ctx, path, content, size)
+}
+
+func TestExecuteOperation_UploadsChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("hello"), 0644))
+
+	client := &checksumMockClient{mockWebDAVClient: newMockWebDAVClient(), checksums: make(map[string]string)}
+	executor := NewOperationExecutor(client, &SyncConfig{
+		Source:    tmpDir,
+		Target:    "https://cloud.example.com/files/test?dir=/remote",
+		Checksums: true,
+	})
+
+	err := executor.ExecuteOperation(&SyncOperation{
+		ID:         "upload",
+		Type:       ChangeCreate,
+		Direction:  LocalToRemote,
+		SourcePath: "a.txt",
+		TargetPath: "a.txt",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "SHA256:"+helloSHA256, client.checksums["/remote/a.txt"])
+	assert.Contains(t, client.files, "/remote/a.txt")
+}
@@ -18,24 +18,26 @@ func CompareFiles(local, remote *FileMetadata, opts *ComparisonOptions) *Change
 		return &Change{Type: ChangeNone, Reason: "both files nil"}
 	}
 
-	// Local exists, remote doesn't -> create remote
+	// Local exists, remote doesn't -> create remote at the same relative path
 	if local != nil && remote == nil {
 		return &Change{
-			Type:      ChangeCreate,
-			Direction: LocalToRemote,
-			LocalMeta: local,
-			LocalPath: local.Path,
-			Reason:    "local file not found on remote",
-			Priority:  calculatePriority(local),
+			Type:       ChangeCreate,
+			Direction:  LocalToRemote,
+			LocalMeta:  local,
+			LocalPath:  local.Path,
+			RemotePath: local.Path,
+			Reason:     "local file not found on remote",
+			Priority:   calculatePriority(local),
 		}
 	}
 
-	// Remote exists, local doesn't -> create local
+	// Remote exists, local doesn't -> create local at the same relative path
 	if local == nil && remote != nil {
 		return &Change{
 			Type:       ChangeCreate,
 			Direction:  RemoteToLocal,
 			RemoteMeta: remote,
+			LocalPath:  remote.Path,
 			RemotePath: remote.Path,
 			Reason:     "remote file not found locally",
 			Priority:   calculatePriority(remote),
@@ -51,8 +53,18 @@ func CompareFiles(local, remote *FileMetadata, opts *ComparisonOptions) *Change
 
 // compareExistingFiles compares two existing files and determines the appropriate change
 func compareExistingFiles(local, remote *FileMetadata, opts *ComparisonOptions) *Change {
+	// Directories have no content, their modification times change with their entries
+	if local.IsDirectory && remote.IsDirectory {
+		return &Change{Type: ChangeNone, Reason: "both are directories"}
+	}
+
+	// Files with identical content never conflict
+	if sameContent(local, remote, opts) {
+		return &Change{Type: ChangeNone, Reason: "files have identical checksums"}
+	}
+
 	// Check for conflicts first
-	if conflict := detectConflict(local, remote); conflict != nil {
+	if conflict := detectConflict(local, remote, opts); conflict != nil {
 		return &Change{
 			Type:       ChangeUpdate,
 			Direction:  Bidirectional,
@@ -102,8 +114,19 @@ func compareExistingFiles(local, remote *FileMetadata, opts *ComparisonOptions)
 	}
 }
 
-// detectConflict detects if there's a conflict between local and remote files
-func detectConflict(local, remote *FileMetadata) *Conflict {
+// sameContent reports whether checksum comparison is enabled and both files have the same checksum
+func sameContent(local, remote *FileMetadata, opts *ComparisonOptions) bool {
+	return opts.CompareChecksums && !local.IsDirectory && !remote.IsDirectory &&
+		local.Checksum != "" && local.Checksum == remote.Checksum
+}
+
+// detectConflict detects if there's a conflict between local and remote files.
+// Differing ETags only count if opts allows comparing them.
+func detectConflict(local, remote *FileMetadata, opts *ComparisonOptions) *Conflict {
+	if opts == nil {
+		opts = DefaultComparisonOptions()
+	}
+
 	// Type mismatch (file vs directory)
 	if local.IsDirectory != remote.IsDirectory {
 		return &Conflict{
@@ -138,7 +161,7 @@ func detectConflict(local, remote *FileMetadata) *Conflict {
 
 	// If both files were modified recently and have different content
 	recentThreshold := 5 * time.Minute
-	if timeDiff < recentThreshold &&
+	if timeDiff < recentThreshold && opts.CompareETags &&
 		local.ETag != "" && remote.ETag != "" &&
 		local.ETag != remote.ETag {
 		return &Conflict{
@@ -155,7 +178,9 @@ func detectConflict(local, remote *FileMetadata) *Conflict {
 	return nil
 }
 
-// DetectChanges compares two file trees and returns all detected changes and conflicts
+// DetectChanges compares two file trees and returns all detected changes and conflicts.
+// With a source direction set and paths that only exist on the target deleted, renames
+// on the source side are detected as moves.
 func DetectChanges(localTree, remoteTree *FileTree, opts *ComparisonOptions) ([]*Change, []*Conflict) {
 	if opts == nil {
 		opts = DefaultComparisonOptions()
@@ -206,16 +231,320 @@ func DetectChanges(localTree, remoteTree *FileTree, opts *ComparisonOptions) ([]
 
 			// Extract conflicts from changes (only if both metadata exist)
 			if localMeta != nil && remoteMeta != nil {
-				if conflict := detectConflict(localMeta, remoteMeta); conflict != nil {
+				if conflict := detectConflict(localMeta, remoteMeta, opts); conflict != nil {
 					conflicts = append(conflicts, conflict)
 				}
 			}
 		}
 	}
 
+	// Without a journal a move can only be told from a coincidental copy on the target
+	// if the copy would be deleted anyway
+	if opts.DeleteTargetOnly && (opts.SourceDirection == LocalToRemote || opts.SourceDirection == RemoteToLocal) {
+		changes = detectTreeMoves(changes, localTree, remoteTree, opts)
+		changes = deleteTargetOnly(changes, opts.SourceDirection)
+	}
+
 	return changes, conflicts
 }
 
+// deleteTargetOnly replaces the copies of paths that only exist on the target side of a
+// one-way sync back to the source with their deletion on the target. Contents of a
+// deleted directory go with it.
+func deleteTargetOnly(changes []*Change, direction ChangeDirection) []*Change {
+	targetOnly := func(change *Change) bool {
+		return change.Type == ChangeCreate && change.Direction != direction
+	}
+
+	deleted := make(map[string]bool)
+	for _, change := range changes {
+		if targetOnly(change) {
+			deleted[change.Path()] = true
+		}
+	}
+
+	result := make([]*Change, 0, len(changes))
+	for _, change := range changes {
+		if !targetOnly(change) {
+			result = append(result, change)
+			continue
+		}
+		if hasDeletedAncestor(change.Path(), deleted) {
+			continue
+		}
+
+		result = append(result, &Change{
+			Type:       ChangeDelete,
+			Direction:  direction,
+			LocalPath:  change.LocalPath,
+			RemotePath: change.RemotePath,
+			LocalMeta:  change.LocalMeta,
+			RemoteMeta: change.RemoteMeta,
+			Reason:     "not found on the source",
+			Priority:   change.Priority,
+		})
+	}
+	return result
+}
+
+// hasDeletedAncestor reports whether a directory containing path is deleted
+func hasDeletedAncestor(path string, deleted map[string]bool) bool {
+	for dir := parentPath(path); dir != ""; dir = parentPath(dir) {
+		if deleted[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectChangesWithJournal compares two file trees against the last synced state
+// recorded in the journal. Every path is classified three-way, which allows
+// deletions on one side to be propagated instead of being undone by the other side,
+// and renames to be propagated as moves instead of a deletion and a new transfer.
+// Paths without a journal entry fall back to a plain two-way comparison.
+func DetectChangesWithJournal(localTree, remoteTree *FileTree, journal *Journal, opts *ComparisonOptions) ([]*Change, []*Conflict) {
+	if opts == nil {
+		opts = DefaultComparisonOptions()
+	}
+
+	if journal == nil {
+		return DetectChanges(localTree, remoteTree, opts)
+	}
+
+	var changes []*Change
+	var conflicts []*Conflict
+
+	// Collect all paths from both trees and the journal
+	allPaths := make(map[string]bool)
+	if localTree != nil {
+		for path := range localTree.PathMap {
+			allPaths[path] = true
+		}
+	}
+	if remoteTree != nil {
+		for path := range remoteTree.PathMap {
+			allPaths[path] = true
+		}
+	}
+	for _, path := range journal.Paths() {
+		allPaths[path] = true
+	}
+
+	for path := range allPaths {
+		// The sync root itself is never synchronized
+		if path == "" {
+			continue
+		}
+
+		localMeta := treeMetadata(localTree, path)
+		remoteMeta := treeMetadata(remoteTree, path)
+
+		entry, known := journal.Get(path)
+		if !known {
+			if localMeta == nil && remoteMeta == nil {
+				continue
+			}
+
+			change := CompareFiles(localMeta, remoteMeta, opts)
+			if change.Type != ChangeNone {
+				changes = append(changes, change)
+				if localMeta != nil && remoteMeta != nil {
+					if conflict := detectConflict(localMeta, remoteMeta, opts); conflict != nil {
+						conflicts = append(conflicts, conflict)
+					}
+				}
+			}
+			continue
+		}
+
+		change, conflict := classifyAgainstBaseline(path, localMeta, remoteMeta, entry, opts)
+		if change != nil {
+			changes = append(changes, change)
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	changes = detectMoves(changes, conflicts, journal, opts)
+
+	return pruneDeletes(changes, conflicts), conflicts
+}
+
+// classifyAgainstBaseline determines the change for a path that has a journal entry
+func classifyAgainstBaseline(path string, local, remote *FileMetadata, entry *JournalEntry, opts *ComparisonOptions) (*Change, *Conflict) {
+	switch {
+	case local == nil && remote == nil:
+		// Deleted on both sides, nothing left to do
+		return nil, nil
+
+	case local != nil && remote != nil:
+		if local.IsDirectory != remote.IsDirectory {
+			return nil, detectConflict(local, remote, opts)
+		}
+
+		localChanged := entry.LocalChanged(local, opts)
+		remoteChanged := entry.RemoteChanged(remote, opts)
+
+		switch {
+		case !localChanged && !remoteChanged:
+			return nil, nil
+		case sameContent(local, remote, opts):
+			// Both sides changed to the same content
+			return nil, nil
+		case localChanged && !remoteChanged:
+			// Only the changed side's metadata is attached, the other side still matches the baseline
+			return &Change{
+				Type:       ChangeUpdate,
+				Direction:  LocalToRemote,
+				LocalPath:  path,
+				RemotePath: path,
+				LocalMeta:  local,
+				Reason:     "local file changed since last sync",
+				Priority:   calculatePriority(local),
+			}, nil
+		case !localChanged && remoteChanged:
+			return &Change{
+				Type:       ChangeUpdate,
+				Direction:  RemoteToLocal,
+				LocalPath:  path,
+				RemotePath: path,
+				RemoteMeta: remote,
+				Reason:     "remote file changed since last sync",
+				Priority:   calculatePriority(remote),
+			}, nil
+		default:
+			return nil, &Conflict{
+				Type:        ConflictContentChanged,
+				LocalPath:   path,
+				RemotePath:  path,
+				LocalMeta:   local,
+				RemoteMeta:  remote,
+				Description: "both local and remote files changed since last sync",
+				Timestamp:   time.Now(),
+			}
+		}
+
+	case local == nil:
+		// Deleted locally - propagate unless the remote side changed in the meantime
+		if entry.RemoteChanged(remote, opts) {
+			return nil, &Conflict{
+				Type:        ConflictDeletedChanged,
+				LocalPath:   path,
+				RemotePath:  path,
+				RemoteMeta:  remote,
+				Description: "deleted locally but changed on remote since last sync",
+				Timestamp:   time.Now(),
+			}
+		}
+		return &Change{
+			Type:       ChangeDelete,
+			Direction:  LocalToRemote,
+			LocalPath:  path,
+			RemotePath: path,
+			RemoteMeta: remote,
+			Reason:     "local file deleted since last sync",
+			Priority:   calculatePriority(remote),
+		}, nil
+
+	default:
+		// Deleted remotely - propagate unless the local side changed in the meantime
+		if entry.LocalChanged(local, opts) {
+			return nil, &Conflict{
+				Type:        ConflictDeletedChanged,
+				LocalPath:   path,
+				RemotePath:  path,
+				LocalMeta:   local,
+				Description: "deleted on remote but changed locally since last sync",
+				Timestamp:   time.Now(),
+			}
+		}
+		return &Change{
+			Type:       ChangeDelete,
+			Direction:  RemoteToLocal,
+			LocalPath:  path,
+			RemotePath: path,
+			LocalMeta:  local,
+			Reason:     "remote file deleted since last sync",
+			Priority:   calculatePriority(local),
+		}, nil
+	}
+}
+
+// pruneDeletes removes deletions that are covered by the deletion of a parent
+// directory, and keeps directories whose contents still need to be synchronized
+func pruneDeletes(changes []*Change, conflicts []*Conflict) []*Change {
+	deleted := make(map[string]bool)
+	for _, change := range changes {
+		if change.Type == ChangeDelete {
+			deleted[change.Path()] = true
+		}
+	}
+
+	if len(deleted) == 0 {
+		return changes
+	}
+
+	// A directory must survive if anything below it is still being synchronized
+	keep := make(map[string]bool)
+	markAncestors := func(path string) {
+		for dir := parentPath(path); dir != ""; dir = parentPath(dir) {
+			keep[dir] = true
+		}
+	}
+	for _, change := range changes {
+		if change.Type != ChangeDelete {
+			markAncestors(change.Path())
+		}
+	}
+	for _, conflict := range conflicts {
+		markAncestors(conflict.LocalPath)
+	}
+
+	var pruned []*Change
+	for _, change := range changes {
+		if change.Type == ChangeDelete {
+			path := change.Path()
+			if keep[path] {
+				continue
+			}
+
+			coveredByParent := false
+			for dir := parentPath(path); dir != ""; dir = parentPath(dir) {
+				if deleted[dir] && !keep[dir] {
+					coveredByParent = true
+					break
+				}
+			}
+			if coveredByParent {
+				continue
+			}
+		}
+		pruned = append(pruned, change)
+	}
+
+	return pruned
+}
+
+// treeMetadata returns the metadata for a path in a tree, or nil if it does not exist
+func treeMetadata(tree *FileTree, path string) *FileMetadata {
+	if tree == nil {
+		return nil
+	}
+	if node, exists := tree.PathMap[path]; exists {
+		return node.Metadata
+	}
+	return nil
+}
+
+// parentPath returns the parent of a slash-separated relative path, or "" at the top level
+func parentPath(path string) string {
+	if idx := strings.LastIndex(path, "/"); idx != -1 {
+		return path[:idx]
+	}
+	return ""
+}
+
 // calculatePriority calculates the sync priority for a file based on its metadata
 func calculatePriority(meta *FileMetadata) int {
 	if meta == nil {
@@ -341,7 +670,7 @@ func GetConflictsFromChanges(changes []*Change) []*Conflict {
 		if change.IsConflict() && change.LocalMeta != nil && change.RemoteMeta != nil {
 			key := change.LocalMeta.Path + ":" + change.RemoteMeta.Path
 			if !seen[key] {
-				conflict := detectConflict(change.LocalMeta, change.RemoteMeta)
+				conflict := detectConflict(change.LocalMeta, change.RemoteMeta, nil)
 				if conflict != nil {
 					conflicts = append(conflicts, conflict)
 					seen[key] = true
@@ -77,7 +77,7 @@ func TestDetectConflict_TypeMismatch(t *testing.T) {
 	remote := createTestFile("test.txt", 0, time.Now(), "")
 	remote.IsDirectory = true
 
-	conflict := detectConflict(local, remote)
+	conflict := detectConflict(local, remote, DefaultComparisonOptions())
 
 	require.NotNil(t, conflict)
 	assert.Equal(t, ConflictTypeChanged, conflict.Type)
@@ -89,7 +89,7 @@ func TestDetectConflict_ContentChanged(t *testing.T) {
 	local := createTestFile("test.txt", 100, now.Add(2*time.Minute), "etag123")
 	remote := createTestFile("test.txt", 100, now.Add(3*time.Minute), "etag456")
 
-	conflict := detectConflict(local, remote)
+	conflict := detectConflict(local, remote, DefaultComparisonOptions())
 
 	require.NotNil(t, conflict)
 	assert.Equal(t, ConflictContentChanged, conflict.Type)
@@ -101,7 +101,7 @@ func TestDetectConflict_SizeMismatch(t *testing.T) {
 	local := createTestFile("test.txt", 100, now, "etag123")
 	remote := createTestFile("test.txt", 200, now, "etag456")
 
-	conflict := detectConflict(local, remote)
+	conflict := detectConflict(local, remote, DefaultComparisonOptions())
 
 	require.NotNil(t, conflict)
 	assert.Equal(t, ConflictContentChanged, conflict.Type)
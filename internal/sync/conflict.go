@@ -4,14 +4,33 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"strings"
 	"time"
 )
 
+// ConflictDetails describes a conflict to the user in interactive mode
+type ConflictDetails struct {
+	Conflict *Conflict
+	Diff     string // Line diff from the local to the remote content, empty unless both are small text files
+}
+
+// ConflictChoice is the resolution the user chose for a conflict
+type ConflictChoice struct {
+	Action     string // "local_wins", "remote_wins", "keep_both" or "skip"
+	ApplyToAll bool   // Resolve all remaining conflicts the same way without asking
+}
+
+// ConflictPromptFunc asks the user how to resolve a conflict
+type ConflictPromptFunc func(details *ConflictDetails) (ConflictChoice, error)
+
 // ConflictResolver handles the resolution of synchronization conflicts
 type ConflictResolver struct {
 	config      *SyncConfig
 	logger      *log.Logger
 	resolutions []*ConflictResolution
+	details     func(conflict *Conflict) *ConflictDetails // Describes conflicts in interactive mode
+	applyToAll  string                                    // Interactive choice for all remaining conflicts
 }
 
 // NewConflictResolver creates a new conflict resolver
@@ -36,9 +55,10 @@ func (r *ConflictResolver) ResolveConflict(conflict *Conflict, sourceDirection C
 	var resolution ConflictResolution
 	var err error
 
-	// Use configured conflict policy or default to source_wins
+	// Use configured conflict policy or default to source_wins, forced syncs always
+	// overwrite the target
 	policy := r.config.ConflictPolicy
-	if policy == "" {
+	if policy == "" || r.config.Force {
 		policy = "source_wins"
 	}
 
@@ -51,6 +71,10 @@ func (r *ConflictResolver) ResolveConflict(conflict *Conflict, sourceDirection C
 		resolution, err = r.resolveSkip(conflict)
 	case "manual":
 		resolution, err = r.resolveManual(conflict)
+	case "keep_both":
+		resolution, err = r.resolveKeepBoth(conflict, sourceDirection)
+	case "interactive":
+		resolution, err = r.resolveInteractive(conflict, sourceDirection)
 	default:
 		return nil, fmt.Errorf("unknown conflict policy: %s", policy)
 	}
@@ -233,6 +257,118 @@ func (r *ConflictResolver) resolveManual(conflict *Conflict) (ConflictResolution
 	}, nil
 }
 
+// resolveKeepBoth implements the keep-both conflict resolution policy. The source
+// version keeps its name and the target version is preserved as a conflict copy.
+func (r *ConflictResolver) resolveKeepBoth(conflict *Conflict, sourceDirection ChangeDirection) (ConflictResolution, error) {
+	return keepBothResolution(conflict, sourceDirection, fmt.Sprintf("keep both policy applied for %s conflict", conflict.Type.String())), nil
+}
+
+// keepBothResolution keeps both versions of a conflicting file. When one side was
+// deleted the remaining version is kept, and a file and a directory are skipped
+// since they cannot both keep their name.
+func keepBothResolution(conflict *Conflict, sourceDirection ChangeDirection, reason string) ConflictResolution {
+	resolution := ConflictResolution{
+		Action:    "keep_both",
+		Timestamp: time.Now(),
+		Reason:    reason,
+	}
+
+	local, remote := conflict.LocalMeta, conflict.RemoteMeta
+	switch {
+	case local != nil && remote != nil && !local.IsDirectory && !remote.IsDirectory:
+		if sourceDirection == LocalToRemote {
+			resolution.Path = conflict.LocalPath
+			resolution.CopyPath = conflictCopyPath(conflict.RemotePath, remote.Modified)
+		} else {
+			resolution.Path = conflict.RemotePath
+			resolution.CopyPath = conflictCopyPath(conflict.LocalPath, local.Modified)
+		}
+	case local != nil && remote == nil:
+		resolution.Action = "local_wins"
+		resolution.Path = conflict.LocalPath
+		resolution.Reason = "only the local version is left to keep"
+	case remote != nil && local == nil:
+		resolution.Action = "remote_wins"
+		resolution.Path = conflict.RemotePath
+		resolution.Reason = "only the remote version is left to keep"
+	default:
+		resolution.Action = "skip"
+		resolution.Path = conflict.LocalPath
+		resolution.Reason = fmt.Sprintf("both versions cannot be kept for %s conflict", conflict.Type.String())
+	}
+
+	return resolution
+}
+
+// conflictCopyPath returns the name a conflicting version is preserved under, in the
+// format of the Nextcloud desktop client: "name (conflicted copy 2006-01-02 150405).ext"
+func conflictCopyPath(p string, modified time.Time) string {
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	// The marker goes before the extension, names starting with a dot have none
+	ext := path.Ext(p)
+	if ext == path.Base(p) {
+		ext = ""
+	}
+	base := strings.TrimSuffix(p, ext)
+
+	return fmt.Sprintf("%s (conflicted copy %s)%s", base, modified.Format("2006-01-02 150405"), ext)
+}
+
+// resolveInteractive asks the user how to resolve the conflict, unless an earlier
+// choice applies to all remaining conflicts
+func (r *ConflictResolver) resolveInteractive(conflict *Conflict, sourceDirection ChangeDirection) (ConflictResolution, error) {
+	if r.applyToAll != "" {
+		return interactiveResolution(conflict, sourceDirection, r.applyToAll, "chosen interactively for all remaining conflicts"), nil
+	}
+
+	if r.config.ConflictPrompt == nil {
+		return ConflictResolution{}, fmt.Errorf("interactive conflict policy requires a conflict prompt")
+	}
+
+	details := &ConflictDetails{Conflict: conflict}
+	if r.details != nil {
+		details = r.details(conflict)
+	}
+
+	choice, err := r.config.ConflictPrompt(details)
+	if err != nil {
+		return ConflictResolution{}, fmt.Errorf("failed to ask for conflict resolution: %w", err)
+	}
+
+	switch choice.Action {
+	case "local_wins", "remote_wins", "keep_both", "skip":
+	default:
+		return ConflictResolution{}, fmt.Errorf("unknown conflict resolution: %s", choice.Action)
+	}
+
+	if choice.ApplyToAll {
+		r.applyToAll = choice.Action
+	}
+
+	return interactiveResolution(conflict, sourceDirection, choice.Action, "chosen interactively"), nil
+}
+
+// interactiveResolution creates the resolution for an action chosen by the user
+func interactiveResolution(conflict *Conflict, sourceDirection ChangeDirection, action, reason string) ConflictResolution {
+	if action == "keep_both" {
+		return keepBothResolution(conflict, sourceDirection, reason)
+	}
+
+	resolution := ConflictResolution{
+		Action:    action,
+		Path:      conflict.LocalPath,
+		Timestamp: time.Now(),
+		Reason:    reason,
+	}
+	if action == "remote_wins" {
+		resolution.Path = conflict.RemotePath
+	}
+	return resolution
+}
+
 // ResolveConflicts resolves multiple conflicts
 func (r *ConflictResolver) ResolveConflicts(conflicts []*Conflict, sourceDirection ChangeDirection) ([]*ConflictResolution, error) {
 	resolutions := make([]*ConflictResolution, 0, len(conflicts))
@@ -201,6 +201,132 @@ func TestResolveConflict_Manual(t *testing.T) {
 	assert.Equal(t, "/local/file.txt", resolution.Path)
 }
 
+func TestResolveConflict_KeepBoth(t *testing.T) {
+	modified := time.Date(2024, 3, 7, 14, 5, 9, 0, time.Local)
+	resolver := NewConflictResolver(&SyncConfig{ConflictPolicy: "keep_both"}, nil)
+
+	tests := []struct {
+		name            string
+		conflict        *Conflict
+		sourceDirection ChangeDirection
+		expectedAction  string
+		expectedCopy    string
+	}{
+		{
+			name: "remote version preserved when local is the source",
+			conflict: &Conflict{
+				Type:       ConflictContentChanged,
+				LocalPath:  "docs/report.txt",
+				RemotePath: "docs/report.txt",
+				LocalMeta:  &FileMetadata{Path: "docs/report.txt"},
+				RemoteMeta: &FileMetadata{Path: "docs/report.txt", Modified: modified},
+			},
+			sourceDirection: LocalToRemote,
+			expectedAction:  "keep_both",
+			expectedCopy:    "docs/report (conflicted copy 2024-03-07 140509).txt",
+		},
+		{
+			name: "local version preserved when remote is the source",
+			conflict: &Conflict{
+				Type:       ConflictContentChanged,
+				LocalPath:  "notes",
+				RemotePath: "notes",
+				LocalMeta:  &FileMetadata{Path: "notes", Modified: modified},
+				RemoteMeta: &FileMetadata{Path: "notes"},
+			},
+			sourceDirection: RemoteToLocal,
+			expectedAction:  "keep_both",
+			expectedCopy:    "notes (conflicted copy 2024-03-07 140509)",
+		},
+		{
+			name: "remaining version kept after a deletion",
+			conflict: &Conflict{
+				Type:       ConflictDeletedChanged,
+				LocalPath:  "a.txt",
+				RemotePath: "a.txt",
+				RemoteMeta: &FileMetadata{Path: "a.txt"},
+			},
+			sourceDirection: LocalToRemote,
+			expectedAction:  "remote_wins",
+		},
+		{
+			name: "file and directory skipped",
+			conflict: &Conflict{
+				Type:       ConflictTypeChanged,
+				LocalPath:  "a",
+				RemotePath: "a",
+				LocalMeta:  &FileMetadata{Path: "a", IsDirectory: true},
+				RemoteMeta: &FileMetadata{Path: "a"},
+			},
+			sourceDirection: LocalToRemote,
+			expectedAction:  "skip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolution, err := resolver.ResolveConflict(tt.conflict, tt.sourceDirection)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedAction, resolution.Action)
+			assert.Equal(t, tt.expectedCopy, resolution.CopyPath)
+		})
+	}
+}
+
+func TestConflictCopyPath(t *testing.T) {
+	modified := time.Date(2019, 1, 15, 13, 42, 59, 0, time.Local)
+
+	assert.Equal(t, "photo (conflicted copy 2019-01-15 134259).jpg", conflictCopyPath("photo.jpg", modified))
+	assert.Equal(t, "a.b/archive.tar (conflicted copy 2019-01-15 134259).gz", conflictCopyPath("a.b/archive.tar.gz", modified))
+	assert.Equal(t, "dir/.bashrc (conflicted copy 2019-01-15 134259)", conflictCopyPath("dir/.bashrc", modified))
+	assert.Equal(t, "Makefile (conflicted copy 2019-01-15 134259)", conflictCopyPath("Makefile", modified))
+}
+
+func TestResolveConflict_Interactive(t *testing.T) {
+	var asked []string
+	answers := []ConflictChoice{
+		{Action: "remote_wins"},
+		{Action: "keep_both", ApplyToAll: true},
+	}
+	config := &SyncConfig{
+		ConflictPolicy: "interactive",
+		ConflictPrompt: func(details *ConflictDetails) (ConflictChoice, error) {
+			asked = append(asked, details.Conflict.LocalPath)
+			choice := answers[0]
+			answers = answers[1:]
+			return choice, nil
+		},
+	}
+	resolver := NewConflictResolver(config, nil)
+
+	var resolutions []*ConflictResolution
+	for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+		resolution, err := resolver.ResolveConflict(&Conflict{
+			Type:       ConflictContentChanged,
+			LocalPath:  path,
+			RemotePath: path,
+			LocalMeta:  &FileMetadata{Path: path},
+			RemoteMeta: &FileMetadata{Path: path},
+		}, LocalToRemote)
+		require.NoError(t, err)
+		resolutions = append(resolutions, resolution)
+	}
+
+	assert.Equal(t, []string{"a.txt", "b.txt"}, asked, "the last choice applies to all remaining conflicts")
+	assert.Equal(t, "remote_wins", resolutions[0].Action)
+	assert.Equal(t, "keep_both", resolutions[1].Action)
+	assert.Equal(t, "keep_both", resolutions[2].Action)
+	assert.Equal(t, "c.txt", resolutions[2].Path)
+	assert.Contains(t, resolutions[2].CopyPath, "c (conflicted copy ")
+}
+
+func TestResolveConflict_InteractiveWithoutPrompt(t *testing.T) {
+	resolver := NewConflictResolver(&SyncConfig{ConflictPolicy: "interactive"}, nil)
+
+	_, err := resolver.ResolveConflict(&Conflict{Type: ConflictContentChanged, LocalPath: "a.txt"}, LocalToRemote)
+	assert.Error(t, err)
+}
+
 func TestResolveConflict_UnknownPolicy(t *testing.T) {
 	config := &SyncConfig{
 		ConflictPolicy: "unknown",
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxDiffSize is the largest file shown as a text diff when resolving conflicts
+	maxDiffSize = 64 * 1024
+
+	// maxDiffLines is the largest number of lines per side that textDiff compares
+	maxDiffLines = 1000
+
+	// diffContext is the number of unchanged lines shown around each change
+	diffContext = 3
+)
+
+// isText reports whether content looks like text that can be shown as a diff
+func isText(content []byte) bool {
+	return utf8.Valid(content) && bytes.IndexByte(content, 0) < 0
+}
+
+// textDiff returns a line diff from a to b. Lines only in a start with "-", lines
+// only in b with "+" and unchanged lines with a space. Unchanged lines away from
+// changes are left out. It returns an empty string for identical texts and for
+// texts too long to compare.
+func textDiff(a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+	if len(aLines) > maxDiffLines || len(bLines) > maxDiffLines {
+		return ""
+	}
+
+	// common[i][j] is the length of the longest common subsequence of aLines[i:] and bLines[j:]
+	common := make([][]int32, len(aLines)+1)
+	for i := range common {
+		common[i] = make([]int32, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			lines = append(lines, " "+aLines[i])
+			i++
+			j++
+		case j == len(bLines) || (i < len(aLines) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "-"+aLines[i])
+			i++
+		default:
+			lines = append(lines, "+"+bLines[j])
+			j++
+		}
+	}
+
+	// Only lines near a change are shown
+	shown := make([]bool, len(lines))
+	for k, line := range lines {
+		if line[0] == ' ' {
+			continue
+		}
+		for c := k - diffContext; c <= k+diffContext; c++ {
+			if c >= 0 && c < len(lines) {
+				shown[c] = true
+			}
+		}
+	}
+
+	var diff strings.Builder
+	last := -1
+	for k, line := range lines {
+		if !shown[k] {
+			continue
+		}
+		if last >= 0 && k > last+1 {
+			diff.WriteString("...\n")
+		}
+		diff.WriteString(line)
+		diff.WriteString("\n")
+		last = k
+	}
+
+	return diff.String()
+}
+
+// splitLines splits a text into lines without their line endings
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextDiff(t *testing.T) {
+	assert.Equal(t, "", textDiff("same\n", "same\n"))
+
+	diff := textDiff("one\ntwo\nthree\n", "one\n2\nthree\nfour\n")
+	assert.Equal(t, " one\n-two\n+2\n three\n+four\n", diff)
+}
+
+func TestTextDiff_OnlyShowsContext(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		a = append(a, fmt.Sprintf("line %d", i))
+		b = append(b, fmt.Sprintf("line %d", i))
+	}
+	b[2] = "changed"
+	b[15] = "changed too"
+
+	diff := textDiff(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	assert.Equal(t, ` line 0
+ line 1
+-line 2
++changed
+ line 3
+ line 4
+ line 5
+...
+ line 12
+ line 13
+ line 14
+-line 15
++changed too
+ line 16
+ line 17
+ line 18
+`, diff)
+}
+
+func TestIsText(t *testing.T) {
+	assert.True(t, isText([]byte("plain text\n")))
+	assert.False(t, isText([]byte{0x89, 'P', 'N', 'G', 0, 0}))
+}
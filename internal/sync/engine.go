@@ -2,9 +2,14 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"io/fs"
+	"log"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,9 +19,13 @@ import (
 
 // SyncEngine coordinates the overall synchronization process
 type SyncEngine struct {
-	webdavClient   webdav.Client
-	config         *SyncConfig
-	excludeMatcher *exclude.Matcher
+	webdavClient    webdav.Client
+	config          *SyncConfig
+	excludeMatcher  *exclude.Matcher
+	local           Backend         // Side that the local file tree is built from
+	remote          Backend         // Side that the remote file tree is built from
+	sourceDirection ChangeDirection // Direction the changes of the sync source propagate in
+	scope           []string        // Subtrees an incremental pass is limited to, nil for a full sync
 }
 
 // NewSyncEngine creates a new sync engine
@@ -27,10 +36,15 @@ func NewSyncEngine(client webdav.Client, config *SyncConfig) (*SyncEngine, error
 		return nil, fmt.Errorf("failed to create exclude matcher: %w", err)
 	}
 
+	local, remote, sourceDirection := syncSides(client, config)
+
 	return &SyncEngine{
-		webdavClient:   client,
-		config:         config,
-		excludeMatcher: matcher,
+		webdavClient:    client,
+		config:          config,
+		excludeMatcher:  matcher,
+		local:           local,
+		remote:          remote,
+		sourceDirection: sourceDirection,
 	}, nil
 }
 
@@ -60,145 +74,242 @@ func createExcludeMatcher(config *SyncConfig) (*exclude.Matcher, error) {
 	return exclude.NewMatcherWithRoot(patternSet, config.Source), nil
 }
 
-// BuildLocalFileTree builds a file tree from the local source directory
+// BuildLocalFileTree builds a file tree from the local side of the sync
 func (se *SyncEngine) BuildLocalFileTree(ctx context.Context) (*FileTree, error) {
+	tree, err := se.BuildBackendFileTree(ctx, se.local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build local file tree: %w", err)
+	}
+	return tree, nil
+}
+
+// BuildRemoteFileTree builds a file tree from the remote side of the sync. Where
+// the server reports changes, only those since the last run are fetched.
+func (se *SyncEngine) BuildRemoteFileTree(ctx context.Context) (*FileTree, error) {
+	if state := se.config.RemoteState; state != nil {
+		if syncer, ok := se.remote.(collectionSyncer); ok {
+			if err := se.updateRemoteState(ctx, syncer, state); err == nil {
+				tree := &FileTree{PathMap: make(map[string]*FileNode)}
+				se.addRemoteStateEntries(state, tree)
+				se.buildTreeRelationships(tree)
+				return tree, nil
+			}
+			// The token expired or the server has no sync-collection support
+			state.Reset(syncer.Root())
+		}
+	}
+
+	tree, err := se.BuildBackendFileTree(ctx, se.remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build remote file tree: %w", err)
+	}
+	return tree, nil
+}
+
+// BuildBackendFileTree builds a file tree from everything a backend lists
+func (se *SyncEngine) BuildBackendFileTree(ctx context.Context, backend Backend) (*FileTree, error) {
 	tree := &FileTree{
 		PathMap: make(map[string]*FileNode),
 	}
 
-	// Use exclude matcher to walk the directory
-	err := se.excludeMatcher.Walk(se.config.Source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	if err := se.addBackendPaths(ctx, tree, backend, ""); err != nil {
+		return nil, err
+	}
+	se.buildTreeRelationships(tree)
 
-		// Get relative path from source
-		relPath, err := filepath.Rel(se.config.Source, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path for %s: %w", path, err)
+	return tree, nil
+}
+
+// addBackendPaths adds everything below dir that is not excluded to the tree. In
+// checksum mode the checksums of files are added where the backend can hash them.
+func (se *SyncEngine) addBackendPaths(ctx context.Context, tree *FileTree, backend Backend, dir string) error {
+	var listed []string
+	err := backend.List(ctx, dir, func(meta *FileMetadata) error {
+		if meta.IsDirectory && se.excludeMatcher.ShouldExclude(meta.Path, true) {
+			return fs.SkipDir
 		}
-		if relPath == "." {
-			relPath = ""
+		tree.PathMap[meta.Path] = &FileNode{
+			Metadata: meta,
+			Path:     meta.Path,
 		}
+		listed = append(listed, meta.Path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		// Create metadata
-		metadata := &FileMetadata{
-			Path:        relPath,
-			Name:        info.Name(),
-			Size:        info.Size(),
-			Modified:    info.ModTime(),
-			IsDirectory: info.IsDir(),
-		}
+	// Entries may arrive in no particular order, so exclusions are applied once all are known
+	se.removeExclusions(tree, listed)
 
-		// Create node
-		node := &FileNode{
-			Metadata: metadata,
-			Path:     relPath,
+	hasher, ok := backend.(Hasher)
+	if !se.config.Checksums || !ok {
+		return nil
+	}
+	for _, relPath := range listed {
+		node, exists := tree.PathMap[relPath]
+		if !exists || node.Metadata.IsDirectory || node.Metadata.Checksum != "" {
+			continue
 		}
+		checksum, err := hasher.Hash(ctx, relPath)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", relPath, err)
+		}
+		node.Metadata.Checksum = checksum
+	}
 
-		// Add to tree
-		tree.PathMap[relPath] = node
+	return nil
+}
 
-		// Set as root if this is the source directory
-		if relPath == "" {
-			tree.Root = node
-		}
+// treeLister is implemented by clients that can list a whole remote tree at once
+type treeLister interface {
+	ListTree(ctx context.Context, path string, fn webdav.TreeFunc) error
+}
 
-		return nil
-	})
+// collectionSyncer is implemented by backends that report the changes since a sync token
+type collectionSyncer interface {
+	Root() string
+	SyncCollection(ctx context.Context, token string) (*webdav.SyncCollectionResult, error)
+}
 
+// updateRemoteState brings the remote state up to date with a sync-collection report
+func (se *SyncEngine) updateRemoteState(ctx context.Context, syncer collectionSyncer, state *RemoteState) error {
+	if state.root != syncer.Root() {
+		state.Reset(syncer.Root())
+	}
+
+	result, err := syncer.SyncCollection(ctx, state.Token())
 	if err != nil {
-		return nil, fmt.Errorf("failed to build local file tree: %w", err)
+		return fmt.Errorf("failed to fetch remote changes of %s: %w", syncer.Root(), err)
 	}
 
-	// Build parent-child relationships
-	se.buildTreeRelationships(tree)
+	state.Apply(result)
+	return nil
+}
 
-	return tree, nil
+// addRemoteStateEntries adds the files of the remote state that are not excluded to the tree
+func (se *SyncEngine) addRemoteStateEntries(state *RemoteState, tree *FileTree) {
+	listed := make([]string, 0, len(state.entries))
+	for relPath, meta := range state.entries {
+		metadata := *meta
+		tree.PathMap[relPath] = &FileNode{
+			Metadata: &metadata,
+			Path:     relPath,
+		}
+		listed = append(listed, relPath)
+	}
+
+	se.removeExclusions(tree, listed)
 }
 
-// BuildRemoteFileTree builds a file tree from the remote target
-func (se *SyncEngine) BuildRemoteFileTree(ctx context.Context) (*FileTree, error) {
-	tree := &FileTree{
-		PathMap: make(map[string]*FileNode),
+// removeExclusions removes the listed paths that are excluded from the tree
+func (se *SyncEngine) removeExclusions(tree *FileTree, listed []string) {
+	excludedDirs := make(map[string]bool)
+	for _, relPath := range listed {
+		if se.listedExcluded(tree, relPath, excludedDirs) {
+			delete(tree.PathMap, relPath)
+		}
 	}
+}
 
-	// Extract directory path from remote URL
-	remotePath := se.extractRemotePath(se.config.Target)
+// listedExcluded reports whether a listed path or one of its parent directories
+// is excluded. Results for directories are cached in excludedDirs.
+func (se *SyncEngine) listedExcluded(tree *FileTree, relPath string, excludedDirs map[string]bool) bool {
+	if node, exists := tree.PathMap[relPath]; exists && !node.Metadata.IsDirectory {
+		if se.excludeMatcher.ShouldExclude(relPath, false) {
+			return true
+		}
+		relPath = parentPath(relPath)
+	}
 
-	// List remote directory recursively
-	err := se.listRemoteDirectory(ctx, remotePath, "", tree)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build remote file tree: %w", err)
+	for dir := relPath; dir != ""; dir = parentPath(dir) {
+		excluded, known := excludedDirs[dir]
+		if !known {
+			excluded = se.excludeMatcher.ShouldExclude(dir, true)
+			excludedDirs[dir] = excluded
+		}
+		if excluded {
+			return true
+		}
 	}
 
-	// Build parent-child relationships
-	se.buildTreeRelationships(tree)
+	return false
+}
 
-	return tree, nil
+// remoteFileMetadata converts a listed remote file to file metadata
+func remoteFileMetadata(relPath string, file *webdav.WebDAVFile) *FileMetadata {
+	return &FileMetadata{
+		Path:        relPath,
+		Name:        file.Name,
+		Size:        file.Size,
+		Modified:    file.LastModified,
+		ETag:        file.ETag,
+		IsDirectory: file.IsDirectory,
+		Checksum:    webdav.ChecksumValue(file.Checksums, webdav.ChecksumSHA256),
+		FileID:      file.FileID,
+	}
 }
 
-// listRemoteDirectory recursively lists remote directory and builds file tree
-func (se *SyncEngine) listRemoteDirectory(ctx context.Context, basePath, currentPath string, tree *FileTree) error {
-	// Construct full path
-	fullPath := basePath
-	if currentPath != "" {
-		fullPath = basePath + "/" + currentPath
+// BuildLocalSubtrees builds a file tree that only contains the given root-relative
+// subtrees of the local side. Subtrees that do not exist are left out.
+func (se *SyncEngine) BuildLocalSubtrees(ctx context.Context, subtrees []string) (*FileTree, error) {
+	tree, err := se.buildSubtrees(ctx, se.local, subtrees)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build local file tree: %w", err)
 	}
+	return tree, nil
+}
 
-	// List directory contents
-	files, err := se.webdavClient.ListDirectory(ctx, fullPath)
+// BuildRemoteSubtrees builds a file tree that only contains the given root-relative
+// subtrees of the remote side. Subtrees that do not exist are left out.
+func (se *SyncEngine) BuildRemoteSubtrees(ctx context.Context, subtrees []string) (*FileTree, error) {
+	tree, err := se.buildSubtrees(ctx, se.remote, subtrees)
 	if err != nil {
-		return fmt.Errorf("failed to list remote directory %s: %w", fullPath, err)
+		return nil, fmt.Errorf("failed to build remote file tree: %w", err)
 	}
+	return tree, nil
+}
 
-	for _, file := range files {
-		// Check if file should be excluded
-		relPath := currentPath
-		if relPath != "" {
-			relPath += "/" + file.Name
-		} else {
-			relPath = file.Name
-		}
+// buildSubtrees builds a file tree that only contains the given subtrees of a backend
+func (se *SyncEngine) buildSubtrees(ctx context.Context, backend Backend, subtrees []string) (*FileTree, error) {
+	tree := &FileTree{
+		PathMap: make(map[string]*FileNode),
+	}
 
-		if se.excludeMatcher.ShouldExclude(relPath, file.IsDirectory) {
-			continue // Skip excluded files/directories
+	for _, subtree := range subtrees {
+		meta, err := backend.Stat(ctx, subtree)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to stat %s: %w", subtree, err)
 		}
 
-		// Create metadata
-		metadata := &FileMetadata{
-			Path:        relPath,
-			Name:        file.Name,
-			Size:        file.Size,
-			Modified:    file.LastModified,
-			ETag:        file.ETag,
-			IsDirectory: file.IsDirectory,
+		if se.excludeMatcher.ShouldExclude(subtree, meta.IsDirectory) {
+			continue
 		}
 
-		// Create node
-		node := &FileNode{
-			Metadata: metadata,
-			Path:     relPath,
+		meta.Path = subtree
+		tree.PathMap[subtree] = &FileNode{
+			Metadata: meta,
+			Path:     subtree,
 		}
-
-		// Add to tree
-		tree.PathMap[relPath] = node
-
-		// Set as root if this is the base directory
-		if currentPath == "" && file.Name == filepath.Base(basePath) {
-			tree.Root = node
+		if hasher, ok := backend.(Hasher); ok && se.config.Checksums && !meta.IsDirectory && meta.Checksum == "" {
+			if meta.Checksum, err = hasher.Hash(ctx, subtree); err != nil {
+				return nil, fmt.Errorf("failed to hash %s: %w", subtree, err)
+			}
 		}
 
-		// Recursively list subdirectories
-		if file.IsDirectory {
-			err := se.listRemoteDirectory(ctx, basePath, relPath, tree)
-			if err != nil {
-				return fmt.Errorf("failed to list subdirectory %s: %w", relPath, err)
+		if meta.IsDirectory {
+			if err := se.addBackendPaths(ctx, tree, backend, subtree); err != nil {
+				return nil, fmt.Errorf("failed to build subtree %s: %w", subtree, err)
 			}
 		}
 	}
 
-	return nil
+	se.buildTreeRelationships(tree)
+
+	return tree, nil
 }
 
 // buildTreeRelationships builds parent-child relationships in the file tree
@@ -221,6 +332,16 @@ func (se *SyncEngine) buildTreeRelationships(tree *FileTree) {
 
 // extractRemotePath extracts directory path from remote URL
 func (se *SyncEngine) extractRemotePath(remoteURL string) string {
+	return RemoteBasePath(remoteURL)
+}
+
+// RemoteRoot returns the remote base path the target URL points to
+func (se *SyncEngine) RemoteRoot() string {
+	return se.extractRemotePath(se.config.Target)
+}
+
+// RemoteBasePath extracts the directory path from a remote URL
+func RemoteBasePath(remoteURL string) string {
 	// This is a simplified implementation
 	// In a full implementation, this would parse the Nextcloud URL properly
 	if strings.Contains(remoteURL, "?dir=") {
@@ -236,32 +357,111 @@ func (se *SyncEngine) extractRemotePath(remoteURL string) string {
 func (se *SyncEngine) Sync(ctx context.Context) (*SyncResult, error) {
 	startTime := time.Now()
 
-	// Build file trees
-	var localTree, remoteTree *FileTree
+	localTree, err := se.BuildLocalFileTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteTree, err := se.BuildRemoteFileTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return se.performSync(ctx, localTree, remoteTree, startTime, true)
+}
+
+// performSync runs the sync for the given trees. Checksums of files that were not
+// part of a complete local tree are pruned from the checksum cache.
+func (se *SyncEngine) performSync(ctx context.Context, localTree, remoteTree *FileTree, startTime time.Time, completeLocalTree bool) (*SyncResult, error) {
+	var result *SyncResult
 	var err error
 
-	if se.isLocalSource() {
-		localTree, err = se.BuildLocalFileTree(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build local file tree: %w", err)
+	// Perform bidirectional sync if configured
+	isBidirectional := se.config.Bidirectional || se.config.Direction == SyncDirectionBidirectional
+	if isBidirectional {
+		result, err = se.performBidirectionalSync(ctx, localTree, remoteTree, startTime)
+	} else {
+		// Perform unidirectional sync (original logic)
+		result, err = se.performUnidirectionalSync(ctx, localTree, remoteTree, startTime)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if state := se.config.RemoteState; state != nil {
+		if err := state.Save(); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Failed to save remote state: %v", err))
 		}
 	}
 
-	if se.isRemoteTarget() {
-		remoteTree, err = se.BuildRemoteFileTree(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build remote file tree: %w", err)
+	if cache := se.config.ChecksumCache; cache != nil {
+		if completeLocalTree {
+			cache.PruneUnused()
+		}
+		if err := cache.Save(); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Failed to save checksum cache: %v", err))
 		}
 	}
 
-	// Perform bidirectional sync if configured
-	isBidirectional := se.config.Bidirectional || se.config.Direction == SyncDirectionBidirectional
-	if isBidirectional {
-		return se.performBidirectionalSync(ctx, localTree, remoteTree, startTime)
+	return result, nil
+}
+
+// SyncSubtrees performs an incremental sync limited to the given root-relative paths.
+// Only the affected subtrees are listed on both sides instead of the full file trees.
+func (se *SyncEngine) SyncSubtrees(ctx context.Context, subtrees []string) (*SyncResult, error) {
+	roots := MinimalSubtrees(subtrees)
+	if len(roots) == 0 || (len(roots) == 1 && roots[0] == "") {
+		return se.Sync(ctx)
+	}
+
+	startTime := time.Now()
+
+	localTree, err := se.BuildLocalSubtrees(ctx, roots)
+	if err != nil {
+		return nil, err
 	}
 
-	// Perform unidirectional sync (original logic)
-	return se.performUnidirectionalSync(ctx, localTree, remoteTree, startTime)
+	remoteTree, err := se.BuildRemoteSubtrees(ctx, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	// Journal entries outside the subtrees were not looked at and must not be touched
+	se.scope = roots
+	defer func() { se.scope = nil }()
+
+	return se.performSync(ctx, localTree, remoteTree, startTime, false)
+}
+
+// comparisonOptions returns the file comparison options for this sync. An ETag
+// only identifies a version on the backend that issued it, so ETags are only
+// compared if both sides are the same backend. Otherwise size, modification
+// time, checksums and the journal decide.
+func (se *SyncEngine) comparisonOptions() *ComparisonOptions {
+	opts := DefaultComparisonOptions()
+	opts.CompareChecksums = se.config.Checksums
+	opts.CompareETags = se.local == se.remote
+	return opts
+}
+
+// MinimalSubtrees normalizes root-relative paths and drops those contained in another path of the list
+func MinimalSubtrees(paths []string) []string {
+	normalized := make([]string, 0, len(paths))
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")
+		normalized = append(normalized, p)
+	}
+	sort.Strings(normalized)
+
+	var roots []string
+	for _, p := range normalized {
+		if len(roots) > 0 && withinSubtree(p, roots[len(roots)-1]) {
+			continue
+		}
+		roots = append(roots, p)
+	}
+
+	return roots
 }
 
 // filterExcludedChanges removes changes for excluded files
@@ -283,16 +483,6 @@ func (se *SyncEngine) filterExcludedChanges(changes []*Change) []*Change {
 	return filtered
 }
 
-// isLocalSource checks if source is a local path
-func (se *SyncEngine) isLocalSource() bool {
-	return !strings.Contains(se.config.Source, "://")
-}
-
-// isRemoteTarget checks if target is a remote URL
-func (se *SyncEngine) isRemoteTarget() bool {
-	return strings.Contains(se.config.Target, "://")
-}
-
 // GetExcludeMatcher returns the exclude matcher for testing
 func (se *SyncEngine) GetExcludeMatcher() *exclude.Matcher {
 	return se.excludeMatcher
@@ -300,13 +490,12 @@ func (se *SyncEngine) GetExcludeMatcher() *exclude.Matcher {
 
 // performBidirectionalSync handles two-way synchronization between local and remote
 func (se *SyncEngine) performBidirectionalSync(ctx context.Context, localTree, remoteTree *FileTree, startTime time.Time) (*SyncResult, error) {
-	// Detect changes in both directions
-	localChanges, localConflicts := DetectChanges(localTree, remoteTree, DefaultComparisonOptions())
-	remoteChanges, remoteConflicts := DetectChanges(remoteTree, localTree, DefaultComparisonOptions())
-
-	// Combine all changes and conflicts
-	allChanges := append(localChanges, remoteChanges...)
-	allConflicts := append(localConflicts, remoteConflicts...)
+	// Detect changes in both directions, using the journal as common baseline if available
+	baseline := se.config.Journal
+	if baseline != nil && se.scope != nil {
+		baseline = baseline.Subset(se.scope)
+	}
+	allChanges, allConflicts := DetectChangesWithJournal(localTree, remoteTree, baseline, se.comparisonOptions())
 
 	// Filter out excluded files from changes
 	filteredChanges := se.filterExcludedChanges(allChanges)
@@ -320,6 +509,8 @@ func (se *SyncEngine) performBidirectionalSync(ctx context.Context, localTree, r
 
 	// Add conflicts to plan
 	plan.Conflicts = append(plan.Conflicts, allConflicts...)
+	se.resolveConflicts(ctx, executor, plan)
+	se.config.emitConflicts(plan.Conflicts)
 
 	// Execute plan if not dry run
 	if se.config.DryRun {
@@ -334,27 +525,40 @@ func (se *SyncEngine) performBidirectionalSync(ctx context.Context, localTree, r
 			Duration:      0,
 			DryRun:        true,
 			Bidirectional: false,
+			Plan:          plan,
 		}, nil
 	}
 
-	result, err := executor.ExecutePlan(plan)
+	result, err := executor.ExecutePlan(ctx, plan)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute sync plan: %w", err)
 	}
 
+	// Record the new common state for the next run
+	if se.config.Journal != nil {
+		se.updateJournal(localTree, remoteTree, baseline, allChanges, allConflicts)
+		if err := se.config.Journal.Save(); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Failed to save sync journal: %v", err))
+		}
+	}
+
 	// Update result with timing info
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(startTime)
 	result.DryRun = se.config.DryRun
 	result.Bidirectional = true
+	result.Plan = plan
 
 	return result, nil
 }
 
 // performUnidirectionalSync handles one-way synchronization (original logic)
 func (se *SyncEngine) performUnidirectionalSync(ctx context.Context, localTree, remoteTree *FileTree, startTime time.Time) (*SyncResult, error) {
-	// Detect changes
-	changes, conflicts := DetectChanges(localTree, remoteTree, DefaultComparisonOptions())
+	// Detect changes, in delete mode renames on the source side are matched without a journal
+	opts := se.comparisonOptions()
+	opts.SourceDirection = se.sourceDirection
+	opts.DeleteTargetOnly = se.config.Delete
+	changes, conflicts := DetectChanges(localTree, remoteTree, opts)
 
 	// Filter out excluded files from changes
 	filteredChanges := se.filterExcludedChanges(changes)
@@ -366,8 +570,10 @@ func (se *SyncEngine) performUnidirectionalSync(ctx context.Context, localTree,
 		return nil, fmt.Errorf("failed to create sync plan: %w", err)
 	}
 
-	// Add conflicts to plan
-	plan.Conflicts = append(plan.Conflicts, conflicts...)
+	// Add conflicts to plan, they describe the changes in both directions the planner reports more precisely
+	plan.Conflicts = mergeConflicts(conflicts, plan.Conflicts)
+	se.resolveConflicts(ctx, executor, plan)
+	se.config.emitConflicts(plan.Conflicts)
 
 	// Execute plan if not dry run
 	if se.config.DryRun {
@@ -382,10 +588,11 @@ func (se *SyncEngine) performUnidirectionalSync(ctx context.Context, localTree,
 			Duration:      0,
 			DryRun:        true,
 			Bidirectional: false,
+			Plan:          plan,
 		}, nil
 	}
 
-	result, err := executor.ExecutePlan(plan)
+	result, err := executor.ExecutePlan(ctx, plan)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute sync plan: %w", err)
 	}
@@ -394,10 +601,177 @@ func (se *SyncEngine) performUnidirectionalSync(ctx context.Context, localTree,
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(startTime)
 	result.Bidirectional = false
+	result.Plan = plan
 
 	return result, nil
 }
 
+// mergeConflicts adds the conflicts for paths that are not in conflict yet
+func mergeConflicts(conflicts, more []*Conflict) []*Conflict {
+	known := make(map[string]bool, len(conflicts))
+	for _, conflict := range conflicts {
+		known[conflict.LocalPath+"\x00"+conflict.RemotePath] = true
+	}
+
+	for _, conflict := range more {
+		key := conflict.LocalPath + "\x00" + conflict.RemotePath
+		if !known[key] {
+			known[key] = true
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts
+}
+
+// resolveConflicts resolves the planned conflicts with the configured conflict
+// policy, records the resolutions in the conflicts and plans the operations that
+// apply them
+func (se *SyncEngine) resolveConflicts(ctx context.Context, executor *OperationExecutor, plan *SyncPlan) {
+	if len(plan.Conflicts) == 0 {
+		return
+	}
+
+	// Resolutions are reported with the conflicts, so the resolver does not log them
+	resolver := NewConflictResolver(se.config, log.New(io.Discard, "", 0))
+	resolver.details = func(conflict *Conflict) *ConflictDetails {
+		return se.conflictDetails(ctx, executor, conflict)
+	}
+
+	for _, conflict := range plan.Conflicts {
+		resolution, err := resolver.ResolveConflict(conflict, se.sourceDirection)
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Failed to resolve conflict at %s: %v", conflict.LocalPath, err))
+			continue
+		}
+		conflict.Resolution = *resolution
+
+		operations := planResolution(plan, conflict, se.sourceDirection)
+		if len(operations) == 0 {
+			continue
+		}
+		se.replaceConflictSubtree(plan, conflict, operations[len(operations)-1])
+
+		for _, op := range operations {
+			plan.Operations = append(plan.Operations, op)
+			plan.TotalFiles++
+			plan.TotalSize += op.Size
+		}
+	}
+}
+
+// replaceConflictSubtree orders the planned operations below a conflicting path after
+// the resolution. When a file replaced a directory they are dropped instead, since the
+// directory contents are gone with it.
+func (se *SyncEngine) replaceConflictSubtree(plan *SyncPlan, conflict *Conflict, resolution *SyncOperation) {
+	if !metaIsDirectory(conflict.LocalMeta) && !metaIsDirectory(conflict.RemoteMeta) {
+		return
+	}
+
+	kept := plan.Operations[:0]
+	for _, op := range plan.Operations {
+		if op.TargetPath == conflict.LocalPath || !withinSubtree(op.TargetPath, conflict.LocalPath) {
+			kept = append(kept, op)
+			continue
+		}
+
+		if resolution.IsDirectory && op.Direction == resolution.Direction {
+			op.Dependencies = append(op.Dependencies, resolution.ID)
+			kept = append(kept, op)
+			continue
+		}
+
+		plan.TotalFiles--
+		plan.TotalSize -= op.Size
+	}
+	plan.Operations = kept
+}
+
+// metaIsDirectory reports whether metadata exists and describes a directory
+func metaIsDirectory(meta *FileMetadata) bool {
+	return meta != nil && meta.IsDirectory
+}
+
+// conflictDetails describes a conflict, with a diff of the contents if both sides
+// are small text files
+func (se *SyncEngine) conflictDetails(ctx context.Context, executor *OperationExecutor, conflict *Conflict) *ConflictDetails {
+	details := &ConflictDetails{Conflict: conflict}
+
+	local, remote := conflict.LocalMeta, conflict.RemoteMeta
+	if local == nil || remote == nil || local.IsDirectory || remote.IsDirectory ||
+		local.Size > maxDiffSize || remote.Size > maxDiffSize {
+		return details
+	}
+
+	localContent, ok := readDiffContent(executor.local.Open(ctx, conflict.LocalPath))
+	if !ok {
+		return details
+	}
+	remoteContent, ok := readDiffContent(executor.remote.Open(ctx, conflict.RemotePath))
+	if !ok {
+		return details
+	}
+
+	details.Diff = textDiff(string(localContent), string(remoteContent))
+	return details
+}
+
+// readDiffContent reads an opened file if it is small enough and text that can be diffed
+func readDiffContent(reader io.ReadCloser, err error) ([]byte, bool) {
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxDiffSize+1))
+	if err != nil || len(content) > maxDiffSize || !isText(content) {
+		return nil, false
+	}
+	return content, true
+}
+
+// updateJournal records paths that are in sync on both sides and forgets baseline paths
+// that no longer exist anywhere. Executed operations are recorded by the executor.
+func (se *SyncEngine) updateJournal(localTree, remoteTree *FileTree, baseline *Journal, changes []*Change, conflicts []*Conflict) {
+	journal := se.config.Journal
+	opts := se.comparisonOptions()
+
+	pending := make(map[string]bool)
+	for _, change := range changes {
+		pending[change.Path()] = true
+	}
+	for _, conflict := range conflicts {
+		pending[conflict.LocalPath] = true
+		pending[conflict.RemotePath] = true
+	}
+
+	if localTree != nil {
+		for path, node := range localTree.PathMap {
+			if path == "" || pending[path] {
+				continue
+			}
+			remote := treeMetadata(remoteTree, path)
+			if remote == nil || remote.IsDirectory != node.Metadata.IsDirectory {
+				continue
+			}
+			// Refresh entries of paths that converged on their own
+			if entry, exists := journal.Get(path); exists && !entry.LocalChanged(node.Metadata, opts) && !entry.RemoteChanged(remote, opts) {
+				continue
+			}
+			journal.Put(NewJournalEntry(path, node.Metadata, remote))
+		}
+	}
+
+	for _, path := range baseline.Paths() {
+		if pending[path] {
+			continue
+		}
+		if treeMetadata(localTree, path) == nil && treeMetadata(remoteTree, path) == nil {
+			journal.Delete(path)
+		}
+	}
+}
+
 // createBidirectionalPlan creates an operation plan optimized for bidirectional sync
 func (se *SyncEngine) createBidirectionalPlan(executor *OperationExecutor, changes []*Change) (*SyncPlan, error) {
 	plan := &SyncPlan{
@@ -424,7 +798,7 @@ func (se *SyncEngine) createBidirectionalPlan(executor *OperationExecutor, chang
 
 	// Plan local to remote operations first (typically uploads are faster to start)
 	for _, change := range localToRemote {
-		ops, err := executor.planChange(change)
+		ops, err := executor.planChange(plan, change)
 		if err != nil {
 			return nil, fmt.Errorf("failed to plan local to remote change %s: %w", change.Path(), err)
 		}
@@ -433,13 +807,16 @@ func (se *SyncEngine) createBidirectionalPlan(executor *OperationExecutor, chang
 
 	// Plan remote to local operations (downloads)
 	for _, change := range remoteToLocal {
-		ops, err := executor.planChange(change)
+		ops, err := executor.planChange(plan, change)
 		if err != nil {
 			return nil, fmt.Errorf("failed to plan remote to local change %s: %w", change.Path(), err)
 		}
 		plan.Operations = append(plan.Operations, ops...)
 	}
 
+	linkDirectoryDependencies(plan.Operations)
+	linkMoveDependencies(plan.Operations)
+
 	// Calculate total files and size
 	for _, op := range plan.Operations {
 		plan.TotalFiles++
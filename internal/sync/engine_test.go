@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -92,6 +93,34 @@ func (m *MockWebDAVClient) CopyFile(ctx context.Context, source, destination str
 	return nil
 }
 
+func (m *MockWebDAVClient) SyncCollection(ctx context.Context, path, token string) (*webdav.SyncCollectionResult, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *MockWebDAVClient) ListTrash(ctx context.Context) ([]*webdav.TrashItem, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *MockWebDAVClient) RestoreTrashItem(ctx context.Context, name string) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *MockWebDAVClient) DeleteTrashItem(ctx context.Context, name string) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *MockWebDAVClient) EmptyTrash(ctx context.Context) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *MockWebDAVClient) ListVersions(ctx context.Context, path string) ([]*webdav.FileVersion, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *MockWebDAVClient) RestoreVersion(ctx context.Context, version *webdav.FileVersion) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
 func (m *MockWebDAVClient) Close() error {
 	return nil
 }
@@ -206,7 +235,7 @@ func TestSyncEngine_BuildLocalFileTree(t *testing.T) {
 	assert.NotContains(t, tree.PathMap, ".hidden")        // Excluded by .nextcloudignore
 
 	// Check that included files are in the tree
-	assert.Contains(t, tree.PathMap, "")           // Root directory
+	assert.NotContains(t, tree.PathMap, "")        // The sync root is not part of the tree, like on the remote side
 	assert.Contains(t, tree.PathMap, "main.go")    // Should be included
 	assert.Contains(t, tree.PathMap, "src/app.go") // Should be included
 	assert.Contains(t, tree.PathMap, "src")        // Directory should be included
@@ -277,6 +306,48 @@ func TestSyncEngine_BuildRemoteFileTree(t *testing.T) {
 	assert.Contains(t, tree.PathMap, "documents.txt")
 }
 
+// treeListingClient lists the whole tree in one call, children before their parents
+type treeListingClient struct {
+	*MockWebDAVClient
+	entries []string
+	listed  []string
+}
+
+func (m *treeListingClient) ListTree(ctx context.Context, path string, fn webdav.TreeFunc) error {
+	m.listed = append(m.listed, path)
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		relPath := m.entries[i]
+		isDir := !strings.Contains(filepath.Base(relPath), ".")
+		if err := fn(relPath, &webdav.WebDAVFile{Name: filepath.Base(relPath), IsDirectory: isDir}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSyncEngine_BuildRemoteFileTreeWithTreeListing(t *testing.T) {
+	client := &treeListingClient{
+		MockWebDAVClient: NewMockWebDAVClient(),
+		entries:          []string{"docs", "docs/a.txt", "docs/temp.tmp", "build", "build/out", "build/out/b.txt"},
+	}
+
+	engine, err := NewSyncEngine(client, &SyncConfig{
+		Source:          "/local/source",
+		Target:          "https://cloud.example.com/files/test?dir=/test",
+		ExcludePatterns: []string{"*.tmp", "build/"},
+	})
+	require.NoError(t, err)
+
+	tree, err := engine.BuildRemoteFileTree(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/test"}, client.listed)
+	assert.Len(t, tree.PathMap, 2)
+	assert.Contains(t, tree.PathMap, "docs")
+	assert.Contains(t, tree.PathMap, "docs/a.txt")
+	require.Len(t, tree.PathMap["docs"].Children, 1)
+}
+
 func TestSyncEngine_FilterExcludedChanges(t *testing.T) {
 	config := &SyncConfig{
 		Source:          "/test/source",
@@ -358,4 +429,167 @@ func TestSyncEngine_Integration(t *testing.T) {
 
 	// Should only include .txt file, not .log file
 	assert.GreaterOrEqual(t, result.TotalFiles, 1)
+
+	// The plan is reported even though nothing was executed
+	require.NotNil(t, result.Plan)
+	assert.Equal(t, result.TotalFiles, result.Plan.TotalFiles)
+}
+
+func TestMinimalSubtrees(t *testing.T) {
+	assert.Equal(t, []string{"a", "b/c"}, MinimalSubtrees([]string{"b/c", "a/x.txt", "/a/", "b/c/d", "a"}))
+	assert.Equal(t, []string{""}, MinimalSubtrees([]string{"docs", ""}))
+	assert.Equal(t, []string{"a", "ab"}, MinimalSubtrees([]string{"ab", "a"}))
+}
+
+func TestSyncEngine_SyncSubtrees(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "other"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "other", "b.txt"), []byte("b"), 0644))
+
+	// A synced file outside the subtree, which a full pass would propagate as deleted
+	now := time.Now()
+	journal := NewJournal("")
+	journal.Put(NewJournalEntry("other/c.txt",
+		createTestFile("other/c.txt", 1, now, ""),
+		createTestFile("other/c.txt", 1, now, `"c"`)))
+
+	mockClient := newMockWebDAVClient()
+	config := &SyncConfig{
+		Source:    tmpDir,
+		Target:    "https://cloud.example.com/files/test?dir=/remote",
+		Direction: SyncDirectionBidirectional,
+		Journal:   journal,
+	}
+
+	engine, err := NewSyncEngine(mockClient, config)
+	require.NoError(t, err)
+
+	result, err := engine.SyncSubtrees(context.Background(), []string{"docs/a.txt", "docs"})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	assert.Contains(t, mockClient.files, "/remote/docs/a.txt")
+	assert.NotContains(t, mockClient.files, "/remote/other/b.txt")
+
+	_, exists := journal.Get("other/c.txt")
+	assert.True(t, exists)
+	_, exists = journal.Get("docs/a.txt")
+	assert.True(t, exists)
+}
+
+func TestSyncEngine_ResolveConflictsInteractively(t *testing.T) {
+	localDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "notes.txt"), []byte("one\ntwo\n"), 0644))
+
+	client := newMockWebDAVClient()
+	client.files["/test/notes.txt"] = &mockFile{content: []byte("one\n2\n")}
+
+	var shown *ConflictDetails
+	config := &SyncConfig{
+		Source:         localDir,
+		Target:         "https://cloud.example.com/files/test?dir=/test",
+		ConflictPolicy: "interactive",
+		ConflictPrompt: func(details *ConflictDetails) (ConflictChoice, error) {
+			shown = details
+			return ConflictChoice{Action: "remote_wins"}, nil
+		},
+	}
+	engine, err := NewSyncEngine(client, config)
+	require.NoError(t, err)
+
+	conflict := &Conflict{
+		Type:       ConflictContentChanged,
+		LocalPath:  "notes.txt",
+		RemotePath: "notes.txt",
+		LocalMeta:  &FileMetadata{Path: "notes.txt", Size: 8},
+		RemoteMeta: &FileMetadata{Path: "notes.txt", Size: 6},
+	}
+	plan := &SyncPlan{Conflicts: []*Conflict{conflict}}
+	engine.resolveConflicts(context.Background(), NewOperationExecutor(client, config), plan)
+
+	require.NotNil(t, shown)
+	assert.Equal(t, " one\n-two\n+2\n", shown.Diff)
+	assert.Equal(t, "remote_wins", conflict.Resolution.Action)
+	assert.Empty(t, plan.Warnings)
+}
+
+func TestSyncEngine_ResolveConflictsPlansWinner(t *testing.T) {
+	config := &SyncConfig{
+		Source:         "/local/source",
+		Target:         "https://cloud.example.com/files/test?dir=/test",
+		ConflictPolicy: "target_wins",
+	}
+	engine, err := NewSyncEngine(NewMockWebDAVClient(), config)
+	require.NoError(t, err)
+
+	newPlan := func() *SyncPlan {
+		child := &SyncOperation{ID: "child", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "docs/a.txt", TargetPath: "docs/a.txt", Size: 3}
+		return &SyncPlan{
+			Operations: []*SyncOperation{child},
+			TotalFiles: 1,
+			TotalSize:  3,
+			Conflicts: []*Conflict{{
+				Type:       ConflictTypeChanged,
+				LocalPath:  "docs",
+				RemotePath: "docs",
+				LocalMeta:  &FileMetadata{Path: "docs", IsDirectory: true},
+				RemoteMeta: &FileMetadata{Path: "docs", Size: 7},
+			}},
+		}
+	}
+
+	// The directory is prioritized, so the remote file makes way for the local directory
+	plan := newPlan()
+	engine.resolveConflicts(context.Background(), NewOperationExecutor(engine.webdavClient, config), plan)
+	assert.Equal(t, "local_wins", plan.Conflicts[0].Resolution.Action)
+	require.Len(t, plan.Operations, 3)
+	mkdir := plan.Operations[2]
+	assert.True(t, mkdir.IsDirectory)
+	assert.Contains(t, plan.Operations[0].Dependencies, mkdir.ID)
+	assert.Equal(t, 3, plan.TotalFiles)
+
+	// With a file winning, the planned directory contents are dropped
+	plan = newPlan()
+	plan.Conflicts[0].LocalMeta = &FileMetadata{Path: "docs", Size: 4}
+	plan.Conflicts[0].RemoteMeta = &FileMetadata{Path: "docs", IsDirectory: true}
+	plan.Conflicts[0].Type = ConflictContentChanged
+	config.Force = true
+	engine.resolveConflicts(context.Background(), NewOperationExecutor(engine.webdavClient, config), plan)
+	assert.Equal(t, "local_wins", plan.Conflicts[0].Resolution.Action, "force lets the source win")
+	require.Len(t, plan.Operations, 2)
+	assert.Equal(t, ChangeDelete, plan.Operations[0].Type)
+	assert.Equal(t, ChangeCreate, plan.Operations[1].Type)
+	assert.Equal(t, int64(4), plan.TotalSize)
+}
+
+func TestSyncEngine_CreateBidirectionalPlanDirectoryDependencies(t *testing.T) {
+	config := &SyncConfig{
+		Source: "/local/source",
+		Target: "https://cloud.example.com/files/test?dir=/test",
+	}
+	engine, err := NewSyncEngine(NewMockWebDAVClient(), config)
+	require.NoError(t, err)
+
+	now := time.Now()
+	changes := []*Change{
+		CompareFiles(createTestFile("docs/a.txt", 3, now, ""), nil, nil),
+		CompareFiles(createTestFile("existing/b.txt", 3, now, ""), nil, nil),
+		CompareFiles(createTestDir("docs", now), nil, nil),
+	}
+
+	plan, err := engine.createBidirectionalPlan(NewOperationExecutor(engine.webdavClient, config), changes)
+	require.NoError(t, err)
+	require.Len(t, plan.Operations, 3)
+
+	// Files wait for a directory created by the plan, existing parents need no operation
+	mkdir := plan.Operations[2]
+	assert.True(t, mkdir.IsDirectory)
+	assert.Equal(t, []string{mkdir.ID}, plan.Operations[0].Dependencies)
+	assert.Empty(t, plan.Operations[1].Dependencies)
+	assert.Empty(t, mkdir.Dependencies)
+
+	_, err = newOperationGraph(plan.Operations)
+	assert.NoError(t, err)
 }
@@ -0,0 +1,52 @@
+package sync
+
+import "time"
+
+// EventType identifies what a SyncEvent reports
+type EventType string
+
+const (
+	EventOperationStart  EventType = "operation_start"
+	EventOperationFinish EventType = "operation_finish"
+	EventOperationError  EventType = "operation_error"
+	EventConflict        EventType = "conflict"
+)
+
+// SyncEvent reports the progress of a sync run while it happens
+type SyncEvent struct {
+	Type      EventType      `json:"type"`
+	Time      time.Time      `json:"time"`
+	Operation *SyncOperation `json:"operation,omitempty"`
+	Conflict  *Conflict      `json:"conflict,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// EventHandler receives sync events. It is called from all workers of a
+// parallel sync, so it must be safe for concurrent use.
+type EventHandler func(event SyncEvent)
+
+// emit passes an event to the configured event handler, if any
+func (c *SyncConfig) emit(event SyncEvent) {
+	if c.Events == nil {
+		return
+	}
+	event.Time = time.Now()
+	c.Events(event)
+}
+
+// emitOperation reports the start or the outcome of an operation
+func (c *SyncConfig) emitOperation(eventType EventType, op *SyncOperation, err error) {
+	event := SyncEvent{Type: eventType, Operation: op}
+	if err != nil {
+		event.Type = EventOperationError
+		event.Error = err.Error()
+	}
+	c.emit(event)
+}
+
+// emitConflicts reports the conflicts found while planning
+func (c *SyncConfig) emitConflicts(conflicts []*Conflict) {
+	for _, conflict := range conflicts {
+		c.emit(SyncEvent{Type: EventConflict, Conflict: conflict})
+	}
+}
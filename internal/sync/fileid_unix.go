@@ -0,0 +1,18 @@
+//go:build !windows
+
+package sync
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns a device and inode based identifier for a file
+func fileID(info os.FileInfo) (string, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino), true
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package sync
+
+import "os"
+
+// fileID is not available from os.FileInfo on Windows, files are identified by path
+func fileID(info os.FileInfo) (string, bool) {
+	return "", false
+}
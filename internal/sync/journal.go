@@ -0,0 +1,330 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	stdsync "sync"
+	"time"
+)
+
+// journalVersion is the on-disk format version of the sync journal
+const journalVersion = 1
+
+// JournalEntry records the state of a path as of the last successful sync
+type JournalEntry struct {
+	Path           string    `json:"path"`
+	Size           int64     `json:"size"`
+	Modified       time.Time `json:"modified"`        // Local modification time
+	RemoteModified time.Time `json:"remote_modified"` // Remote modification time
+	ETag           string    `json:"etag,omitempty"`
+	Hash           string    `json:"hash,omitempty"` // SHA-256 of the content, if known
+	LocalFileID    string    `json:"local_file_id,omitempty"`
+	RemoteFileID   string    `json:"remote_file_id,omitempty"`
+	IsDirectory    bool      `json:"is_directory"`
+	SyncedAt       time.Time `json:"synced_at"`
+}
+
+// journalFile is the serialized form of a journal
+type journalFile struct {
+	Version   int                      `json:"version"`
+	UpdatedAt time.Time                `json:"updated_at"`
+	Entries   map[string]*JournalEntry `json:"entries"`
+}
+
+// Journal is a persistent per-profile record of the last synced state of every path.
+// It provides the common baseline needed to tell deletions apart from creations.
+type Journal struct {
+	path    string
+	entries map[string]*JournalEntry
+	mu      stdsync.RWMutex
+}
+
+// DefaultJournalDir returns the directory where sync journals are stored
+func DefaultJournalDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".nextcloud-sync", "journal"), nil
+}
+
+// JournalName returns the journal name for a sync. Named profiles use their
+// profile name, ad-hoc syncs are keyed by a hash of source and target.
+func JournalName(profile, source, target string) string {
+	if profile != "" {
+		return profile
+	}
+	hash := sha256.Sum256([]byte(source + "\x00" + target))
+	return "adhoc-" + hex.EncodeToString(hash[:8])
+}
+
+// DefaultJournalPath returns the journal file path for the given journal name
+func DefaultJournalPath(name string) (string, error) {
+	dir, err := DefaultJournalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// NewJournal creates an empty in-memory journal that saves to the given path.
+// An empty path creates a journal that is never persisted.
+func NewJournal(path string) *Journal {
+	return &Journal{
+		path:    path,
+		entries: make(map[string]*JournalEntry),
+	}
+}
+
+// OpenJournal loads a journal from disk, or creates an empty one if it does not exist yet
+func OpenJournal(path string) (*Journal, error) {
+	journal := NewJournal(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return journal, nil
+		}
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+
+	var file journalFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", path, err)
+	}
+
+	if file.Version != journalVersion {
+		return nil, fmt.Errorf("unsupported journal version %d in %s", file.Version, path)
+	}
+
+	if file.Entries != nil {
+		journal.entries = file.Entries
+	}
+
+	return journal, nil
+}
+
+// Save writes the journal to disk atomically
+func (j *Journal) Save() error {
+	if j.path == "" {
+		return nil
+	}
+
+	j.mu.RLock()
+	data, err := json.Marshal(journalFile{
+		Version:   journalVersion,
+		UpdatedAt: time.Now(),
+		Entries:   j.entries,
+	})
+	j.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	// Write to temporary file first, then rename for an atomic update
+	tmpPath := j.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write temporary journal file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename journal file: %w", err)
+	}
+
+	return nil
+}
+
+// Path returns the file path the journal is stored at
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Get returns the journal entry for a path
+func (j *Journal) Get(path string) (*JournalEntry, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	entry, exists := j.entries[path]
+	return entry, exists
+}
+
+// Put records the synced state of a path
+func (j *Journal) Put(entry *JournalEntry) {
+	if entry == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry.SyncedAt.IsZero() {
+		entry.SyncedAt = time.Now()
+	}
+	j.entries[entry.Path] = entry
+}
+
+// Delete removes a path and everything below it from the journal
+func (j *Journal) Delete(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.entries, path)
+
+	prefix := path + "/"
+	for entryPath := range j.entries {
+		if strings.HasPrefix(entryPath, prefix) {
+			delete(j.entries, entryPath)
+		}
+	}
+}
+
+// Move records a path and everything below it under a new path
+func (j *Journal) Move(from, to string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var moved []*JournalEntry
+	for entryPath, entry := range j.entries {
+		if withinSubtree(entryPath, from) {
+			moved = append(moved, entry)
+			delete(j.entries, entryPath)
+		}
+	}
+
+	for _, entry := range moved {
+		relocated := *entry
+		relocated.Path = to + strings.TrimPrefix(entry.Path, from)
+		j.entries[relocated.Path] = &relocated
+	}
+}
+
+// Subset returns an unpersisted journal holding only the entries within the given subtrees
+func (j *Journal) Subset(subtrees []string) *Journal {
+	subset := NewJournal("")
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	for entryPath, entry := range j.entries {
+		for _, subtree := range subtrees {
+			if withinSubtree(entryPath, subtree) {
+				subset.entries[entryPath] = entry
+				break
+			}
+		}
+	}
+
+	return subset
+}
+
+// Paths returns all paths recorded in the journal
+func (j *Journal) Paths() []string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	paths := make([]string, 0, len(j.entries))
+	for path := range j.entries {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// Len returns the number of entries in the journal
+func (j *Journal) Len() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return len(j.entries)
+}
+
+// NewJournalEntry builds a journal entry from the metadata of both sides of a synced path
+func NewJournalEntry(path string, local, remote *FileMetadata) *JournalEntry {
+	entry := &JournalEntry{
+		Path:     path,
+		SyncedAt: time.Now(),
+	}
+
+	if local != nil {
+		entry.Size = local.Size
+		entry.Modified = local.Modified
+		entry.IsDirectory = local.IsDirectory
+		entry.Hash = local.Checksum
+		entry.LocalFileID = local.FileID
+	}
+
+	if remote != nil {
+		entry.RemoteModified = remote.Modified
+		entry.ETag = remote.ETag
+		entry.RemoteFileID = remote.FileID
+		entry.IsDirectory = remote.IsDirectory
+		if local == nil {
+			entry.Size = remote.Size
+		}
+	}
+
+	return entry
+}
+
+// LocalChanged reports whether local metadata differs from the recorded baseline
+func (e *JournalEntry) LocalChanged(local *FileMetadata, opts *ComparisonOptions) bool {
+	if local.IsDirectory != e.IsDirectory {
+		return true
+	}
+
+	// Directory modification times change with their contents, only existence matters
+	if local.IsDirectory {
+		return false
+	}
+
+	if local.Size != e.Size {
+		return true
+	}
+
+	// A touched file with the recorded content is unchanged
+	if opts.CompareChecksums && local.Checksum != "" && e.Hash != "" {
+		return local.Checksum != e.Hash
+	}
+
+	return !withinTolerance(local.Modified, e.Modified, opts.IgnoreModTimeDiff)
+}
+
+// RemoteChanged reports whether remote metadata differs from the recorded baseline
+func (e *JournalEntry) RemoteChanged(remote *FileMetadata, opts *ComparisonOptions) bool {
+	if remote.IsDirectory != e.IsDirectory {
+		return true
+	}
+
+	if remote.IsDirectory {
+		return false
+	}
+
+	// ETags are authoritative on the remote side when both are known
+	if e.ETag != "" && remote.ETag != "" {
+		return !CompareETagsSafely(e.ETag, remote.ETag)
+	}
+
+	if remote.Size != e.Size {
+		return true
+	}
+
+	return !withinTolerance(remote.Modified, e.RemoteModified, opts.IgnoreModTimeDiff)
+}
+
+// withinSubtree reports whether a root-relative path equals or lies below a subtree
+func withinSubtree(path, subtree string) bool {
+	return subtree == "" || path == subtree || strings.HasPrefix(path, subtree+"/")
+}
+
+// withinTolerance reports whether two timestamps are equal within the given tolerance
+func withinTolerance(a, b time.Time, tolerance time.Duration) bool {
+	diff := a.Sub(b)
+	return diff >= -tolerance && diff <= tolerance
+}
@@ -0,0 +1,226 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal_SaveAndOpen(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal", "profile.json")
+	now := time.Now().Truncate(time.Second)
+
+	journal := NewJournal(journalPath)
+	journal.Put(NewJournalEntry("docs/a.txt",
+		createTestFile("docs/a.txt", 100, now, ""),
+		createTestFile("docs/a.txt", 100, now, `"etag1"`)))
+	journal.Put(NewJournalEntry("docs", createTestDir("docs", now), createTestDir("docs", now)))
+	require.NoError(t, journal.Save())
+
+	info, err := os.Stat(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded.Len())
+
+	entry, exists := loaded.Get("docs/a.txt")
+	require.True(t, exists)
+	assert.Equal(t, int64(100), entry.Size)
+	assert.Equal(t, `"etag1"`, entry.ETag)
+	assert.True(t, entry.Modified.Equal(now))
+}
+
+func TestOpenJournal_Missing(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, journal.Len())
+}
+
+func TestJournal_DeleteRemovesChildren(t *testing.T) {
+	journal := NewJournal("")
+	for _, path := range []string{"docs", "docs/a.txt", "docs/sub/b.txt", "docs2/c.txt"} {
+		journal.Put(&JournalEntry{Path: path})
+	}
+
+	journal.Delete("docs")
+
+	assert.ElementsMatch(t, []string{"docs2/c.txt"}, journal.Paths())
+}
+
+func TestJournal_MoveRelocatesChildren(t *testing.T) {
+	journal := NewJournal("")
+	for _, path := range []string{"docs", "docs/a.txt", "docs/sub/b.txt", "docs2/c.txt"} {
+		journal.Put(&JournalEntry{Path: path})
+	}
+
+	journal.Move("docs", "papers")
+
+	assert.ElementsMatch(t, []string{"papers", "papers/a.txt", "papers/sub/b.txt", "docs2/c.txt"}, journal.Paths())
+	entry, exists := journal.Get("papers/sub/b.txt")
+	require.True(t, exists)
+	assert.Equal(t, "papers/sub/b.txt", entry.Path)
+}
+
+func TestJournalName(t *testing.T) {
+	assert.Equal(t, "work", JournalName("work", "/a", "https://b"))
+
+	adhoc := JournalName("", "/a", "https://b")
+	assert.Contains(t, adhoc, "adhoc-")
+	assert.Equal(t, adhoc, JournalName("", "/a", "https://b"))
+	assert.NotEqual(t, adhoc, JournalName("", "/b", "https://a"))
+}
+
+func TestDetectChangesWithJournal(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	opts := DefaultComparisonOptions()
+
+	journal := NewJournal("")
+	for _, path := range []string{"unchanged.txt", "local-deleted.txt", "remote-deleted.txt", "local-edited.txt", "both-edited.txt", "deleted-vs-edited.txt"} {
+		journal.Put(NewJournalEntry(path,
+			createTestFile(path, 10, now, ""),
+			createTestFile(path, 10, now, `"`+path+`"`)))
+	}
+
+	localTree := &FileTree{PathMap: make(map[string]*FileNode)}
+	remoteTree := &FileTree{PathMap: make(map[string]*FileNode)}
+	addLocal := func(meta *FileMetadata) { localTree.PathMap[meta.Path] = &FileNode{Metadata: meta, Path: meta.Path} }
+	addRemote := func(meta *FileMetadata) { remoteTree.PathMap[meta.Path] = &FileNode{Metadata: meta, Path: meta.Path} }
+
+	addLocal(createTestFile("unchanged.txt", 10, now, ""))
+	addRemote(createTestFile("unchanged.txt", 10, now, `"unchanged.txt"`))
+
+	addRemote(createTestFile("local-deleted.txt", 10, now, `"local-deleted.txt"`))
+	addLocal(createTestFile("remote-deleted.txt", 10, now, ""))
+
+	addLocal(createTestFile("local-edited.txt", 20, later, ""))
+	addRemote(createTestFile("local-edited.txt", 10, now, `"local-edited.txt"`))
+
+	addLocal(createTestFile("both-edited.txt", 20, later, ""))
+	addRemote(createTestFile("both-edited.txt", 30, later, `"changed"`))
+
+	addRemote(createTestFile("deleted-vs-edited.txt", 30, later, `"changed"`))
+
+	addLocal(createTestFile("new-local.txt", 5, now, ""))
+
+	changes, conflicts := DetectChangesWithJournal(localTree, remoteTree, journal, opts)
+
+	byPath := make(map[string]*Change)
+	for _, change := range changes {
+		byPath[change.Path()] = change
+	}
+
+	assert.NotContains(t, byPath, "unchanged.txt")
+
+	require.Contains(t, byPath, "local-deleted.txt")
+	assert.Equal(t, ChangeDelete, byPath["local-deleted.txt"].Type)
+	assert.Equal(t, LocalToRemote, byPath["local-deleted.txt"].Direction)
+
+	require.Contains(t, byPath, "remote-deleted.txt")
+	assert.Equal(t, ChangeDelete, byPath["remote-deleted.txt"].Type)
+	assert.Equal(t, RemoteToLocal, byPath["remote-deleted.txt"].Direction)
+
+	require.Contains(t, byPath, "local-edited.txt")
+	assert.Equal(t, ChangeUpdate, byPath["local-edited.txt"].Type)
+	assert.Equal(t, LocalToRemote, byPath["local-edited.txt"].Direction)
+	assert.False(t, byPath["local-edited.txt"].IsConflict())
+
+	require.Contains(t, byPath, "new-local.txt")
+	assert.Equal(t, ChangeCreate, byPath["new-local.txt"].Type)
+
+	conflictTypes := make(map[string]ConflictType)
+	for _, conflict := range conflicts {
+		conflictTypes[conflict.LocalPath] = conflict.Type
+	}
+	assert.Equal(t, ConflictContentChanged, conflictTypes["both-edited.txt"])
+	assert.Equal(t, ConflictDeletedChanged, conflictTypes["deleted-vs-edited.txt"])
+	assert.NotContains(t, byPath, "both-edited.txt")
+	assert.NotContains(t, byPath, "deleted-vs-edited.txt")
+}
+
+func TestDetectChangesWithJournal_PrunesNestedDeletes(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+
+	journal := NewJournal("")
+	journal.Put(NewJournalEntry("docs", createTestDir("docs", now), createTestDir("docs", now)))
+	journal.Put(NewJournalEntry("docs/a.txt",
+		createTestFile("docs/a.txt", 10, now, ""),
+		createTestFile("docs/a.txt", 10, now, `"a"`)))
+
+	// The directory was deleted locally and still exists unchanged remotely
+	localTree := &FileTree{PathMap: make(map[string]*FileNode)}
+	remoteTree := &FileTree{PathMap: map[string]*FileNode{
+		"docs":       {Metadata: createTestDir("docs", now), Path: "docs"},
+		"docs/a.txt": {Metadata: createTestFile("docs/a.txt", 10, now, `"a"`), Path: "docs/a.txt"},
+	}}
+
+	changes, conflicts := DetectChangesWithJournal(localTree, remoteTree, journal, opts)
+
+	assert.Empty(t, conflicts)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeDelete, changes[0].Type)
+	assert.Equal(t, "docs", changes[0].Path())
+}
+
+func TestDetectChangesWithJournal_NilJournal(t *testing.T) {
+	now := time.Now()
+	localTree := &FileTree{PathMap: map[string]*FileNode{
+		"a.txt": {Metadata: createTestFile("a.txt", 10, now, ""), Path: "a.txt"},
+	}}
+	remoteTree := &FileTree{PathMap: make(map[string]*FileNode)}
+
+	changes, _ := DetectChangesWithJournal(localTree, remoteTree, nil, DefaultComparisonOptions())
+
+	// Without a baseline a missing remote file is a creation, never a deletion
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeCreate, changes[0].Type)
+}
+
+func TestExecuteOperation_RecordsJournal(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("hello"), 0644))
+
+	mockClient := newMockWebDAVClient()
+	journal := NewJournal("")
+	config := &SyncConfig{
+		Source:  tmpDir,
+		Target:  "https://cloud.example.com/files/test?dir=/remote",
+		Journal: journal,
+	}
+	executor := NewOperationExecutor(mockClient, config)
+
+	err := executor.ExecuteOperation(&SyncOperation{
+		ID:         "upload",
+		Type:       ChangeCreate,
+		Direction:  LocalToRemote,
+		SourcePath: "a.txt",
+		TargetPath: "a.txt",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, mockClient.files, "/remote/a.txt")
+
+	entry, exists := journal.Get("a.txt")
+	require.True(t, exists)
+	assert.Equal(t, int64(5), entry.Size)
+	assert.Equal(t, helloSHA256, entry.Hash)
+
+	err = executor.ExecuteOperation(&SyncOperation{
+		ID:         "delete",
+		Type:       ChangeDelete,
+		Direction:  LocalToRemote,
+		SourcePath: "a.txt",
+		TargetPath: "a.txt",
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, mockClient.files, "/remote/a.txt")
+
+	_, exists = journal.Get("a.txt")
+	assert.False(t, exists)
+}
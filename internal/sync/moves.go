@@ -0,0 +1,408 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// moveCandidate is a path that disappeared from one side since the last sync
+type moveCandidate struct {
+	change   *Change
+	entry    *JournalEntry
+	path     string // Current path, differs from the change once a parent directory was moved
+	consumed bool
+}
+
+// moveDetector pairs disappeared and appeared paths of the same direction
+type moveDetector struct {
+	opts       *ComparisonOptions
+	candidates map[ChangeDirection][]*moveCandidate
+	consumed   map[*Change]bool
+	moves      []*Change
+}
+
+// detectMoves replaces a deletion and a creation of the same file or directory under a
+// new path with a single move. Disappeared and appeared paths are matched by their
+// file ID, which is the inode locally and oc:fileid on the remote, and files also by
+// size and checksum. Deletions below a moved directory are relocated to its new path.
+func detectMoves(changes []*Change, conflicts []*Conflict, journal *Journal, opts *ComparisonOptions) []*Change {
+	d := &moveDetector{
+		opts:       opts,
+		candidates: make(map[ChangeDirection][]*moveCandidate),
+		consumed:   make(map[*Change]bool),
+	}
+
+	var created []*Change
+	for _, change := range changes {
+		switch change.Type {
+		case ChangeDelete:
+			if entry, exists := journal.Get(change.Path()); exists {
+				d.candidates[change.Direction] = append(d.candidates[change.Direction], &moveCandidate{
+					change: change,
+					entry:  entry,
+					path:   change.Path(),
+				})
+			}
+		case ChangeCreate:
+			created = append(created, change)
+		}
+	}
+
+	if len(d.candidates) == 0 || len(created) == 0 {
+		return changes
+	}
+
+	// Parents are handled before their contents
+	sort.Slice(created, func(i, j int) bool { return created[i].Path() < created[j].Path() })
+
+	for _, change := range created {
+		if d.consumed[change] {
+			continue
+		}
+
+		meta := appearedMetadata(change)
+		if meta == nil {
+			continue
+		}
+
+		candidate := d.match(change.Direction, meta)
+		if candidate == nil {
+			continue
+		}
+		if meta.IsDirectory && hasConflictWithin(conflicts, candidate.path) {
+			continue
+		}
+
+		d.move(candidate, change, meta)
+		if meta.IsDirectory {
+			d.moveContents(candidate.path, change.Path(), change.Direction, created)
+		}
+	}
+
+	if len(d.moves) == 0 {
+		return changes
+	}
+
+	result := make([]*Change, 0, len(changes))
+	for _, change := range changes {
+		if d.consumed[change] {
+			continue
+		}
+		result = append(result, d.relocated(change))
+	}
+
+	return append(result, d.moves...)
+}
+
+// match finds the disappeared path that an appeared file or directory was moved from
+func (d *moveDetector) match(direction ChangeDirection, meta *FileMetadata) *moveCandidate {
+	candidates := d.candidates[direction]
+
+	if meta.FileID != "" {
+		for _, candidate := range candidates {
+			if !candidate.consumed && candidateFileID(candidate.entry, direction) == meta.FileID &&
+				candidate.entry.IsDirectory == meta.IsDirectory && d.sameContent(candidate.entry, direction, meta) {
+				return candidate
+			}
+		}
+	}
+
+	// Without a file ID only files with a known, unambiguous checksum can be matched
+	if meta.IsDirectory || meta.Checksum == "" {
+		return nil
+	}
+
+	var found *moveCandidate
+	for _, candidate := range candidates {
+		entry := candidate.entry
+		if candidate.consumed || entry.IsDirectory || entry.Hash != meta.Checksum || entry.Size != meta.Size {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = candidate
+	}
+
+	return found
+}
+
+// sameContent reports whether a moved file still has the content recorded in the journal
+func (d *moveDetector) sameContent(entry *JournalEntry, direction ChangeDirection, meta *FileMetadata) bool {
+	if meta.IsDirectory {
+		return true
+	}
+
+	if direction == LocalToRemote {
+		return !entry.LocalChanged(meta, d.opts)
+	}
+
+	// The remote ETag may change with the path, so the content is compared directly
+	if meta.Size != entry.Size {
+		return false
+	}
+	return meta.Checksum == "" || entry.Hash == "" || meta.Checksum == entry.Hash
+}
+
+// move records the move of a disappeared path to an appeared one
+func (d *moveDetector) move(candidate *moveCandidate, change *Change, meta *FileMetadata) {
+	candidate.consumed = true
+	d.consumed[candidate.change] = true
+	d.consumed[change] = true
+
+	reason := fmt.Sprintf("moved locally from %s", candidate.path)
+	if change.Direction == RemoteToLocal {
+		reason = fmt.Sprintf("moved on remote from %s", candidate.path)
+	}
+
+	d.moves = append(d.moves, &Change{
+		Type:       ChangeMove,
+		Direction:  change.Direction,
+		LocalPath:  change.LocalPath,
+		RemotePath: change.RemotePath,
+		OldPath:    candidate.path,
+		LocalMeta:  change.LocalMeta,
+		RemoteMeta: change.RemoteMeta,
+		Reason:     reason,
+		Priority:   calculatePriority(meta),
+	})
+}
+
+// moveContents relocates the disappeared paths below a moved directory. Contents that
+// arrive unchanged at the new location are carried along by the directory move.
+func (d *moveDetector) moveContents(from, to string, direction ChangeDirection, created []*Change) {
+	relocated := make(map[string]*moveCandidate)
+	for _, candidate := range d.candidates[direction] {
+		if candidate.consumed || !strings.HasPrefix(candidate.path, from+"/") {
+			continue
+		}
+		candidate.path = to + strings.TrimPrefix(candidate.path, from)
+		relocated[candidate.path] = candidate
+	}
+
+	for _, change := range created {
+		candidate, exists := relocated[change.Path()]
+		if !exists || d.consumed[change] || change.Direction != direction {
+			continue
+		}
+
+		meta := appearedMetadata(change)
+		if meta == nil || meta.IsDirectory != candidate.entry.IsDirectory {
+			continue
+		}
+
+		// The old content arrives with the directory and is then replaced by the creation
+		candidate.consumed = true
+		d.consumed[candidate.change] = true
+
+		if d.sameContent(candidate.entry, direction, meta) {
+			d.consumed[change] = true
+		}
+	}
+}
+
+// relocated returns a deletion at the current path of its candidate
+func (d *moveDetector) relocated(change *Change) *Change {
+	if change.Type != ChangeDelete {
+		return change
+	}
+
+	for _, candidate := range d.candidates[change.Direction] {
+		if candidate.change == change && candidate.path != change.Path() {
+			moved := *change
+			moved.LocalPath = candidate.path
+			moved.RemotePath = candidate.path
+			return &moved
+		}
+	}
+
+	return change
+}
+
+// appearedMetadata returns the metadata of the side a created path appeared on
+func appearedMetadata(change *Change) *FileMetadata {
+	if change.Direction == LocalToRemote {
+		return change.LocalMeta
+	}
+	return change.RemoteMeta
+}
+
+// candidateFileID returns the recorded file ID of the side a path disappeared from
+func candidateFileID(entry *JournalEntry, direction ChangeDirection) string {
+	if direction == LocalToRemote {
+		return entry.LocalFileID
+	}
+	return entry.RemoteFileID
+}
+
+// hasConflictWithin reports whether a conflict affects a path or anything below it
+func hasConflictWithin(conflicts []*Conflict, path string) bool {
+	for _, conflict := range conflicts {
+		if withinSubtree(conflict.LocalPath, path) || withinSubtree(conflict.RemotePath, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectTreeMoves replaces the creation of a path that only exists on the source side of
+// a one-way sync and the creation of a path that only exists on the target side with a
+// single move of the target path, if both hold the same file or directory. Without a
+// journal there is no recorded file ID, so files are matched by size and checksum and
+// directories by their contents. This is only safe if the sync deletes the target path
+// otherwise.
+func detectTreeMoves(changes []*Change, localTree, remoteTree *FileTree, opts *ComparisonOptions) []*Change {
+	direction, reverse := opts.SourceDirection, RemoteToLocal
+	sourceTree, targetTree := localTree, remoteTree
+	if direction == RemoteToLocal {
+		reverse = LocalToRemote
+		sourceTree, targetTree = remoteTree, localTree
+	}
+	if sourceTree == nil || targetTree == nil {
+		return changes
+	}
+
+	var appeared, vanished []*Change
+	for _, change := range changes {
+		if change.Type != ChangeCreate {
+			continue
+		}
+		switch change.Direction {
+		case direction:
+			appeared = append(appeared, change)
+		case reverse:
+			vanished = append(vanished, change)
+		}
+	}
+	if len(appeared) == 0 || len(vanished) == 0 {
+		return changes
+	}
+
+	// Parents are handled before their contents
+	sort.Slice(appeared, func(i, j int) bool { return appeared[i].Path() < appeared[j].Path() })
+
+	consumed := make(map[*Change]bool)
+	var moves []*Change
+	for _, change := range appeared {
+		if consumed[change] {
+			continue
+		}
+
+		meta := appearedMetadata(change)
+		old := matchTreeMove(meta, vanished, consumed, sourceTree, targetTree, opts)
+		if old == nil {
+			continue
+		}
+		oldPath := old.Path()
+
+		// Contents that are the same at the old path are carried along by the move,
+		// new and edited files are still transferred afterwards
+		for _, other := range appeared {
+			if !withinSubtree(other.Path(), meta.Path) {
+				continue
+			}
+			counterpart := targetTree.PathMap[oldPath+strings.TrimPrefix(other.Path(), meta.Path)]
+			if counterpart != nil && sameTreeEntry(appearedMetadata(other), counterpart.Metadata, opts) {
+				consumed[other] = true
+			}
+		}
+		for _, other := range vanished {
+			if withinSubtree(other.Path(), oldPath) {
+				consumed[other] = true
+			}
+		}
+
+		moves = append(moves, &Change{
+			Type:       ChangeMove,
+			Direction:  direction,
+			LocalPath:  change.LocalPath,
+			RemotePath: change.RemotePath,
+			OldPath:    oldPath,
+			LocalMeta:  change.LocalMeta,
+			RemoteMeta: change.RemoteMeta,
+			Reason:     fmt.Sprintf("moved from %s", oldPath),
+			Priority:   calculatePriority(meta),
+		})
+	}
+
+	if len(moves) == 0 {
+		return changes
+	}
+
+	result := make([]*Change, 0, len(changes))
+	for _, change := range changes {
+		if !consumed[change] {
+			result = append(result, change)
+		}
+	}
+	return append(result, moves...)
+}
+
+// matchTreeMove finds the only path on the target side that an appeared file or
+// directory of a one-way sync was moved from
+func matchTreeMove(meta *FileMetadata, vanished []*Change, consumed map[*Change]bool, sourceTree, targetTree *FileTree, opts *ComparisonOptions) *Change {
+	// Without a checksum a file cannot be told apart from another one of the same size
+	if meta == nil || (!meta.IsDirectory && meta.Checksum == "") {
+		return nil
+	}
+
+	var found *Change
+	for _, change := range vanished {
+		old := appearedMetadata(change)
+		if consumed[change] || old == nil || old.IsDirectory != meta.IsDirectory {
+			continue
+		}
+
+		if meta.IsDirectory {
+			if !sameDirectoryContents(sourceTree, meta.Path, targetTree, old.Path, opts) {
+				continue
+			}
+		} else if old.Checksum != meta.Checksum || old.Size != meta.Size {
+			continue
+		}
+
+		if found != nil {
+			return nil
+		}
+		found = change
+	}
+
+	return found
+}
+
+// sameDirectoryContents reports whether everything below the old directory exists
+// below the new one and at least one file is unchanged, which tells that the new
+// directory is the old one under a new path
+func sameDirectoryContents(sourceTree *FileTree, newPath string, targetTree *FileTree, oldPath string, opts *ComparisonOptions) bool {
+	unchanged := 0
+	for path, node := range targetTree.PathMap {
+		if !strings.HasPrefix(path, oldPath+"/") {
+			continue
+		}
+
+		counterpart := sourceTree.PathMap[newPath+strings.TrimPrefix(path, oldPath)]
+		if counterpart == nil || counterpart.Metadata.IsDirectory != node.Metadata.IsDirectory {
+			return false
+		}
+		if !node.Metadata.IsDirectory && sameTreeEntry(counterpart.Metadata, node.Metadata, opts) {
+			unchanged++
+		}
+	}
+	return unchanged > 0
+}
+
+// sameTreeEntry reports whether a file or directory on the source side equals one on
+// the target side, by checksum if both have one and otherwise by size and time
+func sameTreeEntry(source, target *FileMetadata, opts *ComparisonOptions) bool {
+	if source.IsDirectory || target.IsDirectory {
+		return source.IsDirectory == target.IsDirectory
+	}
+	if source.Size != target.Size {
+		return false
+	}
+	if source.Checksum != "" && target.Checksum != "" {
+		return source.Checksum == target.Checksum
+	}
+	return withinTolerance(source.Modified, target.Modified, opts.IgnoreModTimeDiff)
+}
@@ -0,0 +1,272 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withFileID sets the file ID of test metadata
+func withFileID(meta *FileMetadata, id string) *FileMetadata {
+	meta.FileID = id
+	return meta
+}
+
+// withChecksum sets the checksum of test metadata
+func withChecksum(meta *FileMetadata, checksum string) *FileMetadata {
+	meta.Checksum = checksum
+	return meta
+}
+
+// newTestTree creates a file tree from metadata
+func newTestTree(files ...*FileMetadata) *FileTree {
+	tree := &FileTree{PathMap: make(map[string]*FileNode)}
+	for _, meta := range files {
+		tree.PathMap[meta.Path] = &FileNode{Metadata: meta, Path: meta.Path}
+	}
+	return tree
+}
+
+func TestDetectChangesWithJournal_LocalDirectoryMove(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+
+	journal := NewJournal("")
+	journal.Put(NewJournalEntry("docs", withFileID(createTestDir("docs", now), "1:10"), createTestDir("docs", now)))
+	for i, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := "docs/" + name
+		journal.Put(NewJournalEntry(path,
+			withFileID(createTestFile(path, 10, now, ""), "1:"+string(rune('a'+i))),
+			createTestFile(path, 10, now, `"`+name+`"`)))
+	}
+
+	// docs was renamed to papers, b.txt deleted, c.txt edited and new.txt added
+	localTree := newTestTree(
+		withFileID(createTestDir("papers", now), "1:10"),
+		withFileID(createTestFile("papers/a.txt", 10, now, ""), "1:a"),
+		withFileID(createTestFile("papers/c.txt", 20, now.Add(time.Hour), ""), "1:c"),
+		withFileID(createTestFile("papers/new.txt", 5, now, ""), "1:d"),
+	)
+	remoteTree := newTestTree(
+		createTestDir("docs", now),
+		createTestFile("docs/a.txt", 10, now, `"a.txt"`),
+		createTestFile("docs/b.txt", 10, now, `"b.txt"`),
+		createTestFile("docs/c.txt", 10, now, `"c.txt"`),
+	)
+
+	changes, conflicts := DetectChangesWithJournal(localTree, remoteTree, journal, opts)
+	assert.Empty(t, conflicts)
+
+	byPath := make(map[string]*Change)
+	for _, change := range changes {
+		byPath[change.Path()] = change
+	}
+	require.Len(t, changes, 4)
+
+	require.Contains(t, byPath, "papers")
+	assert.Equal(t, ChangeMove, byPath["papers"].Type)
+	assert.Equal(t, LocalToRemote, byPath["papers"].Direction)
+	assert.Equal(t, "docs", byPath["papers"].OldPath)
+
+	// Deletions below the old path are relocated to the new one
+	require.Contains(t, byPath, "papers/b.txt")
+	assert.Equal(t, ChangeDelete, byPath["papers/b.txt"].Type)
+
+	require.Contains(t, byPath, "papers/c.txt")
+	assert.Equal(t, ChangeCreate, byPath["papers/c.txt"].Type)
+	require.Contains(t, byPath, "papers/new.txt")
+	assert.Equal(t, ChangeCreate, byPath["papers/new.txt"].Type)
+
+	// Everything in the new directory waits for the move
+	executor := NewOperationExecutor(newMockWebDAVClient(), &SyncConfig{})
+	plan, err := executor.PlanOperations(changes)
+	require.NoError(t, err)
+
+	var move *SyncOperation
+	for _, op := range plan.Operations {
+		if op.Type == ChangeMove {
+			move = op
+		}
+	}
+	require.NotNil(t, move)
+	assert.Equal(t, "docs", move.SourcePath)
+	assert.Equal(t, "papers", move.TargetPath)
+	assert.Zero(t, move.Size)
+
+	for _, op := range plan.Operations {
+		if op != move && withinSubtree(op.TargetPath, "papers") {
+			assert.Contains(t, op.Dependencies, move.ID, op.TargetPath)
+		}
+	}
+}
+
+func TestDetectChangesWithJournal_FileMoves(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+	opts.CompareChecksums = true
+
+	journal := NewJournal("")
+	put := func(path, hash, remoteID string) {
+		local := createTestFile(path, 10, now, "")
+		local.Checksum = hash
+		journal.Put(NewJournalEntry(path, local, withFileID(createTestFile(path, 10, now, `"`+path+`"`), remoteID)))
+	}
+	put("remote-renamed.txt", "h1", "42")
+	put("local-renamed.txt", "h2", "43")
+	put("copy1.txt", "h3", "44")
+	put("copy2.txt", "h3", "45")
+
+	local := func(path, hash string) *FileMetadata {
+		meta := createTestFile(path, 10, now, "")
+		meta.Checksum = hash
+		return meta
+	}
+
+	localTree := newTestTree(
+		local("remote-renamed.txt", "h1"),
+		local("renamed-here.txt", "h2"),
+		local("copy.txt", "h3"),
+	)
+	remoteTree := newTestTree(
+		withFileID(createTestFile("renamed-there.txt", 10, now, `"other"`), "42"),
+		withFileID(createTestFile("local-renamed.txt", 10, now, `"local-renamed.txt"`), "43"),
+		withFileID(createTestFile("copy1.txt", 10, now, `"copy1.txt"`), "44"),
+		withFileID(createTestFile("copy2.txt", 10, now, `"copy2.txt"`), "45"),
+	)
+
+	changes, conflicts := DetectChangesWithJournal(localTree, remoteTree, journal, opts)
+	assert.Empty(t, conflicts)
+
+	byPath := make(map[string]*Change)
+	for _, change := range changes {
+		byPath[change.Path()] = change
+	}
+
+	// Matched by oc:fileid
+	require.Contains(t, byPath, "renamed-there.txt")
+	assert.Equal(t, ChangeMove, byPath["renamed-there.txt"].Type)
+	assert.Equal(t, RemoteToLocal, byPath["renamed-there.txt"].Direction)
+	assert.Equal(t, "remote-renamed.txt", byPath["renamed-there.txt"].OldPath)
+
+	// Matched by size and checksum
+	require.Contains(t, byPath, "renamed-here.txt")
+	assert.Equal(t, ChangeMove, byPath["renamed-here.txt"].Type)
+	assert.Equal(t, LocalToRemote, byPath["renamed-here.txt"].Direction)
+	assert.Equal(t, "local-renamed.txt", byPath["renamed-here.txt"].OldPath)
+
+	// Two deleted files with the same content are ambiguous
+	assert.Equal(t, ChangeCreate, byPath["copy.txt"].Type)
+	assert.Equal(t, ChangeDelete, byPath["copy1.txt"].Type)
+	assert.Equal(t, ChangeDelete, byPath["copy2.txt"].Type)
+
+	assert.NotContains(t, byPath, "remote-renamed.txt")
+	assert.NotContains(t, byPath, "local-renamed.txt")
+}
+
+func TestExecuteOperation_MoveUpdatesJournal(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "new.txt"), []byte("hello"), 0644))
+
+	mockClient := newMockWebDAVClient()
+	mockClient.files["/remote/old.txt"] = &mockFile{content: []byte("hello"), modTime: time.Now()}
+
+	journal := NewJournal("")
+	journal.Put(&JournalEntry{Path: "old.txt", Size: 5, Hash: helloSHA256})
+
+	executor := NewOperationExecutor(mockClient, &SyncConfig{
+		Source:  tmpDir,
+		Target:  "https://cloud.example.com/files/test?dir=/remote",
+		Journal: journal,
+	})
+
+	err := executor.ExecuteOperation(&SyncOperation{
+		ID:         "move",
+		Type:       ChangeMove,
+		Direction:  LocalToRemote,
+		SourcePath: "old.txt",
+		TargetPath: "new.txt",
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, mockClient.files, "/remote/old.txt")
+	assert.Contains(t, mockClient.files, "/remote/new.txt")
+
+	_, exists := journal.Get("old.txt")
+	assert.False(t, exists)
+
+	entry, exists := journal.Get("new.txt")
+	require.True(t, exists)
+	assert.Equal(t, helloSHA256, entry.Hash)
+	assert.Equal(t, int64(5), entry.Size)
+}
+
+func TestDetectChanges_OneWayFileMoveByChecksum(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+	opts.SourceDirection = RemoteToLocal
+	opts.DeleteTargetOnly = true
+
+	localTree := newTestTree(
+		withChecksum(createTestFile("old.txt", 10, now, ""), "abc"),
+		withChecksum(createTestFile("same-size.txt", 10, now, ""), "def"),
+	)
+	remoteTree := newTestTree(
+		withChecksum(createTestFile("new.txt", 10, now.Add(time.Hour), `"1"`), "abc"),
+	)
+
+	changes, conflicts := DetectChanges(localTree, remoteTree, opts)
+	assert.Empty(t, conflicts)
+
+	var moves []*Change
+	for _, change := range changes {
+		if change.Type == ChangeMove {
+			moves = append(moves, change)
+		}
+	}
+	require.Len(t, moves, 1)
+	assert.Equal(t, RemoteToLocal, moves[0].Direction)
+	assert.Equal(t, "old.txt", moves[0].OldPath)
+	assert.Equal(t, "new.txt", moves[0].Path())
+
+	// Without a source direction the paths stay unrelated
+	changes, _ = DetectChanges(localTree, remoteTree, DefaultComparisonOptions())
+	for _, change := range changes {
+		assert.NotEqual(t, ChangeMove, change.Type)
+	}
+
+	// A target path that is kept is not taken for the old path of a move
+	opts.DeleteTargetOnly = false
+	changes, _ = DetectChanges(localTree, remoteTree, opts)
+	for _, change := range changes {
+		assert.NotEqual(t, ChangeMove, change.Type)
+		assert.NotEqual(t, ChangeDelete, change.Type)
+	}
+}
+
+func TestDetectChanges_OneWayDeletesTargetOnlyPaths(t *testing.T) {
+	now := time.Now()
+	opts := DefaultComparisonOptions()
+	opts.SourceDirection = LocalToRemote
+	opts.DeleteTargetOnly = true
+
+	localTree := newTestTree(createTestFile("kept.txt", 10, now, ""))
+	remoteTree := newTestTree(
+		createTestFile("kept.txt", 10, now, `"1"`),
+		createTestFile("stray.txt", 5, now, `"2"`),
+		createTestDir("old", now),
+		createTestFile("old/a.txt", 5, now, `"3"`),
+	)
+
+	changes, conflicts := DetectChanges(localTree, remoteTree, opts)
+	assert.Empty(t, conflicts)
+
+	deleted := make(map[string]ChangeDirection)
+	for _, change := range changes {
+		require.Equal(t, ChangeDelete, change.Type)
+		deleted[change.Path()] = change.Direction
+	}
+	assert.Equal(t, map[string]ChangeDirection{"stray.txt": LocalToRemote, "old": LocalToRemote}, deleted)
+}
@@ -2,7 +2,10 @@ package sync
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path"
@@ -10,23 +13,46 @@ import (
 	"strings"
 	"time"
 
+	"github.com/phaus/nextcloud-sync/internal/bandwidth"
 	"github.com/phaus/nextcloud-sync/internal/webdav"
 )
 
+const (
+	// partialFileSuffix marks local files that are still being downloaded
+	partialFileSuffix = ".nextcloud-sync.part"
+
+	// resumeCheckpointInterval is how often the progress of a download is recorded
+	resumeCheckpointInterval = 8 * 1024 * 1024 // 8MB
+
+	// limitedChunkSize bounds the bytes a rate limited transfer moves at once, so
+	// that its waits are spread evenly over the transfer
+	limitedChunkSize = 32 * 1024 // 32KB
+)
+
 // OperationExecutor handles the execution of sync operations
 type OperationExecutor struct {
 	webdavClient webdav.Client
 	config       *SyncConfig
 	ctx          context.Context
+	local        Backend // Side that changes in the local to remote direction come from
+	remote       Backend // Side that changes in the remote to local direction come from
 }
 
 // NewOperationExecutor creates a new operation executor
 func NewOperationExecutor(client webdav.Client, config *SyncConfig) *OperationExecutor {
-	return &OperationExecutor{
+	executor := &OperationExecutor{
 		webdavClient: client,
 		config:       config,
 		ctx:          context.Background(),
 	}
+
+	// Operations planned from file trees carry paths relative to the sync roots
+	executor.local, executor.remote, _ = syncSides(client, config)
+	if wb, ok := executor.remote.(*WebDAVBackend); ok && client == nil {
+		executor.webdavClient = wb.client
+	}
+
+	return executor
 }
 
 // ExecuteOperation executes a single sync operation
@@ -35,175 +61,224 @@ func (e *OperationExecutor) ExecuteOperation(op *SyncOperation) error {
 		e.config.ProgressTracker.SetOperation(fmt.Sprintf("%s %s", op.Type.String(), op.SourcePath))
 	}
 
+	hash, err := e.executeOperation(op)
+	if err != nil {
+		return err
+	}
+
+	e.recordJournal(op, hash)
+	return nil
+}
+
+// executeOperation executes an operation on the target side of its direction and
+// returns the content hash of any transferred file
+func (e *OperationExecutor) executeOperation(op *SyncOperation) (string, error) {
+	var source, target Backend
+	switch op.Direction {
+	case LocalToRemote:
+		source, target = e.local, e.remote
+	case RemoteToLocal:
+		source, target = e.remote, e.local
+	default:
+		return "", fmt.Errorf("unsupported direction for %s operation: %v", strings.ToLower(op.Type.String()), op.Direction)
+	}
+
 	switch op.Type {
-	case ChangeCreate:
-		if op.Direction == LocalToRemote {
-			return e.uploadFile(op.SourcePath, op.TargetPath)
-		} else if op.Direction == RemoteToLocal {
-			return e.downloadFile(op.SourcePath, op.TargetPath)
-		} else {
-			return fmt.Errorf("unsupported direction for create operation: %v", op.Direction)
-		}
-	case ChangeUpdate:
-		if op.Direction == LocalToRemote {
-			return e.uploadFile(op.SourcePath, op.TargetPath)
-		} else if op.Direction == RemoteToLocal {
-			return e.downloadFile(op.SourcePath, op.TargetPath)
-		} else {
-			return fmt.Errorf("unsupported direction for update operation: %v", op.Direction)
+	case ChangeCreate, ChangeUpdate:
+		if op.IsDirectory {
+			if err := target.Mkdir(e.ctx, op.TargetPath); err != nil {
+				return "", fmt.Errorf("failed to create directory %s: %w", op.TargetPath, err)
+			}
+			return "", nil
 		}
+		return e.transferFile(source, target, op.SourcePath, op.TargetPath)
 	case ChangeDelete:
-		if op.Direction == LocalToRemote {
-			return e.deleteLocalFile(op.SourcePath)
-		} else if op.Direction == RemoteToLocal {
-			return e.deleteRemoteFile(op.TargetPath)
-		} else {
-			return fmt.Errorf("unsupported direction for delete operation: %v", op.Direction)
+		if err := target.Remove(e.ctx, op.TargetPath); err != nil {
+			return "", fmt.Errorf("failed to delete %s: %w", op.TargetPath, err)
 		}
+		return "", nil
 	case ChangeMove:
-		if op.Direction == LocalToRemote {
-			return e.moveLocalFile(op.SourcePath, op.TargetPath)
-		} else if op.Direction == RemoteToLocal {
-			return e.moveRemoteFile(op.SourcePath, op.TargetPath)
-		} else {
-			return fmt.Errorf("unsupported direction for move operation: %v", op.Direction)
+		if err := target.Rename(e.ctx, op.SourcePath, op.TargetPath); err != nil {
+			return "", fmt.Errorf("failed to move %s to %s: %w", op.SourcePath, op.TargetPath, err)
 		}
+		return "", nil
 	default:
-		return fmt.Errorf("unsupported operation type: %v", op.Type)
+		return "", fmt.Errorf("unsupported operation type: %v", op.Type)
 	}
 }
 
-// uploadFile uploads a local file to the remote WebDAV server
-func (e *OperationExecutor) uploadFile(localPath, remotePath string) error {
-	// Open local file
-	file, err := os.Open(localPath)
+// transferFile copies a file between two backends and returns the SHA-256 of the copied content.
+// Targets that implement ResumableCreator continue where an interrupted earlier attempt stopped,
+// sources that implement RangeOpener then only read the missing part.
+func (e *OperationExecutor) transferFile(source, target Backend, sourcePath, targetPath string) (string, error) {
+	meta, err := source.Stat(e.ctx, sourcePath)
 	if err != nil {
-		return fmt.Errorf("failed to open local file %s: %w", localPath, err)
+		return "", fmt.Errorf("failed to stat %s: %w", sourcePath, err)
+	}
+
+	if e.config.ProgressTracker != nil {
+		e.config.ProgressTracker.Start(meta.Size)
 	}
-	defer file.Close()
 
-	// Get file info for size
-	fileInfo, err := file.Stat()
+	from := &transferSource{executor: e, backend: source, path: sourcePath, meta: meta, target: target}
+	defer from.close()
+
+	if creator, ok := target.(ResumableCreator); ok {
+		err = creator.CreateResumable(e.ctx, targetPath, from.transfer())
+	} else {
+		err = e.createFile(target, targetPath, from)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to stat local file %s: %w", localPath, err)
+		return "", fmt.Errorf("failed to copy %s to %s: %w", sourcePath, targetPath, err)
 	}
 
-	// Update progress tracker
 	if e.config.ProgressTracker != nil {
-		e.config.ProgressTracker.Start(fileInfo.Size())
+		e.config.ProgressTracker.Finish()
 	}
 
-	// Create remote directory if it doesn't exist
-	remoteDir := filepath.Dir(remotePath)
-	if remoteDir != "." && remoteDir != "/" {
-		if err := e.ensureRemoteDirectory(remoteDir); err != nil {
-			return fmt.Errorf("failed to create remote directory %s: %w", remoteDir, err)
-		}
+	if hash, ok := from.hash(); ok {
+		return hash, nil
 	}
 
-	// Determine if we should use chunked upload
-	chunkSize := e.config.ChunkSize
-	if chunkSize <= 0 {
-		chunkSize = 1024 * 1024 // Default to 1MB
+	// A resumed transfer only streamed part of the file
+	if hasher, ok := target.(Hasher); ok && from.start > 0 {
+		if hash, err := hasher.Hash(e.ctx, targetPath); err == nil {
+			return hash, nil
+		}
 	}
+	return "", nil
+}
 
-	largeFileThreshold := e.config.LargeFileThreshold
-	if largeFileThreshold <= 0 {
-		largeFileThreshold = 50 * 1024 * 1024 // Default to 50MB
+// createFile writes a file to a target that cannot resume, from the start of the source
+func (e *OperationExecutor) createFile(target Backend, targetPath string, from *transferSource) error {
+	content, _, err := from.open(0)
+	if err != nil {
+		return err
+	}
+	if err := target.Create(e.ctx, targetPath, content, from.meta.Size, from.meta.Modified); err != nil {
+		return err
+	}
+	if from.meta.ETag == "" {
+		return nil
 	}
+	return from.verify()
+}
 
-	// Upload file with appropriate method
-	if fileInfo.Size() > largeFileThreshold {
-		// Use chunked upload for large files
-		progressReader := &progressReader{
-			reader:    file,
-			tracker:   e.config.ProgressTracker,
-			totalSize: fileInfo.Size(),
-		}
+// transferSource reads the source of a file transfer, hashing and counting the content
+// on the way and keeping it within the bandwidth limits
+type transferSource struct {
+	executor *OperationExecutor
+	backend  Backend
+	path     string
+	meta     *FileMetadata
+	target   Backend
+
+	content io.ReadCloser
+	reader  *progressReader
+	hasher  hash.Hash
+	start   int64
+}
 
-		err = e.webdavClient.UploadFileChunked(e.ctx, remotePath, progressReader, fileInfo.Size(), chunkSize)
-		if err != nil {
-			return fmt.Errorf("failed to upload file (chunked) to %s: %w", remotePath, err)
-		}
-	} else {
-		// Use regular upload for smaller files
-		progressReader := &progressReader{
-			reader:    file,
-			tracker:   e.config.ProgressTracker,
-			totalSize: fileInfo.Size(),
-		}
+// transfer describes the source for a ResumableCreator
+func (s *transferSource) transfer() *Transfer {
+	e := s.executor
+	transfer := &Transfer{
+		Size:          s.meta.Size,
+		Modified:      s.meta.Modified,
+		ETag:          s.meta.ETag,
+		StoreChecksum: e.config.Checksums,
+		Resumes:       e.config.ResumeManager,
+		Open:          s.open,
+	}
 
-		err = e.webdavClient.UploadFile(e.ctx, remotePath, progressReader, fileInfo.Size())
-		if err != nil {
-			return fmt.Errorf("failed to upload file to %s: %w", remotePath, err)
-		}
+	if s.meta.Checksum != "" {
+		checksum := s.meta.Checksum
+		transfer.Checksum = func() (string, error) { return checksum, nil }
+	} else if hasher, ok := s.backend.(Hasher); ok {
+		transfer.Checksum = func() (string, error) { return hasher.Hash(e.ctx, s.path) }
 	}
 
-	// Finish progress tracking
-	if e.config.ProgressTracker != nil {
-		e.config.ProgressTracker.Finish()
+	if s.meta.ETag != "" {
+		transfer.Verify = s.verify
 	}
 
-	return nil
+	return transfer
 }
 
-// downloadFile downloads a remote file to the local filesystem
-func (e *OperationExecutor) downloadFile(remotePath, localPath string) error {
-	// Get remote file properties first to get size
-	props, err := e.webdavClient.GetProperties(e.ctx, remotePath)
+// open opens the source at offset, or at its start if the source cannot skip ahead
+func (s *transferSource) open(offset int64) (io.Reader, int64, error) {
+	e := s.executor
+
+	var content io.ReadCloser
+	var err error
+	if opener, ok := s.backend.(RangeOpener); ok && offset > 0 {
+		content, offset, err = opener.OpenRange(e.ctx, s.path, offset, s.meta.ETag)
+	} else {
+		content, err = s.backend.Open(e.ctx, s.path)
+		offset = 0
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get remote file properties for %s: %w", remotePath, err)
+		return nil, 0, fmt.Errorf("failed to open %s: %w", s.path, err)
 	}
 
-	// Update progress tracker
-	if e.config.ProgressTracker != nil {
-		e.config.ProgressTracker.Start(props.Size)
+	s.content, s.start = content, offset
+	s.hasher = sha256.New()
+	s.reader = &progressReader{
+		reader:    io.TeeReader(content, s.hasher),
+		tracker:   e.config.ProgressTracker,
+		totalSize: s.meta.Size,
+		readBytes: offset,
 	}
 
-	// Download file
-	readCloser, err := e.webdavClient.DownloadFile(e.ctx, remotePath)
-	if err != nil {
-		return fmt.Errorf("failed to download file from %s: %w", remotePath, err)
+	// Streams from a server count as downloads and streams to a server as uploads
+	var reader io.Reader = s.reader
+	if _, ok := s.backend.(*WebDAVBackend); ok {
+		reader = e.limitReader(reader, e.config.DownloadLimiter)
 	}
-	defer readCloser.Close()
-
-	// Create local directory if it doesn't exist
-	localDir := filepath.Dir(localPath)
-	if localDir != "." {
-		if err := os.MkdirAll(localDir, 0755); err != nil {
-			return fmt.Errorf("failed to create local directory %s: %w", localDir, err)
-		}
+	if _, ok := s.target.(*WebDAVBackend); ok {
+		reader = e.limitReader(reader, e.config.UploadLimiter)
 	}
 
-	// Create local file
-	file, err := os.Create(localPath)
+	return reader, offset, nil
+}
+
+// verify fails if the source has a different ETag than when the transfer started
+func (s *transferSource) verify() error {
+	current, err := s.backend.Stat(s.executor.ctx, s.path)
 	if err != nil {
-		return fmt.Errorf("failed to create local file %s: %w", localPath, err)
+		return fmt.Errorf("failed to verify %s: %w", s.path, err)
 	}
-	defer file.Close()
-
-	// Copy with progress tracking
-	progressWriter := &progressWriter{
-		writer:    file,
-		tracker:   e.config.ProgressTracker,
-		totalSize: props.Size,
+	if current.ETag != s.meta.ETag {
+		return fmt.Errorf("%s changed during download", s.path)
 	}
+	return nil
+}
 
-	_, err = io.Copy(progressWriter, readCloser)
-	if err != nil {
-		return fmt.Errorf("failed to copy downloaded content to %s: %w", localPath, err)
+// hash returns the SHA-256 of the content if the target read the whole file from its start
+func (s *transferSource) hash() (string, bool) {
+	if s.reader == nil || s.start != 0 || s.reader.readBytes != s.meta.Size {
+		return "", false
 	}
+	return hex.EncodeToString(s.hasher.Sum(nil)), true
+}
 
-	// Finish progress tracking
-	if e.config.ProgressTracker != nil {
-		e.config.ProgressTracker.Finish()
+// close closes the content if the source was opened
+func (s *transferSource) close() {
+	if s.content != nil {
+		s.content.Close()
 	}
+}
 
-	return nil
+// resumeStateKey identifies the resume state of a local file independent of the working directory
+func resumeStateKey(localPath string) string {
+	if absPath, err := filepath.Abs(localPath); err == nil {
+		return absPath
+	}
+	return localPath
 }
 
-// ensureRemoteDirectory creates a remote directory and all parent directories
-func (e *OperationExecutor) ensureRemoteDirectory(remotePath string) error {
+// makeRemoteDirectory creates a remote directory and all parent directories with client
+func makeRemoteDirectory(ctx context.Context, client webdav.Client, remotePath string) error {
 	// Clean the path and split by forward slashes (WebDAV always uses /)
 	remotePath = path.Clean(remotePath)
 	if remotePath == "/" || remotePath == "" {
@@ -226,16 +301,16 @@ func (e *OperationExecutor) ensureRemoteDirectory(remotePath string) error {
 		}
 
 		// Check if directory exists
-		_, err := e.webdavClient.GetProperties(e.ctx, currentPath)
+		_, err := client.GetProperties(ctx, currentPath)
 		if err == nil {
 			// Directory exists, continue
 			continue
 		}
 
 		// Try to create directory
-		if err := e.webdavClient.CreateDirectory(e.ctx, currentPath); err != nil {
+		if err := client.CreateDirectory(ctx, currentPath); err != nil {
 			// If creation failed, check if it was created by another process
-			if _, checkErr := e.webdavClient.GetProperties(e.ctx, currentPath); checkErr == nil {
+			if _, checkErr := client.GetProperties(ctx, currentPath); checkErr == nil {
 				continue
 			}
 			return fmt.Errorf("failed to create remote directory %s: %w", currentPath, err)
@@ -245,67 +320,6 @@ func (e *OperationExecutor) ensureRemoteDirectory(remotePath string) error {
 	return nil
 }
 
-// deleteLocalFile deletes a local file or directory
-func (e *OperationExecutor) deleteLocalFile(path string) error {
-	// Check if it's a directory
-	fileInfo, err := os.Stat(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // File already deleted
-		}
-		return fmt.Errorf("failed to stat local file %s: %w", path, err)
-	}
-
-	if fileInfo.IsDir() {
-		return os.RemoveAll(path)
-	}
-
-	return os.Remove(path)
-}
-
-// deleteRemoteFile deletes a remote file or directory
-func (e *OperationExecutor) deleteRemoteFile(path string) error {
-	// Try to delete file/directory
-	err := e.webdavClient.DeleteFile(e.ctx, path)
-	if err != nil {
-		// Check if it's a WebDAV "not found" error
-		if webdavErr, ok := err.(*webdav.WebDAVError); ok && webdavErr.IsNotFoundError() {
-			return nil // File already deleted
-		}
-		return fmt.Errorf("failed to delete remote file %s: %w", path, err)
-	}
-
-	return nil
-}
-
-// moveLocalFile moves a local file from source to destination
-func (e *OperationExecutor) moveLocalFile(source, destination string) error {
-	// Create destination directory if needed
-	destDir := filepath.Dir(destination)
-	if destDir != "." {
-		if err := os.MkdirAll(destDir, 0755); err != nil {
-			return fmt.Errorf("failed to create destination directory %s: %w", destDir, err)
-		}
-	}
-
-	// Move the file
-	return os.Rename(source, destination)
-}
-
-// moveRemoteFile moves a remote file from source to destination
-func (e *OperationExecutor) moveRemoteFile(source, destination string) error {
-	// Ensure destination directory exists
-	destDir := filepath.Dir(destination)
-	if destDir != "." && destDir != "/" {
-		if err := e.ensureRemoteDirectory(destDir); err != nil {
-			return fmt.Errorf("failed to create destination directory %s: %w", destDir, err)
-		}
-	}
-
-	// Move the file
-	return e.webdavClient.MoveFile(e.ctx, source, destination)
-}
-
 // PlanOperations creates a sync plan from detected changes
 func (e *OperationExecutor) PlanOperations(changes []*Change) (*SyncPlan, error) {
 	plan := &SyncPlan{
@@ -316,7 +330,6 @@ func (e *OperationExecutor) PlanOperations(changes []*Change) (*SyncPlan, error)
 	}
 
 	var totalSize int64
-	var totalFiles int
 
 	for _, change := range changes {
 		// Check for conflicts
@@ -336,7 +349,7 @@ func (e *OperationExecutor) PlanOperations(changes []*Change) (*SyncPlan, error)
 
 		// Create operation
 		op := &SyncOperation{
-			ID:           fmt.Sprintf("%s_%d", change.Type.String(), time.Now().UnixNano()),
+			ID:           plan.newOperationID(change.Type.String()),
 			Type:         change.Type,
 			Direction:    change.Direction,
 			Priority:     change.Priority,
@@ -362,9 +375,13 @@ func (e *OperationExecutor) PlanOperations(changes []*Change) (*SyncPlan, error)
 		} else if change.Direction == RemoteToLocal && change.RemoteMeta != nil {
 			op.Size = change.RemoteMeta.Size
 		}
+		op.IsDirectory = changeIsDirectory(change)
+		if op.IsDirectory {
+			op.Size = 0
+		}
+		planMove(op, change)
 
 		totalSize += op.Size
-		totalFiles++
 
 		// Add dependencies for directory creation
 		if change.Type == ChangeCreate || change.Type == ChangeUpdate {
@@ -388,7 +405,10 @@ func (e *OperationExecutor) PlanOperations(changes []*Change) (*SyncPlan, error)
 		plan.Operations = append(plan.Operations, op)
 	}
 
-	plan.TotalFiles = totalFiles
+	linkMoveDependencies(plan.Operations)
+
+	// Directories created for uploads count as well
+	plan.TotalFiles = len(plan.Operations)
 	plan.TotalSize = totalSize
 
 	// Estimate time (rough calculation: 1MB per second)
@@ -402,112 +422,209 @@ func (e *OperationExecutor) PlanOperations(changes []*Change) (*SyncPlan, error)
 	return plan, nil
 }
 
-// findOrCreateDirectoryOp finds or creates an operation for directory creation
-func (e *OperationExecutor) findOrCreateDirectoryOp(plan *SyncPlan, dirPath string) string {
-	// Check if we already have an operation for this directory
-	for _, op := range plan.Operations {
-		if op.Type == ChangeCreate && op.TargetPath == dirPath {
-			return op.ID
-		}
-	}
+// newOperationID returns an ID that no other operation of the plan has
+func (p *SyncPlan) newOperationID(name string) string {
+	p.issuedIDs++
+	return fmt.Sprintf("%s_%d", name, p.issuedIDs)
+}
 
-	// Create a directory creation operation
-	dirOp := &SyncOperation{
-		ID:         fmt.Sprintf("mkdir_%s_%d", dirPath, time.Now().UnixNano()),
-		Type:       ChangeCreate,
-		Direction:  LocalToRemote,
-		SourcePath: "",
-		TargetPath: dirPath,
-		Size:       0,
-		Priority:   100, // High priority for directories
+// planMove sets the paths of a move operation, which renames the old path to the
+// new one on the target side without transferring any content
+func planMove(op *SyncOperation, change *Change) {
+	if change.Type != ChangeMove {
+		return
 	}
+	op.SourcePath = change.OldPath
+	op.TargetPath = change.Path()
+	op.Size = 0
+}
 
-	plan.Operations = append(plan.Operations, dirOp)
-	return dirOp.ID
+// planResolution creates the operations that apply the resolution of a conflict.
+// Skipped conflicts and those left for manual resolution need none.
+func planResolution(plan *SyncPlan, conflict *Conflict, sourceDirection ChangeDirection) []*SyncOperation {
+	switch conflict.Resolution.Action {
+	case "local_wins":
+		return planWinner(plan, LocalToRemote, conflict.LocalPath, conflict.RemotePath, conflict.LocalMeta, conflict.RemoteMeta)
+	case "remote_wins":
+		return planWinner(plan, RemoteToLocal, conflict.RemotePath, conflict.LocalPath, conflict.RemoteMeta, conflict.LocalMeta)
+	case "keep_both":
+		return planKeepBoth(plan, conflict, sourceDirection)
+	default:
+		return nil
+	}
 }
 
-// ExecutePlan executes a complete sync plan
-func (e *OperationExecutor) ExecutePlan(plan *SyncPlan) (*SyncResult, error) {
-	result := &SyncResult{
-		StartTime:    time.Now(),
-		CreatedFiles: make([]string, 0),
-		UpdatedFiles: make([]string, 0),
-		DeletedFiles: make([]string, 0),
-		SkippedFiles: make([]string, 0),
-		Errors:       make([]string, 0),
-		Warnings:     make([]string, 0),
-		Conflicts:    make([]*Conflict, 0),
+// planWinner creates the operations that make the losing side of a conflict match
+// the winning side: the winner is transferred, or the loser deleted if the winner was
+// deleted. A loser of the other type is deleted before the winner takes its place.
+func planWinner(plan *SyncPlan, direction ChangeDirection, source, target string, winner, loser *FileMetadata) []*SyncOperation {
+	id := plan.newOperationID("resolve_" + target)
+
+	if winner == nil {
+		return []*SyncOperation{{
+			ID:           id,
+			Type:         ChangeDelete,
+			Direction:    direction,
+			SourcePath:   source,
+			TargetPath:   target,
+			IsDirectory:  loser != nil && loser.IsDirectory,
+			Priority:     100,
+			Dependencies: make([]string, 0),
+		}}
+	}
+
+	var operations []*SyncOperation
+	transfer := &SyncOperation{
+		ID:           id,
+		Type:         ChangeUpdate,
+		Direction:    direction,
+		SourcePath:   source,
+		TargetPath:   target,
+		Size:         winner.Size,
+		IsDirectory:  winner.IsDirectory,
+		Priority:     calculatePriority(winner),
+		Dependencies: make([]string, 0),
+	}
+	if winner.IsDirectory {
+		transfer.Size = 0
+	}
+
+	if loser == nil {
+		transfer.Type = ChangeCreate
+	} else if loser.IsDirectory != winner.IsDirectory {
+		remove := &SyncOperation{
+			ID:           id + "_remove",
+			Type:         ChangeDelete,
+			Direction:    direction,
+			SourcePath:   source,
+			TargetPath:   target,
+			IsDirectory:  loser.IsDirectory,
+			Priority:     100,
+			Dependencies: make([]string, 0),
+		}
+		operations = append(operations, remove)
+		transfer.Type = ChangeCreate
+		transfer.Dependencies = append(transfer.Dependencies, remove.ID)
 	}
 
-	// Copy conflicts from plan
-	result.Conflicts = plan.Conflicts
+	return append(operations, transfer)
+}
 
-	// Sort operations by priority (higher first)
-	sortedOps := make([]*SyncOperation, len(plan.Operations))
-	copy(sortedOps, plan.Operations)
+// planKeepBoth creates the operations for a conflict resolved by keeping both
+// versions. The target version is renamed to its conflict copy, which is then
+// transferred to the source side, and the source version takes its place.
+func planKeepBoth(plan *SyncPlan, conflict *Conflict, sourceDirection ChangeDirection) []*SyncOperation {
+	resolution := conflict.Resolution
+	copyDirection := RemoteToLocal
+	winner, loser := conflict.LocalMeta, conflict.RemoteMeta
+	if sourceDirection == RemoteToLocal {
+		copyDirection = LocalToRemote
+		winner, loser = conflict.RemoteMeta, conflict.LocalMeta
+	}
+
+	id := plan.newOperationID("keep_both_" + resolution.Path)
+	preserve := &SyncOperation{
+		ID:           id + "_preserve",
+		Type:         ChangeMove,
+		Direction:    sourceDirection,
+		SourcePath:   resolution.Path,
+		TargetPath:   resolution.CopyPath,
+		Priority:     100,
+		Dependencies: make([]string, 0),
+	}
+	transferCopy := &SyncOperation{
+		ID:           id + "_copy",
+		Type:         ChangeCreate,
+		Direction:    copyDirection,
+		SourcePath:   resolution.CopyPath,
+		TargetPath:   resolution.CopyPath,
+		Size:         loser.Size,
+		Priority:     calculatePriority(loser),
+		Dependencies: []string{preserve.ID},
+	}
+	replace := &SyncOperation{
+		ID:           id + "_replace",
+		Type:         ChangeUpdate,
+		Direction:    sourceDirection,
+		SourcePath:   resolution.Path,
+		TargetPath:   resolution.Path,
+		Size:         winner.Size,
+		Priority:     calculatePriority(winner),
+		Dependencies: []string{preserve.ID},
+	}
+
+	return []*SyncOperation{preserve, transferCopy, replace}
+}
 
-	// Simple sort by priority
-	for i := 0; i < len(sortedOps)-1; i++ {
-		for j := i + 1; j < len(sortedOps); j++ {
-			if sortedOps[j].Priority > sortedOps[i].Priority {
-				sortedOps[i], sortedOps[j] = sortedOps[j], sortedOps[i]
-			}
+// linkMoveDependencies orders operations around moves on the same side: operations
+// within the new path wait for the move, and so do deletions of a directory the
+// moved path is taken out of
+func linkMoveDependencies(operations []*SyncOperation) {
+	for _, move := range operations {
+		if move.Type != ChangeMove {
+			continue
 		}
-	}
 
-	// Execute operations in order
-	for _, op := range sortedOps {
-		// Check dependencies
-		dependenciesSatisfied := true
-		for _, depID := range op.Dependencies {
-			if !e.isOperationCompleted(depID, result) {
-				dependenciesSatisfied = false
-				break
+		for _, op := range operations {
+			if op == move || op.Direction != move.Direction {
+				continue
+			}
+			if withinSubtree(op.TargetPath, move.TargetPath) ||
+				(op.Type == ChangeDelete && withinSubtree(move.SourcePath, op.TargetPath)) {
+				op.Dependencies = append(op.Dependencies, move.ID)
 			}
 		}
+	}
+}
 
-		if !dependenciesSatisfied {
-			result.SkippedFiles = append(result.SkippedFiles, fmt.Sprintf("%s (dependencies not satisfied)", op.SourcePath))
-			continue
+// linkDirectoryDependencies makes uploads wait for the creation of their parent
+// directory on the remote if the plan creates it. Parents that already exist
+// need no operation, so no dependency is added for them.
+func linkDirectoryDependencies(operations []*SyncOperation) {
+	directories := make(map[string]string)
+	for _, op := range operations {
+		if op.Type == ChangeCreate && op.IsDirectory && op.Direction == LocalToRemote {
+			directories[op.TargetPath] = op.ID
 		}
+	}
 
-		// Execute operation
-		err := e.ExecuteOperation(op)
-		if err != nil {
-			errorMsg := fmt.Sprintf("Failed to execute %s on %s: %v", op.Type.String(), op.SourcePath, err)
-			result.Errors = append(result.Errors, errorMsg)
-
-			if e.config.ProgressTracker != nil {
-				e.config.ProgressTracker.Error(err)
-			}
+	for _, op := range operations {
+		if (op.Type != ChangeCreate && op.Type != ChangeUpdate) || op.Direction != LocalToRemote || op.TargetPath == "" {
 			continue
 		}
+		if parentOpID, exists := directories[filepath.Dir(op.TargetPath)]; exists && parentOpID != op.ID {
+			op.Dependencies = append(op.Dependencies, parentOpID)
+		}
+	}
+}
 
-		// Update result
-		result.ProcessedFiles++
-		result.TransferredSize += op.Size
-
-		switch op.Type {
-		case ChangeCreate:
-			result.CreatedFiles = append(result.CreatedFiles, op.SourcePath)
-		case ChangeUpdate:
-			result.UpdatedFiles = append(result.UpdatedFiles, op.SourcePath)
-		case ChangeDelete:
-			result.DeletedFiles = append(result.DeletedFiles, op.SourcePath)
+// findOrCreateDirectoryOp finds or creates an operation for directory creation
+func (e *OperationExecutor) findOrCreateDirectoryOp(plan *SyncPlan, dirPath string) string {
+	// Check if we already have an operation for this directory
+	for _, op := range plan.Operations {
+		if op.Type == ChangeCreate && op.TargetPath == dirPath {
+			return op.ID
 		}
 	}
 
-	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime)
-	result.TotalFiles = plan.TotalFiles
-	result.TotalSize = plan.TotalSize
-	result.Success = len(result.Errors) == 0
+	// Create a directory creation operation
+	dirOp := &SyncOperation{
+		ID:          plan.newOperationID("mkdir_" + dirPath),
+		Type:        ChangeCreate,
+		Direction:   LocalToRemote,
+		SourcePath:  "",
+		TargetPath:  dirPath,
+		Size:        0,
+		IsDirectory: true,
+		Priority:    100, // High priority for directories
+	}
 
-	return result, nil
+	plan.Operations = append(plan.Operations, dirOp)
+	return dirOp.ID
 }
 
-// planChange creates operations for a single change
-func (e *OperationExecutor) planChange(change *Change) ([]*SyncOperation, error) {
+// planChange creates operations for a single change of a plan
+func (e *OperationExecutor) planChange(plan *SyncPlan, change *Change) ([]*SyncOperation, error) {
 	var operations []*SyncOperation
 
 	// Skip if this is a conflict
@@ -517,7 +634,7 @@ func (e *OperationExecutor) planChange(change *Change) ([]*SyncOperation, error)
 
 	// Create operation based on change type and direction
 	op := &SyncOperation{
-		ID:           fmt.Sprintf("%s_%d", change.Type.String(), time.Now().UnixNano()),
+		ID:           plan.newOperationID(change.Type.String()),
 		Type:         change.Type,
 		Direction:    change.Direction,
 		SourcePath:   change.LocalPath,
@@ -526,11 +643,19 @@ func (e *OperationExecutor) planChange(change *Change) ([]*SyncOperation, error)
 		Dependencies: make([]string, 0),
 	}
 
-	// Set size based on direction and available metadata
+	// Set paths and size based on direction and available metadata
 	if change.Direction == LocalToRemote && change.LocalMeta != nil {
 		op.Size = change.LocalMeta.Size
-	} else if change.Direction == RemoteToLocal && change.RemoteMeta != nil {
-		op.Size = change.RemoteMeta.Size
+	} else if change.Direction == RemoteToLocal {
+		op.SourcePath = change.RemotePath
+		op.TargetPath = change.LocalPath
+		if change.RemoteMeta != nil {
+			op.Size = change.RemoteMeta.Size
+		}
+	}
+	op.IsDirectory = changeIsDirectory(change)
+	if op.IsDirectory {
+		op.Size = 0
 	}
 
 	// Handle bidirectional operations
@@ -560,60 +685,84 @@ func (e *OperationExecutor) planChange(change *Change) ([]*SyncOperation, error)
 		}
 	}
 
-	// Add directory creation dependencies if needed
-	if change.Type == ChangeCreate || change.Type == ChangeUpdate {
-		if op.Direction == LocalToRemote && op.TargetPath != "" {
-			parentDir := filepath.Dir(op.TargetPath)
-			if parentDir != "." && parentDir != "/" {
-				parentOpID := e.findOrCreateDirectoryOpForPlan(nil, parentDir)
-				if parentOpID != "" {
-					op.Dependencies = append(op.Dependencies, parentOpID)
-				}
-			}
-		}
-	}
+	planMove(op, change)
 
 	operations = append(operations, op)
 	return operations, nil
 }
 
-// findOrCreateDirectoryOpForPlan finds or creates a directory operation for a plan
-func (e *OperationExecutor) findOrCreateDirectoryOpForPlan(plan *SyncPlan, dirPath string) string {
-	// If we have a plan, check existing operations
-	if plan != nil {
-		for _, op := range plan.Operations {
-			if op.Type == ChangeCreate && op.TargetPath == dirPath {
-				return op.ID
-			}
-		}
+// changeIsDirectory reports whether a change refers to a directory
+func changeIsDirectory(change *Change) bool {
+	if change.LocalMeta != nil && change.LocalMeta.IsDirectory {
+		return true
+	}
+	return change.RemoteMeta != nil && change.RemoteMeta.IsDirectory
+}
+
+// recordJournal updates the sync journal after an operation completed successfully
+func (e *OperationExecutor) recordJournal(op *SyncOperation, hash string) {
+	journal := e.config.Journal
+	if journal == nil || op.TargetPath == "" {
+		return
 	}
 
-	// Generate a unique ID for directory creation
-	dirOpID := fmt.Sprintf("mkdir_%s_%d", dirPath, time.Now().UnixNano())
+	// Journal keys are the root-relative paths shared by both sides
+	key := strings.TrimPrefix(filepath.ToSlash(op.TargetPath), "/")
 
-	// If we have a plan, add the operation to it
-	if plan != nil {
-		dirOp := &SyncOperation{
-			ID:         dirOpID,
-			Type:       ChangeCreate,
-			Direction:  LocalToRemote,
-			SourcePath: "",
-			TargetPath: dirPath,
-			Size:       0,
-			Priority:   100, // High priority for directories
+	var localPath, remotePath string
+	switch op.Type {
+	case ChangeDelete:
+		journal.Delete(key)
+		return
+	case ChangeMove:
+		// Everything below a moved directory keeps its synced state under the new path
+		journal.Move(strings.TrimPrefix(filepath.ToSlash(op.SourcePath), "/"), key)
+		if op.IsDirectory {
+			return
+		}
+
+		// A moved file is refreshed since the remote ETag may change with its path
+		if entry, exists := journal.Get(key); exists {
+			hash = entry.Hash
+		}
+		localPath, remotePath = op.TargetPath, op.TargetPath
+	case ChangeCreate, ChangeUpdate:
+		localPath, remotePath = op.SourcePath, op.TargetPath
+		if op.Direction == RemoteToLocal {
+			localPath, remotePath = op.TargetPath, op.SourcePath
+		} else if op.IsDirectory {
+			localPath = op.TargetPath
 		}
-		plan.Operations = append(plan.Operations, dirOp)
+	default:
+		return
+	}
+
+	// A file renamed on one side only, such as a conflict copy, is not in sync yet
+	local, remote, err := e.statSides(localPath, remotePath)
+	if err != nil {
+		if op.Type == ChangeMove {
+			journal.Delete(key)
+		}
+		return
 	}
+	local.Path, remote.Path = key, key
 
-	return dirOpID
+	entry := NewJournalEntry(key, local, remote)
+	entry.Hash = hash
+	journal.Put(entry)
 }
 
-// isOperationCompleted checks if an operation (by ID) has been completed
-func (e *OperationExecutor) isOperationCompleted(opID string, result *SyncResult) bool {
-	// This is a simplified check - in a real implementation,
-	// we'd track operation IDs more carefully
-	// For now, we assume all operations are completed if we reach them
-	return true
+// statSides returns the metadata of a path on the local and the remote side
+func (e *OperationExecutor) statSides(localPath, remotePath string) (*FileMetadata, *FileMetadata, error) {
+	local, err := e.local.Stat(e.ctx, localPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	remote, err := e.remote.Stat(e.ctx, remotePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return local, remote, nil
 }
 
 // progressReader wraps an io.Reader to track progress
@@ -635,21 +784,58 @@ func (pr *progressReader) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
-// progressWriter wraps an io.Writer to track progress
-type progressWriter struct {
-	writer     io.Writer
-	tracker    ProgressTracker
-	totalSize  int64
-	wroteBytes int64
+// limitReader limits how fast a transfer consumes a reader, a nil limiter leaves it unlimited
+func (e *OperationExecutor) limitReader(reader io.Reader, limiter *bandwidth.Limiter) io.Reader {
+	if limiter == nil {
+		return reader
+	}
+	return &limitedReader{ctx: e.ctx, reader: reader, limiter: limiter}
 }
 
-func (pw *progressWriter) Write(p []byte) (n int, err error) {
-	n, err = pw.writer.Write(p)
-	pw.wroteBytes += int64(n)
+// limitedReader wraps a progressReader to keep a transfer within a bandwidth limit
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *bandwidth.Limiter
+}
 
-	if pw.tracker != nil {
-		pw.tracker.Update(pw.wroteBytes)
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitedChunkSize {
+		p = p[:limitedChunkSize]
 	}
 
+	n, err := lr.reader.Read(p)
+	if waitErr := lr.limiter.WaitN(lr.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
 	return n, err
 }
+
+// checkpointWriter writes to a partial download and periodically flushes it to disk,
+// so that the recorded progress never exceeds what a later attempt finds in the file
+type checkpointWriter struct {
+	file       *os.File
+	written    int64
+	next       int64
+	checkpoint func(written int64) error
+}
+
+func (cw *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := cw.file.Write(p)
+	cw.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	if cw.written >= cw.next {
+		cw.next = cw.written + resumeCheckpointInterval
+		if err := cw.file.Sync(); err != nil {
+			return n, err
+		}
+		if err := cw.checkpoint(cw.written); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
@@ -1,13 +1,22 @@
 package sync
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/iotest"
 	"time"
 
+	"github.com/phaus/nextcloud-sync/internal/bandwidth"
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
+	"github.com/phaus/nextcloud-sync/internal/progress"
 	"github.com/phaus/nextcloud-sync/internal/webdav"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -143,6 +152,34 @@ func (m *mockWebDAVClient) CopyFile(ctx context.Context, source, destination str
 	return nil
 }
 
+func (m *mockWebDAVClient) SyncCollection(ctx context.Context, path, token string) (*webdav.SyncCollectionResult, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) ListTrash(ctx context.Context) ([]*webdav.TrashItem, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) RestoreTrashItem(ctx context.Context, name string) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) DeleteTrashItem(ctx context.Context, name string) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) EmptyTrash(ctx context.Context) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) ListVersions(ctx context.Context, path string) ([]*webdav.FileVersion, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) RestoreVersion(ctx context.Context, version *webdav.FileVersion) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
 func (m *mockWebDAVClient) Close() error {
 	return nil
 }
@@ -308,25 +345,26 @@ func TestExecuteOperation_Delete(t *testing.T) {
 	config := &SyncConfig{}
 	executor := NewOperationExecutor(mockClient, config)
 
-	// Test local deletion
+	// Test local deletion, propagated from the remote side
 	localDeleteOp := &SyncOperation{
 		ID:         "test-delete-local",
 		Type:       ChangeDelete,
-		Direction:  LocalToRemote,
-		SourcePath: localFile,
-		TargetPath: "/remote/test.txt",
+		Direction:  RemoteToLocal,
+		SourcePath: "/remote/test.txt",
+		TargetPath: localFile,
 	}
 
 	err = executor.ExecuteOperation(localDeleteOp)
 	assert.NoError(t, err)
 	_, err = os.Stat(localFile)
 	assert.True(t, os.IsNotExist(err))
+	assert.Contains(t, mockClient.files, "/remote/test.txt")
 
-	// Test remote deletion
+	// Test remote deletion, propagated from the local side
 	remoteDeleteOp := &SyncOperation{
 		ID:         "test-delete-remote",
 		Type:       ChangeDelete,
-		Direction:  RemoteToLocal,
+		Direction:  LocalToRemote,
 		SourcePath: localFile,
 		TargetPath: "/remote/test.txt",
 	}
@@ -347,53 +385,52 @@ func TestExecuteOperation_Move(t *testing.T) {
 
 	// Create temporary local file
 	tmpDir := t.TempDir()
-	sourceFile := filepath.Join(tmpDir, "source.txt")
-	destFile := filepath.Join(tmpDir, "dest.txt")
-	err := os.WriteFile(sourceFile, []byte("test content"), 0644)
+	err := os.WriteFile(filepath.Join(tmpDir, "source.txt"), []byte("test content"), 0644)
 	require.NoError(t, err)
 
 	// Setup executor
-	config := &SyncConfig{}
+	config := &SyncConfig{
+		Source: tmpDir,
+		Target: "https://cloud.example.com/files/test?dir=/remote",
+	}
 	executor := NewOperationExecutor(mockClient, config)
 
-	// Test local move
-	localMoveOp := &SyncOperation{
-		ID:         "test-move-local",
+	// A local rename is propagated as a remote move
+	remoteMoveOp := &SyncOperation{
+		ID:         "test-move-remote",
 		Type:       ChangeMove,
 		Direction:  LocalToRemote,
-		SourcePath: sourceFile,
-		TargetPath: destFile,
+		SourcePath: "source.txt",
+		TargetPath: "dest.txt",
 	}
 
-	err = executor.ExecuteOperation(localMoveOp)
-	assert.NoError(t, err)
-	_, err = os.Stat(sourceFile)
-	assert.True(t, os.IsNotExist(err))
-	_, err = os.Stat(destFile)
+	err = executor.ExecuteOperation(remoteMoveOp)
 	assert.NoError(t, err)
+	assert.NotContains(t, mockClient.files, "/remote/source.txt")
+	assert.Contains(t, mockClient.files, "/remote/dest.txt")
 
-	// Test remote move
-	remoteMoveOp := &SyncOperation{
-		ID:         "test-move-remote",
+	// A remote rename is propagated as a local rename
+	localMoveOp := &SyncOperation{
+		ID:         "test-move-local",
 		Type:       ChangeMove,
 		Direction:  RemoteToLocal,
-		SourcePath: "/remote/source.txt",
-		TargetPath: "/remote/dest.txt",
+		SourcePath: "source.txt",
+		TargetPath: "sub/dest.txt",
 	}
 
-	err = executor.ExecuteOperation(remoteMoveOp)
+	err = executor.ExecuteOperation(localMoveOp)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tmpDir, "source.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(tmpDir, "sub", "dest.txt"))
 	assert.NoError(t, err)
-	assert.NotContains(t, mockClient.files, "/remote/source.txt")
-	assert.Contains(t, mockClient.files, "/remote/dest.txt")
 }
 
-func TestEnsureRemoteDirectory(t *testing.T) {
+func TestMakeRemoteDirectory(t *testing.T) {
 	mockClient := newMockWebDAVClient()
-	config := &SyncConfig{}
-	executor := NewOperationExecutor(mockClient, config)
 
 	// Test nested directory creation
-	err := executor.ensureRemoteDirectory("/a/b/c/d")
+	err := makeRemoteDirectory(context.Background(), mockClient, "/a/b/c/d")
 	assert.NoError(t, err)
 
 	// Verify all directories were created
@@ -464,7 +501,7 @@ func TestPlanOperations(t *testing.T) {
 	assert.Equal(t, 3, len(plan.Operations)) // 2 file ops + 1 auto directory creation
 	assert.Equal(t, 1, len(plan.Conflicts))
 	assert.Equal(t, int64(300), plan.TotalSize) // 100 + 200 (directory ops have size 0)
-	assert.Equal(t, 2, plan.TotalFiles)         // Only 2 non-conflicting files
+	assert.Equal(t, 3, plan.TotalFiles)         // The directory creation counts as well
 
 	// Verify conflict
 	conflict := plan.Conflicts[0]
@@ -473,6 +510,38 @@ func TestPlanOperations(t *testing.T) {
 	assert.Equal(t, "/remote/file3.txt", conflict.RemotePath)
 }
 
+func TestPlanOperations_IDsAndTotalsCoverDirectories(t *testing.T) {
+	modified := time.Now().Add(-time.Minute)
+	source, target := NewMemoryBackend(), NewMemoryBackend()
+
+	var changes []*Change
+	for i := 0; i < 50; i++ {
+		p := fmt.Sprintf("dir/file%d.txt", i)
+		require.NoError(t, source.WriteFile(p, []byte("content"), modified))
+		meta, err := source.Stat(context.Background(), p)
+		require.NoError(t, err)
+		changes = append(changes, CompareFiles(meta, nil, nil))
+	}
+
+	executor := NewOperationExecutor(nil, &SyncConfig{SourceBackend: source, TargetBackend: target})
+	plan, err := executor.PlanOperations(changes)
+	require.NoError(t, err)
+
+	// Operations planned within the same clock tick still have their own IDs
+	ids := make(map[string]bool)
+	for _, op := range plan.Operations {
+		assert.False(t, ids[op.ID], "duplicate ID %s", op.ID)
+		ids[op.ID] = true
+	}
+	require.Len(t, plan.Operations, 51)
+	assert.Equal(t, 51, plan.TotalFiles)
+
+	result, err := executor.ExecutePlan(context.Background(), plan)
+	require.NoError(t, err)
+	assert.True(t, result.Success, "errors: %v", result.Errors)
+	assert.Equal(t, plan.TotalFiles, result.ProcessedFiles)
+}
+
 func TestExecutePlan(t *testing.T) {
 	// Setup temporary directory
 	tmpDir := t.TempDir()
@@ -508,7 +577,7 @@ func TestExecutePlan(t *testing.T) {
 	}
 
 	// Execute plan
-	result, err := executor.ExecutePlan(plan)
+	result, err := executor.ExecutePlan(context.Background(), plan)
 	require.NoError(t, err)
 
 	// Verify result
@@ -546,35 +615,548 @@ func TestProgressReader(t *testing.T) {
 	assert.Greater(t, tracker.updateCount, 0)
 }
 
-func TestProgressWriter(t *testing.T) {
-	content := []byte("test content for progress writer")
-	tracker := &mockProgressTracker{}
+func TestLimitedReader(t *testing.T) {
+	schedule, err := bandwidth.ParseSchedule("256K")
+	require.NoError(t, err)
 
-	var writtenData []byte
-	writer := &progressWriter{
-		writer:    &mockDataWriter{data: &writtenData},
-		tracker:   tracker,
-		totalSize: int64(len(content)),
+	// A full bucket allows a one second burst, the rest has to wait for the rate
+	content := bytes.Repeat([]byte("x"), 256*1024+32*1024)
+	executor := &OperationExecutor{ctx: context.Background()}
+
+	t.Run("reader", func(t *testing.T) {
+		start := time.Now()
+		result, err := io.ReadAll(executor.limitReader(bytes.NewReader(content), bandwidth.NewLimiter(schedule)))
+		require.NoError(t, err)
+		assert.Equal(t, content, result)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("shared limiter", func(t *testing.T) {
+		// Two transfers sharing a limiter split the rate between them
+		limiter := bandwidth.NewLimiter(schedule)
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			_, err := io.Copy(io.Discard, executor.limitReader(bytes.NewReader(content[:144*1024]), limiter))
+			require.NoError(t, err)
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		cancelled := &OperationExecutor{ctx: ctx}
+		result, err := io.ReadAll(cancelled.limitReader(bytes.NewReader(content), bandwidth.NewLimiter(schedule)))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, len(result), len(content))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		reader := bytes.NewReader(content)
+		assert.Same(t, reader, executor.limitReader(reader, nil))
+	})
+}
+
+// downloadFile transfers a file from the server of the executor to a local path
+func downloadFile(executor *OperationExecutor, remotePath, localPath string) (string, error) {
+	return executor.transferFile(executor.remote, NewLocalBackend(""), remotePath, localPath)
+}
+
+// uploadFile transfers a local file to the server of the executor
+func uploadFile(executor *OperationExecutor, localPath, remotePath string) (string, error) {
+	return executor.transferFile(NewLocalBackend(""), executor.remote, localPath, remotePath)
+}
+
+// rangeMockClient serves versioned files with range requests and can fail mid-download
+type rangeMockClient struct {
+	*mockWebDAVClient
+	etags       []string // ETag reported by successive GetProperties calls, the last one repeats
+	failAfter   int      // Number of bytes sent before the download fails, 0 for no failure
+	rangeOffset int64
+}
+
+func (m *rangeMockClient) GetProperties(ctx context.Context, path string) (*webdav.WebDAVProperties, error) {
+	props, err := m.mockWebDAVClient.GetProperties(ctx, path)
+	if err != nil {
+		return nil, err
 	}
+	props.ETag = m.etags[0]
+	if len(m.etags) > 1 {
+		m.etags = m.etags[1:]
+	}
+	return props, nil
+}
+
+func (m *rangeMockClient) DownloadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	content, _, err := m.DownloadFileRange(ctx, path, 0, "")
+	return content, err
+}
+
+func (m *rangeMockClient) DownloadFileRange(ctx context.Context, path string, offset int64, etag string) (io.ReadCloser, int64, error) {
+	m.rangeOffset = offset
+	data := m.files[path].content[offset:]
+	if m.failAfter > 0 {
+		return io.NopCloser(io.MultiReader(bytes.NewReader(data[:m.failAfter]), iotest.ErrReader(errors.New("connection reset")))), offset, nil
+	}
+	return io.NopCloser(bytes.NewReader(data)), offset, nil
+}
+
+func TestDownloadFile_ResumesPartialFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	modTime := time.Now().Truncate(time.Second)
+	client := &rangeMockClient{mockWebDAVClient: newMockWebDAVClient(), etags: []string{`"v1"`}}
+	client.files["/remote/big.bin"] = &mockFile{content: content, modTime: modTime}
+
+	localFile := filepath.Join(t.TempDir(), "big.bin")
+	require.NoError(t, os.WriteFile(localFile+partialFileSuffix, content[:40], 0644))
 
-	// Write all content
-	n, err := writer.Write(content)
+	resumeManager, err := progress.NewResumeManager(t.TempDir())
 	require.NoError(t, err)
-	assert.Equal(t, len(content), n)
+	_, err = resumeManager.StartTransferWithETag(localFile, "download", 100, modTime, `"v1"`)
+	require.NoError(t, err)
+	require.NoError(t, resumeManager.UpdateProgress(localFile, 40, ""))
 
-	// Verify data was written
-	assert.Equal(t, content, writtenData)
+	executor := NewOperationExecutor(client, &SyncConfig{ResumeManager: resumeManager})
+	hash, err := downloadFile(executor, "/remote/big.bin", localFile)
+	require.NoError(t, err)
 
-	// Verify progress was tracked
-	assert.Greater(t, tracker.updateCount, 0)
+	assert.Equal(t, int64(40), client.rangeOffset)
+	downloaded, err := os.ReadFile(localFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+
+	expected := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(expected[:]), hash)
+
+	assert.NoFileExists(t, localFile+partialFileSuffix)
+	assert.Empty(t, resumeManager.GetActiveTransfers())
 }
 
-// mockDataWriter captures written data for testing
-type mockDataWriter struct {
-	data *[]byte
+func TestDownloadFile_InterruptedDownloadKeepsPartialFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	client := &rangeMockClient{mockWebDAVClient: newMockWebDAVClient(), etags: []string{`"v1"`}, failAfter: 30}
+	client.files["/remote/big.bin"] = &mockFile{content: content, modTime: time.Now()}
+
+	localFile := filepath.Join(t.TempDir(), "big.bin")
+	resumeManager, err := progress.NewResumeManager(t.TempDir())
+	require.NoError(t, err)
+
+	executor := NewOperationExecutor(client, &SyncConfig{ResumeManager: resumeManager})
+	_, err = downloadFile(executor, "/remote/big.bin", localFile)
+	require.Error(t, err)
+
+	assert.NoFileExists(t, localFile)
+	partial, err := os.ReadFile(localFile + partialFileSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, content[:30], partial)
+
+	transfers := resumeManager.GetActiveTransfers()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, int64(30), transfers[0].TransferredSize)
+	assert.Equal(t, `"v1"`, transfers[0].ETag)
+
+	// The next attempt only fetches the rest
+	client.failAfter = 0
+	_, err = downloadFile(executor, "/remote/big.bin", localFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), client.rangeOffset)
+
+	downloaded, err := os.ReadFile(localFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+}
+
+func TestDownloadFile_RemoteChangedDuringDownload(t *testing.T) {
+	client := &rangeMockClient{mockWebDAVClient: newMockWebDAVClient(), etags: []string{`"v1"`, `"v2"`}}
+	client.files["/remote/a.txt"] = &mockFile{content: []byte("hello"), modTime: time.Now()}
+
+	localFile := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(localFile, []byte("old"), 0644))
+
+	executor := NewOperationExecutor(client, &SyncConfig{})
+	_, err := downloadFile(executor, "/remote/a.txt", localFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed during download")
+
+	// The existing file is left untouched
+	existing, err := os.ReadFile(localFile)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), existing)
+	assert.NoFileExists(t, localFile+partialFileSuffix)
+}
+
+// resumeMockClient reports chunks of an interrupted upload and records how uploads are continued
+type resumeMockClient struct {
+	*mockWebDAVClient
+	received     int64
+	resumeOffset int64
+	resumed      bool
+	seeked       bool
+	failUpload   bool
+}
+
+func (m *resumeMockClient) ChunkedUploadOffset(ctx context.Context, path string, size int64, chunkSize int64) (int64, error) {
+	return m.received, nil
+}
+
+func (m *resumeMockClient) UploadFileChunked(ctx context.Context, path string, content io.Reader, size int64, chunkSize int64) error {
+	if m.failUpload {
+		return errors.New("connection reset")
+	}
+	return m.mockWebDAVClient.UploadFileChunked(ctx, path, content, size, chunkSize)
+}
+
+func (m *resumeMockClient) ResumeChunkedUpload(ctx context.Context, path string, content io.Reader, size int64, offset int64, chunkSize int64) error {
+	m.resumed = true
+	m.resumeOffset = offset
+
+	// Like the WebDAV client, skip what the server already has
+	if seeker, ok := content.(io.Seeker); ok {
+		m.seeked = true
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	} else if _, err := io.CopyN(io.Discard, content, offset); err != nil {
+		return err
+	}
+	return m.mockWebDAVClient.ResumeChunkedUpload(ctx, path, content, size, offset, chunkSize)
+}
+
+func newResumeUploadExecutor(t *testing.T, client webdav.Client) (*OperationExecutor, *progress.ResumeManager, string) {
+	tmpDir := t.TempDir()
+	localFile := filepath.Join(tmpDir, "big.bin")
+	require.NoError(t, os.WriteFile(localFile, bytes.Repeat([]byte("0123456789"), 20), 0644))
+
+	resumeManager, err := progress.NewResumeManager(t.TempDir())
+	require.NoError(t, err)
+
+	executor := NewOperationExecutor(client, &SyncConfig{
+		ChunkSize:          50,
+		LargeFileThreshold: 100,
+		ResumeManager:      resumeManager,
+	})
+	return executor, resumeManager, localFile
+}
+
+func TestUploadFile_ResumesInterruptedChunkedUpload(t *testing.T) {
+	client := &resumeMockClient{mockWebDAVClient: newMockWebDAVClient(), received: 100}
+	executor, resumeManager, localFile := newResumeUploadExecutor(t, client)
+
+	// An earlier run was interrupted after the upload started
+	info, err := os.Stat(localFile)
+	require.NoError(t, err)
+	checksum, err := progress.CalculateChecksum(localFile)
+	require.NoError(t, err)
+	_, err = resumeManager.StartTransfer("/remote/big.bin", "upload", info.Size(), info.ModTime())
+	require.NoError(t, err)
+	require.NoError(t, resumeManager.UpdateProgress("/remote/big.bin", 0, checksum))
+
+	_, err = uploadFile(executor, localFile, "/remote/big.bin")
+	require.NoError(t, err)
+
+	assert.True(t, client.resumed)
+	assert.Equal(t, int64(100), client.resumeOffset)
+	assert.Empty(t, resumeManager.GetActiveTransfers())
 }
 
-func (w *mockDataWriter) Write(p []byte) (n int, err error) {
-	*w.data = append(*w.data, p...)
-	return len(p), nil
+func TestUploadFile_ResumeSeeksPastBandwidthLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 300)
+	client := &resumeMockClient{mockWebDAVClient: newMockWebDAVClient(), received: 2900}
+	executor, resumeManager, localFile := newResumeUploadExecutor(t, client)
+	require.NoError(t, os.WriteFile(localFile, content, 0644))
+
+	// The limit allows the missing 100 bytes at once, but not the 2900 bytes before them
+	schedule, err := bandwidth.ParseSchedule("1K")
+	require.NoError(t, err)
+	executor.config.UploadLimiter = bandwidth.NewLimiter(schedule)
+
+	info, err := os.Stat(localFile)
+	require.NoError(t, err)
+	checksum, err := progress.CalculateChecksum(localFile)
+	require.NoError(t, err)
+	_, err = resumeManager.StartTransfer("/remote/big.bin", "upload", info.Size(), info.ModTime())
+	require.NoError(t, err)
+	require.NoError(t, resumeManager.UpdateProgress("/remote/big.bin", 0, checksum))
+
+	start := time.Now()
+	_, err = uploadFile(executor, localFile, "/remote/big.bin")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	assert.True(t, client.seeked, "the file is seeked instead of read up to the offset")
+	assert.Equal(t, content[2900:], client.files["/remote/big.bin"].content)
+}
+
+func TestUploadFile_RestartsUploadOfChangedFile(t *testing.T) {
+	client := &resumeMockClient{mockWebDAVClient: newMockWebDAVClient(), received: 100}
+	executor, resumeManager, localFile := newResumeUploadExecutor(t, client)
+
+	// Same size and modification time, but different content
+	info, err := os.Stat(localFile)
+	require.NoError(t, err)
+	_, err = resumeManager.StartTransfer("/remote/big.bin", "upload", info.Size(), info.ModTime())
+	require.NoError(t, err)
+	require.NoError(t, resumeManager.UpdateProgress("/remote/big.bin", 0, "other"))
+
+	_, err = uploadFile(executor, localFile, "/remote/big.bin")
+	require.NoError(t, err)
+
+	assert.False(t, client.resumed)
+	assert.Contains(t, client.files, "/remote/big.bin")
+	assert.Empty(t, resumeManager.GetActiveTransfers())
+}
+
+func TestUploadFile_FailedChunkedUploadKeepsResumeState(t *testing.T) {
+	client := &resumeMockClient{mockWebDAVClient: newMockWebDAVClient(), failUpload: true}
+	executor, resumeManager, localFile := newResumeUploadExecutor(t, client)
+
+	_, err := uploadFile(executor, localFile, "/remote/big.bin")
+	require.Error(t, err)
+
+	transfers := resumeManager.GetActiveTransfers()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, "upload", transfers[0].Operation)
+
+	checksum, err := progress.CalculateChecksum(localFile)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, transfers[0].Checksum)
+}
+
+// capabilitiesMockClient reports server capabilities and records the upload method used
+type capabilitiesMockClient struct {
+	*mockWebDAVClient
+	caps   *capabilities.Capabilities
+	method string
+}
+
+func (m *capabilitiesMockClient) Capabilities(ctx context.Context) (*capabilities.Capabilities, error) {
+	return m.caps, nil
+}
+
+func (m *capabilitiesMockClient) UploadFile(ctx context.Context, path string, content io.Reader, size int64) error {
+	m.method = "put"
+	return m.mockWebDAVClient.UploadFile(ctx, path, content, size)
+}
+
+func (m *capabilitiesMockClient) UploadFileWithChecksum(ctx context.Context, path string, content io.Reader, size int64, checksum string) error {
+	m.method = "checksum"
+	return m.mockWebDAVClient.UploadFile(ctx, path, content, size)
+}
+
+func (m *capabilitiesMockClient) UploadFileChunked(ctx context.Context, path string, content io.Reader, size int64, chunkSize int64) error {
+	m.method = "chunked"
+	return m.mockWebDAVClient.UploadFileChunked(ctx, path, content, size, chunkSize)
+}
+
+func TestUploadFile_AdaptsToCapabilities(t *testing.T) {
+	tests := []struct {
+		name      string
+		caps      *capabilities.Capabilities
+		threshold int64
+		checksums bool
+		expected  string
+	}{
+		{name: "chunking", caps: &capabilities.Capabilities{ChunkingV2: true}, threshold: 100, expected: "chunked"},
+		{name: "no chunking", caps: &capabilities.Capabilities{}, threshold: 100, expected: "put"},
+		{name: "small file", caps: &capabilities.Capabilities{ChunkingV2: true}, threshold: 1000, expected: "put"},
+		{name: "max chunk size", caps: &capabilities.Capabilities{ChunkingV2: true, MaxChunkSize: 100}, threshold: 1000, expected: "chunked"},
+		{name: "checksum", caps: &capabilities.Capabilities{}, threshold: 1000, checksums: true, expected: "checksum"},
+		{name: "unsupported checksum", caps: &capabilities.Capabilities{ChecksumTypes: []string{"SHA1"}}, threshold: 1000, checksums: true, expected: "put"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localFile := filepath.Join(t.TempDir(), "big.bin")
+			require.NoError(t, os.WriteFile(localFile, bytes.Repeat([]byte("0123456789"), 20), 0644))
+
+			client := &capabilitiesMockClient{mockWebDAVClient: newMockWebDAVClient(), caps: tt.caps}
+			executor := NewOperationExecutor(client, &SyncConfig{
+				ChunkSize:          50,
+				LargeFileThreshold: tt.threshold,
+				Checksums:          tt.checksums,
+				ChecksumCache:      NewChecksumCache(""),
+			})
+
+			_, err := uploadFile(executor, localFile, "/remote/big.bin")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, client.method)
+			assert.Contains(t, client.files, "/remote/big.bin")
+		})
+	}
+}
+
+func TestTransferFile_BackendsResumeWithTheirOwnClient(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 20)
+	modTime := time.Now().Truncate(time.Second)
+
+	t.Run("upload", func(t *testing.T) {
+		client := &resumeMockClient{mockWebDAVClient: newMockWebDAVClient(), received: 100}
+		target := NewWebDAVBackend(client, "/remote")
+		target.SetChunking(100, 50)
+
+		resumeManager, err := progress.NewResumeManager(t.TempDir())
+		require.NoError(t, err)
+		sum := sha256.Sum256(content)
+		_, err = resumeManager.StartTransfer("/remote/big.bin", "upload", int64(len(content)), modTime)
+		require.NoError(t, err)
+		require.NoError(t, resumeManager.UpdateProgress("/remote/big.bin", 0, hex.EncodeToString(sum[:])))
+
+		// The source is not a local directory and the target does not use the executor's client
+		source := NewMemoryBackend()
+		require.NoError(t, source.WriteFile("big.bin", content, modTime))
+		executor := NewOperationExecutor(newMockWebDAVClient(), &SyncConfig{
+			SourceBackend: source,
+			TargetBackend: target,
+			ResumeManager: resumeManager,
+		})
+
+		_, err = executor.transferFile(source, target, "big.bin", "big.bin")
+		require.NoError(t, err)
+		assert.True(t, client.resumed)
+		assert.Equal(t, int64(100), client.resumeOffset)
+		assert.Equal(t, content[100:], client.files["/remote/big.bin"].content)
+		assert.Empty(t, resumeManager.GetActiveTransfers())
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		client := &capabilitiesMockClient{mockWebDAVClient: newMockWebDAVClient(), caps: &capabilities.Capabilities{}}
+		target := NewWebDAVBackend(client, "/remote")
+		source := NewMemoryBackend()
+		require.NoError(t, source.WriteFile("a.txt", content, modTime))
+		executor := NewOperationExecutor(newMockWebDAVClient(), &SyncConfig{
+			SourceBackend: source,
+			TargetBackend: target,
+			Checksums:     true,
+		})
+
+		_, err := executor.transferFile(source, target, "a.txt", "a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "checksum", client.method)
+	})
+
+	t.Run("download", func(t *testing.T) {
+		client := &rangeMockClient{mockWebDAVClient: newMockWebDAVClient(), etags: []string{`"v1"`}}
+		client.files["/remote/big.bin"] = &mockFile{content: content, modTime: modTime}
+		source := NewWebDAVBackend(client, "/remote")
+
+		localDir := t.TempDir()
+		localFile := filepath.Join(localDir, "big.bin")
+		require.NoError(t, os.WriteFile(localFile+partialFileSuffix, content[:40], 0644))
+		resumeManager, err := progress.NewResumeManager(t.TempDir())
+		require.NoError(t, err)
+		_, err = resumeManager.StartTransferWithETag(localFile, "download", int64(len(content)), modTime, `"v1"`)
+		require.NoError(t, err)
+		require.NoError(t, resumeManager.UpdateProgress(localFile, 40, ""))
+
+		target := NewLocalBackend(localDir)
+		executor := NewOperationExecutor(newMockWebDAVClient(), &SyncConfig{
+			SourceBackend: source,
+			TargetBackend: target,
+			ResumeManager: resumeManager,
+		})
+
+		hash, err := executor.transferFile(source, target, "big.bin", "big.bin")
+		require.NoError(t, err)
+		assert.Equal(t, int64(40), client.rangeOffset)
+		sum := sha256.Sum256(content)
+		assert.Equal(t, hex.EncodeToString(sum[:]), hash)
+
+		downloaded, err := os.ReadFile(localFile)
+		require.NoError(t, err)
+		assert.Equal(t, content, downloaded)
+	})
+}
+
+func TestPlanKeepBoth_PreservesTargetVersion(t *testing.T) {
+	localDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "report.txt"), []byte("local edit"), 0644))
+
+	client := newMockWebDAVClient()
+	client.files["/remote/report.txt"] = &mockFile{content: []byte("remote edit")}
+
+	journal := NewJournal("")
+	journal.Put(&JournalEntry{Path: "report.txt", Size: 8})
+	config := &SyncConfig{
+		Source:  localDir,
+		Target:  "https://cloud.example.com/files/test?dir=/remote",
+		Journal: journal,
+	}
+	executor := NewOperationExecutor(client, config)
+
+	conflict := &Conflict{
+		Type:       ConflictContentChanged,
+		LocalPath:  "report.txt",
+		RemotePath: "report.txt",
+		LocalMeta:  &FileMetadata{Path: "report.txt", Size: 10},
+		RemoteMeta: &FileMetadata{Path: "report.txt", Size: 11},
+	}
+	conflict.Resolution = keepBothResolution(conflict, LocalToRemote, "test")
+	copyPath := conflict.Resolution.CopyPath
+
+	ops := planKeepBoth(&SyncPlan{}, conflict, LocalToRemote)
+	require.Len(t, ops, 3)
+	result, err := executor.ExecutePlan(context.Background(), &SyncPlan{Operations: ops, TotalFiles: len(ops)})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+
+	// Both versions exist on both sides
+	assert.Equal(t, []byte("local edit"), client.files["/remote/report.txt"].content)
+	assert.Equal(t, []byte("remote edit"), client.files["/remote/"+copyPath].content)
+	content, err := os.ReadFile(filepath.Join(localDir, copyPath))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("remote edit"), content)
+	content, err = os.ReadFile(filepath.Join(localDir, "report.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("local edit"), content)
+
+	entry, exists := journal.Get(copyPath)
+	require.True(t, exists)
+	assert.Equal(t, int64(11), entry.Size)
+	_, exists = journal.Get("report.txt")
+	assert.True(t, exists)
+}
+
+func TestPlanResolution(t *testing.T) {
+	file := &FileMetadata{Path: "a", Size: 5}
+	dir := &FileMetadata{Path: "a", IsDirectory: true}
+
+	tests := []struct {
+		name      string
+		action    string
+		local     *FileMetadata
+		remote    *FileMetadata
+		expected  []ChangeType
+		direction ChangeDirection
+	}{
+		{name: "local file wins", action: "local_wins", local: file, remote: file, expected: []ChangeType{ChangeUpdate}, direction: LocalToRemote},
+		{name: "remote file restored", action: "remote_wins", remote: file, expected: []ChangeType{ChangeCreate}, direction: RemoteToLocal},
+		{name: "local deletion wins", action: "local_wins", remote: file, expected: []ChangeType{ChangeDelete}, direction: LocalToRemote},
+		{name: "remote directory replaces local file", action: "remote_wins", local: file, remote: dir, expected: []ChangeType{ChangeDelete, ChangeCreate}, direction: RemoteToLocal},
+		{name: "skipped", action: "skip", local: file, remote: file},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict := &Conflict{
+				LocalPath:  "a",
+				RemotePath: "a",
+				LocalMeta:  tt.local,
+				RemoteMeta: tt.remote,
+				Resolution: ConflictResolution{Action: tt.action},
+			}
+
+			ops := planResolution(&SyncPlan{}, conflict, LocalToRemote)
+			require.Len(t, ops, len(tt.expected))
+			for i, op := range ops {
+				assert.Equal(t, tt.expected[i], op.Type)
+				assert.Equal(t, tt.direction, op.Direction)
+				assert.Equal(t, "a", op.TargetPath)
+			}
+			if len(ops) == 2 {
+				assert.Equal(t, []string{ops[0].ID}, ops[1].Dependencies)
+				assert.True(t, ops[1].IsDirectory)
+			}
+		})
+	}
 }
@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+)
+
+// remoteStateVersion is the on-disk format version of the remote state
+const remoteStateVersion = 1
+
+// remoteStateFile is the serialized form of a remote state
+type remoteStateFile struct {
+	Version int                      `json:"version"`
+	Root    string                   `json:"root"`
+	Token   string                   `json:"token"`
+	Entries map[string]*FileMetadata `json:"entries"`
+}
+
+// RemoteState is the remote tree as of a sync-collection token. Applying the changes
+// the server reports since the token brings it up to date without listing the whole
+// remote tree. Entries are unfiltered, exclusions are applied when a tree is built.
+type RemoteState struct {
+	path    string
+	root    string
+	token   string
+	entries map[string]*FileMetadata
+}
+
+// DefaultRemoteStatePath returns the remote state file path for the given journal name
+func DefaultRemoteStatePath(name string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".nextcloud-sync", "remote", name+".json"), nil
+}
+
+// NewRemoteState creates an empty remote state that saves to the given path.
+// An empty path creates a state that is never persisted.
+func NewRemoteState(path string) *RemoteState {
+	return &RemoteState{
+		path:    path,
+		entries: make(map[string]*FileMetadata),
+	}
+}
+
+// OpenRemoteState loads a remote state from disk, or creates an empty one.
+// A state in an unknown format is discarded since it can always be rebuilt.
+func OpenRemoteState(path string) (*RemoteState, error) {
+	state := NewRemoteState(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read remote state %s: %w", path, err)
+	}
+
+	var file remoteStateFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != remoteStateVersion {
+		return state, nil
+	}
+
+	state.root = file.Root
+	state.token = file.Token
+	if file.Entries != nil {
+		state.entries = file.Entries
+	}
+
+	return state, nil
+}
+
+// Token returns the sync token the state corresponds to, empty if it holds nothing
+func (s *RemoteState) Token() string {
+	return s.token
+}
+
+// Len returns the number of known remote files and directories
+func (s *RemoteState) Len() int {
+	return len(s.entries)
+}
+
+// Reset discards the state and starts over for the given remote directory
+func (s *RemoteState) Reset(root string) {
+	s.root = root
+	s.token = ""
+	s.entries = make(map[string]*FileMetadata)
+}
+
+// Apply updates the state with the result of a sync-collection report for the
+// token the state holds
+func (s *RemoteState) Apply(result *webdav.SyncCollectionResult) {
+	if s.token == "" {
+		s.entries = make(map[string]*FileMetadata)
+	}
+
+	for _, change := range result.Changes {
+		if change.File == nil {
+			s.remove(change.Path)
+			continue
+		}
+		s.entries[change.Path] = remoteFileMetadata(change.Path, change.File)
+	}
+
+	s.token = result.Token
+}
+
+// remove drops a path and everything below it
+func (s *RemoteState) remove(path string) {
+	for p := range s.entries {
+		if withinSubtree(p, path) {
+			delete(s.entries, p)
+		}
+	}
+}
+
+// Save writes the state to disk atomically
+func (s *RemoteState) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(remoteStateFile{
+		Version: remoteStateVersion,
+		Root:    s.root,
+		Token:   s.token,
+		Entries: s.entries,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize remote state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create remote state directory: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write remote state: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace remote state: %w", err)
+	}
+
+	return nil
+}
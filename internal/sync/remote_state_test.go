@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncCollectionClient answers sync-collection reports with prepared results
+type syncCollectionClient struct {
+	*MockWebDAVClient
+	results map[string]*webdav.SyncCollectionResult // Keyed by the token of the request
+	tokens  []string
+}
+
+func (m *syncCollectionClient) SyncCollection(ctx context.Context, path, token string) (*webdav.SyncCollectionResult, error) {
+	m.tokens = append(m.tokens, token)
+	result, exists := m.results[token]
+	if !exists {
+		return nil, &webdav.WebDAVError{StatusCode: 403, Message: fmt.Sprintf("invalid sync token %q", token)}
+	}
+	return result, nil
+}
+
+func remoteChange(path string, isDir bool) *webdav.SyncCollectionChange {
+	return &webdav.SyncCollectionChange{
+		Path: path,
+		File: &webdav.WebDAVFile{Name: filepath.Base(path), IsDirectory: isDir, Size: int64(len(path))},
+	}
+}
+
+func TestSyncEngine_BuildRemoteFileTreeFromSyncCollection(t *testing.T) {
+	client := &syncCollectionClient{
+		MockWebDAVClient: NewMockWebDAVClient(),
+		results: map[string]*webdav.SyncCollectionResult{
+			"": {Token: "t1", Changes: []*webdav.SyncCollectionChange{
+				remoteChange("docs", true),
+				remoteChange("docs/a.txt", false),
+				remoteChange("docs/old", true),
+				remoteChange("docs/old/b.txt", false),
+				remoteChange("docs/temp.tmp", false),
+			}},
+			"t2": {Token: "t3", Changes: []*webdav.SyncCollectionChange{
+				{Path: "docs/old"},
+				remoteChange("docs/c.txt", false),
+			}},
+		},
+	}
+	client.results["t1"] = &webdav.SyncCollectionResult{Token: "t2"}
+
+	state := NewRemoteState("")
+	engine, err := NewSyncEngine(client, &SyncConfig{
+		Source:          "/local/source",
+		Target:          "https://cloud.example.com/files/test?dir=/test",
+		ExcludePatterns: []string{"*.tmp"},
+		RemoteState:     state,
+	})
+	require.NoError(t, err)
+
+	// The first run fetches everything
+	tree, err := engine.BuildRemoteFileTree(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"docs", "docs/a.txt", "docs/old", "docs/old/b.txt"}, treePaths(tree))
+	assert.Len(t, tree.PathMap["docs"].Children, 2)
+	assert.Equal(t, 5, state.Len(), "excluded files are kept in the state")
+
+	// Later runs only apply what changed
+	_, err = engine.BuildRemoteFileTree(context.Background())
+	require.NoError(t, err)
+	tree, err = engine.BuildRemoteFileTree(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"docs", "docs/a.txt", "docs/c.txt"}, treePaths(tree))
+	assert.Equal(t, "t3", state.Token())
+	assert.Equal(t, []string{"", "t1", "t2"}, client.tokens)
+}
+
+func TestSyncEngine_BuildRemoteFileTreeFallsBackToListing(t *testing.T) {
+	client := &syncCollectionClient{MockWebDAVClient: NewMockWebDAVClient()}
+	client.AddFile("/test/a.txt", &webdav.WebDAVFile{Name: "a.txt", Size: 1})
+
+	state := NewRemoteState("")
+	state.Reset("/test")
+	state.token = "expired"
+	state.entries["stale.txt"] = &FileMetadata{Path: "stale.txt"}
+
+	engine, err := NewSyncEngine(client, &SyncConfig{
+		Source:      "/local/source",
+		Target:      "https://cloud.example.com/files/test?dir=/test",
+		RemoteState: state,
+	})
+	require.NoError(t, err)
+
+	tree, err := engine.BuildRemoteFileTree(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, treePaths(tree))
+	assert.Equal(t, "", state.Token())
+	assert.Equal(t, 0, state.Len())
+}
+
+func TestRemoteState_SaveAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remote", "profile.json")
+
+	state := NewRemoteState(path)
+	state.Reset("/test")
+	state.Apply(&webdav.SyncCollectionResult{Token: "t1", Changes: []*webdav.SyncCollectionChange{
+		remoteChange("docs", true),
+		remoteChange("docs/a.txt", false),
+	}})
+	require.NoError(t, state.Save())
+
+	loaded, err := OpenRemoteState(path)
+	require.NoError(t, err)
+	assert.Equal(t, "t1", loaded.Token())
+	assert.Equal(t, "/test", loaded.root)
+	require.Equal(t, 2, loaded.Len())
+	assert.Equal(t, int64(len("docs/a.txt")), loaded.entries["docs/a.txt"].Size)
+
+	missing, err := OpenRemoteState(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, missing.Len())
+}
+
+// treePaths returns the paths of a file tree
+func treePaths(tree *FileTree) []string {
+	paths := make([]string, 0, len(tree.PathMap))
+	for p := range tree.PathMap {
+		paths = append(paths, p)
+	}
+	return paths
+}
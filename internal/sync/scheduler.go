@@ -0,0 +1,427 @@
+package sync
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	stdsync "sync"
+	"time"
+)
+
+// ExecutePlan executes a complete sync plan. Operations run on a bounded pool of
+// workers, and an operation only starts once all of its dependencies succeeded.
+// Once ctx is cancelled no further operations start, running transfers are
+// stopped and the operations that did not run are reported as skipped.
+func (e *OperationExecutor) ExecutePlan(ctx context.Context, plan *SyncPlan) (*SyncResult, error) {
+	graph, err := newOperationGraph(plan.Operations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync plan: %w", err)
+	}
+	collector := newResultCollector(plan)
+	e = e.withContext(ctx)
+	workers := e.concurrency(len(plan.Operations))
+
+	// A single tracker shared by several workers must not see interleaved calls
+	sharedTracker := e.config.ProgressTracker
+	if sharedTracker != nil && workers > 1 && e.config.WorkerProgress == nil {
+		sharedTracker = &lockedProgressTracker{tracker: sharedTracker}
+	}
+
+	jobs := make(chan *SyncOperation)
+	done := make(chan operationOutcome)
+
+	var wg stdsync.WaitGroup
+	for i := 0; i < workers; i++ {
+		tracker := sharedTracker
+		if e.config.WorkerProgress != nil {
+			tracker = e.config.WorkerProgress(i)
+		}
+		worker := e.withProgressTracker(tracker)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for op := range jobs {
+				e.config.emitOperation(EventOperationStart, op, nil)
+				err := worker.ExecuteOperation(op)
+				if err != nil && worker.config.ProgressTracker != nil {
+					worker.config.ProgressTracker.Error(err)
+				}
+				e.config.emitOperation(EventOperationFinish, op, err)
+				collector.record(op, err)
+				done <- operationOutcome{op: op, err: err}
+			}
+		}()
+	}
+
+	// Dispatch ready operations while there are idle workers, then wait for one to finish
+	inFlight := 0
+	for {
+		for inFlight < workers && ctx.Err() == nil {
+			op := graph.next()
+			if op == nil {
+				break
+			}
+			jobs <- op
+			inFlight++
+		}
+
+		if inFlight == 0 {
+			break
+		}
+
+		outcome := <-done
+		inFlight--
+		for _, skipped := range graph.complete(outcome.op, outcome.err == nil) {
+			collector.skip(skipped, "dependencies not satisfied")
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		for _, op := range graph.cancel() {
+			collector.skip(op, "sync cancelled")
+		}
+		collector.fail(fmt.Sprintf("Sync cancelled: %v", err))
+	}
+
+	// Anything left never became ready, which only happens with circular dependencies
+	for _, op := range graph.remaining() {
+		collector.skip(op, "circular dependency")
+	}
+
+	return collector.finish(plan), nil
+}
+
+// concurrency returns the number of workers to use for the given number of operations
+func (e *OperationExecutor) concurrency(operations int) int {
+	workers := e.config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if operations > 0 && workers > operations {
+		workers = operations
+	}
+	return workers
+}
+
+// withContext returns an executor whose operations are bound to ctx
+func (e *OperationExecutor) withContext(ctx context.Context) *OperationExecutor {
+	executor := *e
+	executor.ctx = ctx
+	return &executor
+}
+
+// withProgressTracker returns an executor that reports progress to the given tracker
+func (e *OperationExecutor) withProgressTracker(tracker ProgressTracker) *OperationExecutor {
+	if tracker == nil && e.config.ProgressTracker == nil {
+		return e
+	}
+
+	config := *e.config
+	config.ProgressTracker = tracker
+
+	worker := *e
+	worker.config = &config
+	return &worker
+}
+
+// operationOutcome is reported by a worker after executing an operation
+type operationOutcome struct {
+	op  *SyncOperation
+	err error
+}
+
+// operationGraph tracks the dependency DAG of a plan and hands out operations
+// whose dependencies have all completed, highest priority first
+type operationGraph struct {
+	operations []*SyncOperation
+	index      map[*SyncOperation]int
+	byID       map[string][]*SyncOperation
+	dependents map[*SyncOperation][]*SyncOperation
+	pending    map[*SyncOperation]int
+	state      map[*SyncOperation]operationState
+	ready      operationQueue
+}
+
+// operationState is the scheduling state of an operation
+type operationState int
+
+const (
+	operationWaiting operationState = iota
+	operationQueued
+	operationRunning
+	operationFinished
+	operationSkipped
+)
+
+// newOperationGraph builds the dependency graph for a list of operations.
+// Dependencies on IDs that are not part of the plan are rejected.
+func newOperationGraph(operations []*SyncOperation) (*operationGraph, error) {
+	g := &operationGraph{
+		operations: operations,
+		index:      make(map[*SyncOperation]int, len(operations)),
+		byID:       make(map[string][]*SyncOperation),
+		dependents: make(map[*SyncOperation][]*SyncOperation),
+		pending:    make(map[*SyncOperation]int),
+		state:      make(map[*SyncOperation]operationState),
+	}
+
+	for index, op := range operations {
+		g.index[op] = index
+		g.byID[op.ID] = append(g.byID[op.ID], op)
+	}
+
+	for _, op := range operations {
+		seen := make(map[string]bool)
+		for _, depID := range op.Dependencies {
+			if seen[depID] || depID == op.ID {
+				continue
+			}
+			seen[depID] = true
+
+			deps, exists := g.byID[depID]
+			if !exists {
+				return nil, fmt.Errorf("operation %s depends on unknown operation %s", op.ID, depID)
+			}
+			for _, dep := range deps {
+				g.dependents[dep] = append(g.dependents[dep], op)
+				g.pending[op]++
+			}
+		}
+
+		if g.pending[op] == 0 {
+			g.enqueue(op)
+		}
+	}
+
+	return g, nil
+}
+
+// enqueue marks an operation as ready to run
+func (g *operationGraph) enqueue(op *SyncOperation) {
+	g.state[op] = operationQueued
+	heap.Push(&g.ready, queuedOperation{op: op, index: g.index[op]})
+}
+
+// next returns the highest priority operation that is ready to run, or nil
+func (g *operationGraph) next() *SyncOperation {
+	if g.ready.Len() == 0 {
+		return nil
+	}
+	op := heap.Pop(&g.ready).(queuedOperation).op
+	g.state[op] = operationRunning
+	return op
+}
+
+// complete marks an operation as finished. On success its dependents may become
+// ready; on failure all operations depending on it are returned as skipped.
+func (g *operationGraph) complete(op *SyncOperation, success bool) []*SyncOperation {
+	g.state[op] = operationFinished
+
+	if !success {
+		return g.skipDependents(op)
+	}
+
+	for _, dependent := range g.dependents[op] {
+		g.pending[dependent]--
+		if g.pending[dependent] == 0 && g.state[dependent] == operationWaiting {
+			g.enqueue(dependent)
+		}
+	}
+
+	return nil
+}
+
+// skipDependents marks everything that transitively depends on an operation as skipped
+func (g *operationGraph) skipDependents(op *SyncOperation) []*SyncOperation {
+	var skipped []*SyncOperation
+	stack := append([]*SyncOperation(nil), g.dependents[op]...)
+
+	for len(stack) > 0 {
+		dependent := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if g.state[dependent] != operationWaiting {
+			continue
+		}
+		g.state[dependent] = operationSkipped
+		skipped = append(skipped, dependent)
+		stack = append(stack, g.dependents[dependent]...)
+	}
+
+	return skipped
+}
+
+// cancel marks all operations that have not started as skipped and returns them
+func (g *operationGraph) cancel() []*SyncOperation {
+	var cancelled []*SyncOperation
+	for _, op := range g.operations {
+		if state := g.state[op]; state == operationWaiting || state == operationQueued {
+			g.state[op] = operationSkipped
+			cancelled = append(cancelled, op)
+		}
+	}
+	g.ready = nil
+	return cancelled
+}
+
+// remaining returns operations that were neither run nor skipped
+func (g *operationGraph) remaining() []*SyncOperation {
+	var remaining []*SyncOperation
+	for _, op := range g.operations {
+		if g.state[op] == operationWaiting {
+			remaining = append(remaining, op)
+		}
+	}
+	return remaining
+}
+
+// queuedOperation is an entry in the ready queue
+type queuedOperation struct {
+	op    *SyncOperation
+	index int
+}
+
+// operationQueue is a priority queue of ready operations. Higher priorities run
+// first, operations with equal priority keep their plan order.
+type operationQueue []queuedOperation
+
+func (q operationQueue) Len() int { return len(q) }
+
+func (q operationQueue) Less(i, j int) bool {
+	if q[i].op.Priority != q[j].op.Priority {
+		return q[i].op.Priority > q[j].op.Priority
+	}
+	return q[i].index < q[j].index
+}
+
+func (q operationQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *operationQueue) Push(x interface{}) { *q = append(*q, x.(queuedOperation)) }
+
+func (q *operationQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// resultCollector aggregates operation outcomes reported by concurrent workers
+type resultCollector struct {
+	mu     stdsync.Mutex
+	result *SyncResult
+}
+
+// newResultCollector creates a collector for the given plan
+func newResultCollector(plan *SyncPlan) *resultCollector {
+	return &resultCollector{
+		result: &SyncResult{
+			StartTime:    time.Now(),
+			CreatedFiles: make([]string, 0),
+			UpdatedFiles: make([]string, 0),
+			DeletedFiles: make([]string, 0),
+			SkippedFiles: make([]string, 0),
+			Errors:       make([]string, 0),
+			Warnings:     make([]string, 0),
+			Conflicts:    plan.Conflicts,
+		},
+	}
+}
+
+// record adds the outcome of an executed operation
+func (c *resultCollector) record(op *SyncOperation, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.result.Errors = append(c.result.Errors, fmt.Sprintf("Failed to execute %s on %s: %v", op.Type.String(), op.SourcePath, err))
+		return
+	}
+
+	c.result.ProcessedFiles++
+	c.result.TransferredSize += op.Size
+
+	switch op.Type {
+	case ChangeCreate:
+		c.result.CreatedFiles = append(c.result.CreatedFiles, op.SourcePath)
+	case ChangeUpdate:
+		c.result.UpdatedFiles = append(c.result.UpdatedFiles, op.SourcePath)
+	case ChangeDelete:
+		c.result.DeletedFiles = append(c.result.DeletedFiles, op.SourcePath)
+	case ChangeMove:
+		c.result.MovedFiles = append(c.result.MovedFiles, op.TargetPath)
+	}
+}
+
+// skip records an operation that was not executed
+func (c *resultCollector) skip(op *SyncOperation, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := op.SourcePath
+	if path == "" {
+		path = op.TargetPath
+	}
+	c.result.SkippedFiles = append(c.result.SkippedFiles, fmt.Sprintf("%s (%s)", path, reason))
+}
+
+// fail records an error that is not caused by a single operation
+func (c *resultCollector) fail(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.result.Errors = append(c.result.Errors, message)
+}
+
+// finish completes the result once all workers are done
+func (c *resultCollector) finish(plan *SyncPlan) *SyncResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.result.EndTime = time.Now()
+	c.result.Duration = c.result.EndTime.Sub(c.result.StartTime)
+	c.result.TotalFiles = plan.TotalFiles
+	c.result.TotalSize = plan.TotalSize
+	c.result.Success = len(c.result.Errors) == 0
+
+	return c.result
+}
+
+// lockedProgressTracker serializes calls to a tracker shared by several workers
+type lockedProgressTracker struct {
+	mu      stdsync.Mutex
+	tracker ProgressTracker
+}
+
+func (t *lockedProgressTracker) Start(total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tracker.Start(total)
+}
+
+func (t *lockedProgressTracker) Update(current int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tracker.Update(current)
+}
+
+func (t *lockedProgressTracker) Finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tracker.Finish()
+}
+
+func (t *lockedProgressTracker) SetOperation(operation string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tracker.SetOperation(operation)
+}
+
+func (t *lockedProgressTracker) Error(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tracker.Error(err)
+}
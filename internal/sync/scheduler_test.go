@@ -0,0 +1,355 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/bandwidth"
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrentMockClient serializes access to the mock and tracks concurrent uploads
+type concurrentMockClient struct {
+	*mockWebDAVClient
+	mu          stdsync.Mutex
+	inFlight    int
+	maxInFlight int
+	failDirs    map[string]bool
+	uploadDelay time.Duration
+}
+
+func newConcurrentMockClient() *concurrentMockClient {
+	return &concurrentMockClient{
+		mockWebDAVClient: newMockWebDAVClient(),
+		failDirs:         make(map[string]bool),
+	}
+}
+
+func (m *concurrentMockClient) GetProperties(ctx context.Context, path string) (*webdav.WebDAVProperties, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mockWebDAVClient.GetProperties(ctx, path)
+}
+
+func (m *concurrentMockClient) CreateDirectory(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failDirs[path] {
+		return errors.New("insufficient storage")
+	}
+	return m.mockWebDAVClient.CreateDirectory(ctx, path)
+}
+
+func (m *concurrentMockClient) UploadFile(ctx context.Context, path string, content io.Reader, size int64) error {
+	m.mu.Lock()
+	m.inFlight++
+	if m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+	m.mu.Unlock()
+
+	time.Sleep(m.uploadDelay)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	return m.mockWebDAVClient.UploadFile(ctx, path, content, size)
+}
+
+func (m *concurrentMockClient) hasFile(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, exists := m.files[path]
+	return exists
+}
+
+func writeTestFiles(t *testing.T, count int) (string, []string) {
+	tmpDir := t.TempDir()
+	var names []string
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644))
+		names = append(names, name)
+	}
+	return tmpDir, names
+}
+
+func TestExecutePlan_Parallel(t *testing.T) {
+	tmpDir, names := writeTestFiles(t, 8)
+
+	mockClient := newConcurrentMockClient()
+	mockClient.uploadDelay = 20 * time.Millisecond
+
+	config := &SyncConfig{
+		Source:      tmpDir,
+		Target:      "https://cloud.example.com/files/test?dir=/remote",
+		Concurrency: 4,
+	}
+	executor := NewOperationExecutor(mockClient, config)
+
+	plan := &SyncPlan{TotalFiles: len(names)}
+	for _, name := range names {
+		plan.Operations = append(plan.Operations, &SyncOperation{
+			ID:         "upload_" + name,
+			Type:       ChangeCreate,
+			Direction:  LocalToRemote,
+			SourcePath: name,
+			TargetPath: name,
+		})
+	}
+
+	result, err := executor.ExecutePlan(context.Background(), plan)
+	require.NoError(t, err)
+
+	assert.True(t, result.Success)
+	assert.Equal(t, len(names), result.ProcessedFiles)
+	assert.Len(t, result.CreatedFiles, len(names))
+	for _, name := range names {
+		assert.True(t, mockClient.hasFile("/remote/"+name), name)
+	}
+	assert.Greater(t, mockClient.maxInFlight, 1)
+	assert.LessOrEqual(t, mockClient.maxInFlight, 4)
+}
+
+func TestExecutePlan_SkipsDependentsOfFailedOperation(t *testing.T) {
+	tmpDir, _ := writeTestFiles(t, 1)
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "dir", "nested.txt"), []byte("nested"), 0644))
+
+	mockClient := newConcurrentMockClient()
+	mockClient.failDirs["/remote/dir"] = true
+
+	config := &SyncConfig{
+		Source:      tmpDir,
+		Target:      "https://cloud.example.com/files/test?dir=/remote",
+		Concurrency: 2,
+	}
+	executor := NewOperationExecutor(mockClient, config)
+
+	plan := &SyncPlan{
+		Operations: []*SyncOperation{
+			{ID: "mkdir", Type: ChangeCreate, Direction: LocalToRemote, TargetPath: "dir", IsDirectory: true, Priority: 100},
+			{ID: "nested", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "dir/nested.txt", TargetPath: "dir/nested.txt", Dependencies: []string{"mkdir"}},
+			{ID: "independent", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "file0.txt", TargetPath: "file0.txt"},
+		},
+	}
+
+	result, err := executor.ExecutePlan(context.Background(), plan)
+	require.NoError(t, err)
+
+	assert.False(t, result.Success)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, []string{"dir/nested.txt (dependencies not satisfied)"}, result.SkippedFiles)
+	assert.True(t, mockClient.hasFile("/remote/file0.txt"))
+	assert.False(t, mockClient.hasFile("/remote/dir/nested.txt"))
+}
+
+func TestExecutePlan_CircularDependencies(t *testing.T) {
+	executor := NewOperationExecutor(newMockWebDAVClient(), &SyncConfig{})
+
+	plan := &SyncPlan{
+		Operations: []*SyncOperation{
+			{ID: "a", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "a", Dependencies: []string{"b"}},
+			{ID: "b", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "b", Dependencies: []string{"a"}},
+		},
+	}
+
+	result, err := executor.ExecutePlan(context.Background(), plan)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, result.ProcessedFiles)
+	assert.ElementsMatch(t, []string{"a (circular dependency)", "b (circular dependency)"}, result.SkippedFiles)
+}
+
+func TestExecutePlan_UnknownDependency(t *testing.T) {
+	mockClient := newConcurrentMockClient()
+	executor := NewOperationExecutor(mockClient, &SyncConfig{})
+
+	plan := &SyncPlan{
+		Operations: []*SyncOperation{
+			{ID: "a", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "a", TargetPath: "dir/a", Dependencies: []string{"mkdir_dir"}},
+		},
+	}
+
+	_, err := executor.ExecutePlan(context.Background(), plan)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown operation mkdir_dir")
+	assert.False(t, mockClient.hasFile("/dir/a"))
+}
+
+func TestOperationGraph_PriorityAndDependencies(t *testing.T) {
+	low := &SyncOperation{ID: "low", Priority: 1}
+	high := &SyncOperation{ID: "high", Priority: 10}
+	child := &SyncOperation{ID: "child", Priority: 50, Dependencies: []string{"low"}}
+
+	graph, err := newOperationGraph([]*SyncOperation{low, child, high})
+	require.NoError(t, err)
+
+	// The child waits for its dependency even though it has the highest priority
+	assert.Equal(t, high, graph.next())
+	assert.Equal(t, low, graph.next())
+	assert.Nil(t, graph.next())
+
+	assert.Empty(t, graph.complete(high, true))
+	assert.Nil(t, graph.next())
+
+	assert.Empty(t, graph.complete(low, true))
+	assert.Equal(t, child, graph.next())
+	assert.Empty(t, graph.remaining())
+}
+
+func TestExecutePlan_WorkerProgress(t *testing.T) {
+	tmpDir, names := writeTestFiles(t, 4)
+
+	var mu stdsync.Mutex
+	trackers := make(map[int]*mockProgressTracker)
+
+	config := &SyncConfig{
+		Source:      tmpDir,
+		Target:      "https://cloud.example.com/files/test?dir=/remote",
+		Concurrency: 2,
+		WorkerProgress: func(worker int) ProgressTracker {
+			mu.Lock()
+			defer mu.Unlock()
+			trackers[worker] = &mockProgressTracker{}
+			return trackers[worker]
+		},
+	}
+	executor := NewOperationExecutor(newConcurrentMockClient(), config)
+
+	plan := &SyncPlan{}
+	for _, name := range names {
+		plan.Operations = append(plan.Operations, &SyncOperation{
+			ID:         name,
+			Type:       ChangeCreate,
+			Direction:  LocalToRemote,
+			SourcePath: name,
+			TargetPath: name,
+		})
+	}
+
+	result, err := executor.ExecutePlan(context.Background(), plan)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	assert.Len(t, trackers, 2)
+	total := 0
+	for _, tracker := range trackers {
+		total += len(tracker.operations)
+	}
+	assert.Equal(t, len(names), total)
+}
+
+func TestExecutePlan_Events(t *testing.T) {
+	tmpDir, _ := writeTestFiles(t, 1)
+
+	mockClient := newConcurrentMockClient()
+	mockClient.failDirs["/remote/dir"] = true
+
+	var mu stdsync.Mutex
+	events := make(map[string][]EventType)
+	config := &SyncConfig{
+		Source:      tmpDir,
+		Target:      "https://cloud.example.com/files/test?dir=/remote",
+		Concurrency: 2,
+		Events: func(event SyncEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.False(t, event.Time.IsZero())
+			events[event.Operation.ID] = append(events[event.Operation.ID], event.Type)
+		},
+	}
+	executor := NewOperationExecutor(mockClient, config)
+
+	plan := &SyncPlan{
+		Operations: []*SyncOperation{
+			{ID: "mkdir", Type: ChangeCreate, Direction: LocalToRemote, TargetPath: "dir", IsDirectory: true},
+			{ID: "upload", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "file0.txt", TargetPath: "file0.txt"},
+		},
+	}
+
+	_, err := executor.ExecutePlan(context.Background(), plan)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]EventType{
+		"mkdir":  {EventOperationStart, EventOperationError},
+		"upload": {EventOperationStart, EventOperationFinish},
+	}, events)
+}
+
+func TestExecutePlan_StopsDispatchingWhenCancelled(t *testing.T) {
+	tmpDir, names := writeTestFiles(t, 4)
+	mockClient := newConcurrentMockClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := &SyncConfig{
+		Source:      tmpDir,
+		Target:      "https://cloud.example.com/files/test?dir=/remote",
+		Concurrency: 1,
+		Events: func(event SyncEvent) {
+			if event.Type == EventOperationStart {
+				cancel()
+			}
+		},
+	}
+	executor := NewOperationExecutor(mockClient, config)
+
+	plan := &SyncPlan{TotalFiles: len(names)}
+	for _, name := range names {
+		plan.Operations = append(plan.Operations, &SyncOperation{
+			ID:         "upload_" + name,
+			Type:       ChangeCreate,
+			Direction:  LocalToRemote,
+			SourcePath: name,
+			TargetPath: name,
+		})
+	}
+
+	result, err := executor.ExecutePlan(ctx, plan)
+	require.NoError(t, err)
+
+	// Only the operation that was running when the sync was cancelled was executed
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Errors, "Sync cancelled: context canceled")
+	assert.Len(t, result.SkippedFiles, len(names)-1)
+	for _, skipped := range result.SkippedFiles {
+		assert.Contains(t, skipped, "(sync cancelled)")
+	}
+	assert.False(t, mockClient.hasFile("/remote/"+names[len(names)-1]))
+}
+
+func TestExecutePlan_CancelStopsThrottledTransfer(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "big.bin"), make([]byte, 100*1024), 0644))
+
+	schedule, err := bandwidth.ParseSchedule("1K")
+	require.NoError(t, err)
+	config := &SyncConfig{
+		Source:        tmpDir,
+		Target:        "https://cloud.example.com/files/test?dir=/remote",
+		UploadLimiter: bandwidth.NewLimiter(schedule),
+	}
+	executor := NewOperationExecutor(newConcurrentMockClient(), config)
+
+	// At 1K/s the upload takes more than a minute, the cancellation ends it right away
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := executor.ExecutePlan(ctx, &SyncPlan{
+		Operations: []*SyncOperation{{ID: "upload", Type: ChangeCreate, Direction: LocalToRemote, SourcePath: "big.bin", TargetPath: "big.bin", Size: 100 * 1024}},
+		TotalFiles: 1,
+	})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.False(t, result.Success)
+}
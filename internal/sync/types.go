@@ -2,6 +2,9 @@ package sync
 
 import (
 	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/bandwidth"
+	"github.com/phaus/nextcloud-sync/internal/progress"
 )
 
 // FileMetadata represents the metadata for a file or directory
@@ -14,6 +17,8 @@ type FileMetadata struct {
 	IsDirectory bool      `json:"is_directory"`
 	Permissions string    `json:"permissions,omitempty"`
 	ContentType string    `json:"content_type,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"` // SHA-256 of the content, if known
+	FileID      string    `json:"file_id,omitempty"`  // Identity that survives renames: the inode locally, oc:fileid remotely
 }
 
 // ChangeType represents the type of change detected
@@ -43,6 +48,7 @@ type Change struct {
 	Direction  ChangeDirection `json:"direction"`
 	LocalPath  string          `json:"local_path,omitempty"`
 	RemotePath string          `json:"remote_path,omitempty"`
+	OldPath    string          `json:"old_path,omitempty"` // Previous path of a moved file, LocalPath and RemotePath hold the new one
 	LocalMeta  *FileMetadata   `json:"local_meta,omitempty"`
 	RemoteMeta *FileMetadata   `json:"remote_meta,omitempty"`
 	Reason     string          `json:"reason"`
@@ -75,8 +81,9 @@ type Conflict struct {
 
 // ConflictResolution represents how a conflict was resolved
 type ConflictResolution struct {
-	Action    string    `json:"action"` // "local_wins", "remote_wins", "skip", "manual"
-	Path      string    `json:"path"`   // Final path that was kept
+	Action    string    `json:"action"`              // "local_wins", "remote_wins", "keep_both", "skip", "manual"
+	Path      string    `json:"path"`                // Final path that was kept
+	CopyPath  string    `json:"copy_path,omitempty"` // Where the other version is preserved with keep_both
 	Timestamp time.Time `json:"timestamp"`
 	Reason    string    `json:"reason"`
 }
@@ -92,19 +99,33 @@ const (
 
 // SyncConfig represents the configuration for a sync operation
 type SyncConfig struct {
-	Source             string          `json:"source"`
-	Target             string          `json:"target"`
-	Direction          SyncDirection   `json:"direction"`
-	Bidirectional      bool            `json:"bidirectional"` // Convenience field for bidirectional sync
-	DryRun             bool            `json:"dry_run"`
-	Force              bool            `json:"force"`
-	ExcludePatterns    []string        `json:"exclude_patterns,omitempty"`
-	MaxRetries         int             `json:"max_retries"`
-	Timeout            time.Duration   `json:"timeout"`
-	ChunkSize          int64           `json:"chunk_size"`
-	LargeFileThreshold int64           `json:"large_file_threshold"` // Files larger than this will use chunked upload
-	ConflictPolicy     string          `json:"conflict_policy"`      // "source_wins", "target_wins", "skip"
-	ProgressTracker    ProgressTracker `json:"-"`
+	Source             string                  `json:"source"`
+	Target             string                  `json:"target"`
+	Direction          SyncDirection           `json:"direction"`
+	Bidirectional      bool                    `json:"bidirectional"` // Convenience field for bidirectional sync
+	DryRun             bool                    `json:"dry_run"`
+	Force              bool                    `json:"force"`
+	ExcludePatterns    []string                `json:"exclude_patterns,omitempty"`
+	MaxRetries         int                     `json:"max_retries"`
+	Timeout            time.Duration           `json:"timeout"`
+	ChunkSize          int64                   `json:"chunk_size"`
+	LargeFileThreshold int64                   `json:"large_file_threshold"` // Files larger than this will use chunked upload
+	ConflictPolicy     string                  `json:"conflict_policy"`      // "source_wins", "target_wins", "skip", "keep_both", "interactive"
+	Concurrency        int                     `json:"concurrency"`          // Number of parallel operation workers, 1 if unset
+	ProgressTracker    ProgressTracker         `json:"-"`
+	WorkerProgress     WorkerProgressFunc      `json:"-"`         // Optional per-worker trackers for parallel execution
+	Journal            *Journal                `json:"-"`         // Last synced state, enables deletion propagation
+	Checksums          bool                    `json:"checksums"` // Compare file contents by SHA-256 checksum
+	Delete             bool                    `json:"delete"`    // One-way sync deletes paths that only exist on the target instead of copying them back
+	ChecksumCache      *ChecksumCache          `json:"-"`         // Cached local checksums, used in checksum mode
+	RemoteState        *RemoteState            `json:"-"`         // Remote tree as of the last sync token, avoids listing the whole remote tree
+	ResumeManager      *progress.ResumeManager `json:"-"`         // Records transfer progress so interrupted transfers can continue
+	Events             EventHandler            `json:"-"`         // Receives operation and conflict events while syncing
+	ConflictPrompt     ConflictPromptFunc      `json:"-"`         // Asks the user about conflicts with the interactive policy
+	SourceBackend      Backend                 `json:"-"`         // Source storage, set with TargetBackend to sync two local directories or two servers
+	TargetBackend      Backend                 `json:"-"`         // Target storage, set with SourceBackend
+	UploadLimiter      *bandwidth.Limiter      `json:"-"`         // Limits the combined upload rate of all transfers
+	DownloadLimiter    *bandwidth.Limiter      `json:"-"`         // Limits the combined download rate of all transfers
 }
 
 // ProgressTracker interface for tracking sync progress
@@ -116,6 +137,9 @@ type ProgressTracker interface {
 	Error(err error)
 }
 
+// WorkerProgressFunc returns the progress tracker for a parallel worker
+type WorkerProgressFunc func(worker int) ProgressTracker
+
 // SyncOperation represents a single sync operation to be performed
 type SyncOperation struct {
 	ID           string          `json:"id"`
@@ -124,6 +148,7 @@ type SyncOperation struct {
 	SourcePath   string          `json:"source_path"`
 	TargetPath   string          `json:"target_path"`
 	Size         int64           `json:"size"`
+	IsDirectory  bool            `json:"is_directory,omitempty"`
 	Priority     int             `json:"priority"`
 	Dependencies []string        `json:"dependencies,omitempty"` // IDs of operations that must complete first
 }
@@ -137,6 +162,8 @@ type SyncPlan struct {
 	CreatedAt     time.Time        `json:"created_at"`
 	Conflicts     []*Conflict      `json:"conflicts,omitempty"`
 	Warnings      []string         `json:"warnings,omitempty"`
+
+	issuedIDs int // Number of operation IDs handed out for the plan
 }
 
 // SyncResult represents the result of a sync operation
@@ -155,9 +182,11 @@ type SyncResult struct {
 	CreatedFiles    []string      `json:"created_files,omitempty"`
 	UpdatedFiles    []string      `json:"updated_files,omitempty"`
 	DeletedFiles    []string      `json:"deleted_files,omitempty"`
+	MovedFiles      []string      `json:"moved_files,omitempty"`
 	StartTime       time.Time     `json:"start_time"`
 	EndTime         time.Time     `json:"end_time"`
-	Bidirectional   bool          `json:"bidirectional"` // Indicates if this was a bidirectional sync
+	Bidirectional   bool          `json:"bidirectional"`  // Indicates if this was a bidirectional sync
+	Plan            *SyncPlan     `json:"plan,omitempty"` // The plan that was executed, or would be in a dry run
 }
 
 // FileTree represents a tree structure for file metadata
@@ -176,10 +205,13 @@ type FileNode struct {
 
 // ComparisonOptions controls how files are compared
 type ComparisonOptions struct {
-	IgnoreModTimeDiff time.Duration `json:"ignore_mod_time_diff"`
-	CompareETags      bool          `json:"compare_etags"`
-	CompareSize       bool          `json:"compare_size"`
-	IgnoreEmptyFiles  bool          `json:"ignore_empty_files"`
+	IgnoreModTimeDiff time.Duration   `json:"ignore_mod_time_diff"`
+	CompareETags      bool            `json:"compare_etags"`
+	CompareSize       bool            `json:"compare_size"`
+	IgnoreEmptyFiles  bool            `json:"ignore_empty_files"`
+	CompareChecksums  bool            `json:"compare_checksums"`            // Checksums decide equality when both sides have one
+	SourceDirection   ChangeDirection `json:"source_direction,omitempty"`   // Direction of a one-way sync
+	DeleteTargetOnly  bool            `json:"delete_target_only,omitempty"` // One-way sync deletes paths that only exist on the target, which lets them be matched as moves
 }
 
 // DefaultComparisonOptions returns sensible defaults for file comparison
@@ -210,6 +242,11 @@ func (fm *FileMetadata) IsEqual(other *FileMetadata, opts *ComparisonOptions) bo
 		return false
 	}
 
+	// Equal content is equal regardless of modification times
+	if opts.CompareChecksums && fm.Checksum != "" && other.Checksum != "" {
+		return fm.Checksum == other.Checksum
+	}
+
 	// Check size difference
 	if opts.CompareSize && fm.Size != other.Size {
 		return false
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays maps the day prefixes of timetable entries to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// BandwidthSlot is an entry of a bandwidth timetable, its rate applies from its
+// start until the next entry
+type BandwidthSlot struct {
+	Start time.Duration // Offset into the week, starting on Sunday at midnight
+	Rate  int64         // Bytes per second, 0 for unlimited
+}
+
+// ParseBandwidthLimit parses a bandwidth limit into timetable entries sorted by
+// their start, none for an empty limit. A limit is either a single rate such as
+// "1M", or a timetable of space-separated "HH:MM,RATE" entries, each applying
+// from its time until the next entry, e.g. "08:00,1M 18:00,off" for 1 MiB/s
+// during office hours and full speed at night. Entries may be restricted to a
+// day with a prefix such as "Mon-08:00,1M"; a timetable then applies weekly and
+// all entries need a day. Rates are parsed by ParseRate.
+func ParseBandwidthLimit(text string) ([]BandwidthSlot, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 1 && !strings.Contains(fields[0], ",") {
+		rate, err := ParseRate(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		return []BandwidthSlot{{Start: 0, Rate: rate}}, nil
+	}
+
+	var slots []BandwidthSlot
+	weekly := false
+	for i, field := range fields {
+		timeSpec, rateSpec, found := strings.Cut(field, ",")
+		if !found {
+			return nil, fmt.Errorf("invalid timetable entry %q: expected HH:MM,RATE", field)
+		}
+
+		rate, err := ParseRate(rateSpec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timetable entry %q: %w", field, err)
+		}
+
+		day, clock, hasDay := strings.Cut(timeSpec, "-")
+		if !hasDay {
+			clock = day
+		}
+		if i == 0 {
+			weekly = hasDay
+		} else if hasDay != weekly {
+			return nil, fmt.Errorf("invalid timetable entry %q: either all or no entries need a day", field)
+		}
+
+		offset, err := parseClock(clock)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timetable entry %q: %w", field, err)
+		}
+
+		if !weekly {
+			// A daily entry applies on every day of the week
+			for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+				slots = append(slots, BandwidthSlot{Start: time.Duration(weekday)*24*time.Hour + offset, Rate: rate})
+			}
+			continue
+		}
+
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("invalid timetable entry %q: unknown day %q", field, day)
+		}
+		slots = append(slots, BandwidthSlot{Start: time.Duration(weekday)*24*time.Hour + offset, Rate: rate})
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Start < slots[j].Start })
+	for i := 1; i < len(slots); i++ {
+		if slots[i].Start == slots[i-1].Start {
+			return nil, fmt.Errorf("timetable %q has two entries for the same time", text)
+		}
+	}
+
+	return slots, nil
+}
+
+// parseClock parses an "HH:MM" time of day into an offset from midnight
+func parseClock(clock string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", clock)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// ParseRate parses a rate in bytes per second such as "512K", "1.5M" or "off".
+// Suffixes are multiples of 1024 and may be followed by "B" or "iB"; "off" and 0
+// mean unlimited.
+func ParseRate(text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, "off") {
+		return 0, nil
+	}
+
+	number := strings.TrimSuffix(strings.TrimSuffix(text, "iB"), "B")
+	multiplier := int64(1)
+	if number != "" {
+		switch number[len(number)-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			number = number[:len(number)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || !(value >= 0) || math.IsInf(value, 1) {
+		return 0, fmt.Errorf("invalid rate %q: use bytes per second with an optional K, M or G suffix, or off", text)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
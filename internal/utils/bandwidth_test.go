@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int64
+	}{
+		{"off", 0},
+		{"OFF", 0},
+		{"0", 0},
+		{"1000", 1000},
+		{"512K", 512 * 1024},
+		{"512k", 512 * 1024},
+		{"1M", 1024 * 1024},
+		{"1.5M", 1536 * 1024},
+		{"1MB", 1024 * 1024},
+		{"1MiB", 1024 * 1024},
+		{"2G", 2 * 1024 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			rate, err := ParseRate(tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rate)
+		})
+	}
+
+	for _, text := range []string{"", "fast", "-1M", "1X", "M", "NaN", "Inf"} {
+		t.Run("invalid "+text, func(t *testing.T) {
+			_, err := ParseRate(text)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseBandwidthLimit(t *testing.T) {
+	slots, err := ParseBandwidthLimit("  ")
+	require.NoError(t, err)
+	assert.Empty(t, slots)
+
+	slots, err = ParseBandwidthLimit("1M")
+	require.NoError(t, err)
+	assert.Equal(t, []BandwidthSlot{{Start: 0, Rate: 1 << 20}}, slots)
+
+	// Daily entries apply on every day of the week
+	slots, err = ParseBandwidthLimit("18:00,off 08:00,1M")
+	require.NoError(t, err)
+	require.Len(t, slots, 14)
+	assert.Equal(t, BandwidthSlot{Start: 8 * time.Hour, Rate: 1 << 20}, slots[0])
+	assert.Equal(t, BandwidthSlot{Start: 18 * time.Hour, Rate: 0}, slots[1])
+
+	// Weekly entries are sorted from Sunday on
+	slots, err = ParseBandwidthLimit("Mon-08:00,1M Sun-20:00,512K")
+	require.NoError(t, err)
+	assert.Equal(t, []BandwidthSlot{
+		{Start: 20 * time.Hour, Rate: 512 << 10},
+		{Start: 24*time.Hour + 8*time.Hour, Rate: 1 << 20},
+	}, slots)
+
+	for _, text := range []string{"fast", "08:00", "Mon-08:00,1M 18:00,off", "08:00,1M 08:00,2M"} {
+		_, err := ParseBandwidthLimit(text)
+		assert.Error(t, err, text)
+	}
+}
@@ -0,0 +1,141 @@
+package watch
+
+import (
+	"context"
+	"time"
+)
+
+// Debounce groups events into batches. A batch is emitted once no event arrived for
+// the quiet period, or at the latest maxDelay after its first event, so that a steady
+// stream of writes cannot postpone syncing forever. The returned channel is closed
+// when the input channel is closed or the context is cancelled.
+func Debounce(ctx context.Context, in <-chan Event, quiet, maxDelay time.Duration) <-chan []Event {
+	out := make(chan []Event)
+
+	go func() {
+		defer close(out)
+
+		var pending []Event
+		var quietTimer, maxTimer *time.Timer
+		var quietC, maxC <-chan time.Time
+
+		stopTimers := func() {
+			if quietTimer != nil {
+				quietTimer.Stop()
+			}
+			if maxTimer != nil {
+				maxTimer.Stop()
+			}
+			quietC, maxC = nil, nil
+		}
+		defer stopTimers()
+
+		flush := func() bool {
+			stopTimers()
+			batch := Coalesce(pending)
+			pending = nil
+			if len(batch) == 0 {
+				return true
+			}
+
+			select {
+			case out <- batch:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+
+				pending = append(pending, event)
+
+				if quietTimer == nil {
+					quietTimer = time.NewTimer(quiet)
+				} else {
+					quietTimer.Stop()
+					quietTimer.Reset(quiet)
+				}
+				quietC = quietTimer.C
+
+				if maxC == nil {
+					if maxTimer == nil {
+						maxTimer = time.NewTimer(maxDelay)
+					} else {
+						maxTimer.Reset(maxDelay)
+					}
+					maxC = maxTimer.C
+				}
+			case <-quietC:
+				if !flush() {
+					return
+				}
+			case <-maxC:
+				if !flush() {
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// Coalesce merges the two halves of a move into a single rename and drops repeated
+// events for the same path. A move whose other half was not seen becomes a remove
+// when it left the tree, or a create when it entered it.
+func Coalesce(events []Event) []Event {
+	movedTo := make(map[uint32]int)
+	for i, event := range events {
+		if event.Op == OpMovedTo && event.Cookie != 0 {
+			movedTo[event.Cookie] = i
+		}
+	}
+
+	paired := make(map[int]bool)
+	var result []Event
+	seen := make(map[Event]bool)
+
+	add := func(event Event) {
+		event.Cookie = 0
+		if !seen[event] {
+			seen[event] = true
+			result = append(result, event)
+		}
+	}
+
+	for i, event := range events {
+		switch event.Op {
+		case OpMovedFrom:
+			if j, ok := movedTo[event.Cookie]; ok && event.Cookie != 0 && !paired[j] {
+				paired[j] = true
+				add(Event{Path: events[j].Path, OldPath: event.Path, Op: OpRename, IsDir: event.IsDir})
+				continue
+			}
+			add(Event{Path: event.Path, Op: OpRemove, IsDir: event.IsDir})
+		case OpMovedTo:
+			if paired[i] {
+				continue
+			}
+			add(Event{Path: event.Path, Op: OpCreate, IsDir: event.IsDir})
+		case OpWrite:
+			// A write to something created in the same batch adds nothing
+			if seen[Event{Path: event.Path, Op: OpCreate, IsDir: event.IsDir}] {
+				continue
+			}
+			add(event)
+		default:
+			add(event)
+		}
+	}
+
+	return result
+}
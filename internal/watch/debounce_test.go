@@ -0,0 +1,99 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesce_PairsMoves(t *testing.T) {
+	events := []Event{
+		{Path: "old.txt", Op: OpMovedFrom, Cookie: 7},
+		{Path: "new.txt", Op: OpMovedTo, Cookie: 7},
+		{Path: "gone.txt", Op: OpMovedFrom, Cookie: 8},
+		{Path: "arrived.txt", Op: OpMovedTo, Cookie: 9},
+	}
+
+	assert.Equal(t, []Event{
+		{Path: "new.txt", OldPath: "old.txt", Op: OpRename},
+		{Path: "gone.txt", Op: OpRemove},
+		{Path: "arrived.txt", Op: OpCreate},
+	}, Coalesce(events))
+}
+
+func TestCoalesce_DropsDuplicates(t *testing.T) {
+	events := []Event{
+		{Path: "a.txt", Op: OpCreate},
+		{Path: "a.txt", Op: OpWrite},
+		{Path: "b.txt", Op: OpWrite},
+		{Path: "b.txt", Op: OpWrite},
+		{Path: "b.txt", Op: OpRemove},
+	}
+
+	assert.Equal(t, []Event{
+		{Path: "a.txt", Op: OpCreate},
+		{Path: "b.txt", Op: OpWrite},
+		{Path: "b.txt", Op: OpRemove},
+	}, Coalesce(events))
+}
+
+func TestAffectedPaths(t *testing.T) {
+	events := []Event{
+		{Path: "docs/b.txt", Op: OpWrite},
+		{Path: "docs/new", OldPath: "old", Op: OpRename, IsDir: true},
+		{Path: "docs/b.txt", Op: OpRemove},
+	}
+
+	assert.Equal(t, []string{"docs/b.txt", "docs/new", "old"}, AffectedPaths(events))
+	assert.Equal(t, []string{"", "a"}, AffectedPaths([]Event{{Path: "a", Op: OpWrite}, {Op: OpOverflow}}))
+}
+
+func TestDebounce_WaitsForQuietPeriod(t *testing.T) {
+	in := make(chan Event)
+	batches := Debounce(context.Background(), in, 50*time.Millisecond, time.Second)
+
+	in <- Event{Path: "a.txt", Op: OpWrite}
+	in <- Event{Path: "a.txt", Op: OpWrite}
+	in <- Event{Path: "b.txt", Op: OpCreate}
+
+	select {
+	case batch := <-batches:
+		assert.Equal(t, []Event{{Path: "a.txt", Op: OpWrite}, {Path: "b.txt", Op: OpCreate}}, batch)
+	case <-time.After(time.Second):
+		t.Fatal("no batch emitted")
+	}
+
+	close(in)
+	_, ok := <-batches
+	assert.False(t, ok)
+}
+
+func TestDebounce_MaxDelay(t *testing.T) {
+	in := make(chan Event)
+	batches := Debounce(context.Background(), in, 100*time.Millisecond, 150*time.Millisecond)
+	defer close(in)
+
+	// Events keep arriving faster than the quiet period
+	stop := time.After(400 * time.Millisecond)
+	var received [][]Event
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			in <- Event{Path: "busy.log", Op: OpWrite}
+		case batch := <-batches:
+			received = append(received, batch)
+		case <-stop:
+			break loop
+		}
+	}
+
+	require.NotEmpty(t, received)
+	assert.Equal(t, []Event{{Path: "busy.log", Op: OpWrite}}, received[0])
+}
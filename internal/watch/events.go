@@ -0,0 +1,100 @@
+package watch
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrUnsupported is returned when file system events are not available on the platform
+var ErrUnsupported = errors.New("file system events are not supported on this platform")
+
+// Op describes the kind of change reported by a file system event
+type Op int
+
+const (
+	OpCreate Op = iota + 1
+	OpWrite
+	OpRemove
+	OpRename
+	OpMovedFrom
+	OpMovedTo
+	OpOverflow
+)
+
+// String returns a string representation of the operation
+func (o Op) String() string {
+	switch o {
+	case OpCreate:
+		return "create"
+	case OpWrite:
+		return "write"
+	case OpRemove:
+		return "remove"
+	case OpRename:
+		return "rename"
+	case OpMovedFrom:
+		return "moved_from"
+	case OpMovedTo:
+		return "moved_to"
+	case OpOverflow:
+		return "overflow"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change below the watched root. Paths are relative to the root and use
+// forward slashes; the root itself is the empty path.
+type Event struct {
+	Path    string
+	OldPath string // Previous path of a rename
+	Op      Op
+	IsDir   bool
+	Cookie  uint32 // Pairs the two halves of a move
+}
+
+// Filter reports whether a root-relative path should be ignored
+type Filter func(path string, isDir bool) bool
+
+// FileWatcher delivers file system events for a directory tree
+type FileWatcher interface {
+	// Events returns the channel events are delivered on. It is closed by Close.
+	Events() <-chan Event
+
+	// Errors returns the channel watch errors are delivered on
+	Errors() <-chan error
+
+	// Close stops watching and releases all resources
+	Close() error
+}
+
+// AffectedPaths returns the sorted, distinct paths touched by a batch of events.
+// Renames contribute both their old and new path; an overflow affects the root.
+func AffectedPaths(events []Event) []string {
+	seen := make(map[string]bool)
+	var paths []string
+
+	add := func(p string) {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, event := range events {
+		if event.Op == OpOverflow {
+			add("")
+			continue
+		}
+		add(event.Path)
+		if event.OldPath != "" {
+			add(event.OldPath)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,272 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	stdsync "sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events watched on every directory
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// inotifyWatcher watches a directory tree with one inotify watch per directory
+type inotifyWatcher struct {
+	root   string
+	filter Filter
+	fd     int
+	file   *os.File
+
+	mu      stdsync.Mutex
+	watches map[int]string // Watch descriptor to root-relative directory
+	paths   map[string]int
+
+	events    chan Event
+	errors    chan error
+	done      chan struct{}
+	closeOnce stdsync.Once
+}
+
+// NewFileWatcher starts watching root and all directories below it. Directories
+// matched by the filter are not watched.
+func NewFileWatcher(root string, filter Filter) (FileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+
+	w := &inotifyWatcher{
+		root:    root,
+		filter:  filter,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int]string),
+		paths:   make(map[string]int),
+		events:  make(chan Event, 256),
+		errors:  make(chan error, 16),
+		done:    make(chan struct{}),
+	}
+
+	if err := w.addTree(""); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go w.readEvents()
+
+	return w, nil
+}
+
+// Events returns the channel events are delivered on
+func (w *inotifyWatcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors returns the channel watch errors are delivered on
+func (w *inotifyWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close stops watching and releases the inotify instance
+func (w *inotifyWatcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.file.Close()
+	})
+	return err
+}
+
+// addTree adds watches for a directory and everything below it
+func (w *inotifyWatcher) addTree(dir string) error {
+	start := filepath.Join(w.root, filepath.FromSlash(dir))
+
+	return filepath.Walk(start, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Directories may disappear while they are being walked
+			if os.IsNotExist(err) && fullPath != w.root {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(w.root, fullPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			relPath = ""
+		}
+
+		if relPath != "" && w.filter != nil && w.filter(relPath, true) {
+			return filepath.SkipDir
+		}
+
+		if err := w.addWatch(relPath, fullPath); err != nil {
+			if errors.Is(err, syscall.ENOENT) && relPath != "" {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// addWatch watches a single directory
+func (w *inotifyWatcher) addWatch(relPath, fullPath string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, fullPath, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", fullPath, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// A moved directory keeps its watch descriptor under the new path
+	if oldPath, exists := w.watches[wd]; exists {
+		delete(w.paths, oldPath)
+	}
+	w.watches[wd] = relPath
+	w.paths[relPath] = wd
+
+	return nil
+}
+
+// removeTree removes the watches for a directory and everything below it
+func (w *inotifyWatcher) removeTree(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for relPath, wd := range w.paths {
+		if relPath == dir || strings.HasPrefix(relPath, dir+"/") {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.paths, relPath)
+			delete(w.watches, wd)
+		}
+	}
+}
+
+// readEvents decodes raw inotify events until the watcher is closed
+func (w *inotifyWatcher) readEvents() {
+	defer close(w.events)
+
+	buf := make([]byte, 256*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendError(fmt.Errorf("failed to read inotify events: %w", err))
+			}
+			return
+		}
+
+		offset := 0
+		for offset+syscall.SizeofInotifyEvent <= n {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			if nameEnd > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			offset = nameEnd
+
+			if !w.handleEvent(int(raw.Wd), raw.Mask, raw.Cookie, name) {
+				return
+			}
+		}
+	}
+}
+
+// handleEvent translates a raw event and delivers it. It returns false once the
+// watcher was closed.
+func (w *inotifyWatcher) handleEvent(wd int, mask, cookie uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were lost, only a full pass can tell what changed
+		return w.send(Event{Op: OpOverflow})
+	}
+
+	w.mu.Lock()
+	dir, known := w.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 && known {
+		delete(w.watches, wd)
+		if w.paths[dir] == wd {
+			delete(w.paths, dir)
+		}
+	}
+	w.mu.Unlock()
+
+	if !known || name == "" {
+		return true
+	}
+
+	relPath := path.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if w.filter != nil && w.filter(relPath, isDir) {
+		return true
+	}
+
+	event := Event{Path: relPath, IsDir: isDir, Cookie: cookie}
+
+	switch {
+	case mask&syscall.IN_CREATE != 0:
+		event.Op = OpCreate
+	case mask&syscall.IN_MOVED_TO != 0:
+		event.Op = OpMovedTo
+	case mask&syscall.IN_MOVED_FROM != 0:
+		event.Op = OpMovedFrom
+	case mask&syscall.IN_DELETE != 0:
+		event.Op = OpRemove
+	case mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE|syscall.IN_ATTRIB) != 0:
+		event.Op = OpWrite
+	default:
+		return true
+	}
+
+	if isDir {
+		switch event.Op {
+		case OpCreate, OpMovedTo:
+			// Watch new directories, files created before the watch exists are
+			// covered by the event for the directory itself
+			if err := w.addTree(relPath); err != nil {
+				w.sendError(err)
+			}
+		case OpMovedFrom:
+			// The watches follow the directory; re-added if it moves within the tree
+			w.removeTree(relPath)
+		}
+	}
+
+	return w.send(event)
+}
+
+// send delivers an event unless the watcher was closed
+func (w *inotifyWatcher) send(event Event) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendError delivers an error without blocking the event loop
+func (w *inotifyWatcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
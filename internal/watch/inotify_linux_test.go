@@ -0,0 +1,81 @@
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectEvents reads events until the watcher was quiet for a short while
+func collectEvents(t *testing.T, w FileWatcher) []Event {
+	var events []Event
+	for {
+		select {
+		case event := <-w.Events():
+			events = append(events, event)
+		case <-time.After(200 * time.Millisecond):
+			return events
+		}
+	}
+}
+
+func TestFileWatcher_ReportsChanges(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".git"), 0755))
+
+	w, err := NewFileWatcher(root, func(path string, isDir bool) bool {
+		return path == ".git" || strings.HasPrefix(path, ".git/")
+	})
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".git", "index"), []byte("x"), 0644))
+	require.NoError(t, os.Rename(filepath.Join(root, "docs", "a.txt"), filepath.Join(root, "b.txt")))
+
+	batch := Coalesce(collectEvents(t, w))
+
+	assert.Contains(t, batch, Event{Path: "docs/a.txt", Op: OpCreate})
+	assert.Contains(t, batch, Event{Path: "b.txt", OldPath: "docs/a.txt", Op: OpRename})
+	for _, event := range batch {
+		assert.False(t, strings.HasPrefix(event.Path, ".git"), event.Path)
+	}
+}
+
+func TestFileWatcher_WatchesNewDirectories(t *testing.T) {
+	root := t.TempDir()
+
+	w, err := NewFileWatcher(root, nil)
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "new"), 0755))
+	collectEvents(t, w)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new", "file.txt"), []byte("x"), 0644))
+
+	assert.Contains(t, Coalesce(collectEvents(t, w)), Event{Path: "new/file.txt", Op: OpCreate})
+}
+
+func TestFileWatcher_Close(t *testing.T) {
+	w, err := NewFileWatcher(t.TempDir(), nil)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+
+	select {
+	case _, ok := <-w.Events():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("events channel not closed")
+	}
+}
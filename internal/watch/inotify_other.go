@@ -0,0 +1,8 @@
+//go:build !linux
+
+package watch
+
+// NewFileWatcher is only implemented on Linux, where inotify is available
+func NewFileWatcher(root string, filter Filter) (FileWatcher, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,121 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+)
+
+// RemotePoller detects remote changes by polling the ETag of the remote root.
+// Nextcloud propagates ETag changes up to the root, so an unchanged root ETag
+// costs a single PROPFIND. When it changed, the poller descends into the
+// directories whose ETags changed to narrow the change down to subtrees.
+// Directories are only listed once they change, so the first change below a
+// directory reports it as a whole.
+type RemotePoller struct {
+	client   webdav.Client
+	root     string
+	rootETag string
+	children map[string]map[string]string // Directory to child name to ETag
+}
+
+// NewRemotePoller creates a poller for the given remote base path
+func NewRemotePoller(client webdav.Client, root string) *RemotePoller {
+	return &RemotePoller{
+		client:   client,
+		root:     root,
+		children: make(map[string]map[string]string),
+	}
+}
+
+// Poll returns the root-relative subtrees that changed since the previous poll.
+// The first poll only records the current state and reports no changes.
+func (p *RemotePoller) Poll(ctx context.Context) ([]string, error) {
+	props, err := p.client.GetProperties(ctx, p.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote root properties: %w", err)
+	}
+
+	if props.ETag == p.rootETag {
+		return nil, nil
+	}
+
+	first := p.rootETag == ""
+	changed, err := p.diff(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	p.rootETag = props.ETag
+
+	if first {
+		return nil, nil
+	}
+
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// diff lists a directory, updates the recorded child ETags and returns the changed paths
+func (p *RemotePoller) diff(ctx context.Context, dir string) ([]string, error) {
+	files, err := p.client.ListDirectory(ctx, path.Join(p.root, dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote directory %s: %w", dir, err)
+	}
+
+	previous, listed := p.children[dir]
+	current := make(map[string]string, len(files))
+
+	var changed []string
+	for _, file := range files {
+		current[file.Name] = file.ETag
+		childPath := path.Join(dir, file.Name)
+
+		oldETag, known := previous[file.Name]
+		switch {
+		case !listed:
+			// Nothing to compare against yet; the caller reports the whole directory
+		case !known:
+			changed = append(changed, childPath)
+		case oldETag != file.ETag:
+			if !file.IsDirectory {
+				changed = append(changed, childPath)
+				break
+			}
+
+			nested, err := p.diff(ctx, childPath)
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) == 0 {
+				// The directory itself changed or its children were never seen
+				nested = []string{childPath}
+			}
+			changed = append(changed, nested...)
+		}
+	}
+
+	for name := range previous {
+		if _, exists := current[name]; !exists {
+			childPath := path.Join(dir, name)
+			changed = append(changed, childPath)
+			p.forget(childPath)
+		}
+	}
+
+	p.children[dir] = current
+
+	return changed, nil
+}
+
+// forget drops the recorded state of a directory and everything below it
+func (p *RemotePoller) forget(dir string) {
+	for recorded := range p.children {
+		if recorded == dir || strings.HasPrefix(recorded, dir+"/") {
+			delete(p.children, recorded)
+		}
+	}
+}
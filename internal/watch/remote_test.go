@@ -0,0 +1,168 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"path"
+	stdsync "sync"
+	"testing"
+
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockWebDAVClient serves a remote tree and counts requests
+type mockWebDAVClient struct {
+	mu       stdsync.Mutex
+	entries  map[string]*webdav.WebDAVFile
+	listings int
+}
+
+func newMockWebDAVClient() *mockWebDAVClient {
+	return &mockWebDAVClient{entries: make(map[string]*webdav.WebDAVFile)}
+}
+
+func (m *mockWebDAVClient) set(p, etag string, isDir bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[p] = &webdav.WebDAVFile{Name: path.Base(p), ETag: etag, IsDirectory: isDir}
+}
+
+func (m *mockWebDAVClient) ListDirectory(ctx context.Context, dir string) ([]*webdav.WebDAVFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listings++
+	var files []*webdav.WebDAVFile
+	for p, file := range m.entries {
+		if p != dir && path.Dir(p) == dir {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (m *mockWebDAVClient) GetProperties(ctx context.Context, p string) (*webdav.WebDAVProperties, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if file, exists := m.entries[p]; exists {
+		return &webdav.WebDAVProperties{ETag: file.ETag, IsDirectory: file.IsDirectory}, nil
+	}
+	return nil, webdav.NewWebDAVError(404, p, "PROPFIND")
+}
+
+func (m *mockWebDAVClient) DownloadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (m *mockWebDAVClient) UploadFile(ctx context.Context, path string, content io.Reader, size int64) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) UploadFileChunked(ctx context.Context, path string, content io.Reader, size int64, chunkSize int64) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) ResumeChunkedUpload(ctx context.Context, path string, content io.Reader, size int64, offset int64, chunkSize int64) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) CreateDirectory(ctx context.Context, path string) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) DeleteFile(ctx context.Context, path string) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) MoveFile(ctx context.Context, source, destination string) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) CopyFile(ctx context.Context, source, destination string) error {
+	return nil
+}
+
+func (m *mockWebDAVClient) SyncCollection(ctx context.Context, path, token string) (*webdav.SyncCollectionResult, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) ListTrash(ctx context.Context) ([]*webdav.TrashItem, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) RestoreTrashItem(ctx context.Context, name string) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) DeleteTrashItem(ctx context.Context, name string) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) EmptyTrash(ctx context.Context) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) ListVersions(ctx context.Context, path string) ([]*webdav.FileVersion, error) {
+	return nil, &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) RestoreVersion(ctx context.Context, version *webdav.FileVersion) error {
+	return &webdav.WebDAVError{StatusCode: 501}
+}
+
+func (m *mockWebDAVClient) Close() error {
+	return nil
+}
+
+func TestRemotePoller_UnchangedRootIsCheap(t *testing.T) {
+	client := newMockWebDAVClient()
+	client.set("/remote", "r1", true)
+	client.set("/remote/a.txt", "a1", false)
+
+	poller := NewRemotePoller(client, "/remote")
+
+	changed, err := poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	listings := client.listings
+
+	changed, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, listings, client.listings)
+}
+
+func TestRemotePoller_NarrowsToChangedSubtrees(t *testing.T) {
+	client := newMockWebDAVClient()
+	client.set("/remote", "r1", true)
+	client.set("/remote/a.txt", "a1", false)
+	client.set("/remote/docs", "d1", true)
+	client.set("/remote/docs/b.txt", "b1", false)
+	client.set("/remote/docs/c.txt", "c1", false)
+	client.set("/remote/old", "o1", true)
+
+	poller := NewRemotePoller(client, "/remote")
+	_, err := poller.Poll(context.Background())
+	require.NoError(t, err)
+
+	// The first change below a directory that was never listed reports the directory
+	client.set("/remote", "r2", true)
+	client.set("/remote/docs", "d2", true)
+	client.set("/remote/docs/b.txt", "b2", false)
+
+	changed, err := poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs"}, changed)
+
+	// Once listed, changes are narrowed down to the file
+	client.set("/remote", "r3", true)
+	client.set("/remote/docs", "d3", true)
+	client.set("/remote/docs/c.txt", "c2", false)
+	client.set("/remote/new.txt", "n1", false)
+	delete(client.entries, "/remote/old")
+
+	changed, err = poller.Poll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs/c.txt", "new.txt", "old"}, changed)
+}
@@ -0,0 +1,132 @@
+package watch
+
+import (
+	"context"
+	"time"
+)
+
+// SyncFunc runs a sync pass limited to the given root-relative subtrees. The
+// empty path stands for the whole tree.
+type SyncFunc func(ctx context.Context, subtrees []string) error
+
+// Options configures a Watcher
+type Options struct {
+	// Quiet is how long the local tree must be quiet before a batch is synced
+	Quiet time.Duration
+
+	// MaxDelay bounds how long a batch can be postponed by further events
+	MaxDelay time.Duration
+
+	// PollInterval is how often the remote root ETag is checked
+	PollInterval time.Duration
+
+	// OnError is called for errors that do not stop watching
+	OnError func(err error)
+}
+
+// DefaultOptions returns the default watch options
+func DefaultOptions() Options {
+	return Options{
+		Quiet:        2 * time.Second,
+		MaxDelay:     30 * time.Second,
+		PollInterval: 30 * time.Second,
+	}
+}
+
+// Watcher keeps a local tree and a remote tree in sync by running incremental
+// sync passes for local file system events and remote ETag changes
+type Watcher struct {
+	local   FileWatcher
+	remote  *RemotePoller
+	sync    SyncFunc
+	options Options
+}
+
+// NewWatcher creates a watcher. Either the local watcher or the remote poller may be nil.
+func NewWatcher(local FileWatcher, remote *RemotePoller, syncFn SyncFunc, options Options) *Watcher {
+	defaults := DefaultOptions()
+	if options.Quiet <= 0 {
+		options.Quiet = defaults.Quiet
+	}
+	if options.MaxDelay < options.Quiet {
+		options.MaxDelay = options.Quiet
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaults.PollInterval
+	}
+
+	return &Watcher{
+		local:   local,
+		remote:  remote,
+		sync:    syncFn,
+		options: options,
+	}
+}
+
+// Run performs an initial full sync and then syncs changes until the context is
+// cancelled. Errors of individual passes are reported through OnError.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.sync(ctx, []string{""}); err != nil {
+		return err
+	}
+
+	var batches <-chan []Event
+	var localErrors <-chan error
+	if w.local != nil {
+		batches = Debounce(ctx, w.local.Events(), w.options.Quiet, w.options.MaxDelay)
+		localErrors = w.local.Errors()
+	}
+
+	var poll <-chan time.Time
+	if w.remote != nil {
+		// Record the baseline the ETag comparison starts from
+		if _, err := w.remote.Poll(ctx); err != nil {
+			w.reportError(err)
+		}
+
+		ticker := time.NewTicker(w.options.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case batch, ok := <-batches:
+			if !ok {
+				batches = nil
+				continue
+			}
+			w.runSync(ctx, AffectedPaths(batch))
+		case err := <-localErrors:
+			w.reportError(err)
+		case <-poll:
+			changed, err := w.remote.Poll(ctx)
+			if err != nil {
+				w.reportError(err)
+				continue
+			}
+			if len(changed) > 0 {
+				w.runSync(ctx, changed)
+			}
+		}
+	}
+}
+
+// runSync runs a sync pass unless the watcher is shutting down
+func (w *Watcher) runSync(ctx context.Context, subtrees []string) {
+	if ctx.Err() != nil {
+		return
+	}
+	if err := w.sync(ctx, subtrees); err != nil {
+		w.reportError(err)
+	}
+}
+
+// reportError passes a non-fatal error to the configured handler
+func (w *Watcher) reportError(err error) {
+	if w.options.OnError != nil {
+		w.options.OnError(err)
+	}
+}
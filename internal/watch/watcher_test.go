@@ -0,0 +1,64 @@
+package watch
+
+import (
+	"context"
+	stdsync "sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFileWatcher delivers events pushed by a test
+type fakeFileWatcher struct {
+	events chan Event
+	errors chan error
+}
+
+func newFakeFileWatcher() *fakeFileWatcher {
+	return &fakeFileWatcher{events: make(chan Event), errors: make(chan error)}
+}
+
+func (w *fakeFileWatcher) Events() <-chan Event { return w.events }
+func (w *fakeFileWatcher) Errors() <-chan error { return w.errors }
+func (w *fakeFileWatcher) Close() error         { return nil }
+
+func TestWatcher_SyncsAffectedSubtrees(t *testing.T) {
+	local := newFakeFileWatcher()
+	client := newMockWebDAVClient()
+	client.set("/remote", "r1", true)
+
+	var mu stdsync.Mutex
+	var passes [][]string
+	syncFn := func(ctx context.Context, subtrees []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		passes = append(passes, subtrees)
+		return nil
+	}
+	passCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(passes)
+	}
+
+	options := Options{Quiet: 20 * time.Millisecond, MaxDelay: time.Second, PollInterval: 20 * time.Millisecond}
+	watcher := NewWatcher(local, NewRemotePoller(client, "/remote"), syncFn, options)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	local.events <- Event{Path: "docs/a.txt", Op: OpWrite}
+	require.Eventually(t, func() bool { return passCount() == 2 }, time.Second, 10*time.Millisecond)
+
+	client.set("/remote/new.txt", "n1", false)
+	client.set("/remote", "r2", true)
+	require.Eventually(t, func() bool { return passCount() == 3 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, [][]string{{""}, {"docs/a.txt"}, {"new.txt"}}, passes)
+}
@@ -0,0 +1,35 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/phaus/nextcloud-sync/internal/capabilities"
+)
+
+// Capabilities returns the capabilities of the server, which are fetched once
+// per run and shared by all clients of the server
+func (c *WebDAVClient) Capabilities(ctx context.Context) (*capabilities.Capabilities, error) {
+	davRoot, err := c.davRootURL()
+	if err != nil {
+		return nil, err
+	}
+
+	authHeader, err := c.auth.GetAuthHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth header: %w", err)
+	}
+
+	return capabilities.Get(ctx, c.httpClient, strings.TrimSuffix(davRoot, "/remote.php/dav"), authHeader)
+}
+
+// knownCapabilities returns the capabilities of the server, or nil if they cannot
+// be determined; the client then assumes a stock Nextcloud installation
+func (c *WebDAVClient) knownCapabilities(ctx context.Context) *capabilities.Capabilities {
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		return nil
+	}
+	return caps
+}
@@ -0,0 +1,275 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultChunkSize is used when no chunk size is configured, as by the desktop client
+	defaultChunkSize = 10 * 1024 * 1024 // 10MB
+
+	// minChunkSize is the smallest chunk Nextcloud accepts except for the last one,
+	// S3 primary storage rejects smaller parts
+	minChunkSize = 5 * 1024 * 1024 // 5MB
+
+	// maxChunkCount is the highest chunk number Nextcloud accepts for one upload
+	maxChunkCount = 10000
+
+	// chunkedUploadPrefix marks upload directories created by this client
+	chunkedUploadPrefix = "nextcloud-sync-"
+)
+
+// chunkedUpload is a Nextcloud chunking v2 upload. Chunks are stored in a
+// collection below /remote.php/dav/uploads/<user>/ and assembled into the
+// destination file by moving the virtual .file resource.
+type chunkedUpload struct {
+	client         *WebDAVClient
+	filePath       string
+	uploadURL      string
+	destinationURL string
+	size           int64
+	chunkSize      int64
+}
+
+// newChunkedUpload prepares a chunked upload of filePath. The upload directory
+// is derived from the destination, size and chunk size so that an interrupted
+// upload of the same file can be resumed.
+func (c *WebDAVClient) newChunkedUpload(ctx context.Context, filePath string, size, chunkSize int64) (*chunkedUpload, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	if minSize := c.minChunkSize(); chunkSize < minSize {
+		chunkSize = minSize
+	}
+
+	// Stay below the largest request the server accepts
+	if caps := c.knownCapabilities(ctx); caps != nil && caps.MaxChunkSize > 0 && chunkSize > caps.MaxChunkSize {
+		chunkSize = caps.MaxChunkSize
+	}
+
+	// Grow the chunks for very large files to stay within the chunk number limit
+	if minChunkSize := (size + maxChunkCount - 1) / maxChunkCount; chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+
+	uploadsURL, err := c.uploadsURL()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", filePath, size, chunkSize)))
+	transferID := chunkedUploadPrefix + hex.EncodeToString(hash[:16])
+
+	return &chunkedUpload{
+		client:         c,
+		filePath:       filePath,
+		uploadURL:      uploadsURL + "/" + transferID,
+		destinationURL: c.buildURL(filePath),
+		size:           size,
+		chunkSize:      chunkSize,
+	}, nil
+}
+
+// minChunkSize returns the smallest chunk size of uploads
+func (c *WebDAVClient) minChunkSize() int64 {
+	if c.chunkSizeFloor > 0 {
+		return c.chunkSizeFloor
+	}
+	return minChunkSize
+}
+
+// supportsChunking reports whether the server accepts chunked uploads, which is
+// assumed if its capabilities are unknown
+func (c *WebDAVClient) supportsChunking(ctx context.Context) bool {
+	caps := c.knownCapabilities(ctx)
+	return caps == nil || caps.ChunkingV2
+}
+
+// uploadsURL returns the chunked upload root of the current user
+func (c *WebDAVClient) uploadsURL() (string, error) {
+	davRoot, err := c.davRootURL()
+	if err != nil {
+		return "", err
+	}
+	return davRoot + "/uploads/" + c.auth.GetUsername(), nil
+}
+
+// davRootURL returns the root of the Nextcloud DAV endpoint, e.g. https://host/remote.php/dav
+func (c *WebDAVClient) davRootURL() (string, error) {
+	baseURL := strings.Replace(c.baseURL, "USERNAME", c.auth.GetUsername(), 1)
+
+	index := strings.Index(baseURL, "/remote.php/dav/")
+	if index < 0 {
+		return "", fmt.Errorf("cannot derive DAV endpoint from %s", baseURL)
+	}
+
+	return baseURL[:index] + "/remote.php/dav", nil
+}
+
+// create creates the upload directory. It reports whether the directory is new,
+// i.e. whether chunks of an earlier attempt are missing.
+func (u *chunkedUpload) create(ctx context.Context) (bool, error) {
+	req, err := u.client.createRequest(ctx, "MKCOL", u.uploadURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create MKCOL request: %w", err)
+	}
+	req.Header.Set("Destination", u.destinationURL)
+
+	resp, err := u.client.doRequest(req)
+	if err != nil {
+		// The directory of an interrupted upload still exists
+		var webdavErr *WebDAVError
+		if errors.As(err, &webdavErr) && webdavErr.StatusCode == http.StatusMethodNotAllowed {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create upload directory for %s: %w", u.filePath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return false, NewWebDAVError(resp.StatusCode, u.filePath, "MKCOL (upload)")
+	}
+
+	return true, nil
+}
+
+// receivedOffset returns how much of the file the server already holds, i.e. the
+// end of the complete chunks uploaded in sequence from the first one
+func (u *chunkedUpload) receivedOffset(ctx context.Context) (int64, error) {
+	files, err := u.client.listCollection(ctx, u.uploadURL)
+	if err != nil {
+		var webdavErr *WebDAVError
+		if errors.As(err, &webdavErr) && webdavErr.IsNotFoundError() {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to list uploaded chunks of %s: %w", u.filePath, err)
+	}
+
+	chunkSizes := make(map[int64]int64, len(files))
+	for _, file := range files {
+		number, err := strconv.ParseInt(file.Name, 10, 64)
+		if err != nil || file.IsDirectory {
+			continue
+		}
+		chunkSizes[number] = file.Size
+	}
+
+	var offset int64
+	for number := int64(1); offset < u.size; number++ {
+		expected := u.chunkSize
+		if remaining := u.size - offset; remaining < expected {
+			expected = remaining
+		}
+		if size, exists := chunkSizes[number]; !exists || size != expected {
+			break
+		}
+		offset += expected
+	}
+
+	return offset, nil
+}
+
+// sendChunks uploads the chunks from offset, which must be a chunk boundary, to
+// the end of the file. content must be positioned at offset.
+func (u *chunkedUpload) sendChunks(ctx context.Context, content io.Reader, offset int64) error {
+	buffer := make([]byte, u.chunkSize)
+
+	for offset < u.size {
+		length := u.chunkSize
+		if remaining := u.size - offset; remaining < length {
+			length = remaining
+		}
+
+		bytesRead, err := io.ReadFull(content, buffer[:length])
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("content ended at offset %d of %d", offset+int64(bytesRead), u.size)
+			}
+			return fmt.Errorf("failed to read chunk at offset %d: %w", offset, err)
+		}
+
+		if err := u.sendChunk(ctx, offset/u.chunkSize+1, buffer[:bytesRead]); err != nil {
+			return fmt.Errorf("failed to upload chunk at offset %d: %w", offset, err)
+		}
+
+		offset += int64(bytesRead)
+	}
+
+	return nil
+}
+
+// sendChunk uploads one numbered chunk into the upload directory
+func (u *chunkedUpload) sendChunk(ctx context.Context, number int64, data []byte) error {
+	url := fmt.Sprintf("%s/%05d", u.uploadURL, number)
+
+	req, err := u.client.createRequest(ctx, "PUT", url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create PUT request for chunk: %w", err)
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Destination", u.destinationURL)
+	req.Header.Set("OC-Total-Length", strconv.FormatInt(u.size, 10))
+
+	resp, err := u.client.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute chunk PUT request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return NewWebDAVError(resp.StatusCode, u.filePath, "PUT (chunk)")
+	}
+
+	return nil
+}
+
+// assemble moves the uploaded chunks to the destination file. The server checks
+// the total length and removes the upload directory afterwards.
+func (u *chunkedUpload) assemble(ctx context.Context) error {
+	req, err := u.client.createRequest(ctx, "MOVE", u.uploadURL+"/.file", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create MOVE request: %w", err)
+	}
+	req.Header.Set("Destination", u.destinationURL)
+	req.Header.Set("OC-Total-Length", strconv.FormatInt(u.size, 10))
+	req.Header.Set("Overwrite", "T")
+
+	resp, err := u.client.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to assemble chunks of %s: %w", u.filePath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return NewWebDAVError(resp.StatusCode, u.filePath, "MOVE (assemble)")
+	}
+
+	return nil
+}
+
+// skipTo positions content at offset. Seekable content is repositioned, other
+// content is assumed to start at byte 0 and is read up to offset.
+func skipTo(content io.Reader, offset int64) error {
+	if seeker, ok := content.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek to offset %d: %w", offset, err)
+		}
+		return nil
+	}
+
+	skipped, err := io.CopyN(io.Discard, content, offset)
+	if err != nil {
+		return fmt.Errorf("failed to skip to offset %d (skipped %d): %w", offset, skipped, err)
+	}
+
+	return nil
+}
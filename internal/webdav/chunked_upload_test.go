@@ -3,8 +3,16 @@ package webdav
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -114,6 +122,34 @@ func (m *MockWebDAVClientForChunked) CopyFile(ctx context.Context, source, desti
 	return nil
 }
 
+func (m *MockWebDAVClientForChunked) SyncCollection(ctx context.Context, path, token string) (*SyncCollectionResult, error) {
+	return nil, &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
+func (m *MockWebDAVClientForChunked) ListTrash(ctx context.Context) ([]*TrashItem, error) {
+	return nil, &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
+func (m *MockWebDAVClientForChunked) RestoreTrashItem(ctx context.Context, name string) error {
+	return &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
+func (m *MockWebDAVClientForChunked) DeleteTrashItem(ctx context.Context, name string) error {
+	return &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
+func (m *MockWebDAVClientForChunked) EmptyTrash(ctx context.Context) error {
+	return &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
+func (m *MockWebDAVClientForChunked) ListVersions(ctx context.Context, path string) ([]*FileVersion, error) {
+	return nil, &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
+func (m *MockWebDAVClientForChunked) RestoreVersion(ctx context.Context, version *FileVersion) error {
+	return &WebDAVError{StatusCode: http.StatusNotImplemented}
+}
+
 func (m *MockWebDAVClientForChunked) Close() error {
 	return nil
 }
@@ -244,3 +280,274 @@ func TestChunkedUploadWithZeroChunkSize(t *testing.T) {
 	uploadedContent := string(uploadedFiles[filePath])
 	assert.Equal(t, content, uploadedContent)
 }
+
+// chunkingServer is a minimal Nextcloud chunking v2 endpoint
+type chunkingServer struct {
+	mu           sync.Mutex
+	capabilities string // Capabilities of the dav and files apps as JSON
+	uploads      map[string]map[string][]byte
+	files        map[string][]byte
+	requests     []string
+	destination  []string
+	totalLength  string
+}
+
+func newChunkingServer() *chunkingServer {
+	return &chunkingServer{
+		capabilities: `"dav":{"chunking":"1.0"}`,
+		uploads:      make(map[string]map[string][]byte),
+		files:        make(map[string][]byte),
+	}
+}
+
+func (s *chunkingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The capabilities are not part of the upload protocol and not recorded
+	if r.URL.Path == "/ocs/v1.php/cloud/capabilities" {
+		fmt.Fprintf(w, `{"ocs":{"meta":{"status":"ok","statuscode":100},"data":{"version":{"major":28},"capabilities":{%s}}}}`, s.capabilities)
+		return
+	}
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.destination = append(s.destination, r.Header.Get("Destination"))
+
+	switch {
+	case r.Method == "PROPFIND":
+		chunks, exists := s.uploads[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, r.URL.Path)
+		for name, data := range chunks {
+			fmt.Fprintf(w, `<d:response><d:href>%s/%s</d:href><d:propstat><d:prop><d:getcontentlength>%d</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, r.URL.Path, name, len(data))
+		}
+		fmt.Fprintf(w, `</d:multistatus>`)
+	case r.Method == "MKCOL":
+		if _, exists := s.uploads[r.URL.Path]; exists {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.uploads[r.URL.Path] = make(map[string][]byte)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/remote.php/dav/files/"):
+		s.files[r.URL.Path], _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT":
+		dir, name := path.Split(r.URL.Path)
+		chunks, exists := s.uploads[strings.TrimSuffix(dir, "/")]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		chunks[name] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "MOVE" && strings.HasSuffix(r.URL.Path, "/.file"):
+		dir := strings.TrimSuffix(r.URL.Path, "/.file")
+		chunks := s.uploads[dir]
+		names := make([]string, 0, len(chunks))
+		for name := range chunks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var content []byte
+		for _, name := range names {
+			content = append(content, chunks[name]...)
+		}
+		s.totalLength = r.Header.Get("OC-Total-Length")
+		if strconv.Itoa(len(content)) != s.totalLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		destination, _ := url.Parse(r.Header.Get("Destination"))
+		s.files[destination.Path] = content
+		delete(s.uploads, dir)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newChunkingClient(t *testing.T, server *httptest.Server) *WebDAVClient {
+	client, err := NewClient(&mockAuthProvider{serverURL: server.URL, username: "testuser", password: "testpass"})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	// Small chunks keep the tests short
+	client.chunkSizeFloor = 1
+	return client
+}
+
+func TestWebDAVClient_UploadFileChunkedV2(t *testing.T) {
+	handler := newChunkingServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	content := strings.Repeat("0123456789", 25)
+	err := client.UploadFileChunked(context.Background(), "/docs/big.bin", strings.NewReader(content), int64(len(content)), 100)
+	require.NoError(t, err)
+
+	assert.Equal(t, content, string(handler.files["/remote.php/dav/files/testuser/docs/big.bin"]))
+	assert.Equal(t, "250", handler.totalLength)
+	assert.Empty(t, handler.uploads)
+
+	require.Len(t, handler.requests, 5)
+	uploadDir := strings.TrimPrefix(handler.requests[0], "MKCOL ")
+	assert.True(t, strings.HasPrefix(uploadDir, "/remote.php/dav/uploads/testuser/nextcloud-sync-"))
+	assert.Equal(t, []string{
+		"MKCOL " + uploadDir,
+		"PUT " + uploadDir + "/00001",
+		"PUT " + uploadDir + "/00002",
+		"PUT " + uploadDir + "/00003",
+		"MOVE " + uploadDir + "/.file",
+	}, handler.requests)
+
+	for _, destination := range handler.destination {
+		assert.Equal(t, server.URL+"/remote.php/dav/files/testuser/docs/big.bin", destination)
+	}
+}
+
+func TestWebDAVClient_ResumeChunkedUploadV2(t *testing.T) {
+	handler := newChunkingServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	content := strings.Repeat("0123456789", 25)
+	upload, err := client.newChunkedUpload(context.Background(), "/big.bin", int64(len(content)), 100)
+	require.NoError(t, err)
+
+	// An earlier attempt stored the first chunk before it was interrupted
+	uploadDir := strings.TrimPrefix(upload.uploadURL, server.URL)
+	handler.uploads[uploadDir] = map[string][]byte{"00001": []byte(content[:100])}
+
+	err = client.ResumeChunkedUpload(context.Background(), "/big.bin", strings.NewReader(content), int64(len(content)), 150, 100)
+	require.NoError(t, err)
+
+	assert.Equal(t, content, string(handler.files["/remote.php/dav/files/testuser/big.bin"]))
+	assert.Equal(t, []string{
+		"MKCOL " + uploadDir,
+		"PUT " + uploadDir + "/00002",
+		"PUT " + uploadDir + "/00003",
+		"MOVE " + uploadDir + "/.file",
+	}, handler.requests)
+}
+
+func TestWebDAVClient_ResumeChunkedUploadRestartsExpiredUpload(t *testing.T) {
+	handler := newChunkingServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	// The upload directory is gone, so the content is sent from the start
+	content := strings.Repeat("0123456789", 25)
+	err := client.ResumeChunkedUpload(context.Background(), "/big.bin", io.LimitReader(strings.NewReader(content), 250), int64(len(content)), 150, 100)
+	require.NoError(t, err)
+
+	assert.Equal(t, content, string(handler.files["/remote.php/dav/files/testuser/big.bin"]))
+	assert.Len(t, handler.requests, 5)
+}
+
+func TestWebDAVClient_UploadFileChunkedCapabilities(t *testing.T) {
+	content := strings.Repeat("0123456789", 25)
+
+	// Servers without chunking get the whole file at once
+	handler := newChunkingServer()
+	handler.capabilities = `"dav":{}`
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	err := client.UploadFileChunked(context.Background(), "/big.bin", strings.NewReader(content), int64(len(content)), 100)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(handler.files["/remote.php/dav/files/testuser/big.bin"]))
+	assert.Equal(t, []string{"PUT /remote.php/dav/files/testuser/big.bin"}, handler.requests)
+
+	offset, err := client.ChunkedUploadOffset(context.Background(), "/big.bin", int64(len(content)), 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	// Chunks do not exceed the largest request the server accepts
+	handler = newChunkingServer()
+	handler.capabilities = `"dav":{"chunking":"1.0"},"files":{"chunked_upload":{"max_size":50}}`
+	server = httptest.NewServer(handler)
+	defer server.Close()
+	client = newChunkingClient(t, server)
+
+	err = client.UploadFileChunked(context.Background(), "/big.bin", strings.NewReader(content), int64(len(content)), 100)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(handler.files["/remote.php/dav/files/testuser/big.bin"]))
+	assert.Len(t, handler.requests, 7, "MKCOL, five chunks and MOVE")
+}
+
+func TestWebDAVClient_ChunkSizeLimits(t *testing.T) {
+	handler := newChunkingServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client, err := NewClient(&mockAuthProvider{serverURL: server.URL, username: "testuser", password: "testpass"})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	// Nextcloud rejects chunks below 5MB except for the last one
+	upload, err := client.newChunkedUpload(ctx, "/big.bin", 100*1024*1024, 1024*1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5*1024*1024), upload.chunkSize)
+
+	upload, err = client.newChunkedUpload(ctx, "/big.bin", 100*1024*1024, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10*1024*1024), upload.chunkSize)
+
+	upload, err = client.newChunkedUpload(ctx, "/big.bin", 100*1024*1024, 20*1024*1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20*1024*1024), upload.chunkSize)
+}
+
+func TestWebDAVClient_UploadFileChunkedShortContent(t *testing.T) {
+	handler := newChunkingServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	err := client.UploadFileChunked(context.Background(), "/big.bin", strings.NewReader("too short"), 250, 100)
+	assert.Error(t, err)
+	assert.Empty(t, handler.files)
+}
+
+func TestWebDAVClient_ChunkedUploadOffset(t *testing.T) {
+	handler := newChunkingServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	offset, err := client.ChunkedUploadOffset(context.Background(), "/big.bin", 250, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	upload, err := client.newChunkedUpload(context.Background(), "/big.bin", 250, 100)
+	require.NoError(t, err)
+	uploadDir := strings.TrimPrefix(upload.uploadURL, server.URL)
+
+	// The second chunk is incomplete, so the third one does not count
+	handler.uploads[uploadDir] = map[string][]byte{
+		"00001": bytes.Repeat([]byte("a"), 100),
+		"00002": bytes.Repeat([]byte("b"), 60),
+		"00003": bytes.Repeat([]byte("c"), 50),
+	}
+	offset, err = client.ChunkedUploadOffset(context.Background(), "/big.bin", 250, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), offset)
+
+	handler.uploads[uploadDir]["00002"] = bytes.Repeat([]byte("b"), 100)
+	offset, err = client.ChunkedUploadOffset(context.Background(), "/big.bin", 250, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(250), offset)
+}
@@ -1,13 +1,15 @@
 package webdav
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/phaus/nextcloud-sync/internal/auth"
@@ -23,6 +25,8 @@ type WebDAVFile struct {
 	ETag         string    `xml:"getetag"`
 	ContentType  string    `xml:"getcontenttype"`
 	IsDirectory  bool      `xml:"iscollection"`
+	Checksums    string    `xml:"checksums"` // Space-separated "ALGORITHM:value" pairs
+	FileID       string    `xml:"fileid"`    // Nextcloud file ID, kept across moves and renames
 }
 
 // WebDAVProperties represents WebDAV properties for a file
@@ -33,6 +37,8 @@ type WebDAVProperties struct {
 	ETag         string    `xml:"getetag"`
 	ContentType  string    `xml:"getcontenttype"`
 	IsDirectory  bool      `xml:"iscollection"`
+	Checksums    string    `xml:"checksums"` // Space-separated "ALGORITHM:value" pairs
+	FileID       string    `xml:"fileid"`    // Nextcloud file ID, kept across moves and renames
 }
 
 // Client defines the interface for WebDAV operations
@@ -67,6 +73,28 @@ type Client interface {
 	// CopyFile copies a file from source to destination
 	CopyFile(ctx context.Context, source, destination string) error
 
+	// SyncCollection returns the resources below a directory that changed since a
+	// sync token, or all of them for an empty token
+	SyncCollection(ctx context.Context, path, token string) (*SyncCollectionResult, error)
+
+	// ListTrash lists the deleted files and directories in the trashbin
+	ListTrash(ctx context.Context) ([]*TrashItem, error)
+
+	// RestoreTrashItem restores an item of the trashbin to its original location
+	RestoreTrashItem(ctx context.Context, name string) error
+
+	// DeleteTrashItem permanently deletes an item of the trashbin
+	DeleteTrashItem(ctx context.Context, name string) error
+
+	// EmptyTrash permanently deletes all items of the trashbin
+	EmptyTrash(ctx context.Context) error
+
+	// ListVersions lists the earlier versions of a file
+	ListVersions(ctx context.Context, path string) ([]*FileVersion, error)
+
+	// RestoreVersion replaces the content of a file with an earlier version
+	RestoreVersion(ctx context.Context, version *FileVersion) error
+
 	// Close cleans up resources
 	Close() error
 }
@@ -78,6 +106,11 @@ type WebDAVClient struct {
 	userAgent   string
 	httpClient  *http.Client
 	retryConfig *utils.RetryConfig
+	listingMu   sync.Mutex
+	listing     treeListing // First tree listing method to try, see ListTree
+	resignMu    sync.Mutex  // Serializes refreshing rejected credentials
+
+	chunkSizeFloor int64 // Smallest chunk size if not 0, lowered by tests to use small chunks
 }
 
 // SetRetryConfig sets custom retry configuration
@@ -102,25 +135,35 @@ func NewClient(authProvider auth.AuthProvider) (*WebDAVClient, error) {
 		return nil, fmt.Errorf("failed to extract WebDAV endpoint: %w", err)
 	}
 
-	// Create HTTP client with reasonable defaults
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:       10,
-			IdleConnTimeout:    30 * time.Second,
-			DisableCompression: false,
-		},
-	}
-
 	return &WebDAVClient{
 		auth:        authProvider,
 		baseURL:     webdavURL,
 		userAgent:   "nextcloud-sync/1.0",
-		httpClient:  client,
+		httpClient:  newHTTPClient(requestTimeout),
 		retryConfig: utils.DefaultRetryConfig(),
 	}, nil
 }
 
+// requestTimeout bounds connecting to the server and waiting for the response
+// headers of a request
+const requestTimeout = 30 * time.Second
+
+// newHTTPClient creates an HTTP client whose requests fail if the server does not
+// answer within timeout. Request and response bodies have no deadline, a rate
+// limited transfer takes as long as it needs and is stopped by its context.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+			DisableCompression:    false,
+		},
+	}
+}
+
 // extractWebDAVEndpoint converts Nextcloud URL to WebDAV endpoint
 func extractWebDAVEndpoint(nextcloudURL string) (string, error) {
 	// Handle empty URL
@@ -180,9 +223,20 @@ func (c *WebDAVClient) doRequest(req *http.Request) (*http.Response, error) {
 	var resp *http.Response
 
 	// Use retry logic for the request
+	attempt := 0
 	err := utils.RetryWithBackoff(req.Context(), c.retryConfig, utils.IsTemporaryWebDAVError, func() error {
+		// The body of the previous attempt has been consumed, send it again
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+		attempt++
+
 		var err error
-		resp, err = c.httpClient.Do(req)
+		resp, err = c.send(req)
 		if err != nil {
 			return WrapHTTPError(err, req.URL.Path, req.Method)
 		}
@@ -207,7 +261,7 @@ func (c *WebDAVClient) doRequest(req *http.Request) (*http.Response, error) {
 
 // doRequestWithoutRetry executes an HTTP request without retry logic (for internal use)
 func (c *WebDAVClient) doRequestWithoutRetry(req *http.Request) (*http.Response, error) {
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, WrapHTTPError(err, req.URL.Path, req.Method)
 	}
@@ -221,50 +275,138 @@ func (c *WebDAVClient) doRequestWithoutRetry(req *http.Request) (*http.Response,
 	return resp, nil
 }
 
+// send sends a request once. If the server rejects the credentials, they are
+// refreshed and the request is signed and sent again, unless its body cannot be
+// sent twice.
+func (c *WebDAVClient) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	authHeader, err := c.resign(req.Context(), req.Header.Get("Authorization"))
+	if err != nil {
+		return resp, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		req.Body = body
+	}
+
+	resp.Body.Close()
+	req.Header.Set("Authorization", authHeader)
+	return c.httpClient.Do(req)
+}
+
+// resign returns the authorization header to send instead of a rejected one.
+// The credentials are only refreshed if no concurrent request did so already.
+func (c *WebDAVClient) resign(ctx context.Context, rejected string) (string, error) {
+	c.resignMu.Lock()
+	defer c.resignMu.Unlock()
+
+	authHeader, err := c.auth.GetAuthHeader()
+	if err != nil || authHeader != rejected {
+		return authHeader, err
+	}
+
+	if err := c.auth.RefreshCredentials(ctx); err != nil {
+		return "", err
+	}
+	return c.auth.GetAuthHeader()
+}
+
+// setXMLBody sets an XML request body that is sent again when the request is retried
+func setXMLBody(req *http.Request, body string) {
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+}
+
 // ListDirectory implements Client.ListDirectory
 func (c *WebDAVClient) ListDirectory(ctx context.Context, dirPath string) ([]*WebDAVFile, error) {
-	url := c.buildURL(dirPath)
+	return c.listCollection(ctx, c.buildURL(dirPath))
+}
 
-	// Create property request for directory listing
-	propReq := GetStandardPropertyRequest()
-	propReq.SetDepth(DepthOne)
+// listCollection lists the members of the collection at url
+func (c *WebDAVClient) listCollection(ctx context.Context, url string) ([]*WebDAVFile, error) {
+	var files []*WebDAVFile
+	responses := 0
+
+	err := c.propfind(ctx, url, DepthOne, func(basePath string, response *Response) error {
+		responses++
+
+		// Skip the base directory itself
+		if normalizeHref(response.Href) == normalizeHref(basePath) {
+			return nil
+		}
+
+		if file := fileFromResponse(response); file != nil {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if responses == 0 {
+		return nil, fmt.Errorf("invalid PROPFIND response: no responses in multistatus")
+	}
+
+	return files, nil
+}
+
+// propfind requests the standard properties of the resource at url and, depending
+// on depth, of its descendants. The response is parsed as a stream and every
+// resource is passed to fn together with the URL path that was requested.
+func (c *WebDAVClient) propfind(ctx context.Context, url, depth string, fn func(basePath string, response *Response) error) error {
+	return c.propfindProperties(ctx, url, depth, GetBasicProperties(), fn)
+}
+
+// propfindProperties works like propfind for a custom set of properties
+func (c *WebDAVClient) propfindProperties(ctx context.Context, url, depth string, properties []string, fn func(basePath string, response *Response) error) error {
+	propReq := &PropertyRequest{Properties: properties}
+	if err := propReq.SetDepth(depth); err != nil {
+		return err
+	}
 	propfindBody := propReq.BuildPROPFINDBody()
 
 	req, err := c.createRequest(ctx, "PROPFIND", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create PROPFIND request: %w", err)
+		return fmt.Errorf("failed to create PROPFIND request: %w", err)
 	}
 
-	// Set headers for directory listing
-	req.Header.Set("Depth", DepthOne)
+	req.Header.Set("Depth", depth)
 	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
-	req.Body = io.NopCloser(strings.NewReader(propfindBody))
-	req.ContentLength = int64(len(propfindBody))
+	setXMLBody(req, propfindBody)
 
 	resp, err := c.doRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute PROPFIND request: %w", err)
+		return fmt.Errorf("failed to execute PROPFIND request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Parse XML response
-	multistatus, err := parseMultistatusResponse(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse PROPFIND response: %w", err)
-	}
-
-	// Validate response
-	if err := validateMultistatus(multistatus); err != nil {
-		return nil, fmt.Errorf("invalid PROPFIND response: %w", err)
+	var callbackErr error
+	err = decodeMultistatus(resp.Body, func(response *Response) error {
+		callbackErr = fn(req.URL.Path, response)
+		return callbackErr
+	})
+	if callbackErr != nil {
+		return callbackErr
 	}
-
-	// Convert to WebDAVFile slice
-	files, err := parseWebDAVFiles(multistatus, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse WebDAV files: %w", err)
+		return fmt.Errorf("failed to parse PROPFIND response: %w", err)
 	}
 
-	return files, nil
+	return nil
 }
 
 // GetProperties implements Client.GetProperties
@@ -284,8 +426,7 @@ func (c *WebDAVClient) GetProperties(ctx context.Context, filePath string) (*Web
 	// Set headers for single file properties
 	req.Header.Set("Depth", DepthZero)
 	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
-	req.Body = io.NopCloser(strings.NewReader(propfindBody))
-	req.ContentLength = int64(len(propfindBody))
+	setXMLBody(req, propfindBody)
 
 	resp, err := c.doRequest(req)
 	if err != nil {
@@ -330,8 +471,75 @@ func (c *WebDAVClient) DownloadFile(ctx context.Context, filePath string) (io.Re
 	return resp.Body, nil
 }
 
+// DownloadFileRange downloads a file starting at offset. The range is only
+// honored if the file still has the given ETag, otherwise the server sends the
+// whole file. The returned offset is where the content actually starts.
+func (c *WebDAVClient) DownloadFileRange(ctx context.Context, filePath string, offset int64, etag string) (io.ReadCloser, int64, error) {
+	url := c.buildURL(filePath)
+
+	req, err := c.createRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create GET request: %w", err)
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if etag != "" {
+			req.Header.Set("If-Range", etag)
+		}
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute GET request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return resp.Body, 0, nil
+	}
+
+	start, err := parseContentRangeStart(resp.Header.Get("Content-Range"))
+	if err != nil || start != offset {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+	}
+
+	return resp.Body, offset, nil
+}
+
+// parseContentRangeStart returns the first byte position of a "bytes start-end/total" header
+func parseContentRangeStart(contentRange string) (int64, error) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, fmt.Errorf("unsupported Content-Range unit: %s", contentRange)
+	}
+	rangeSpec := strings.TrimPrefix(contentRange, "bytes ")
+
+	start, _, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid Content-Range: %s", contentRange)
+	}
+
+	return strconv.ParseInt(start, 10, 64)
+}
+
 // UploadFile implements Client.UploadFile
 func (c *WebDAVClient) UploadFile(ctx context.Context, filePath string, content io.Reader, size int64) error {
+	return c.upload(ctx, filePath, content, size, "", time.Time{})
+}
+
+// UploadFileWithChecksum uploads a file and lets the server store the given checksum,
+// formatted as "ALGORITHM:value", so that it is reported in oc:checksums
+func (c *WebDAVClient) UploadFileWithChecksum(ctx context.Context, filePath string, content io.Reader, size int64, checksum string) error {
+	return c.upload(ctx, filePath, content, size, checksum, time.Time{})
+}
+
+// UploadFileWithMtime uploads a file and sets its modification time on the server
+func (c *WebDAVClient) UploadFileWithMtime(ctx context.Context, filePath string, content io.Reader, size int64, modified time.Time) error {
+	return c.upload(ctx, filePath, content, size, "", modified)
+}
+
+// upload sends a file with PUT, with an optional checksum and modification time
+func (c *WebDAVClient) upload(ctx context.Context, filePath string, content io.Reader, size int64, checksum string, modified time.Time) error {
 	url := c.buildURL(filePath)
 
 	req, err := c.createRequest(ctx, "PUT", url, content)
@@ -344,173 +552,110 @@ func (c *WebDAVClient) UploadFile(ctx context.Context, filePath string, content
 		req.ContentLength = size
 	}
 
+	if checksum != "" {
+		req.Header.Set("OC-Checksum", checksum)
+	}
+	if !modified.IsZero() {
+		req.Header.Set("X-OC-MTime", strconv.FormatInt(modified.Unix(), 10))
+	}
+
 	resp, err := c.doRequest(req)
 	if err != nil {
 		return fmt.Errorf("failed to execute PUT request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check for successful upload
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+	// Check for successful upload, replacing an existing file yields 204
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
 		return NewWebDAVError(resp.StatusCode, filePath, "PUT")
 	}
 
 	return nil
 }
 
-// UploadFileChunked implements Client.UploadFileChunked
+// UploadFileChunked implements Client.UploadFileChunked using Nextcloud chunking v2
 func (c *WebDAVClient) UploadFileChunked(ctx context.Context, filePath string, content io.Reader, size int64, chunkSize int64) error {
-	// Validate inputs
 	if chunkSize <= 0 {
-		chunkSize = 1024 * 1024 // Default to 1MB
+		chunkSize = defaultChunkSize
 	}
 
-	// For small files, use regular upload
-	if size <= chunkSize {
+	// For small files, and servers without chunking, use regular upload
+	if size <= chunkSize || !c.supportsChunking(ctx) {
 		return c.UploadFile(ctx, filePath, content, size)
 	}
 
-	// Create a buffered reader for chunking
-	buffer := make([]byte, chunkSize)
-	var offset int64 = 0
-
-	for offset < size {
-		// Read a chunk
-		bytesRead, err := io.ReadFull(content, buffer)
-		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-			return fmt.Errorf("failed to read chunk at offset %d: %w", offset, err)
-		}
-
-		// Handle last chunk which might be smaller
-		chunkData := buffer[:bytesRead]
-		if bytesRead == 0 {
-			break
-		}
-
-		// Upload this chunk
-		err = c.uploadChunk(ctx, filePath, chunkData, offset, size)
-		if err != nil {
-			return fmt.Errorf("failed to upload chunk at offset %d: %w", offset, err)
-		}
+	upload, err := c.newChunkedUpload(ctx, filePath, size, chunkSize)
+	if err != nil {
+		return err
+	}
 
-		offset += int64(bytesRead)
+	if _, err := upload.create(ctx); err != nil {
+		return err
+	}
 
-		// If we read less than requested, we're done
-		if int64(bytesRead) < chunkSize {
-			break
-		}
+	if err := upload.sendChunks(ctx, content, 0); err != nil {
+		return err
 	}
 
-	return nil
+	return upload.assemble(ctx)
 }
 
-// ResumeChunkedUpload implements Client.ResumeChunkedUpload
+// ResumeChunkedUpload implements Client.ResumeChunkedUpload. Chunks of the
+// interrupted upload before offset are kept, the upload restarts at the last
+// complete chunk. If the server already expired the upload directory, the whole
+// file is uploaded again.
 func (c *WebDAVClient) ResumeChunkedUpload(ctx context.Context, filePath string, content io.Reader, size int64, offset int64, chunkSize int64) error {
-	// Validate inputs
 	if chunkSize <= 0 {
-		chunkSize = 1024 * 1024 // Default to 1MB
+		chunkSize = defaultChunkSize
 	}
 
-	// Seek to the resume position if the content supports seeking
-	if seeker, ok := content.(io.Seeker); ok {
-		_, err := seeker.Seek(offset, io.SeekStart)
-		if err != nil {
-			return fmt.Errorf("failed to seek to offset %d: %w", offset, err)
-		}
-	} else if offset > 0 {
-		// If we can't seek, we need to read and discard bytes to get to the offset
-		discarded := int64(0)
-		buffer := make([]byte, 4096)
-		for discarded < offset {
-			toRead := int64(len(buffer))
-			if discarded+toRead > offset {
-				toRead = offset - discarded
-			}
-
-			bytesRead, err := io.ReadFull(content, buffer[:toRead])
-			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-				return fmt.Errorf("failed to skip to offset %d: %w", offset, err)
-			}
-
-			discarded += int64(bytesRead)
-			if int64(bytesRead) < toRead {
-				break // EOF reached
-			}
-		}
+	if size <= chunkSize || !c.supportsChunking(ctx) {
+		return c.UploadFile(ctx, filePath, content, size)
 	}
 
-	// Continue upload from the offset
-	buffer := make([]byte, chunkSize)
-	currentOffset := offset
-
-	for currentOffset < size {
-		// Read a chunk
-		bytesRead, err := io.ReadFull(content, buffer)
-		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-			return fmt.Errorf("failed to read chunk at offset %d: %w", currentOffset, err)
-		}
-
-		// Handle last chunk which might be smaller
-		chunkData := buffer[:bytesRead]
-		if bytesRead == 0 {
-			break
-		}
-
-		// Upload this chunk
-		err = c.uploadChunk(ctx, filePath, chunkData, currentOffset, size)
-		if err != nil {
-			return fmt.Errorf("failed to upload chunk at offset %d: %w", currentOffset, err)
-		}
-
-		currentOffset += int64(bytesRead)
-
-		// If we read less than requested, we're done
-		if int64(bytesRead) < chunkSize {
-			break
-		}
+	upload, err := c.newChunkedUpload(ctx, filePath, size, chunkSize)
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
-
-// uploadChunk uploads a single chunk using Content-Range header
-func (c *WebDAVClient) uploadChunk(ctx context.Context, filePath string, chunkData []byte, offset, totalSize int64) error {
-	url := c.buildURL(filePath)
-
-	// Create a reader for the chunk data
-	chunkReader := bytes.NewReader(chunkData)
-
-	// Create the request
-	req, err := c.createRequest(ctx, "PUT", url, chunkReader)
+	created, err := upload.create(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create PUT request for chunk: %w", err)
+		return err
 	}
 
-	// Set Content-Length for this chunk
-	req.ContentLength = int64(len(chunkData))
+	start := offset - offset%upload.chunkSize
+	if created || start < 0 {
+		start = 0
+	}
+	if start > size {
+		start = size - size%upload.chunkSize
+	}
 
-	// Set Content-Range header for chunked upload
-	endRange := offset + int64(len(chunkData)) - 1
-	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, endRange, totalSize))
+	if err := skipTo(content, start); err != nil {
+		return err
+	}
 
-	// For the first chunk, don't send Content-Range to create the file
-	if offset == 0 {
-		req.Header.Del("Content-Range")
+	if err := upload.sendChunks(ctx, content, start); err != nil {
+		return err
 	}
 
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return fmt.Errorf("failed to execute chunk PUT request: %w", err)
+	return upload.assemble(ctx)
+}
+
+// ChunkedUploadOffset returns the offset at which an interrupted chunked upload of
+// filePath can continue, based on the chunks the server already received. It is 0
+// if there is nothing to resume.
+func (c *WebDAVClient) ChunkedUploadOffset(ctx context.Context, filePath string, size int64, chunkSize int64) (int64, error) {
+	if !c.supportsChunking(ctx) {
+		return 0, nil
 	}
-	defer resp.Body.Close()
 
-	// Check response status
-	// For chunked uploads, we accept 200 (OK) or 201 (Created) or 206 (Partial Content)
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusPartialContent {
-		return NewWebDAVError(resp.StatusCode, filePath, "PUT (chunk)")
+	upload, err := c.newChunkedUpload(ctx, filePath, size, chunkSize)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return upload.receivedOffset(ctx)
 }
 
 // CreateDirectory implements Client.CreateDirectory
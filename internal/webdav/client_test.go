@@ -1,14 +1,18 @@
 package webdav
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/phaus/nextcloud-sync/internal/auth"
 	"github.com/phaus/nextcloud-sync/internal/utils"
+	"github.com/phaus/nextcloud-sync/internal/webdav/webdavtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -447,3 +451,202 @@ func TestRetryWithContextCancellation(t *testing.T) {
 	assert.Contains(t, err.Error(), "context cancelled")
 	assert.Less(t, elapsed, 200*time.Millisecond, "Should return quickly due to context cancellation")
 }
+
+func TestUploadFileWithChecksum(t *testing.T) {
+	var checksumHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checksumHeader = r.Header.Get("OC-Checksum")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&mockAuthProvider{serverURL: server.URL, username: "testuser", password: "testpass"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	err = client.UploadFileWithChecksum(context.Background(), "/a.txt", strings.NewReader("a"), 1, "SHA256:abc")
+	require.NoError(t, err)
+	assert.Equal(t, "SHA256:abc", checksumHeader)
+
+	err = client.UploadFile(context.Background(), "/a.txt", strings.NewReader("a"), 1)
+	require.NoError(t, err)
+	assert.Empty(t, checksumHeader)
+}
+
+func TestUploadFileWithMtime(t *testing.T) {
+	var mtimeHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtimeHeader = r.Header.Get("X-OC-MTime")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&mockAuthProvider{serverURL: server.URL, username: "testuser", password: "testpass"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	err = client.UploadFileWithMtime(context.Background(), "/a.txt", strings.NewReader("a"), 1, time.Unix(1700000000, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "1700000000", mtimeHeader)
+
+	err = client.UploadFile(context.Background(), "/a.txt", strings.NewReader("a"), 1)
+	require.NoError(t, err)
+	assert.Empty(t, mtimeHeader)
+}
+
+func TestDownloadFileRange(t *testing.T) {
+	content := "0123456789"
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "a.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&mockAuthProvider{serverURL: server.URL, username: "testuser", password: "testpass"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	body, offset, err := client.DownloadFileRange(context.Background(), "/a.txt", 4, `"v1"`)
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), offset)
+	assert.Equal(t, "456789", string(data))
+
+	// A changed file is sent in full
+	etag = `"v2"`
+	body, offset, err = client.DownloadFileRange(context.Background(), "/a.txt", 4, `"v1"`)
+	require.NoError(t, err)
+	data, err = io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadFileRange_SlowReaderHasNoDeadline(t *testing.T) {
+	content := strings.Repeat("0123456789", 1024*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "big.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := newChunkingClient(t, server)
+	client.httpClient = newHTTPClient(100 * time.Millisecond)
+
+	// A rate limited download reads the rest of the file for longer than a request may wait
+	body, offset, err := client.DownloadFileRange(context.Background(), "/big.bin", 100, `"v1"`)
+	require.NoError(t, err)
+	defer body.Close()
+	data, err := io.ReadAll(&throttledReader{content: body, piece: 1024 * 1024, delay: 5 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), offset)
+	assert.Equal(t, len(content)-100, len(data))
+}
+
+func TestWebDAVClient_ResignsAfterUnauthorized(t *testing.T) {
+	srv := webdavtest.NewServer("alice", "secret")
+	defer srv.Close()
+	srv.RegisterOAuth2Client("client", "client-secret", "http://localhost:8765/callback")
+	require.NoError(t, srv.WriteFile("a.txt", []byte("a"), time.Now()))
+
+	// Obtain a refresh token the way a browser would
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	oauth2Client := auth.OAuth2Client{ServerURL: srv.URL, ClientID: "client", ClientSecret: "client-secret", RedirectURL: "http://localhost:8765/callback"}
+	resp, err := noRedirect.Get(oauth2Client.AuthCodeURL("state"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	location, err := resp.Location()
+	require.NoError(t, err)
+	token, err := oauth2Client.Exchange(context.Background(), location.Query().Get("code"))
+	require.NoError(t, err)
+
+	authProvider, err := auth.NewOAuth2Auth(oauth2Client, "alice", *token)
+	require.NoError(t, err)
+	client, err := NewClient(authProvider)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	files, err := client.ListDirectory(ctx, "/")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, 0, srv.TokenRefreshes())
+
+	// A revoked access token is renewed and the request signed again
+	srv.RevokeAccessTokens()
+	files, err = client.ListDirectory(ctx, "/")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, 1, srv.TokenRefreshes())
+
+	// Bodies that can be read again are sent again
+	srv.RevokeAccessTokens()
+	require.NoError(t, client.UploadFile(ctx, "/b.txt", bytes.NewReader([]byte("b")), 1))
+	assert.Equal(t, 2, srv.TokenRefreshes())
+	content, err := srv.ReadFile("b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(content))
+}
+
+// throttledReader delivers its content in pieces with a pause before each
+type throttledReader struct {
+	content io.Reader
+	piece   int
+	delay   time.Duration
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) > r.piece {
+		p = p[:r.piece]
+	}
+	return r.content.Read(p)
+}
+
+func TestWebDAVClient_ThrottledTransfersHaveNoDeadline(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT":
+			uploaded, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasSuffix(r.URL.Path, "/stalled.txt"):
+			time.Sleep(300 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusOK)
+			for i := 0; i < len(content); i += 10 {
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+				_, _ = io.WriteString(w, content[i:i+10])
+			}
+		}
+	}))
+	defer server.Close()
+
+	// Bodies stream for about 200ms, twice as long as the server may take to answer
+	client := newChunkingClient(t, server)
+	client.httpClient = newHTTPClient(100 * time.Millisecond)
+	client.SetRetryConfig(&utils.RetryConfig{MaxRetries: 0})
+	ctx := context.Background()
+
+	body, err := client.DownloadFile(ctx, "/big.bin")
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, content, string(downloaded))
+
+	reader := &throttledReader{content: strings.NewReader(content), piece: 10, delay: 20 * time.Millisecond}
+	require.NoError(t, client.UploadFile(ctx, "/big.bin", reader, int64(len(content))))
+	assert.Equal(t, content, string(uploaded))
+
+	// A server that does not answer still fails the request
+	_, err = client.DownloadFile(ctx, "/stalled.txt")
+	assert.Error(t, err)
+}
@@ -8,8 +8,12 @@ import (
 
 // WebDAV Property namespaces and XML constants
 const (
-	WebDAVNamespace = "DAV:"
-	XMLNSDav        = "xmlns:d=\"DAV:\""
+	WebDAVNamespace    = "DAV:"
+	XMLNSDav           = "xmlns:d=\"DAV:\""
+	OwnCloudNamespace  = "http://owncloud.org/ns"
+	XMLNSOwnCloud      = "xmlns:oc=\"http://owncloud.org/ns\""
+	NextcloudNamespace = "http://nextcloud.org/ns"
+	XMLNSNextcloud     = "xmlns:nc=\"http://nextcloud.org/ns\""
 )
 
 // Depth values for PROPFIND requests
@@ -80,12 +84,16 @@ func (pr *PropertyRequest) BuildPROPFINDBody() string {
 	// Build custom property request
 	var propBuilder strings.Builder
 	propBuilder.WriteString(`<?xml version="1.0" encoding="utf-8" ?>
-<d:propfind xmlns:d="DAV:">
+<d:propfind ` + XMLNSDav + ` ` + XMLNSOwnCloud + ` ` + XMLNSNextcloud + `>
   <d:prop>`)
 
 	for _, prop := range pr.Properties {
+		// Unprefixed properties belong to the DAV: namespace
+		if !strings.Contains(prop, ":") {
+			prop = "d:" + prop
+		}
 		propBuilder.WriteString("\n    <")
-		propBuilder.WriteString(strings.TrimPrefix(prop, "d:"))
+		propBuilder.WriteString(prop)
 		propBuilder.WriteString("/>")
 	}
 
@@ -126,6 +134,38 @@ func (pr *PropertyRequest) RemoveProperty(property string) {
 	}
 }
 
+// Checksum algorithms reported by Nextcloud in oc:checksums
+const (
+	ChecksumSHA1    = "SHA1"
+	ChecksumMD5     = "MD5"
+	ChecksumADLER32 = "ADLER32"
+	ChecksumSHA256  = "SHA256"
+)
+
+// ParseChecksums parses an oc:checksums value such as "SHA1:abc MD5:def" into a map
+// from upper-case algorithm name to lower-case checksum
+func ParseChecksums(checksums string) map[string]string {
+	result := make(map[string]string)
+	for _, field := range strings.Fields(checksums) {
+		algorithm, value, found := strings.Cut(field, ":")
+		if !found || value == "" {
+			continue
+		}
+		result[strings.ToUpper(algorithm)] = strings.ToLower(value)
+	}
+	return result
+}
+
+// ChecksumValue returns the checksum for an algorithm from an oc:checksums value, or ""
+func ChecksumValue(checksums, algorithm string) string {
+	return ParseChecksums(checksums)[strings.ToUpper(algorithm)]
+}
+
+// FormatChecksum formats a checksum for the OC-Checksum header
+func FormatChecksum(algorithm, value string) string {
+	return strings.ToUpper(algorithm) + ":" + value
+}
+
 // PropertyValidator validates WebDAV property values
 type PropertyValidator struct{}
 
@@ -231,3 +231,33 @@ func TestGetMinimalPropertiesForChangeDetection(t *testing.T) {
 		}
 	}
 }
+
+func TestPropertyRequest_BuildPROPFINDBodyNamespaces(t *testing.T) {
+	body := GetStandardPropertyRequest().BuildPROPFINDBody()
+
+	for _, expected := range []string{XMLNSDav, XMLNSOwnCloud, "<d:getetag/>", "<oc:checksums/>"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("PROPFIND body should contain %s, got %s", expected, body)
+		}
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	checksums := ParseChecksums("SHA1:AbC md5:123 invalid SHA256:")
+
+	if len(checksums) != 2 {
+		t.Errorf("Expected 2 checksums, got %v", checksums)
+	}
+	if checksums[ChecksumSHA1] != "abc" {
+		t.Errorf("Expected normalized SHA1 checksum, got %q", checksums[ChecksumSHA1])
+	}
+	if ChecksumValue("SHA1:abc MD5:123", "md5") != "123" {
+		t.Error("Expected MD5 checksum to be found case-insensitively")
+	}
+	if ChecksumValue("", ChecksumSHA256) != "" {
+		t.Error("Expected no checksum for empty value")
+	}
+	if FormatChecksum("sha256", "ff") != "SHA256:ff" {
+		t.Errorf("Unexpected formatted checksum %s", FormatChecksum("sha256", "ff"))
+	}
+}
@@ -189,12 +189,14 @@ func (rb *RequestBuilder) buildPROPFINDBody(properties []string) string {
 			"d:getetag",
 			"d:getcontenttype",
 			"d:resourcetype",
+			"oc:checksums",
+			"oc:fileid",
 		}
 	}
 
 	var propBuilder strings.Builder
 	propBuilder.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\" ?>\n")
-	propBuilder.WriteString("<d:propfind xmlns:d=\"DAV:\">\n")
+	propBuilder.WriteString("<d:propfind " + XMLNSDav + " " + XMLNSOwnCloud + ">\n")
 	propBuilder.WriteString("  <d:prop>\n")
 
 	for _, prop := range properties {
@@ -217,6 +219,13 @@ const (
 	PropResourceType   = "d:resourcetype"
 	PropCreationDate   = "d:creationdate"
 	PropGetContentLang = "d:getcontentlanguage"
+	PropChecksums      = "oc:checksums"
+	PropFileID         = "oc:fileid"
+
+	PropTrashbinFilename         = "nc:trashbin-filename"
+	PropTrashbinOriginalLocation = "nc:trashbin-original-location"
+	PropTrashbinDeletionTime     = "nc:trashbin-deletion-time"
+	PropVersionLabel             = "nc:version-label"
 )
 
 // GetAllProperties returns a slice of all common WebDAV properties
@@ -241,6 +250,8 @@ func GetBasicProperties() []string {
 		PropLastModified,
 		PropETag,
 		PropResourceType,
+		PropChecksums,
+		PropFileID,
 	}
 }
 
@@ -261,7 +272,7 @@ func DefaultRequestConfig() *RequestConfig {
 		UserAgent:         "nextcloud-sync/1.0",
 		MaxRetries:        3,
 		RetryDelay:        5,
-		ChunkSize:         1024 * 1024, // 1MB
+		ChunkSize:         10 * 1024 * 1024, // 10MB
 		EnableCompression: true,
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -23,6 +24,33 @@ type Response struct {
 	Status   string   `xml:"status,omitempty"`
 }
 
+// UnmarshalXML decodes a response. Servers return properties they do not have in a
+// separate propstat with a 404 status, so the successful propstat is kept.
+func (r *Response) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Href      string     `xml:"href"`
+		Propstats []Propstat `xml:"propstat"`
+		Status    string     `xml:"status,omitempty"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	r.Href = raw.Href
+	r.Status = raw.Status
+	r.Propstat = Propstat{}
+	for i, propstat := range raw.Propstats {
+		if i == 0 || strings.Contains(propstat.Status, "200 OK") {
+			r.Propstat = propstat
+		}
+		if strings.Contains(propstat.Status, "200 OK") {
+			break
+		}
+	}
+
+	return nil
+}
+
 // Propstat represents property statistics
 type Propstat struct {
 	Prop   Prop   `xml:"prop"`
@@ -37,6 +65,14 @@ type Prop struct {
 	ETag          string       `xml:"getetag"`
 	ContentType   string       `xml:"getcontenttype"`
 	ResourceType  ResourceType `xml:"resourcetype"`
+	Checksums     string       `xml:"checksums>checksum"`
+	FileID        string       `xml:"fileid"`
+
+	// Nextcloud trashbin and version properties
+	TrashbinFilename         string `xml:"trashbin-filename"`
+	TrashbinOriginalLocation string `xml:"trashbin-original-location"`
+	TrashbinDeletionTime     string `xml:"trashbin-deletion-time"`
+	VersionLabel             string `xml:"version-label"`
 }
 
 // ResourceType represents the type of a WebDAV resource
@@ -63,43 +99,115 @@ func parseMultistatusResponse(body io.Reader) (*Multistatus, error) {
 func parseWebDAVFiles(multistatus *Multistatus, basePath string) ([]*WebDAVFile, error) {
 	var files []*WebDAVFile
 
-	for _, response := range multistatus.Responses {
+	base := normalizeHref(basePath)
+
+	for i := range multistatus.Responses {
+		response := &multistatus.Responses[i]
+
 		// Skip the base directory itself
-		if response.Href == basePath || response.Href == basePath+"/" {
+		if normalizeHref(response.Href) == base {
 			continue
 		}
 
-		// Check if the request was successful
-		if !strings.Contains(response.Propstat.Status, "200 OK") &&
-			!strings.Contains(response.Status, "200 OK") {
-			continue
+		if file := fileFromResponse(response); file != nil {
+			files = append(files, file)
 		}
+	}
+
+	return files, nil
+}
+
+// fileFromResponse converts a single multistatus response to a WebDAVFile.
+// It returns nil if the properties of the resource could not be retrieved.
+func fileFromResponse(response *Response) *WebDAVFile {
+	// Check if the request was successful
+	if !strings.Contains(response.Propstat.Status, "200 OK") &&
+		!strings.Contains(response.Status, "200 OK") {
+		return nil
+	}
+
+	file := &WebDAVFile{
+		Name:        extractFileName(normalizeHref(response.Href)),
+		Path:        response.Propstat.Prop.DisplayName,
+		Size:        response.Propstat.Prop.ContentLength,
+		ETag:        response.Propstat.Prop.ETag,
+		ContentType: response.Propstat.Prop.ContentType,
+		IsDirectory: len(response.Propstat.Prop.ResourceType.Collection) > 0,
+		Checksums:   strings.TrimSpace(response.Propstat.Prop.Checksums),
+		FileID:      strings.TrimSpace(response.Propstat.Prop.FileID),
+	}
 
-		file := &WebDAVFile{
-			Name:        extractFileName(response.Href),
-			Path:        response.Propstat.Prop.DisplayName,
-			Size:        response.Propstat.Prop.ContentLength,
-			ETag:        response.Propstat.Prop.ETag,
-			ContentType: response.Propstat.Prop.ContentType,
-			IsDirectory: len(response.Propstat.Prop.ResourceType.Collection) > 0,
+	// Parse last modified time
+	if response.Propstat.Prop.LastModified != "" {
+		if lastMod, err := parseWebDAVTime(response.Propstat.Prop.LastModified); err == nil {
+			file.LastModified = lastMod
 		}
+	}
+
+	// Use display name as path if not available
+	if file.Path == "" {
+		file.Path = file.Name
+	}
 
-		// Parse last modified time
-		if response.Propstat.Prop.LastModified != "" {
-			if lastMod, err := parseWebDAVTime(response.Propstat.Prop.LastModified); err == nil {
-				file.LastModified = lastMod
+	return file
+}
+
+// decodeMultistatus parses a multistatus response as a stream and calls fn for each
+// response element in turn, so that large listings are never held in memory at once
+func decodeMultistatus(body io.Reader, fn func(*Response) error) error {
+	_, err := decodeMultistatusWithToken(body, fn)
+	return err
+}
+
+// decodeMultistatusWithToken works like decodeMultistatus and also returns the
+// sync token of a sync-collection report, if any
+func decodeMultistatusWithToken(body io.Reader, fn func(*Response) error) (string, error) {
+	decoder := xml.NewDecoder(body)
+	found := false
+	syncToken := ""
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if !found {
+				return "", fmt.Errorf("no multistatus element in response")
 			}
+			return syncToken, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse XML response: %w", err)
 		}
 
-		// Use display name as path if not available
-		if file.Path == "" {
-			file.Path = file.Name
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
 		}
 
-		files = append(files, file)
+		switch start.Name.Local {
+		case "multistatus":
+			found = true
+		case "response":
+			var response Response
+			if err := decoder.DecodeElement(&response, &start); err != nil {
+				return "", fmt.Errorf("failed to parse XML response: %w", err)
+			}
+			if response.Href == "" {
+				return "", fmt.Errorf("response has empty href")
+			}
+			if err := fn(&response); err != nil {
+				return "", err
+			}
+		case "sync-token":
+			if err := decoder.DecodeElement(&syncToken, &start); err != nil {
+				return "", fmt.Errorf("failed to parse sync token: %w", err)
+			}
+			syncToken = strings.TrimSpace(syncToken)
+		default:
+			if err := decoder.Skip(); err != nil {
+				return "", fmt.Errorf("failed to parse XML response: %w", err)
+			}
+		}
 	}
-
-	return files, nil
 }
 
 // parseWebDAVProperties extracts properties from multistatus response
@@ -123,6 +231,8 @@ func parseWebDAVProperties(multistatus *Multistatus) (*WebDAVProperties, error)
 		ETag:        prop.ETag,
 		ContentType: prop.ContentType,
 		IsDirectory: len(prop.ResourceType.Collection) > 0,
+		Checksums:   strings.TrimSpace(prop.Checksums),
+		FileID:      strings.TrimSpace(prop.FileID),
 	}
 
 	// Parse last modified time
@@ -140,6 +250,14 @@ func parseWebDAVProperties(multistatus *Multistatus) (*WebDAVProperties, error)
 	return properties, nil
 }
 
+// normalizeHref unescapes an href and strips trailing slashes so that it can be compared to a path
+func normalizeHref(href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return strings.TrimRight(href, "/")
+}
+
 // extractFileName extracts the file name from a WebDAV href
 func extractFileName(href string) string {
 	// Remove any trailing slashes
@@ -294,3 +294,65 @@ func TestValidateMultistatus(t *testing.T) {
 		})
 	}
 }
+
+func TestParseWebDAVFiles_ChecksumsAndMissingProperties(t *testing.T) {
+	xmlData := `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns">
+    <d:response>
+        <d:href>/remote.php/dav/files/user/documents/</d:href>
+        <d:propstat>
+            <d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop>
+            <d:status>HTTP/1.1 200 OK</d:status>
+        </d:propstat>
+    </d:response>
+    <d:response>
+        <d:href>/remote.php/dav/files/user/documents/report.pdf</d:href>
+        <d:propstat>
+            <d:prop>
+                <d:getcontentlength>2048</d:getcontentlength>
+                <d:getetag>&quot;e1&quot;</d:getetag>
+                <oc:checksums><oc:checksum>SHA1:ABC SHA256:DEF0</oc:checksum></oc:checksums>
+                <oc:fileid>4711</oc:fileid>
+            </d:prop>
+            <d:status>HTTP/1.1 200 OK</d:status>
+        </d:propstat>
+    </d:response>
+    <d:response>
+        <d:href>/remote.php/dav/files/user/documents/subdir/</d:href>
+        <d:propstat>
+            <d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop>
+            <d:status>HTTP/1.1 200 OK</d:status>
+        </d:propstat>
+        <d:propstat>
+            <d:prop><oc:checksums/></d:prop>
+            <d:status>HTTP/1.1 404 Not Found</d:status>
+        </d:propstat>
+    </d:response>
+</d:multistatus>`
+
+	multistatus, err := parseMultistatusResponse(strings.NewReader(xmlData))
+	if err != nil {
+		t.Fatalf("Failed to parse multistatus response: %v", err)
+	}
+
+	files, err := parseWebDAVFiles(multistatus, "/remote.php/dav/files/user/documents")
+	if err != nil {
+		t.Fatalf("Failed to parse WebDAV files: %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+
+	if files[0].Checksums != "SHA1:ABC SHA256:DEF0" {
+		t.Errorf("Expected checksums to be parsed, got %q", files[0].Checksums)
+	}
+	if files[0].FileID != "4711" {
+		t.Errorf("Expected file ID to be parsed, got %q", files[0].FileID)
+	}
+
+	// A 404 propstat for an unsupported property must not hide the directory
+	if files[1].Name != "subdir" || !files[1].IsDirectory {
+		t.Errorf("Expected directory subdir, got %+v", files[1])
+	}
+}
@@ -0,0 +1,132 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SyncCollectionChange is a resource that changed since a sync token
+type SyncCollectionChange struct {
+	Path string      // Slash-separated path relative to the synchronized collection
+	File *WebDAVFile // Current properties, nil if the resource was removed
+}
+
+// SyncCollectionResult is the outcome of a sync-collection report
+type SyncCollectionResult struct {
+	Token   string // Token to pass to the next SyncCollection call
+	Changes []*SyncCollectionChange
+}
+
+// SyncCollection implements Client.SyncCollection with the RFC 6578 sync-collection
+// REPORT. Truncated results are continued until the server reports all changes.
+func (c *WebDAVClient) SyncCollection(ctx context.Context, dirPath, token string) (*SyncCollectionResult, error) {
+	result := &SyncCollectionResult{Token: token}
+	index := make(map[string]int)
+
+	for {
+		previous := result.Token
+		truncated, err := c.syncCollectionPage(ctx, dirPath, result, index)
+		if err != nil {
+			return nil, err
+		}
+		if !truncated {
+			return result, nil
+		}
+		if result.Token == previous {
+			return nil, fmt.Errorf("sync-collection of %s was truncated without a new sync token", dirPath)
+		}
+	}
+}
+
+// syncCollectionPage requests the changes since result.Token and merges them into
+// result. It reports whether the server truncated the result.
+func (c *WebDAVClient) syncCollectionPage(ctx context.Context, dirPath string, result *SyncCollectionResult, index map[string]int) (bool, error) {
+	collectionURL := c.buildURL(dirPath)
+	parsed, err := url.Parse(collectionURL)
+	if err != nil {
+		return false, fmt.Errorf("invalid URL %s: %w", collectionURL, err)
+	}
+	body := buildSyncCollectionBody(result.Token, GetBasicProperties())
+
+	req, err := c.createRequest(ctx, "REPORT", collectionURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create REPORT request: %w", err)
+	}
+
+	req.Header.Set("Depth", DepthZero)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	setXMLBody(req, body)
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute sync-collection REPORT: %w", err)
+	}
+	defer resp.Body.Close()
+
+	truncated := false
+	token, err := decodeMultistatusWithToken(resp.Body, func(response *Response) error {
+		relPath, ok := relativeHref(parsed.Path, response.Href)
+		if !ok {
+			return nil
+		}
+
+		// The collection itself is only reported when the result is incomplete
+		if relPath == "" {
+			truncated = strings.Contains(response.Status, "507")
+			return nil
+		}
+
+		change := &SyncCollectionChange{Path: relPath}
+		if !strings.Contains(response.Status, "404") {
+			change.File = fileFromResponse(response)
+			if change.File == nil {
+				return nil
+			}
+		}
+
+		if i, exists := index[relPath]; exists {
+			result.Changes[i] = change
+		} else {
+			index[relPath] = len(result.Changes)
+			result.Changes = append(result.Changes, change)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to parse sync-collection response: %w", err)
+	}
+
+	if token == "" {
+		return false, fmt.Errorf("sync-collection response for %s has no sync token", dirPath)
+	}
+	result.Token = token
+
+	return truncated, nil
+}
+
+// buildSyncCollectionBody creates the XML body of a sync-collection REPORT. An empty
+// token requests all resources of the collection.
+func buildSyncCollectionBody(token string, properties []string) string {
+	var body strings.Builder
+	body.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\" ?>\n")
+	body.WriteString("<d:sync-collection " + XMLNSDav + " " + XMLNSOwnCloud + ">\n")
+	if token == "" {
+		body.WriteString("  <d:sync-token/>\n")
+	} else {
+		body.WriteString("  <d:sync-token>")
+		xml.EscapeText(&body, []byte(token))
+		body.WriteString("</d:sync-token>\n")
+	}
+	body.WriteString("  <d:sync-level>infinite</d:sync-level>\n")
+	body.WriteString("  <d:prop>\n")
+	for _, prop := range properties {
+		body.WriteString(fmt.Sprintf("    <%s/>\n", prop))
+	}
+	body.WriteString("  </d:prop>\n")
+	body.WriteString("</d:sync-collection>")
+
+	return body.String()
+}
@@ -0,0 +1,92 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncCollectionServer answers sync-collection reports with one page per token
+type syncCollectionServer struct {
+	pages  map[string]string // Multistatus bodies keyed by the requested token
+	bodies []string
+}
+
+func (s *syncCollectionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+
+	if r.Method != "REPORT" || r.Header.Get("Depth") != DepthZero {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := ""
+	if start := strings.Index(string(body), "<d:sync-token>"); start >= 0 {
+		rest := string(body)[start+len("<d:sync-token>"):]
+		token = rest[:strings.Index(rest, "</d:sync-token>")]
+	}
+
+	page, exists := s.pages[token]
+	if !exists {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns">`+page+`</d:multistatus>`)
+}
+
+// syncResource returns a response element for a resource below the docs collection
+func syncResource(path, status string) string {
+	href := treeServerRoot + "/docs/" + path
+	if status != "" {
+		return fmt.Sprintf(`<d:response><d:href>%s</d:href><d:status>HTTP/1.1 %s</d:status></d:response>`, href, status)
+	}
+	return fmt.Sprintf(`<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getcontentlength>3</d:getcontentlength>`+
+		`<d:getetag>"%s"</d:getetag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, href, path)
+}
+
+func TestWebDAVClient_SyncCollection(t *testing.T) {
+	truncated := `<d:response><d:href>` + treeServerRoot + `/docs/</d:href><d:status>HTTP/1.1 507 Insufficient Storage</d:status></d:response>`
+	handler := &syncCollectionServer{pages: map[string]string{
+		"":                             syncResource("a%20b.txt", "") + syncResource("c.txt", "") + truncated + `<d:sync-token>http://example.com/ns/sync/1</d:sync-token>`,
+		"http://example.com/ns/sync/1": syncResource("c.txt", "404 Not Found") + `<d:sync-token>http://example.com/ns/sync/2</d:sync-token>`,
+		"http://example.com/ns/sync/2": syncResource("d.txt", "") + `<d:sync-token>http://example.com/ns/sync/3</d:sync-token>`,
+	}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	// Truncated results are continued, later entries for a path replace earlier ones
+	result, err := client.SyncCollection(context.Background(), "/docs", "")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/ns/sync/2", result.Token)
+	require.Len(t, result.Changes, 2)
+	assert.Equal(t, "a b.txt", result.Changes[0].Path)
+	require.NotNil(t, result.Changes[0].File)
+	assert.Equal(t, int64(3), result.Changes[0].File.Size)
+	assert.Equal(t, "c.txt", result.Changes[1].Path)
+	assert.Nil(t, result.Changes[1].File)
+	assert.Contains(t, handler.bodies[0], "<d:sync-token/>")
+	assert.Contains(t, handler.bodies[0], "<d:sync-level>infinite</d:sync-level>")
+
+	result, err = client.SyncCollection(context.Background(), "/docs", result.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/ns/sync/3", result.Token)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, "d.txt", result.Changes[0].Path)
+
+	// An unknown token is refused by the server
+	_, err = client.SyncCollection(context.Background(), "/docs", "expired")
+	var webdavErr *WebDAVError
+	require.ErrorAs(t, err, &webdavErr)
+	assert.Equal(t, http.StatusForbidden, webdavErr.StatusCode)
+}
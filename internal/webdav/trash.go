@@ -0,0 +1,171 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashItem is a deleted file or directory in the Nextcloud trashbin
+type TrashItem struct {
+	Name             string    `json:"name"`              // Name in the trashbin, the original name with a deletion suffix such as ".d1700000000"
+	OriginalName     string    `json:"original_name"`     // Name the item had before it was deleted
+	OriginalLocation string    `json:"original_location"` // Path the item had before it was deleted, relative to the user's files
+	DeletionTime     time.Time `json:"deletion_time"`     // When the item was deleted
+	Size             int64     `json:"size"`
+	IsDirectory      bool      `json:"is_directory"`
+	FileID           string    `json:"file_id,omitempty"`
+}
+
+// trashProperties are the properties requested for trashbin listings
+var trashProperties = []string{
+	PropContentLength,
+	PropLastModified,
+	PropResourceType,
+	PropFileID,
+	PropTrashbinFilename,
+	PropTrashbinOriginalLocation,
+	PropTrashbinDeletionTime,
+}
+
+// trashbinURL returns the URL of a path below the trashbin of the current user,
+// e.g. "trash" or "restore"
+func (c *WebDAVClient) trashbinURL(relPath string) (string, error) {
+	davRoot, err := c.davRootURL()
+	if err != nil {
+		return "", err
+	}
+	return davRoot + "/trashbin/" + url.PathEscape(c.auth.GetUsername()) + "/" + relPath, nil
+}
+
+// ListTrash implements Client.ListTrash
+func (c *WebDAVClient) ListTrash(ctx context.Context) ([]*TrashItem, error) {
+	trashURL, err := c.trashbinURL("trash")
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*TrashItem
+	err = c.propfindProperties(ctx, trashURL, DepthOne, trashProperties, func(basePath string, response *Response) error {
+		// Skip the trashbin itself
+		if normalizeHref(response.Href) == normalizeHref(basePath) {
+			return nil
+		}
+
+		if item := trashItemFromResponse(response); item != nil {
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashbin: %w", err)
+	}
+
+	return items, nil
+}
+
+// trashItemFromResponse converts a response of a trashbin listing to a TrashItem.
+// It returns nil if the properties of the item could not be retrieved.
+func trashItemFromResponse(response *Response) *TrashItem {
+	if !strings.Contains(response.Propstat.Status, "200 OK") &&
+		!strings.Contains(response.Status, "200 OK") {
+		return nil
+	}
+
+	prop := &response.Propstat.Prop
+	item := &TrashItem{
+		Name:             extractFileName(normalizeHref(response.Href)),
+		OriginalName:     prop.TrashbinFilename,
+		OriginalLocation: strings.TrimPrefix(prop.TrashbinOriginalLocation, "/"),
+		Size:             prop.ContentLength,
+		IsDirectory:      len(prop.ResourceType.Collection) > 0,
+		FileID:           strings.TrimSpace(prop.FileID),
+	}
+	if item.OriginalName == "" {
+		item.OriginalName = item.Name
+	}
+
+	// Nextcloud reports the deletion time as a Unix timestamp
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(prop.TrashbinDeletionTime), 10, 64); err == nil {
+		item.DeletionTime = time.Unix(seconds, 0)
+	} else if prop.LastModified != "" {
+		if modified, err := parseWebDAVTime(prop.LastModified); err == nil {
+			item.DeletionTime = modified
+		}
+	}
+
+	return item
+}
+
+// RestoreTrashItem implements Client.RestoreTrashItem. The item is restored to its
+// original location.
+func (c *WebDAVClient) RestoreTrashItem(ctx context.Context, name string) error {
+	itemURL, err := c.trashbinURL("trash/" + url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+	restoreURL, err := c.trashbinURL("restore/" + url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+
+	req, err := c.createRequest(ctx, "MOVE", itemURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create MOVE request: %w", err)
+	}
+	req.Header.Set("Destination", restoreURL)
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s from the trashbin: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return NewWebDAVError(resp.StatusCode, name, "MOVE")
+	}
+
+	return nil
+}
+
+// DeleteTrashItem implements Client.DeleteTrashItem
+func (c *WebDAVClient) DeleteTrashItem(ctx context.Context, name string) error {
+	itemURL, err := c.trashbinURL("trash/" + url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+	return c.deleteURL(ctx, itemURL, name)
+}
+
+// EmptyTrash implements Client.EmptyTrash
+func (c *WebDAVClient) EmptyTrash(ctx context.Context) error {
+	trashURL, err := c.trashbinURL("trash")
+	if err != nil {
+		return err
+	}
+	return c.deleteURL(ctx, trashURL, "trash")
+}
+
+// deleteURL sends a DELETE request for a resource outside the user's files
+func (c *WebDAVClient) deleteURL(ctx context.Context, resourceURL, name string) error {
+	req, err := c.createRequest(ctx, "DELETE", resourceURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create DELETE request: %w", err)
+	}
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute DELETE request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return NewWebDAVError(resp.StatusCode, name, "DELETE")
+	}
+
+	return nil
+}
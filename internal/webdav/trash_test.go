@@ -0,0 +1,149 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trashListing is a trashbin listing as Nextcloud sends it
+const trashListing = `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:s="http://sabredav.org/ns" xmlns:oc="http://owncloud.org/ns" xmlns:nc="http://nextcloud.org/ns">
+ <d:response>
+  <d:href>/remote.php/dav/trashbin/testuser/trash/</d:href>
+  <d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+ </d:response>
+ <d:response>
+  <d:href>/remote.php/dav/trashbin/testuser/trash/report%20v2.txt.d1700000000</d:href>
+  <d:propstat><d:prop>
+   <d:getcontentlength>12</d:getcontentlength>
+   <d:resourcetype/>
+   <oc:fileid>42</oc:fileid>
+   <nc:trashbin-filename>report v2.txt</nc:trashbin-filename>
+   <nc:trashbin-original-location>Documents/report v2.txt</nc:trashbin-original-location>
+   <nc:trashbin-deletion-time>1700000000</nc:trashbin-deletion-time>
+  </d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+ </d:response>
+ <d:response>
+  <d:href>/remote.php/dav/trashbin/testuser/trash/Photos.d1700000100/</d:href>
+  <d:propstat><d:prop>
+   <d:resourcetype><d:collection/></d:resourcetype>
+   <nc:trashbin-filename>Photos</nc:trashbin-filename>
+   <nc:trashbin-original-location>Photos</nc:trashbin-original-location>
+   <nc:trashbin-deletion-time>1700000100</nc:trashbin-deletion-time>
+  </d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+ </d:response>
+</d:multistatus>`
+
+// versionListing is a version listing as Nextcloud sends it
+const versionListing = `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns" xmlns:nc="http://nextcloud.org/ns">
+ <d:response>
+  <d:href>/remote.php/dav/versions/testuser/versions/42/</d:href>
+  <d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+ </d:response>
+ <d:response>
+  <d:href>/remote.php/dav/versions/testuser/versions/42/1699990000</d:href>
+  <d:propstat><d:prop>
+   <d:getcontentlength>7</d:getcontentlength>
+   <d:getlastmodified>Tue, 14 Nov 2023 19:26:40 GMT</d:getlastmodified>
+   <d:getetag>"1699990000"</d:getetag>
+   <d:resourcetype/>
+   <nc:version-label>Draft</nc:version-label>
+  </d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+ </d:response>
+</d:multistatus>`
+
+// historyServer serves canned trashbin and version listings and records requests
+type historyServer struct {
+	requests []string
+	bodies   []string
+}
+
+func (s *historyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.EscapedPath(), r.Header.Get("Destination")))
+	s.bodies = append(s.bodies, string(body))
+
+	switch {
+	case r.Method == "PROPFIND" && r.URL.Path == "/remote.php/dav/trashbin/testuser/trash":
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, trashListing)
+	case r.Method == "PROPFIND" && r.URL.Path == treeServerRoot+"/Documents/report.txt":
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns"><d:response>`+
+			`<d:href>`+treeServerRoot+`/Documents/report.txt</d:href><d:propstat><d:prop><d:getcontentlength>9</d:getcontentlength>`+
+			`<oc:fileid>42</oc:fileid><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`)
+	case r.Method == "PROPFIND" && r.URL.Path == "/remote.php/dav/versions/testuser/versions/42":
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, versionListing)
+	case r.Method == "MOVE" || r.Method == "DELETE":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestWebDAVClient_Trash(t *testing.T) {
+	handler := &historyServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+	ctx := context.Background()
+
+	items, err := client.ListTrash(ctx)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, &TrashItem{
+		Name:             "report v2.txt.d1700000000",
+		OriginalName:     "report v2.txt",
+		OriginalLocation: "Documents/report v2.txt",
+		DeletionTime:     time.Unix(1700000000, 0),
+		Size:             12,
+		FileID:           "42",
+	}, items[0])
+	assert.Equal(t, "Photos.d1700000100", items[1].Name)
+	assert.True(t, items[1].IsDirectory)
+	for _, expected := range []string{XMLNSNextcloud, "<nc:trashbin-filename/>", "<nc:trashbin-original-location/>", "<nc:trashbin-deletion-time/>"} {
+		assert.Contains(t, handler.bodies[0], expected)
+	}
+
+	require.NoError(t, client.RestoreTrashItem(ctx, items[0].Name))
+	require.NoError(t, client.DeleteTrashItem(ctx, items[1].Name))
+	require.NoError(t, client.EmptyTrash(ctx))
+
+	assert.Equal(t, []string{
+		"PROPFIND /remote.php/dav/trashbin/testuser/trash ",
+		"MOVE /remote.php/dav/trashbin/testuser/trash/report%20v2.txt.d1700000000 " + server.URL + "/remote.php/dav/trashbin/testuser/restore/report%20v2.txt.d1700000000",
+		"DELETE /remote.php/dav/trashbin/testuser/trash/Photos.d1700000100 ",
+		"DELETE /remote.php/dav/trashbin/testuser/trash ",
+	}, handler.requests)
+}
+
+func TestWebDAVClient_Versions(t *testing.T) {
+	handler := &historyServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+	ctx := context.Background()
+
+	versions, err := client.ListVersions(ctx, "/Documents/report.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, "1699990000", versions[0].Name)
+	assert.Equal(t, "42", versions[0].FileID)
+	assert.Equal(t, "Draft", versions[0].Label)
+	assert.Equal(t, int64(7), versions[0].Size)
+	assert.True(t, versions[0].LastModified.Equal(time.Unix(1699990000, 0)))
+
+	require.NoError(t, client.RestoreVersion(ctx, versions[0]))
+	assert.Equal(t, "MOVE /remote.php/dav/versions/testuser/versions/42/1699990000 "+server.URL+"/remote.php/dav/versions/testuser/restore/target",
+		handler.requests[len(handler.requests)-1])
+}
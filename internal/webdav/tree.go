@@ -0,0 +1,263 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// crawlConcurrency is the number of directories listed in parallel when a tree is crawled
+const crawlConcurrency = 8
+
+// treeListing is a method of listing a whole remote tree
+type treeListing int
+
+const (
+	listingDepthInfinity treeListing = iota // A single PROPFIND with Depth: infinity
+	listingSearch                           // A single DAV:basicsearch SEARCH request
+	listingCrawl                            // One PROPFIND per directory
+)
+
+// TreeFunc is called by ListTree for every resource below the listed directory
+// with its slash-separated path relative to that directory
+type TreeFunc func(relPath string, file *WebDAVFile) error
+
+// ListTree lists all files and directories below dirPath. It sends a single PROPFIND
+// with Depth: infinity where the server allows it, and otherwise falls back to a
+// SEARCH request or to listing every directory with a bounded number of parallel
+// requests. The method that worked is used for later calls. Resources are reported
+// in no particular order, and fn is never called concurrently.
+func (c *WebDAVClient) ListTree(ctx context.Context, dirPath string, fn TreeFunc) error {
+	for {
+		listing := c.treeListing()
+
+		var err error
+		switch listing {
+		case listingDepthInfinity:
+			err = c.listTreeDepthInfinity(ctx, dirPath, fn)
+		case listingSearch:
+			err = c.searchTree(ctx, dirPath, fn)
+		default:
+			return c.crawlTree(ctx, dirPath, fn)
+		}
+
+		if !isUnsupportedListing(err) {
+			return err
+		}
+		c.setTreeListing(listing + 1)
+	}
+}
+
+// treeListing returns the tree listing method to try first
+func (c *WebDAVClient) treeListing() treeListing {
+	c.listingMu.Lock()
+	defer c.listingMu.Unlock()
+	return c.listing
+}
+
+// setTreeListing records that the server does not support the earlier listing methods
+func (c *WebDAVClient) setTreeListing(listing treeListing) {
+	c.listingMu.Lock()
+	defer c.listingMu.Unlock()
+	if listing > c.listing {
+		c.listing = listing
+	}
+}
+
+// isUnsupportedListing reports whether the server refused a listing method as such,
+// as opposed to the listing failing. Other statuses, such as a malformed request or
+// a full server, are errors and must not downgrade the listing method for the session.
+func isUnsupportedListing(err error) bool {
+	var webdavErr *WebDAVError
+	if !errors.As(err, &webdavErr) {
+		return false
+	}
+
+	switch webdavErr.StatusCode {
+	case http.StatusForbidden, http.StatusMethodNotAllowed,
+		http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
+
+// listTreeDepthInfinity lists a tree with a single PROPFIND request
+func (c *WebDAVClient) listTreeDepthInfinity(ctx context.Context, dirPath string, fn TreeFunc) error {
+	return c.propfind(ctx, c.buildURL(dirPath), DepthInfinity, func(basePath string, response *Response) error {
+		return emitTreeResource(basePath, response, fn)
+	})
+}
+
+// searchTree lists a tree with a DAV:basicsearch query on the Nextcloud DAV root
+func (c *WebDAVClient) searchTree(ctx context.Context, dirPath string, fn TreeFunc) error {
+	davRoot, err := c.davRootURL()
+	if err != nil {
+		return err
+	}
+
+	rootURL := c.buildURL(dirPath)
+	parsed, err := url.Parse(rootURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", rootURL, err)
+	}
+	body := buildSearchBody(strings.TrimPrefix(rootURL, davRoot), GetBasicProperties())
+
+	req, err := c.createRequest(ctx, "SEARCH", davRoot+"/", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create SEARCH request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	setXMLBody(req, body)
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute SEARCH request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var callbackErr error
+	err = decodeMultistatus(resp.Body, func(response *Response) error {
+		callbackErr = emitTreeResource(parsed.Path, response, fn)
+		return callbackErr
+	})
+	if callbackErr != nil {
+		return callbackErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse SEARCH response: %w", err)
+	}
+
+	return nil
+}
+
+// buildSearchBody creates the XML body of a SEARCH request for everything below scope,
+// a path relative to the DAV root such as /files/alice/Documents
+func buildSearchBody(scope string, properties []string) string {
+	var scopeBuilder strings.Builder
+	xml.EscapeText(&scopeBuilder, []byte(scope))
+
+	var body strings.Builder
+	body.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\" ?>\n")
+	body.WriteString("<d:searchrequest " + XMLNSDav + " " + XMLNSOwnCloud + ">\n")
+	body.WriteString("  <d:basicsearch>\n")
+	body.WriteString("    <d:select>\n      <d:prop>\n")
+	for _, prop := range properties {
+		body.WriteString(fmt.Sprintf("        <%s/>\n", prop))
+	}
+	body.WriteString("      </d:prop>\n    </d:select>\n")
+	body.WriteString("    <d:from>\n      <d:scope>\n")
+	body.WriteString("        <d:href>" + scopeBuilder.String() + "</d:href>\n")
+	body.WriteString("        <d:depth>infinity</d:depth>\n")
+	body.WriteString("      </d:scope>\n    </d:from>\n")
+	// Every file and directory has a content type, so this matches everything
+	body.WriteString("    <d:where>\n      <d:like>\n")
+	body.WriteString("        <d:prop><d:getcontenttype/></d:prop>\n")
+	body.WriteString("        <d:literal>%</d:literal>\n")
+	body.WriteString("      </d:like>\n    </d:where>\n")
+	body.WriteString("  </d:basicsearch>\n")
+	body.WriteString("</d:searchrequest>")
+
+	return body.String()
+}
+
+// crawlTree lists a tree directory by directory with a bounded number of parallel requests
+func (c *WebDAVClient) crawlTree(ctx context.Context, dirPath string, fn TreeFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex // Serializes fn and guards firstErr
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	slots := make(chan struct{}, crawlConcurrency)
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	var crawl func(relDir string)
+	crawl = func(relDir string) {
+		defer wg.Done()
+
+		fullPath := path.Join(dirPath, relDir)
+		slots <- struct{}{}
+		files, err := c.listCollection(ctx, c.buildURL(fullPath))
+		<-slots
+		if err != nil {
+			fail(fmt.Errorf("failed to list %s: %w", fullPath, err))
+			return
+		}
+
+		for _, file := range files {
+			relPath := path.Join(relDir, file.Name)
+
+			mu.Lock()
+			if firstErr != nil {
+				mu.Unlock()
+				return
+			}
+			err := fn(relPath, file)
+			mu.Unlock()
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			if file.IsDirectory {
+				wg.Add(1)
+				go crawl(relPath)
+			}
+		}
+	}
+
+	wg.Add(1)
+	go crawl("")
+	wg.Wait()
+
+	return firstErr
+}
+
+// emitTreeResource passes a resource of a tree listing to fn, skipping the listed
+// directory itself and resources whose properties could not be retrieved
+func emitTreeResource(rootPath string, response *Response, fn TreeFunc) error {
+	relPath, ok := relativeHref(rootPath, response.Href)
+	if !ok || relPath == "" {
+		return nil
+	}
+
+	file := fileFromResponse(response)
+	if file == nil {
+		return nil
+	}
+
+	return fn(relPath, file)
+}
+
+// relativeHref returns the path of an href relative to rootPath. It reports false
+// for hrefs outside rootPath.
+func relativeHref(rootPath, href string) (string, bool) {
+	root := normalizeHref(rootPath)
+	p := normalizeHref(href)
+
+	if p == root {
+		return "", true
+	}
+	if !strings.HasPrefix(p, root+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, root+"/"), true
+}
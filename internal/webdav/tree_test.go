@@ -0,0 +1,245 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const treeServerRoot = "/remote.php/dav/files/testuser"
+
+// treeServer serves a fixed tree and supports the listing methods that are enabled
+type treeServer struct {
+	mu            sync.Mutex
+	dirs          map[string]bool // Paths below treeServerRoot, true for directories
+	allowInfinity bool
+	allowSearch   bool
+	refusal       int // Status that refuses a Depth: infinity PROPFIND, 403 if not set
+	requests      []string
+	searchBodies  []string
+}
+
+func newTreeServer() *treeServer {
+	return &treeServer{dirs: map[string]bool{
+		"/docs":               true,
+		"/docs/a b.txt":       false,
+		"/docs/sub":           true,
+		"/docs/sub/c.txt":     false,
+		"/docs/sub/deep":      true,
+		"/docs/sub/deep/d.md": false,
+		"/other.txt":          false,
+	}}
+}
+
+func (s *treeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, fmt.Sprintf("%s %s %s", r.Method, r.Header.Get("Depth"), r.URL.Path))
+	if r.Method == "SEARCH" {
+		s.searchBodies = append(s.searchBodies, string(body))
+	}
+	s.mu.Unlock()
+
+	switch r.Method {
+	case "PROPFIND":
+		depth := r.Header.Get("Depth")
+		if depth == DepthInfinity && !s.allowInfinity {
+			refusal := s.refusal
+			if refusal == 0 {
+				refusal = http.StatusForbidden
+			}
+			w.WriteHeader(refusal)
+			return
+		}
+		root := strings.TrimPrefix(strings.TrimRight(r.URL.Path, "/"), treeServerRoot)
+		s.writeMultistatus(w, root, depth == DepthInfinity)
+	case "SEARCH":
+		if !s.allowSearch {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.writeMultistatus(w, "/docs", true)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writeMultistatus lists root and its children, or all of its descendants
+func (s *treeServer) writeMultistatus(w http.ResponseWriter, root string, recursive bool) {
+	var paths []string
+	for p := range s.dirs {
+		if !strings.HasPrefix(p, root+"/") {
+			continue
+		}
+		if recursive || !strings.Contains(strings.TrimPrefix(p, root+"/"), "/") {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns">`)
+	for _, p := range append([]string{root}, paths...) {
+		href := (&url.URL{Path: treeServerRoot + p}).EscapedPath()
+		resourceType := ""
+		if p == root || s.dirs[p] {
+			href += "/"
+			resourceType = "<d:collection/>"
+		}
+		fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop>`+
+			`<d:resourcetype>%s</d:resourcetype><d:getetag>"%s"</d:getetag><oc:fileid>%d</oc:fileid>`+
+			`</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, href, resourceType, p, len(p))
+	}
+	fmt.Fprint(w, `</d:multistatus>`)
+}
+
+// listTree collects the result of ListTree
+func listTree(t *testing.T, client *WebDAVClient) map[string]bool {
+	listed := make(map[string]bool)
+	err := client.ListTree(context.Background(), "/docs", func(relPath string, file *WebDAVFile) error {
+		assert.NotContains(t, listed, relPath)
+		assert.Equal(t, relPath[strings.LastIndex(relPath, "/")+1:], file.Name)
+		listed[relPath] = file.IsDirectory
+		return nil
+	})
+	require.NoError(t, err)
+	return listed
+}
+
+var expectedTree = map[string]bool{
+	"a b.txt":       false,
+	"sub":           true,
+	"sub/c.txt":     false,
+	"sub/deep":      true,
+	"sub/deep/d.md": false,
+}
+
+func TestWebDAVClient_ListTreeDepthInfinity(t *testing.T) {
+	handler := newTreeServer()
+	handler.allowInfinity = true
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	assert.Equal(t, expectedTree, listTree(t, newChunkingClient(t, server)))
+	assert.Equal(t, []string{"PROPFIND infinity " + treeServerRoot + "/docs"}, handler.requests)
+}
+
+func TestWebDAVClient_ListTreeFallsBackToSearch(t *testing.T) {
+	handler := newTreeServer()
+	handler.allowSearch = true
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	assert.Equal(t, expectedTree, listTree(t, client))
+	assert.Equal(t, []string{
+		"PROPFIND infinity " + treeServerRoot + "/docs",
+		"SEARCH  /remote.php/dav/",
+	}, handler.requests)
+	require.Len(t, handler.searchBodies, 1)
+	assert.Contains(t, handler.searchBodies[0], "<d:href>/files/testuser/docs</d:href>")
+	assert.Contains(t, handler.searchBodies[0], "<oc:fileid/>")
+
+	// The refused method is not tried again
+	handler.requests = nil
+	assert.Equal(t, expectedTree, listTree(t, client))
+	assert.Equal(t, []string{"SEARCH  /remote.php/dav/"}, handler.requests)
+}
+
+func TestWebDAVClient_ListTreeFailureKeepsListingMethod(t *testing.T) {
+	handler := newTreeServer()
+	handler.allowSearch = true
+	handler.refusal = http.StatusInsufficientStorage
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	err := client.ListTree(context.Background(), "/docs", func(relPath string, file *WebDAVFile) error {
+		return nil
+	})
+	var webdavErr *WebDAVError
+	require.ErrorAs(t, err, &webdavErr)
+	assert.Equal(t, http.StatusInsufficientStorage, webdavErr.StatusCode)
+
+	// Once the server recovers the tree is listed with a single request again
+	handler.requests = nil
+	handler.allowInfinity = true
+	assert.Equal(t, expectedTree, listTree(t, client))
+	assert.Equal(t, []string{"PROPFIND infinity " + treeServerRoot + "/docs"}, handler.requests)
+}
+
+func TestIsUnsupportedListing(t *testing.T) {
+	for status, unsupported := range map[int]bool{
+		http.StatusBadRequest:           false,
+		http.StatusForbidden:            true,
+		http.StatusNotFound:             false,
+		http.StatusMethodNotAllowed:     true,
+		http.StatusUnsupportedMediaType: true,
+		http.StatusUnprocessableEntity:  false,
+		http.StatusNotImplemented:       true,
+		http.StatusInsufficientStorage:  false,
+	} {
+		err := fmt.Errorf("listing: %w", &WebDAVError{StatusCode: status})
+		assert.Equal(t, unsupported, isUnsupportedListing(err), "status %d", status)
+	}
+	assert.False(t, isUnsupportedListing(fmt.Errorf("connection reset")))
+}
+
+func TestWebDAVClient_ListTreeCrawls(t *testing.T) {
+	handler := newTreeServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	assert.Equal(t, expectedTree, listTree(t, newChunkingClient(t, server)))
+	assert.ElementsMatch(t, []string{
+		"PROPFIND infinity " + treeServerRoot + "/docs",
+		"SEARCH  /remote.php/dav/",
+		"PROPFIND 1 " + treeServerRoot + "/docs",
+		"PROPFIND 1 " + treeServerRoot + "/docs/sub",
+		"PROPFIND 1 " + treeServerRoot + "/docs/sub/deep",
+	}, handler.requests)
+}
+
+func TestWebDAVClient_ListTreeStopsOnCallbackError(t *testing.T) {
+	handler := newTreeServer()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := newChunkingClient(t, server)
+
+	stop := fmt.Errorf("stop")
+	err := client.ListTree(context.Background(), "/docs", func(relPath string, file *WebDAVFile) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestDecodeMultistatus_Streams(t *testing.T) {
+	xmlData := `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response><d:href>/a</d:href></d:response>
+  <d:sync-token>ignored</d:sync-token>
+  <d:response><d:href>/b</d:href></d:response>
+</d:multistatus>`
+
+	var hrefs []string
+	err := decodeMultistatus(strings.NewReader(xmlData), func(response *Response) error {
+		hrefs = append(hrefs, response.Href)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/a", "/b"}, hrefs)
+
+	err = decodeMultistatus(strings.NewReader("<html></html>"), func(*Response) error { return nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FileVersion is an earlier version of a file kept by the Nextcloud versions app
+type FileVersion struct {
+	Name         string    `json:"name"`            // Version ID, the modification time of the version as a Unix timestamp
+	FileID       string    `json:"file_id"`         // ID of the file the version belongs to
+	Label        string    `json:"label,omitempty"` // Label given to the version in the web interface, if any
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+}
+
+// versionProperties are the properties requested for version listings
+var versionProperties = []string{
+	PropContentLength,
+	PropLastModified,
+	PropETag,
+	PropContentType,
+	PropResourceType,
+	PropVersionLabel,
+}
+
+// versionsURL returns the URL of a path below the versions root of the current
+// user, e.g. "versions/<fileid>" or "restore"
+func (c *WebDAVClient) versionsURL(relPath string) (string, error) {
+	davRoot, err := c.davRootURL()
+	if err != nil {
+		return "", err
+	}
+	return davRoot + "/versions/" + url.PathEscape(c.auth.GetUsername()) + "/" + relPath, nil
+}
+
+// ListVersions implements Client.ListVersions. The versions are looked up by the
+// file ID of the file at filePath.
+func (c *WebDAVClient) ListVersions(ctx context.Context, filePath string) ([]*FileVersion, error) {
+	properties, err := c.GetProperties(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if properties.IsDirectory {
+		return nil, fmt.Errorf("%s is a directory, only files have versions", filePath)
+	}
+	if properties.FileID == "" {
+		return nil, fmt.Errorf("server reported no file ID for %s", filePath)
+	}
+
+	fileURL, err := c.versionsURL("versions/" + url.PathEscape(properties.FileID))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*FileVersion
+	err = c.propfindProperties(ctx, fileURL, DepthOne, versionProperties, func(basePath string, response *Response) error {
+		// Skip the version collection itself
+		if normalizeHref(response.Href) == normalizeHref(basePath) {
+			return nil
+		}
+
+		if file := fileFromResponse(response); file != nil && !file.IsDirectory {
+			versions = append(versions, &FileVersion{
+				Name:         file.Name,
+				FileID:       properties.FileID,
+				Label:        strings.TrimSpace(response.Propstat.Prop.VersionLabel),
+				Size:         file.Size,
+				LastModified: file.LastModified,
+				ETag:         file.ETag,
+				ContentType:  file.ContentType,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s: %w", filePath, err)
+	}
+
+	return versions, nil
+}
+
+// RestoreVersion implements Client.RestoreVersion. The current content of the
+// file becomes a version itself, so a restore can be undone.
+func (c *WebDAVClient) RestoreVersion(ctx context.Context, version *FileVersion) error {
+	versionURL, err := c.versionsURL("versions/" + url.PathEscape(version.FileID) + "/" + url.PathEscape(version.Name))
+	if err != nil {
+		return err
+	}
+	restoreURL, err := c.versionsURL("restore/target")
+	if err != nil {
+		return err
+	}
+
+	req, err := c.createRequest(ctx, "MOVE", versionURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create MOVE request: %w", err)
+	}
+	req.Header.Set("Destination", restoreURL)
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to restore version %s: %w", version.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return NewWebDAVError(resp.StatusCode, version.Name, "MOVE")
+	}
+
+	return nil
+}
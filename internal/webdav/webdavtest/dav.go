@@ -0,0 +1,587 @@
+package webdavtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serveHTTP routes a request after recording it and applying matching faults
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.Method]++
+	fault := s.matchFault(r)
+	s.mu.Unlock()
+
+	if fault != nil && !fault.apply(w, r) {
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/" || r.URL.Path == "/status.php":
+		s.serveStatus(w, r)
+	case strings.HasPrefix(r.URL.Path, loginFlowPrefix):
+		s.serveLoginFlow(w, r)
+	case strings.HasPrefix(r.URL.Path, oauth2Prefix+"/"):
+		s.serveOAuth2(w, r)
+	case strings.HasPrefix(r.URL.Path, "/ocs/"):
+		if s.authenticate(w, r) {
+			s.serveOCS(w, r)
+		}
+	case strings.HasPrefix(r.URL.Path+"/", davPrefix):
+		// OPTIONS is used to discover the endpoint before logging in
+		if r.Method == http.MethodOptions || s.authenticate(w, r) {
+			s.serveDAV(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authenticate checks the credentials of a request and responds with 401 if they are wrong
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if ok && username == s.Username && password == s.Password {
+		return true
+	}
+	if ok && username == s.Username && s.isAppPassword(password) {
+		return true
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != r.Header.Get("Authorization") && s.isAccessToken(token) {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="Nextcloud", charset="UTF-8"`)
+	writeDAVError(w, http.StatusUnauthorized, `Sabre\DAV\Exception\NotAuthenticated`, "No public access to this resource.")
+	return false
+}
+
+// serveDAV handles a request below the DAV root
+func (s *Server) serveDAV(w http.ResponseWriter, r *http.Request) {
+	davPath := strings.Trim(strings.TrimPrefix(r.URL.Path+"/", davPrefix), "/")
+
+	// Nextcloud greets browsers on the DAV root, clients use this to check credentials
+	if davPath == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "This is the WebDAV interface. It can only be accessed by WebDAV clients such as the Nextcloud desktop sync client.\n")
+		return
+	}
+
+	switch {
+	case davPath == s.trashRoot()+"/trash" || strings.HasPrefix(davPath, s.trashRoot()+"/trash/"):
+		s.serveTrashbin(w, r, davPath)
+		return
+	case strings.HasPrefix(davPath, s.versionsRoot()+"/versions/"):
+		s.serveVersions(w, r, davPath)
+		return
+	}
+
+	if r.Method != http.MethodOptions && !s.accessible(davPath) {
+		writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\Forbidden`, "Access to "+davPath+" is not allowed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1, 3, extended-mkcol")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, DELETE, PROPFIND, PUT, MKCOL, MOVE, COPY, REPORT")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		s.propfind(w, r, davPath)
+	case http.MethodGet, http.MethodHead:
+		s.get(w, r, davPath)
+	case http.MethodPut:
+		s.putFile(w, r, davPath)
+	case "MKCOL":
+		s.mkcol(w, davPath)
+	case http.MethodDelete:
+		s.delete(w, davPath)
+	case "MOVE", "COPY":
+		s.moveOrCopy(w, r, davPath)
+	case "REPORT":
+		s.report(w, r, davPath)
+	default:
+		writeDAVError(w, http.StatusMethodNotAllowed, `Sabre\DAV\Exception\MethodNotAllowed`, r.Method+" is not supported")
+	}
+}
+
+// accessible reports whether a DAV path belongs to the user's files or uploads
+func (s *Server) accessible(davPath string) bool {
+	for _, root := range []string{s.filesRoot(), s.uploadsRoot()} {
+		if davPath == root || strings.HasPrefix(davPath, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// propfind lists the properties of a resource and, depending on the Depth header,
+// of its descendants
+func (s *Server) propfind(w http.ResponseWriter, r *http.Request, davPath string) {
+	io.Copy(io.Discard, r.Body)
+
+	depth := r.Header.Get("Depth")
+	if depth == "" {
+		depth = "infinity"
+	}
+	if depth != "0" && depth != "1" && depth != "infinity" {
+		writeDAVError(w, http.StatusBadRequest, `Sabre\DAV\Exception\BadRequest`, "Invalid Depth header "+depth)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, exists := s.nodes[davPath]
+	if !exists {
+		writeNotFound(w, davPath)
+		return
+	}
+
+	responses := []string{propResponse(davPath, n)}
+	if n.isDir && depth == "1" {
+		for _, child := range s.children(davPath) {
+			responses = append(responses, propResponse(child, s.nodes[child]))
+		}
+	} else if n.isDir && depth == "infinity" {
+		for _, p := range sortedPaths(s.subtree(davPath)) {
+			if p != davPath {
+				responses = append(responses, propResponse(p, s.nodes[p]))
+			}
+		}
+	}
+
+	writeMultistatus(w, responses, "")
+}
+
+// get sends the content of a file, honoring Range and If-Range headers
+func (s *Server) get(w http.ResponseWriter, r *http.Request, davPath string) {
+	s.mu.Lock()
+	n, exists := s.nodes[davPath]
+	if !exists {
+		s.mu.Unlock()
+		writeNotFound(w, davPath)
+		return
+	}
+	if n.isDir {
+		s.mu.Unlock()
+		writeDAVError(w, http.StatusMethodNotAllowed, `Sabre\DAV\Exception\MethodNotAllowed`, "Collections cannot be downloaded")
+		return
+	}
+	content, modified := n.content, n.modified
+	setResourceHeaders(w, n)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", contentType(davPath))
+	http.ServeContent(w, r, path.Base(davPath), modified, bytes.NewReader(content))
+}
+
+// putFile stores an uploaded file or chunk
+func (s *Server) putFile(w http.ResponseWriter, r *http.Request, davPath string) {
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeDAVError(w, http.StatusBadRequest, `Sabre\DAV\Exception\BadRequest`, "Failed to read the request body")
+		return
+	}
+	if r.ContentLength >= 0 && int64(len(content)) != r.ContentLength {
+		writeDAVError(w, http.StatusBadRequest, `Sabre\DAV\Exception\BadRequest`, "Expected filesize doesn't match the received size")
+		return
+	}
+
+	modified, mtimeSet := requestMtime(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.nodes[davPath]
+	if exists && existing.isDir {
+		writeDAVError(w, http.StatusMethodNotAllowed, `Sabre\DAV\Exception\MethodNotAllowed`, "A collection exists at "+davPath)
+		return
+	}
+	if !s.isDirectory(parentPath(davPath)) {
+		writeDAVError(w, http.StatusConflict, `Sabre\DAV\Exception\Conflict`, "Parent of "+davPath+" does not exist")
+		return
+	}
+
+	s.writeFile(davPath, content, modified, r.Header.Get("OC-Checksum"))
+	setResourceHeaders(w, s.nodes[davPath])
+	if mtimeSet {
+		w.Header().Set("X-OC-MTime", "accepted")
+	}
+	writeCreated(w, exists)
+}
+
+// mkcol creates a directory
+func (s *Server) mkcol(w http.ResponseWriter, davPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.nodes[davPath]; exists {
+		writeDAVError(w, http.StatusMethodNotAllowed, `Sabre\DAV\Exception\MethodNotAllowed`, "The resource you tried to create already exists")
+		return
+	}
+	if !s.isDirectory(parentPath(davPath)) {
+		writeDAVError(w, http.StatusConflict, `Sabre\DAV\Exception\Conflict`, "Parent node does not exist")
+		return
+	}
+
+	s.put(davPath, &node{isDir: true, modified: time.Now().Truncate(time.Second)})
+	setResourceHeaders(w, s.nodes[davPath])
+	w.WriteHeader(http.StatusCreated)
+}
+
+// delete removes a file or directory with its contents, the user's files are
+// moved to the trashbin
+func (s *Server) delete(w http.ResponseWriter, davPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if davPath == s.filesRoot() || davPath == s.uploadsRoot() {
+		writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\Forbidden`, "The root cannot be deleted")
+		return
+	}
+	if _, exists := s.nodes[davPath]; !exists {
+		writeNotFound(w, davPath)
+		return
+	}
+
+	if strings.HasPrefix(davPath, s.filesRoot()+"/") {
+		s.moveToTrash(davPath)
+	}
+	s.remove(davPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moveOrCopy moves or copies a resource to the Destination header. Moving the
+// .file resource of an upload directory assembles the uploaded chunks.
+func (s *Server) moveOrCopy(w http.ResponseWriter, r *http.Request, davPath string) {
+	destination, err := s.destination(r)
+	if err != nil {
+		writeDAVError(w, http.StatusBadRequest, `Sabre\DAV\Exception\BadRequest`, err.Error())
+		return
+	}
+	if !s.accessible(destination) {
+		writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\Forbidden`, "Access to "+destination+" is not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == "MOVE" && path.Base(davPath) == ".file" && parentPath(parentPath(davPath)) == s.uploadsRoot() {
+		s.assemble(w, r, parentPath(davPath), destination)
+		return
+	}
+
+	if _, exists := s.nodes[davPath]; !exists {
+		writeNotFound(w, davPath)
+		return
+	}
+	if destination == davPath || strings.HasPrefix(destination, davPath+"/") {
+		writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\Forbidden`, "Source and destination overlap")
+		return
+	}
+
+	destinationExists, ok := s.prepareDestination(w, r, destination)
+	if !ok {
+		return
+	}
+
+	source := s.subtree(davPath)
+	for _, p := range sortedPaths(source) {
+		copied := *source[p]
+		if r.Method == "COPY" {
+			copied.fileID = 0
+		}
+		s.put(destination+strings.TrimPrefix(p, davPath), &copied)
+	}
+	if r.Method == "MOVE" {
+		s.remove(davPath)
+	}
+
+	writeCreated(w, destinationExists)
+}
+
+// assemble concatenates the chunks of an upload directory in name order into the
+// destination file and removes the upload directory. The caller holds s.mu.
+func (s *Server) assemble(w http.ResponseWriter, r *http.Request, uploadDir, destination string) {
+	if !s.isDirectory(uploadDir) {
+		writeNotFound(w, uploadDir)
+		return
+	}
+
+	var content []byte
+	for _, chunk := range s.children(uploadDir) {
+		content = append(content, s.nodes[chunk].content...)
+	}
+
+	if total := r.Header.Get("OC-Total-Length"); total != "" {
+		if length, err := strconv.ParseInt(total, 10, 64); err != nil || length != int64(len(content)) {
+			writeDAVError(w, http.StatusBadRequest, `Sabre\DAV\Exception\BadRequest`,
+				fmt.Sprintf("Expected %s bytes but the chunks hold %d", total, len(content)))
+			return
+		}
+	}
+
+	destinationExists, ok := s.prepareDestination(w, r, destination)
+	if !ok {
+		return
+	}
+
+	modified, _ := requestMtime(r)
+	s.writeFile(destination, content, modified, r.Header.Get("OC-Checksum"))
+	s.remove(uploadDir)
+
+	setResourceHeaders(w, s.nodes[destination])
+	writeCreated(w, destinationExists)
+}
+
+// prepareDestination checks the parent of a MOVE or COPY destination and clears
+// an existing destination if the Overwrite header allows it. It reports whether
+// the destination existed and whether the request may go on. The caller holds s.mu.
+func (s *Server) prepareDestination(w http.ResponseWriter, r *http.Request, destination string) (bool, bool) {
+	if !s.isDirectory(parentPath(destination)) {
+		writeDAVError(w, http.StatusConflict, `Sabre\DAV\Exception\Conflict`, "The destination node is not found")
+		return false, false
+	}
+
+	existing, exists := s.nodes[destination]
+	if exists {
+		if strings.EqualFold(r.Header.Get("Overwrite"), "F") {
+			writeDAVError(w, http.StatusPreconditionFailed, `Sabre\DAV\Exception\PreconditionFailed`, "The destination node already exists")
+			return true, false
+		}
+		if existing.isDir {
+			s.remove(destination)
+		}
+	}
+
+	return exists, true
+}
+
+// destination returns the DAV path of the Destination header of a request
+func (s *Server) destination(r *http.Request) (string, error) {
+	header := r.Header.Get("Destination")
+	if header == "" {
+		return "", fmt.Errorf("the Destination header is missing")
+	}
+
+	parsed, err := url.Parse(header)
+	if err != nil {
+		return "", fmt.Errorf("invalid Destination header %q: %w", header, err)
+	}
+	if !strings.HasPrefix(parsed.Path, davPrefix) {
+		return "", fmt.Errorf("destination %s is outside the DAV root", parsed.Path)
+	}
+
+	return strings.Trim(path.Clean("/"+strings.TrimPrefix(parsed.Path, davPrefix)), "/"), nil
+}
+
+// syncCollectionRequest is the body of a sync-collection REPORT
+type syncCollectionRequest struct {
+	XMLName xml.Name
+	Token   string `xml:"sync-token"`
+}
+
+// report answers a sync-collection REPORT with the resources below a directory that
+// changed since the sync token, including removed ones
+func (s *Server) report(w http.ResponseWriter, r *http.Request, davPath string) {
+	var request syncCollectionRequest
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeDAVError(w, http.StatusBadRequest, `Sabre\DAV\Exception\BadRequest`, "Invalid REPORT body")
+		return
+	}
+	if request.XMLName.Local != "sync-collection" {
+		writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\ReportNotSupported`, "The "+request.XMLName.Local+" report is not supported")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var since int64
+	if token := strings.TrimSpace(request.Token); token != "" {
+		version, err := strconv.ParseInt(strings.TrimPrefix(token, syncTokenPrefix), 10, 64)
+		if err != nil || !strings.HasPrefix(token, syncTokenPrefix) || version > s.version {
+			writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\InvalidSyncToken`, "Invalid or unknown sync token")
+			return
+		}
+		since = version
+	}
+
+	if !s.isDirectory(davPath) {
+		writeNotFound(w, davPath)
+		return
+	}
+
+	changes := make(map[string]string)
+	for p, n := range s.subtree(davPath) {
+		if p != davPath && n.version > since {
+			changes[p] = propResponse(p, n)
+		}
+	}
+	if since > 0 {
+		for p, version := range s.tombstones {
+			if version > since && strings.HasPrefix(p, davPath+"/") {
+				changes[p] = removedResponse(p)
+			}
+		}
+	}
+
+	var responses []string
+	for _, p := range sortedKeys(changes) {
+		responses = append(responses, changes[p])
+	}
+	writeMultistatus(w, responses, syncTokenPrefix+strconv.FormatInt(s.version, 10))
+}
+
+// isDirectory reports whether a directory exists at a DAV path, the caller holds s.mu
+func (s *Server) isDirectory(davPath string) bool {
+	n, exists := s.nodes[davPath]
+	return exists && n.isDir
+}
+
+// requestMtime returns the modification time sent in the X-OC-MTime header
+func requestMtime(r *http.Request) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(r.Header.Get("X-OC-MTime"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// setResourceHeaders sets the ETag and file ID headers Nextcloud sends for a resource
+func setResourceHeaders(w http.ResponseWriter, n *node) {
+	w.Header().Set("ETag", n.etag())
+	w.Header().Set("OC-ETag", n.etag())
+	w.Header().Set("OC-FileId", fmt.Sprintf("%08d", n.fileID))
+}
+
+// writeCreated responds with 204 if a resource was replaced and 201 if it is new
+func writeCreated(w http.ResponseWriter, replaced bool) {
+	if replaced {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// contentType guesses the content type of a file from its extension
+func contentType(p string) string {
+	if mimeType := mime.TypeByExtension(path.Ext(p)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// href returns the escaped URL path of a DAV path, collections end with a slash
+func href(davPath string, isDir bool) string {
+	escaped := (&url.URL{Path: davPrefix + davPath}).EscapedPath()
+	if isDir {
+		escaped += "/"
+	}
+	return escaped
+}
+
+// propResponse renders the properties of a resource as a multistatus response element
+func propResponse(davPath string, n *node) string {
+	var b strings.Builder
+	b.WriteString(" <d:response>\n")
+	b.WriteString("  <d:href>" + escapeXML(href(davPath, n.isDir)) + "</d:href>\n")
+	b.WriteString("  <d:propstat>\n   <d:prop>\n")
+	b.WriteString("    <d:displayname>" + escapeXML(path.Base(davPath)) + "</d:displayname>\n")
+	b.WriteString("    <d:getlastmodified>" + n.modified.UTC().Format(http.TimeFormat) + "</d:getlastmodified>\n")
+	b.WriteString("    <d:getetag>" + escapeXML(n.etag()) + "</d:getetag>\n")
+	b.WriteString(fmt.Sprintf("    <oc:fileid>%d</oc:fileid>\n", n.fileID))
+	if n.isDir {
+		b.WriteString("    <d:resourcetype><d:collection/></d:resourcetype>\n")
+	} else {
+		b.WriteString("    <d:resourcetype/>\n")
+		b.WriteString(fmt.Sprintf("    <d:getcontentlength>%d</d:getcontentlength>\n", len(n.content)))
+		b.WriteString("    <d:getcontenttype>" + escapeXML(contentType(davPath)) + "</d:getcontenttype>\n")
+		if n.checksum != "" {
+			b.WriteString("    <oc:checksums><oc:checksum>" + escapeXML(n.checksum) + "</oc:checksum></oc:checksums>\n")
+		}
+	}
+	b.WriteString("   </d:prop>\n   <d:status>HTTP/1.1 200 OK</d:status>\n  </d:propstat>\n")
+	b.WriteString(" </d:response>\n")
+	return b.String()
+}
+
+// removedResponse renders a removed resource of a sync-collection report
+func removedResponse(davPath string) string {
+	return " <d:response>\n  <d:href>" + escapeXML(href(davPath, false)) + "</d:href>\n" +
+		"  <d:status>HTTP/1.1 404 Not Found</d:status>\n </d:response>\n"
+}
+
+// writeMultistatus writes a 207 response with the given response elements and,
+// for sync-collection reports, a sync token
+func writeMultistatus(w http.ResponseWriter, responses []string, syncToken string) {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	b.WriteString("<d:multistatus xmlns:d=\"DAV:\" xmlns:s=\"http://sabredav.org/ns\" xmlns:oc=\"http://owncloud.org/ns\" xmlns:nc=\"http://nextcloud.org/ns\">\n")
+	for _, response := range responses {
+		b.WriteString(response)
+	}
+	if syncToken != "" {
+		b.WriteString(" <d:sync-token>" + escapeXML(syncToken) + "</d:sync-token>\n")
+	}
+	b.WriteString("</d:multistatus>\n")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// writeNotFound responds with 404 for a missing resource
+func writeNotFound(w http.ResponseWriter, davPath string) {
+	writeDAVError(w, http.StatusNotFound, `Sabre\DAV\Exception\NotFound`, "File with name "+davPath+" could not be located")
+}
+
+// writeDAVError writes a Sabre-style XML error body with a status code
+func writeDAVError(w http.ResponseWriter, status int, exception, message string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n"+
+		"<d:error xmlns:d=\"DAV:\" xmlns:s=\"http://sabredav.org/ns\">\n"+
+		"  <s:exception>"+escapeXML(exception)+"</s:exception>\n"+
+		"  <s:message>"+escapeXML(message)+"</s:message>\n"+
+		"</d:error>\n")
+}
+
+// escapeXML escapes text for use in XML content
+func escapeXML(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// sortedPaths returns the keys of a node map in lexical order
+func sortedPaths(nodes map[string]*node) []string {
+	paths := make([]string, 0, len(nodes))
+	for p := range nodes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sortedKeys returns the keys of a string map in lexical order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package webdavtest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault makes the server misbehave for matching requests. A fault with only a
+// latency delays the request and then handles it normally.
+type Fault struct {
+	Method  string        // Request method to match, empty matches every method
+	Path    string        // Substring of the request URL path to match, empty matches every path
+	Status  int           // Status code to respond with instead of handling the request
+	Latency time.Duration // Delay before the request is answered
+	Drop    bool          // Close the connection without sending a response
+	Count   int           // Number of requests the fault applies to, 0 for all of them
+}
+
+// Common faults of a Nextcloud server
+var (
+	// ServerError is an internal server error, which clients should retry
+	ServerError = Fault{Status: http.StatusInternalServerError}
+
+	// Unavailable is returned by Nextcloud in maintenance mode
+	Unavailable = Fault{Status: http.StatusServiceUnavailable}
+
+	// Locked is returned for files locked by another client
+	Locked = Fault{Status: http.StatusLocked}
+
+	// QuotaExceeded is returned for uploads exceeding the user's quota
+	QuotaExceeded = Fault{Status: http.StatusInsufficientStorage}
+
+	// Dropped closes the connection, as a crashing proxy would
+	Dropped = Fault{Drop: true}
+)
+
+// faultExceptions are the Sabre exceptions Nextcloud reports for fault status codes
+var faultExceptions = map[int]string{
+	http.StatusLocked:              `OCA\DAV\Connector\Sabre\Exception\FileLocked`,
+	http.StatusInsufficientStorage: `Sabre\DAV\Exception\InsufficientStorage`,
+	http.StatusServiceUnavailable:  `Sabre\DAV\Exception\ServiceUnavailable`,
+}
+
+// On returns a copy of the fault that only matches requests with a method and a
+// substring of the URL path, either may be empty to match everything
+func (f Fault) On(method, path string) Fault {
+	f.Method = method
+	f.Path = path
+	return f
+}
+
+// Times returns a copy of the fault that applies to the next count matching requests
+func (f Fault) Times(count int) Fault {
+	f.Count = count
+	return f
+}
+
+// AddFault adds a fault, faults are matched in the order they were added
+func (s *Server) AddFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// matchFault returns the first fault matching a request and uses it up, the
+// caller holds s.mu
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for i, fault := range s.faults {
+		if fault.Method != "" && fault.Method != r.Method {
+			continue
+		}
+		if fault.Path != "" && !strings.Contains(r.URL.Path, fault.Path) {
+			continue
+		}
+
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+// apply applies a fault to a request. It reports whether the request should still
+// be handled.
+func (f *Fault) apply(w http.ResponseWriter, r *http.Request) bool {
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return false
+		}
+	}
+
+	if f.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return false
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if f.Status != 0 {
+		exception, ok := faultExceptions[f.Status]
+		if !ok {
+			exception = `Sabre\DAV\Exception`
+		}
+		writeDAVError(w, f.Status, exception, "Injected fault: "+http.StatusText(f.Status))
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,98 @@
+package webdavtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// loginFlowPrefix is the path of Login Flow v2
+const loginFlowPrefix = "/index.php/login/v2"
+
+// loginFlow is a pending Login Flow v2
+type loginFlow struct {
+	loginToken string
+	granted    bool
+	userAgent  string // Nextcloud names the app password after the client
+}
+
+// randomToken returns a random hex string of n bytes
+func randomToken(n int) string {
+	token := make([]byte, n)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// AppPasswords returns the names of the app passwords granted through Login
+// Flow v2, which are the user agents of the clients that requested them
+func (s *Server) AppPasswords() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.appPasswords))
+	for _, name := range s.appPasswords {
+		names = append(names, name)
+	}
+	return names
+}
+
+// serveLoginFlow answers Login Flow v2, which needs no authentication. Opening the
+// login URL stands in for the user logging in and granting access.
+func (s *Server) serveLoginFlow(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoint := strings.TrimPrefix(r.URL.Path, loginFlowPrefix)
+	switch {
+	case endpoint == "" && r.Method == http.MethodPost:
+		pollToken := randomToken(32)
+		flow := &loginFlow{loginToken: randomToken(32), userAgent: r.UserAgent()}
+		s.loginFlows[pollToken] = flow
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"poll": map[string]interface{}{
+				"token":    pollToken,
+				"endpoint": s.URL + loginFlowPrefix + "/poll",
+			},
+			"login": s.URL + loginFlowPrefix + "/flow/" + flow.loginToken,
+		})
+	case strings.HasPrefix(endpoint, "/flow/") && r.Method == http.MethodGet:
+		for _, flow := range s.loginFlows {
+			if flow.loginToken == strings.TrimPrefix(endpoint, "/flow/") {
+				flow.granted = true
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte("<html><body>Account connected</body></html>"))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case endpoint == "/poll" && r.Method == http.MethodPost:
+		r.ParseForm()
+		flow, exists := s.loginFlows[r.PostForm.Get("token")]
+		if !exists || !flow.granted {
+			writeJSON(w, http.StatusNotFound, []interface{}{})
+			return
+		}
+
+		// The credentials are handed out only once
+		delete(s.loginFlows, r.PostForm.Get("token"))
+		appPassword := randomToken(36)
+		s.appPasswords[appPassword] = flow.userAgent
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"server":      s.URL,
+			"loginName":   s.Username,
+			"appPassword": appPassword,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// isAppPassword reports whether password was granted through Login Flow v2
+func (s *Server) isAppPassword(password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.appPasswords[password]
+	return exists
+}
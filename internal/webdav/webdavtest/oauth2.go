@@ -0,0 +1,132 @@
+package webdavtest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oauth2Prefix is the path of the Nextcloud oauth2 app
+const oauth2Prefix = "/index.php/apps/oauth2"
+
+// defaultAccessTokenLifetime is how long access tokens are valid, as in Nextcloud
+const defaultAccessTokenLifetime = time.Hour
+
+// oauth2Client is an OAuth2 client registered in the oauth2 app
+type oauth2Client struct {
+	secret      string
+	redirectURL string
+}
+
+// RegisterOAuth2Client registers an OAuth2 client, as an administrator does in the
+// security settings of Nextcloud
+func (s *Server) RegisterOAuth2Client(clientID, secret, redirectURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.oauth2Clients[clientID] = &oauth2Client{secret: secret, redirectURL: redirectURL}
+}
+
+// SetAccessTokenLifetime sets how long access tokens handed out from now on are valid
+func (s *Server) SetAccessTokenLifetime(lifetime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessTokenLifetime = lifetime
+}
+
+// RevokeAccessTokens invalidates all access tokens, refresh tokens stay valid
+func (s *Server) RevokeAccessTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessTokens = make(map[string]time.Time)
+}
+
+// TokenRefreshes returns how often an access token was renewed with a refresh token
+func (s *Server) TokenRefreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokenRefreshes
+}
+
+// serveOAuth2 answers the authorization and token endpoints of the oauth2 app.
+// Opening the authorization page stands in for the user logging in and granting
+// access, it redirects to the client right away.
+func (s *Server) serveOAuth2(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch endpoint := strings.TrimPrefix(r.URL.Path, oauth2Prefix); {
+	case endpoint == "/authorize" && r.Method == http.MethodGet:
+		query := r.URL.Query()
+		client, exists := s.oauth2Clients[query.Get("client_id")]
+		if !exists || query.Get("response_type") != "code" || query.Get("redirect_uri") != client.redirectURL {
+			http.Error(w, "Your client is not authorized to connect. Please inform the administrator of your client.", http.StatusBadRequest)
+			return
+		}
+
+		code := randomToken(32)
+		s.oauth2Codes[code] = query.Get("client_id")
+		redirect, _ := url.Parse(client.redirectURL)
+		redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	case endpoint == "/api/v1/token" && r.Method == http.MethodPost:
+		r.ParseForm()
+		clientID, secret, ok := r.BasicAuth()
+		if !ok {
+			clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		client, exists := s.oauth2Clients[clientID]
+		if !exists || client.secret != secret {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			code := r.PostForm.Get("code")
+			if s.oauth2Codes[code] != clientID {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			delete(s.oauth2Codes, code)
+		case "refresh_token":
+			// Refresh tokens are rotated, each can be used once
+			refreshToken := r.PostForm.Get("refresh_token")
+			if s.refreshTokens[refreshToken] != clientID {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			delete(s.refreshTokens, refreshToken)
+			s.tokenRefreshes++
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		accessToken, refreshToken := randomToken(32), randomToken(32)
+		s.accessTokens[accessToken] = time.Now().Add(s.accessTokenLifetime)
+		s.refreshTokens[refreshToken] = clientID
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token":  accessToken,
+			"token_type":    "Bearer",
+			"expires_in":    int64(s.accessTokenLifetime / time.Second),
+			"refresh_token": refreshToken,
+			"user_id":       s.Username,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// isAccessToken reports whether token is a valid OAuth2 access token
+func (s *Server) isAccessToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, exists := s.accessTokens[token]
+	return exists && time.Now().Before(expiry)
+}
@@ -0,0 +1,155 @@
+package webdavtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Version reported by the fake server in status.php and the capabilities
+const (
+	versionString = "28.0.4"
+	versionFull   = "28.0.4.1"
+)
+
+// defaultCapabilities returns the capabilities of a stock Nextcloud installation
+func defaultCapabilities() map[string]interface{} {
+	return map[string]interface{}{
+		"core": map[string]interface{}{
+			"pollinterval": 60,
+			"webdav-root":  "remote.php/webdav",
+		},
+		"dav": map[string]interface{}{
+			"chunking":   "1.0",
+			"bulkupload": "1.0",
+		},
+		"files": map[string]interface{}{
+			"bigfilechunking": true,
+			"chunked_upload": map[string]interface{}{
+				"max_size":           100 * 1024 * 1024,
+				"max_parallel_count": 5,
+			},
+			"undelete":   true,
+			"versioning": true,
+		},
+		"files_sharing": map[string]interface{}{
+			"api_enabled": true,
+			"public": map[string]interface{}{
+				"enabled":  true,
+				"password": map[string]interface{}{"enforced": false},
+			},
+		},
+	}
+}
+
+// SetCapabilities replaces the capabilities of an app, e.g. "files_sharing". A nil
+// value removes the app from the capabilities.
+func (s *Server) SetCapabilities(app string, capabilities map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if capabilities == nil {
+		delete(s.capabilities, app)
+		return
+	}
+	s.capabilities[app] = capabilities
+}
+
+// serveStatus answers status.php, which needs no authentication
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"installed":       true,
+		"maintenance":     false,
+		"needsDbUpgrade":  false,
+		"version":         versionFull,
+		"versionstring":   versionString,
+		"edition":         "",
+		"productname":     "Nextcloud",
+		"extendedSupport": false,
+	})
+}
+
+// serveOCS answers an OCS API request below /ocs/v1.php or /ocs/v2.php. Responses
+// are always JSON, the client asks for format=json.
+func (s *Server) serveOCS(w http.ResponseWriter, r *http.Request) {
+	var endpoint string
+	v2 := false
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/ocs/v1.php/"):
+		endpoint = strings.TrimPrefix(r.URL.Path, "/ocs/v1.php")
+	case strings.HasPrefix(r.URL.Path, "/ocs/v2.php/"):
+		endpoint = strings.TrimPrefix(r.URL.Path, "/ocs/v2.php")
+		v2 = true
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case endpoint == sharesEndpoint || strings.HasPrefix(endpoint, sharesEndpoint+"/"):
+		s.serveShares(w, r, v2, strings.TrimPrefix(strings.TrimPrefix(endpoint, sharesEndpoint), "/"))
+	case endpoint == "/cloud/capabilities" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		data := map[string]interface{}{
+			"version": map[string]interface{}{
+				"major":  28,
+				"minor":  0,
+				"micro":  4,
+				"string": versionString,
+			},
+			"capabilities": s.capabilities,
+		}
+		// Encode while holding the lock, SetCapabilities may change the map
+		body, err := json.Marshal(ocsEnvelope(v2, http.StatusOK, "OK", data))
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	default:
+		writeOCS(w, v2, http.StatusNotFound, "Invalid query, please check the syntax. API specifications are here: http://www.freedesktop.org/wiki/Specifications/open-collaboration-services.", nil)
+	}
+}
+
+// ocsEnvelope wraps data in the OCS response format. OCS v1 reports status 100 for
+// success in the body and always answers with HTTP 200, v2 uses HTTP status codes.
+func ocsEnvelope(v2 bool, status int, message string, data interface{}) map[string]interface{} {
+	statusCode := status
+	meta := map[string]interface{}{"status": "ok", "message": message}
+	if status >= 400 {
+		meta["status"] = "failure"
+	} else if !v2 {
+		statusCode = 100
+	}
+	meta["statuscode"] = statusCode
+
+	if data == nil {
+		data = []interface{}{}
+	}
+	return map[string]interface{}{"ocs": map[string]interface{}{"meta": meta, "data": data}}
+}
+
+// writeOCS writes an OCS response with the HTTP status matching the API version
+func writeOCS(w http.ResponseWriter, v2 bool, status int, message string, data interface{}) {
+	httpStatus := http.StatusOK
+	if v2 {
+		httpStatus = status
+	}
+	writeJSON(w, httpStatus, ocsEnvelope(v2, status, message, data))
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,333 @@
+// Package webdavtest provides an in-process fake Nextcloud server for integration
+// tests. It speaks WebDAV, chunked uploads, the trashbin, file versions, the
+// OCS endpoints the client uses and the ways of logging in, keeps files in memory
+// and can be told to misbehave.
+package webdavtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// davPrefix is the URL path of the Nextcloud DAV root
+	davPrefix = "/remote.php/dav/"
+
+	// syncTokenPrefix is the prefix of the sync tokens handed out by the server
+	syncTokenPrefix = "http://sabre.io/ns/sync/"
+)
+
+// node is a file or directory in the server's tree
+type node struct {
+	content  []byte
+	modified time.Time
+	isDir    bool
+	fileID   int64
+	version  int64  // Change counter value of the last change, used for ETags and sync tokens
+	checksum string // oc:checksums value, e.g. "SHA256:..."
+}
+
+// File describes a file or directory on the server
+type File struct {
+	Content  []byte
+	Modified time.Time
+	IsDir    bool
+	ETag     string
+	FileID   string
+	Checksum string
+}
+
+// Server is a fake Nextcloud server for a single user. Paths taken by its helper
+// methods are relative to the user's files root, e.g. "Documents/a.txt".
+type Server struct {
+	*httptest.Server
+
+	Username string
+	Password string
+
+	mu           sync.Mutex
+	nodes        map[string]*node // Keyed by path below the DAV root, e.g. "files/alice/a.txt"
+	tombstones   map[string]int64 // Deleted paths and the change counter value of their deletion
+	version      int64
+	nextFileID   int64
+	faults       []*Fault
+	requests     map[string]int
+	capabilities map[string]interface{}
+	trash        map[string]*trashItem    // Keyed by the name of the item in the trashbin
+	versions     map[int64][]*fileVersion // Earlier versions of files keyed by file ID, oldest first
+	shares       []*share
+	nextShareID  int64
+	loginFlows   map[string]*loginFlow // Pending Login Flow v2 keyed by poll token
+	appPasswords map[string]string     // App passwords granted through Login Flow v2 and their names
+
+	oauth2Clients       map[string]*oauth2Client // Keyed by client ID
+	oauth2Codes         map[string]string        // Unused authorization codes and their client IDs
+	accessTokens        map[string]time.Time     // OAuth2 access tokens and their expiry
+	refreshTokens       map[string]string        // Unused OAuth2 refresh tokens and their client IDs
+	accessTokenLifetime time.Duration
+	tokenRefreshes      int
+}
+
+// NewServer starts a fake Nextcloud server that accepts the given credentials.
+// The caller must call Close when finished.
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Username:     username,
+		Password:     password,
+		nodes:        make(map[string]*node),
+		tombstones:   make(map[string]int64),
+		requests:     make(map[string]int),
+		capabilities: defaultCapabilities(),
+		trash:        make(map[string]*trashItem),
+		versions:     make(map[int64][]*fileVersion),
+		loginFlows:   make(map[string]*loginFlow),
+		appPasswords: make(map[string]string),
+
+		oauth2Clients:       make(map[string]*oauth2Client),
+		oauth2Codes:         make(map[string]string),
+		accessTokens:        make(map[string]time.Time),
+		refreshTokens:       make(map[string]string),
+		accessTokenLifetime: defaultAccessTokenLifetime,
+	}
+
+	for _, dir := range []string{"files", s.filesRoot(), "uploads", s.uploadsRoot()} {
+		s.put(dir, &node{isDir: true, modified: time.Now()})
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// filesRoot returns the DAV path of the user's files
+func (s *Server) filesRoot() string {
+	return "files/" + s.Username
+}
+
+// uploadsRoot returns the DAV path of the user's chunked upload directories
+func (s *Server) uploadsRoot() string {
+	return "uploads/" + s.Username
+}
+
+// filePath converts a path relative to the user's files root to a DAV path
+func (s *Server) filePath(p string) string {
+	return path.Join(s.filesRoot(), path.Clean("/"+p))
+}
+
+// WebDAVURL returns the WebDAV URL of the user's files root
+func (s *Server) WebDAVURL() string {
+	return s.URL + davPrefix + s.filesRoot()
+}
+
+// WriteFile creates or replaces a file, creating its parent directories
+func (s *Server) WriteFile(p string, content []byte, modified time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	davPath := s.filePath(p)
+	if err := s.mkdirAll(parentPath(davPath)); err != nil {
+		return err
+	}
+	if existing, exists := s.nodes[davPath]; exists && existing.isDir {
+		return fmt.Errorf("%s is a directory", p)
+	}
+	s.writeFile(davPath, content, modified, "")
+	return nil
+}
+
+// Mkdir creates a directory and its parents
+func (s *Server) Mkdir(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.mkdirAll(s.filePath(p))
+}
+
+// Remove removes a file or directory with its contents, bypassing the trashbin
+func (s *Server) Remove(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(s.filePath(p))
+}
+
+// ReadFile returns the content of a file
+func (s *Server) ReadFile(p string) ([]byte, error) {
+	file, ok := s.Lookup(p)
+	if !ok {
+		return nil, fmt.Errorf("%s does not exist", p)
+	}
+	if file.IsDir {
+		return nil, fmt.Errorf("%s is a directory", p)
+	}
+	return file.Content, nil
+}
+
+// Lookup returns a copy of a file or directory and whether it exists
+func (s *Server) Lookup(p string) (*File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, exists := s.nodes[s.filePath(p)]
+	if !exists {
+		return nil, false
+	}
+	return &File{
+		Content:  append([]byte(nil), n.content...),
+		Modified: n.modified,
+		IsDir:    n.isDir,
+		ETag:     n.etag(),
+		FileID:   fmt.Sprint(n.fileID),
+		Checksum: n.checksum,
+	}, true
+}
+
+// Paths returns the paths of all files and directories below the user's files
+// root in lexical order
+func (s *Server) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paths []string
+	root := s.filesRoot() + "/"
+	for p := range s.nodes {
+		if strings.HasPrefix(p, root) {
+			paths = append(paths, strings.TrimPrefix(p, root))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// RequestCount returns how many requests with a method the server received, or
+// all requests for an empty method
+func (s *Server) RequestCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if method == "" {
+		total := 0
+		for _, count := range s.requests {
+			total += count
+		}
+		return total
+	}
+	return s.requests[method]
+}
+
+// etag returns the quoted ETag of a node
+func (n *node) etag() string {
+	return fmt.Sprintf(`"%08x"`, n.version)
+}
+
+// put stores a node and records the change. A node without a file ID keeps the
+// ID of the node it replaces. The caller holds s.mu.
+func (s *Server) put(davPath string, n *node) {
+	if existing, exists := s.nodes[davPath]; exists && n.fileID == 0 {
+		n.fileID = existing.fileID
+	}
+	if n.fileID == 0 {
+		s.nextFileID++
+		n.fileID = s.nextFileID
+	}
+	s.nodes[davPath] = n
+	delete(s.tombstones, davPath)
+	s.touch(davPath)
+}
+
+// touch bumps the change counter for a path and, like Nextcloud, propagates the
+// new ETag to all parent directories. The caller holds s.mu.
+func (s *Server) touch(davPath string) {
+	s.version++
+	for p := davPath; ; p = parentPath(p) {
+		if n, exists := s.nodes[p]; exists {
+			n.version = s.version
+		}
+		if p == "" {
+			return
+		}
+	}
+}
+
+// writeFile stores a file, the caller holds s.mu and has created the parent. The
+// content of a replaced file of the user is kept as a version.
+func (s *Server) writeFile(davPath string, content []byte, modified time.Time, checksum string) {
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	if existing, exists := s.nodes[davPath]; exists && strings.HasPrefix(davPath, s.filesRoot()+"/") {
+		s.keepVersion(existing)
+	}
+	s.put(davPath, &node{
+		content:  append([]byte(nil), content...),
+		modified: modified.Truncate(time.Second),
+		checksum: checksum,
+	})
+}
+
+// mkdirAll creates a directory and its parents, the caller holds s.mu
+func (s *Server) mkdirAll(davPath string) error {
+	if davPath == "" {
+		return nil
+	}
+	if existing, exists := s.nodes[davPath]; exists {
+		if !existing.isDir {
+			return fmt.Errorf("%s is not a directory", davPath)
+		}
+		return nil
+	}
+	if err := s.mkdirAll(parentPath(davPath)); err != nil {
+		return err
+	}
+	s.put(davPath, &node{isDir: true, modified: time.Now().Truncate(time.Second)})
+	return nil
+}
+
+// remove deletes a subtree and records tombstones for it, the caller holds s.mu
+func (s *Server) remove(davPath string) {
+	if _, exists := s.nodes[davPath]; !exists {
+		return
+	}
+	s.touch(davPath)
+	for p := range s.subtree(davPath) {
+		delete(s.nodes, p)
+		s.tombstones[p] = s.version
+	}
+}
+
+// subtree returns the nodes at and below a path, the caller holds s.mu
+func (s *Server) subtree(davPath string) map[string]*node {
+	result := make(map[string]*node)
+	for p, n := range s.nodes {
+		if p == davPath || strings.HasPrefix(p, davPath+"/") {
+			result[p] = n
+		}
+	}
+	return result
+}
+
+// children returns the direct children of a directory in lexical order, the caller holds s.mu
+func (s *Server) children(davPath string) []string {
+	var children []string
+	for p := range s.nodes {
+		if p != davPath && parentPath(p) == davPath {
+			children = append(children, p)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// parentPath returns the parent of a DAV path, "" for top level paths
+func parentPath(p string) string {
+	index := strings.LastIndex(p, "/")
+	if index < 0 {
+		return ""
+	}
+	return p[:index]
+}
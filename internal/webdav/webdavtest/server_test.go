@@ -0,0 +1,409 @@
+package webdavtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phaus/nextcloud-sync/internal/auth"
+	"github.com/phaus/nextcloud-sync/internal/utils"
+	"github.com/phaus/nextcloud-sync/internal/webdav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a WebDAV client for the server that retries without delay
+func newTestClient(t *testing.T, srv *Server, password string) *webdav.WebDAVClient {
+	authProvider, err := auth.NewAppPasswordAuth(srv.URL, srv.Username, password)
+	require.NoError(t, err)
+	client, err := webdav.NewClient(authProvider)
+	require.NoError(t, err)
+	client.SetRetryConfig(&utils.RetryConfig{
+		MaxRetries:   3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+		Multiplier:   1,
+	})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// webdavError extracts the WebDAV error wrapped in err
+func webdavError(t *testing.T, err error) *webdav.WebDAVError {
+	var webdavErr *webdav.WebDAVError
+	require.True(t, errors.As(err, &webdavErr), "expected a WebDAV error, got %v", err)
+	return webdavErr
+}
+
+func TestServer_Propfind(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, srv.WriteFile("Documents/report.txt", []byte("hello"), modified))
+	require.NoError(t, srv.WriteFile("Documents/Old Files/notes & ideas.md", []byte("# notes"), modified))
+
+	// Depth 1
+	files, err := client.ListDirectory(ctx, "/Documents")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "Old Files", files[0].Name)
+	assert.True(t, files[0].IsDirectory)
+	assert.Equal(t, "report.txt", files[1].Name)
+	assert.Equal(t, int64(5), files[1].Size)
+	assert.True(t, files[1].LastModified.Equal(modified))
+
+	// Depth 0
+	props, err := client.GetProperties(ctx, "/Documents/report.txt")
+	require.NoError(t, err)
+	file, _ := srv.Lookup("Documents/report.txt")
+	assert.Equal(t, file.ETag, props.ETag)
+	assert.Equal(t, file.FileID, props.FileID)
+	assert.Equal(t, "text/plain; charset=utf-8", props.ContentType)
+
+	// Depth infinity
+	var listed []string
+	require.NoError(t, client.ListTree(ctx, "/", func(relPath string, file *webdav.WebDAVFile) error {
+		listed = append(listed, relPath)
+		return nil
+	}))
+	assert.Equal(t, []string{"Documents", "Documents/Old Files", "Documents/Old Files/notes & ideas.md", "Documents/report.txt"}, listed)
+
+	_, err = client.GetProperties(ctx, "/missing.txt")
+	assert.True(t, webdavError(t, err).IsNotFoundError())
+}
+
+func TestServer_ETagPropagation(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+
+	require.NoError(t, srv.WriteFile("a/b/c.txt", []byte("1"), time.Time{}))
+	require.NoError(t, srv.Mkdir("x"))
+	root, _ := srv.Lookup("")
+	x, _ := srv.Lookup("x")
+
+	require.NoError(t, srv.WriteFile("a/b/c.txt", []byte("2"), time.Time{}))
+	newRoot, _ := srv.Lookup("")
+	newX, _ := srv.Lookup("x")
+	assert.NotEqual(t, root.ETag, newRoot.ETag, "changes propagate to the root")
+	assert.Equal(t, x.ETag, newX.ETag, "unrelated directories keep their ETag")
+}
+
+func TestServer_Transfers(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	checksum := webdav.FormatChecksum(webdav.ChecksumSHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+
+	require.NoError(t, client.UploadFileWithMtime(ctx, "/hello.txt", strings.NewReader("hello world"), 11, modified))
+	file, ok := srv.Lookup("hello.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", string(file.Content))
+	assert.True(t, file.Modified.Equal(modified))
+
+	require.NoError(t, client.UploadFileWithChecksum(ctx, "/hello.txt", strings.NewReader("hello"), 5, checksum))
+	props, err := client.GetProperties(ctx, "/hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, checksum, props.Checksums)
+	replaced, _ := srv.Lookup("hello.txt")
+	assert.Equal(t, file.FileID, replaced.FileID, "replacing a file keeps its ID")
+
+	reader, err := client.DownloadFile(ctx, "/hello.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// Ranges are only honored for the current ETag
+	reader, offset, err := client.DownloadFileRange(ctx, "/hello.txt", 2, props.ETag)
+	require.NoError(t, err)
+	content, _ = io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, int64(2), offset)
+	assert.Equal(t, "llo", string(content))
+
+	reader, offset, err = client.DownloadFileRange(ctx, "/hello.txt", 2, `"stale"`)
+	require.NoError(t, err)
+	content, _ = io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, int64(0), offset)
+	assert.Equal(t, "hello", string(content))
+
+	err = client.UploadFile(ctx, "/missing/hello.txt", strings.NewReader("x"), 1)
+	assert.True(t, webdavError(t, err).IsConflictError(), "the parent must exist")
+}
+
+func TestServer_Collections(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	require.NoError(t, client.CreateDirectory(ctx, "/Photos"))
+	err := client.CreateDirectory(ctx, "/Photos")
+	assert.Equal(t, http.StatusMethodNotAllowed, webdavError(t, err).StatusCode)
+	err = client.CreateDirectory(ctx, "/a/b")
+	assert.True(t, webdavError(t, err).IsConflictError())
+
+	require.NoError(t, srv.WriteFile("Photos/2024/beach.jpg", []byte("jpeg"), time.Time{}))
+	original, _ := srv.Lookup("Photos/2024/beach.jpg")
+
+	require.NoError(t, client.MoveFile(ctx, "/Photos", "/Archive"))
+	moved, ok := srv.Lookup("Archive/2024/beach.jpg")
+	require.True(t, ok)
+	assert.Equal(t, original.FileID, moved.FileID, "moves keep the file ID")
+	_, ok = srv.Lookup("Photos")
+	assert.False(t, ok)
+
+	require.NoError(t, client.CopyFile(ctx, "/Archive/2024/beach.jpg", "/beach.jpg"))
+	copied, _ := srv.Lookup("beach.jpg")
+	assert.Equal(t, "jpeg", string(copied.Content))
+	assert.NotEqual(t, moved.FileID, copied.FileID, "copies get a new file ID")
+
+	require.NoError(t, client.DeleteFile(ctx, "/Archive"))
+	assert.Equal(t, []string{"beach.jpg"}, srv.Paths())
+	err = client.DeleteFile(ctx, "/Archive")
+	assert.True(t, webdavError(t, err).IsNotFoundError())
+}
+
+func TestServer_ChunkedUpload(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	// Chunks are at least 5MB
+	const chunkSize = 5 * 1024 * 1024
+	content := bytes.Repeat([]byte("0123456789"), 1600*1024)
+
+	// The third chunk fails with a permanent error, the upload is resumed after it
+	srv.AddFault(QuotaExceeded.On(http.MethodPut, "/00003").Times(1))
+	err := client.UploadFileChunked(ctx, "/big.bin", bytes.NewReader(content), int64(len(content)), chunkSize)
+	require.Error(t, err)
+	assert.True(t, webdavError(t, err).IsStorageError())
+
+	offset, err := client.ChunkedUploadOffset(ctx, "/big.bin", int64(len(content)), chunkSize)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*chunkSize), offset)
+
+	require.NoError(t, client.ResumeChunkedUpload(ctx, "/big.bin", bytes.NewReader(content), int64(len(content)), offset, chunkSize))
+	uploaded, err := srv.ReadFile("big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, content, uploaded)
+	assert.Equal(t, []string{"big.bin"}, srv.Paths(), "the upload directory is not part of the files")
+}
+
+func TestServer_SyncCollection(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	require.NoError(t, srv.WriteFile("docs/a.txt", []byte("a"), time.Time{}))
+	require.NoError(t, srv.WriteFile("docs/b.txt", []byte("b"), time.Time{}))
+
+	result, err := client.SyncCollection(ctx, "/docs", "")
+	require.NoError(t, err)
+	assert.Len(t, result.Changes, 2)
+	require.NotEmpty(t, result.Token)
+
+	require.NoError(t, srv.WriteFile("docs/a.txt", []byte("changed"), time.Time{}))
+	srv.Remove("docs/b.txt")
+
+	changes, err := client.SyncCollection(ctx, "/docs", result.Token)
+	require.NoError(t, err)
+	require.Len(t, changes.Changes, 2)
+	assert.Equal(t, "a.txt", changes.Changes[0].Path)
+	assert.Equal(t, int64(7), changes.Changes[0].File.Size)
+	assert.Equal(t, "b.txt", changes.Changes[1].Path)
+	assert.Nil(t, changes.Changes[1].File, "removed files have no properties")
+
+	_, err = client.SyncCollection(ctx, "/docs", "http://sabre.io/ns/sync/999")
+	assert.True(t, webdavError(t, err).IsPermissionError(), "unknown tokens are refused")
+}
+
+func TestServer_Trash(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	require.NoError(t, srv.WriteFile("Documents/report.txt", []byte("report"), time.Time{}))
+	require.NoError(t, srv.WriteFile("Photos/a.jpg", []byte("jpeg"), time.Time{}))
+	file, _ := srv.Lookup("Documents/report.txt")
+
+	// Deleting through WebDAV moves files to the trashbin
+	require.NoError(t, client.DeleteFile(ctx, "/Documents/report.txt"))
+	require.NoError(t, client.DeleteFile(ctx, "/Photos"))
+	items, err := client.ListTrash(ctx)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, srv.TrashNames(), []string{items[0].Name, items[1].Name})
+	photos, report := items[0], items[1]
+	assert.Equal(t, "Photos", photos.OriginalLocation)
+	assert.True(t, photos.IsDirectory)
+	assert.Equal(t, "Documents/report.txt", report.OriginalLocation)
+	assert.Equal(t, "report.txt", report.OriginalName)
+	assert.Equal(t, file.FileID, report.FileID)
+	assert.WithinDuration(t, time.Now(), report.DeletionTime, 5*time.Second)
+
+	// A restored file is back with its ID, a taken location gets a new name
+	require.NoError(t, srv.WriteFile("Documents/report.txt", []byte("new"), time.Time{}))
+	require.NoError(t, client.RestoreTrashItem(ctx, report.Name))
+	restored, ok := srv.Lookup("Documents/report (restored).txt")
+	require.True(t, ok)
+	assert.Equal(t, []byte("report"), restored.Content)
+	assert.Equal(t, file.FileID, restored.FileID)
+
+	// Directories are restored with their contents
+	require.NoError(t, client.RestoreTrashItem(ctx, photos.Name))
+	content, err := srv.ReadFile("Photos/a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("jpeg"), content)
+	assert.Empty(t, srv.TrashNames())
+
+	err = client.RestoreTrashItem(ctx, photos.Name)
+	assert.Equal(t, http.StatusNotFound, webdavError(t, err).StatusCode)
+
+	// Purging
+	require.NoError(t, client.DeleteFile(ctx, "/Photos/a.jpg"))
+	require.NoError(t, client.DeleteFile(ctx, "/Documents"))
+	require.Len(t, srv.TrashNames(), 2)
+	require.NoError(t, client.DeleteTrashItem(ctx, srv.TrashNames()[0]))
+	assert.Len(t, srv.TrashNames(), 1)
+	require.NoError(t, client.EmptyTrash(ctx))
+	assert.Empty(t, srv.TrashNames())
+}
+
+func TestServer_Versions(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+
+	first := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, srv.WriteFile("notes.txt", []byte("one"), first))
+	require.NoError(t, client.UploadFileWithMtime(ctx, "/notes.txt", strings.NewReader("two"), 3, first.Add(time.Hour)))
+	require.NoError(t, client.UploadFileWithMtime(ctx, "/notes.txt", strings.NewReader("three"), 5, first.Add(2*time.Hour)))
+	assert.Equal(t, 2, srv.VersionCount("notes.txt"))
+
+	// Newest versions come first
+	versions, err := client.ListVersions(ctx, "/notes.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.True(t, versions[0].LastModified.Equal(first.Add(time.Hour)))
+	assert.Equal(t, int64(3), versions[0].Size)
+	assert.True(t, versions[1].LastModified.Equal(first))
+
+	// Restoring keeps the replaced content as a version
+	require.NoError(t, client.RestoreVersion(ctx, versions[1]))
+	content, err := srv.ReadFile("notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("one"), content)
+	versions, err = client.ListVersions(ctx, "/notes.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.True(t, versions[0].LastModified.Equal(first.Add(2*time.Hour)))
+
+	_, err = client.ListVersions(ctx, "/missing.txt")
+	assert.Equal(t, http.StatusNotFound, webdavError(t, err).StatusCode)
+}
+
+func TestServer_Faults(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+	client := newTestClient(t, srv, "secret")
+	ctx := context.Background()
+	require.NoError(t, srv.WriteFile("a.txt", []byte("a"), time.Time{}))
+
+	// Temporary errors are retried
+	srv.AddFault(Unavailable.On("PROPFIND", "").Times(2))
+	_, err := client.GetProperties(ctx, "/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 3, srv.RequestCount("PROPFIND"))
+
+	srv.AddFault(Locked.On(http.MethodPut, "/a.txt").Times(1))
+	err = client.UploadFile(ctx, "/a.txt", strings.NewReader("b"), 1)
+	assert.True(t, webdavError(t, err).IsLockedError())
+
+	srv.AddFault(ServerError.On(http.MethodDelete, ""))
+	err = client.DeleteFile(ctx, "/a.txt")
+	assert.Equal(t, http.StatusInternalServerError, webdavError(t, err).StatusCode)
+	assert.Equal(t, 4, srv.RequestCount(http.MethodDelete), "the request is sent once and retried three times")
+	srv.ClearFaults()
+
+	srv.AddFault(Dropped.On(http.MethodGet, ""))
+	_, err = client.DownloadFile(ctx, "/a.txt")
+	assert.Error(t, err)
+	srv.ClearFaults()
+
+	srv.AddFault(Fault{Latency: 200 * time.Millisecond})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = client.GetProperties(timeoutCtx, "/a.txt")
+	assert.Error(t, err)
+	srv.ClearFaults()
+
+	_, err = newTestClient(t, srv, "wrong").GetProperties(ctx, "/a.txt")
+	assert.True(t, webdavError(t, err).IsAuthError())
+}
+
+func TestServer_OCS(t *testing.T) {
+	srv := NewServer("alice", "secret")
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/status.php")
+	require.NoError(t, err)
+	var status struct {
+		Installed   bool   `json:"installed"`
+		Maintenance bool   `json:"maintenance"`
+		ProductName string `json:"productname"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+	assert.True(t, status.Installed)
+	assert.Equal(t, "Nextcloud", status.ProductName)
+
+	srv.SetCapabilities("files_sharing", nil)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/ocs/v2.php/cloud/capabilities?format=json", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("OCS-APIRequest", "true")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var capabilities struct {
+		OCS struct {
+			Meta struct {
+				StatusCode int `json:"statuscode"`
+			} `json:"meta"`
+			Data struct {
+				Capabilities map[string]json.RawMessage `json:"capabilities"`
+			} `json:"data"`
+		} `json:"ocs"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&capabilities))
+	assert.Equal(t, 200, capabilities.OCS.Meta.StatusCode)
+	assert.Contains(t, capabilities.OCS.Data.Capabilities, "dav")
+	assert.NotContains(t, capabilities.OCS.Data.Capabilities, "files_sharing")
+
+	resp, err = http.Get(srv.URL + "/ocs/v2.php/cloud/capabilities")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,214 @@
+package webdavtest
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// sharesEndpoint is the OCS endpoint of the files_sharing app
+const sharesEndpoint = "/apps/files_sharing/api/v1/shares"
+
+// Share types of the sharing API
+const (
+	shareTypeUser  = 0
+	shareTypeGroup = 1
+	shareTypeLink  = 3
+)
+
+// share is a share created through the sharing API
+type share struct {
+	id          int64
+	shareType   int
+	path        string // Relative to the user's files root, with a leading slash
+	isDir       bool
+	permissions int
+	shareWith   string
+	token       string
+	password    string
+	expiration  time.Time
+	label       string
+	created     time.Time
+}
+
+// ShareCount returns the number of shares of the user
+func (s *Server) ShareCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.shares)
+}
+
+// serveShares answers the sharing API. id is the share ID below the endpoint, if any.
+func (s *Server) serveShares(w http.ResponseWriter, r *http.Request, v2 bool, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		var shares []interface{}
+		filter := r.URL.Query().Get("path")
+		if filter != "" {
+			if _, exists := s.nodes[s.filePath(filter)]; !exists {
+				writeOCS(w, v2, http.StatusNotFound, "Wrong path, file/folder does not exist", nil)
+				return
+			}
+			filter = path.Clean("/" + filter)
+		}
+		for _, sh := range s.shares {
+			if filter == "" || sh.path == filter {
+				shares = append(shares, s.shareData(sh))
+			}
+		}
+		if shares == nil {
+			shares = []interface{}{}
+		}
+		writeOCS(w, v2, http.StatusOK, "OK", shares)
+	case id == "" && r.Method == http.MethodPost:
+		s.createShare(w, r, v2)
+	case id != "" && r.Method == http.MethodDelete:
+		for i, sh := range s.shares {
+			if strconv.FormatInt(sh.id, 10) == id {
+				s.shares = append(s.shares[:i:i], s.shares[i+1:]...)
+				writeOCS(w, v2, http.StatusOK, "OK", nil)
+				return
+			}
+		}
+		writeOCS(w, v2, http.StatusNotFound, "Wrong share ID, share does not exist", nil)
+	default:
+		writeOCS(w, v2, http.StatusMethodNotAllowed, "Method not allowed", nil)
+	}
+}
+
+// createShare creates a share from the form of a POST request, the caller holds s.mu
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request, v2 bool) {
+	if err := r.ParseForm(); err != nil {
+		writeOCS(w, v2, http.StatusBadRequest, "Invalid form", nil)
+		return
+	}
+
+	sharePath := path.Clean("/" + r.PostForm.Get("path"))
+	n, exists := s.nodes[s.filePath(sharePath)]
+	if r.PostForm.Get("path") == "" || !exists {
+		writeOCS(w, v2, http.StatusNotFound, "Wrong path, file/folder does not exist", nil)
+		return
+	}
+
+	shareType, err := strconv.Atoi(r.PostForm.Get("shareType"))
+	if err != nil || (shareType != shareTypeUser && shareType != shareTypeGroup && shareType != shareTypeLink) {
+		writeOCS(w, v2, http.StatusBadRequest, "Unknown share type", nil)
+		return
+	}
+
+	sh := &share{
+		shareType: shareType,
+		path:      sharePath,
+		isDir:     n.isDir,
+		shareWith: r.PostForm.Get("shareWith"),
+		password:  r.PostForm.Get("password"),
+		label:     r.PostForm.Get("label"),
+		created:   time.Now(),
+	}
+
+	switch shareType {
+	case shareTypeLink:
+		if sh.password == "" && s.passwordEnforced() {
+			writeOCS(w, v2, http.StatusForbidden, "Passwords are enforced for link and mail shares", nil)
+			return
+		}
+		sh.shareWith = ""
+		sh.permissions = 1
+		if r.PostForm.Get("publicUpload") == "true" {
+			if !n.isDir {
+				writeOCS(w, v2, http.StatusNotFound, "Public upload is only possible for publicly shared folders", nil)
+				return
+			}
+			sh.permissions = 15
+		}
+		sh.token = randomToken(8)
+	default:
+		if sh.shareWith == "" {
+			writeOCS(w, v2, http.StatusNotFound, "Please specify a valid user or group", nil)
+			return
+		}
+		sh.permissions = 31
+		if !n.isDir {
+			sh.permissions = 19
+		}
+	}
+
+	if permissions := r.PostForm.Get("permissions"); permissions != "" {
+		value, err := strconv.Atoi(permissions)
+		if err != nil || value < 1 || value > 31 {
+			writeOCS(w, v2, http.StatusBadRequest, "Invalid permissions", nil)
+			return
+		}
+		sh.permissions = value
+	}
+
+	if expireDate := r.PostForm.Get("expireDate"); expireDate != "" {
+		expiration, err := time.Parse("2006-01-02", expireDate)
+		if err != nil {
+			writeOCS(w, v2, http.StatusNotFound, "Invalid date, date format must be YYYY-MM-DD", nil)
+			return
+		}
+		if !expiration.After(time.Now()) {
+			writeOCS(w, v2, http.StatusNotFound, "Expiration date is in the past", nil)
+			return
+		}
+		sh.expiration = expiration
+	}
+
+	s.nextShareID++
+	sh.id = s.nextShareID
+	s.shares = append(s.shares, sh)
+	writeOCS(w, v2, http.StatusOK, "OK", s.shareData(sh))
+}
+
+// passwordEnforced reports whether the capabilities enforce passwords for public
+// links, the caller holds s.mu
+func (s *Server) passwordEnforced() bool {
+	sharing, _ := s.capabilities["files_sharing"].(map[string]interface{})
+	public, _ := sharing["public"].(map[string]interface{})
+	password, _ := public["password"].(map[string]interface{})
+	enforced, _ := password["enforced"].(bool)
+	return enforced
+}
+
+// shareData renders a share like the sharing API does, the caller holds s.mu
+func (s *Server) shareData(sh *share) map[string]interface{} {
+	itemType := "file"
+	if sh.isDir {
+		itemType = "folder"
+	}
+
+	data := map[string]interface{}{
+		"id":                     strconv.FormatInt(sh.id, 10),
+		"share_type":             sh.shareType,
+		"uid_owner":              s.Username,
+		"displayname_owner":      s.Username,
+		"permissions":            sh.permissions,
+		"stime":                  sh.created.Unix(),
+		"path":                   sh.path,
+		"item_type":              itemType,
+		"file_target":            sh.path,
+		"share_with":             nil,
+		"share_with_displayname": nil,
+		"token":                  nil,
+		"expiration":             nil,
+		"label":                  sh.label,
+	}
+	if sh.shareWith != "" {
+		data["share_with"] = sh.shareWith
+		data["share_with_displayname"] = sh.shareWith
+	}
+	if sh.token != "" {
+		data["token"] = sh.token
+		data["url"] = s.URL + "/s/" + sh.token
+	}
+	if !sh.expiration.IsZero() {
+		data["expiration"] = sh.expiration.Format("2006-01-02 15:04:05")
+	}
+	return data
+}
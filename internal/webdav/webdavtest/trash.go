@@ -0,0 +1,301 @@
+package webdavtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashItem is a file or directory deleted through WebDAV
+type trashItem struct {
+	originalLocation string           // Path relative to the user's files root
+	deleted          time.Time        // Deletion time, also part of the item name
+	nodes            map[string]*node // The deleted subtree, keyed by path relative to the item
+}
+
+// fileVersion is an earlier version of a file, kept when the file is replaced
+type fileVersion struct {
+	content  []byte
+	modified time.Time
+}
+
+// trashRoot returns the DAV path of the user's trashbin
+func (s *Server) trashRoot() string {
+	return "trashbin/" + s.Username
+}
+
+// versionsRoot returns the DAV path of the user's file versions
+func (s *Server) versionsRoot() string {
+	return "versions/" + s.Username
+}
+
+// TrashNames returns the names of the items in the trashbin in lexical order.
+// Like Nextcloud, an item is named after the deleted file with a ".d<unix time>"
+// suffix.
+func (s *Server) TrashNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.trash))
+	for name := range s.trash {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VersionCount returns the number of earlier versions kept for a file
+func (s *Server) VersionCount(p string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, exists := s.nodes[s.filePath(p)]
+	if !exists {
+		return 0
+	}
+	return len(s.versions[n.fileID])
+}
+
+// moveToTrash keeps a subtree of the user's files in the trashbin before it is
+// removed, the caller holds s.mu
+func (s *Server) moveToTrash(davPath string) {
+	deleted := time.Now().Truncate(time.Second)
+	name := fmt.Sprintf("%s.d%d", path.Base(davPath), deleted.Unix())
+	for _, exists := s.trash[name]; exists; _, exists = s.trash[name] {
+		deleted = deleted.Add(time.Second)
+		name = fmt.Sprintf("%s.d%d", path.Base(davPath), deleted.Unix())
+	}
+
+	item := &trashItem{
+		originalLocation: strings.TrimPrefix(davPath, s.filesRoot()+"/"),
+		deleted:          deleted,
+		nodes:            make(map[string]*node),
+	}
+	for p, n := range s.subtree(davPath) {
+		item.nodes[strings.TrimPrefix(p, davPath)] = n
+	}
+	s.trash[name] = item
+}
+
+// keepVersion records the current content of a file that is about to be
+// replaced, the caller holds s.mu
+func (s *Server) keepVersion(n *node) {
+	versions := s.versions[n.fileID]
+	for i, version := range versions {
+		if version.modified.Equal(n.modified) {
+			versions = append(versions[:i:i], versions[i+1:]...)
+			break
+		}
+	}
+	s.versions[n.fileID] = append(versions, &fileVersion{content: n.content, modified: n.modified})
+}
+
+// serveTrashbin handles a request below the user's trashbin
+func (s *Server) serveTrashbin(w http.ResponseWriter, r *http.Request, davPath string) {
+	trashPath := s.trashRoot() + "/trash"
+	name := strings.TrimPrefix(davPath, trashPath+"/")
+	if davPath != trashPath && (name == davPath || strings.Contains(name, "/")) {
+		writeNotFound(w, davPath)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var item *trashItem
+	if davPath != trashPath {
+		if item = s.trash[name]; item == nil {
+			writeNotFound(w, davPath)
+			return
+		}
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		io.Copy(io.Discard, r.Body)
+		if item != nil {
+			writeMultistatus(w, []string{trashResponse(davPath, name, item)}, "")
+			return
+		}
+
+		responses := []string{propResponse(trashPath, &node{isDir: true, modified: time.Now()})}
+		if r.Header.Get("Depth") != "0" {
+			names := make([]string, 0, len(s.trash))
+			for name := range s.trash {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				responses = append(responses, trashResponse(trashPath+"/"+name, name, s.trash[name]))
+			}
+		}
+		writeMultistatus(w, responses, "")
+	case http.MethodDelete:
+		if item != nil {
+			delete(s.trash, name)
+		} else {
+			s.trash = make(map[string]*trashItem)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "MOVE":
+		destination, err := s.destination(r)
+		if err != nil || item == nil || parentPath(destination) != s.trashRoot()+"/restore" {
+			writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\Forbidden`, "Trashbin items can only be moved to the restore collection")
+			return
+		}
+		s.restoreTrashItem(name, item)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeDAVError(w, http.StatusMethodNotAllowed, `Sabre\DAV\Exception\MethodNotAllowed`, r.Method+" is not supported in the trashbin")
+	}
+}
+
+// restoreTrashItem moves an item of the trashbin back to its original location.
+// Like Nextcloud, it is restored to the root if its original directory is gone
+// and renamed if the location is taken. The caller holds s.mu.
+func (s *Server) restoreTrashItem(name string, item *trashItem) {
+	target := s.filePath(item.originalLocation)
+	if !s.isDirectory(parentPath(target)) {
+		target = s.filePath(path.Base(item.originalLocation))
+	}
+	if _, exists := s.nodes[target]; exists {
+		ext := path.Ext(target)
+		base := strings.TrimSuffix(target, ext)
+		target = base + " (restored)" + ext
+		for i := 2; ; i++ {
+			if _, exists := s.nodes[target]; !exists {
+				break
+			}
+			target = fmt.Sprintf("%s (restored %d)%s", base, i, ext)
+		}
+	}
+
+	relPaths := make([]string, 0, len(item.nodes))
+	for relPath := range item.nodes {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	for _, relPath := range relPaths {
+		s.put(target+relPath, item.nodes[relPath])
+	}
+	delete(s.trash, name)
+}
+
+// serveVersions handles a request below the user's file versions
+func (s *Server) serveVersions(w http.ResponseWriter, r *http.Request, davPath string) {
+	relPath := strings.TrimPrefix(davPath, s.versionsRoot()+"/versions/")
+	fileIDText, versionName, _ := strings.Cut(relPath, "/")
+	fileID, err := strconv.ParseInt(fileIDText, 10, 64)
+	if relPath == davPath || err != nil || strings.Contains(versionName, "/") {
+		writeNotFound(w, davPath)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filePath := s.fileByID(fileID)
+	if filePath == "" {
+		writeNotFound(w, davPath)
+		return
+	}
+	versions := s.versions[fileID]
+	index := -1
+	for i, version := range versions {
+		if strconv.FormatInt(version.modified.Unix(), 10) == versionName {
+			index = i
+		}
+	}
+	if versionName != "" && index < 0 {
+		writeNotFound(w, davPath)
+		return
+	}
+
+	collection := s.versionsRoot() + "/versions/" + fileIDText
+	switch r.Method {
+	case "PROPFIND":
+		io.Copy(io.Discard, r.Body)
+		if index >= 0 {
+			writeMultistatus(w, []string{versionResponse(collection, filePath, versions[index])}, "")
+			return
+		}
+
+		responses := []string{propResponse(collection, &node{isDir: true, modified: time.Now()})}
+		if r.Header.Get("Depth") != "0" {
+			for i := len(versions) - 1; i >= 0; i-- {
+				responses = append(responses, versionResponse(collection, filePath, versions[i]))
+			}
+		}
+		writeMultistatus(w, responses, "")
+	case "MOVE":
+		destination, err := s.destination(r)
+		if err != nil || index < 0 || destination != s.versionsRoot()+"/restore/target" {
+			writeDAVError(w, http.StatusForbidden, `Sabre\DAV\Exception\Forbidden`, "Versions can only be moved to the restore target")
+			return
+		}
+
+		// The current content becomes a version in place of the restored one
+		version := versions[index]
+		s.versions[fileID] = append(versions[:index:index], versions[index+1:]...)
+		s.writeFile(filePath, version.content, version.modified, "")
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeDAVError(w, http.StatusMethodNotAllowed, `Sabre\DAV\Exception\MethodNotAllowed`, r.Method+" is not supported for versions")
+	}
+}
+
+// fileByID returns the DAV path of the user's file with a file ID, or "" if there
+// is none. The caller holds s.mu.
+func (s *Server) fileByID(fileID int64) string {
+	for p, n := range s.nodes {
+		if n.fileID == fileID && !n.isDir && strings.HasPrefix(p, s.filesRoot()+"/") {
+			return p
+		}
+	}
+	return ""
+}
+
+// trashResponse renders an item of the trashbin as a multistatus response element
+func trashResponse(davPath, name string, item *trashItem) string {
+	root := item.nodes[""]
+	var b strings.Builder
+	b.WriteString(" <d:response>\n")
+	b.WriteString("  <d:href>" + escapeXML(href(davPath, root.isDir)) + "</d:href>\n")
+	b.WriteString("  <d:propstat>\n   <d:prop>\n")
+	b.WriteString("    <d:getlastmodified>" + root.modified.UTC().Format(http.TimeFormat) + "</d:getlastmodified>\n")
+	b.WriteString(fmt.Sprintf("    <oc:fileid>%d</oc:fileid>\n", root.fileID))
+	b.WriteString("    <nc:trashbin-filename>" + escapeXML(path.Base(item.originalLocation)) + "</nc:trashbin-filename>\n")
+	b.WriteString("    <nc:trashbin-original-location>" + escapeXML(item.originalLocation) + "</nc:trashbin-original-location>\n")
+	b.WriteString(fmt.Sprintf("    <nc:trashbin-deletion-time>%d</nc:trashbin-deletion-time>\n", item.deleted.Unix()))
+	if root.isDir {
+		b.WriteString("    <d:resourcetype><d:collection/></d:resourcetype>\n")
+	} else {
+		b.WriteString("    <d:resourcetype/>\n")
+		b.WriteString(fmt.Sprintf("    <d:getcontentlength>%d</d:getcontentlength>\n", len(root.content)))
+	}
+	b.WriteString("   </d:prop>\n   <d:status>HTTP/1.1 200 OK</d:status>\n  </d:propstat>\n")
+	b.WriteString(" </d:response>\n")
+	return b.String()
+}
+
+// versionResponse renders a version of a file as a multistatus response element
+func versionResponse(collection, filePath string, version *fileVersion) string {
+	name := strconv.FormatInt(version.modified.Unix(), 10)
+	var b strings.Builder
+	b.WriteString(" <d:response>\n")
+	b.WriteString("  <d:href>" + escapeXML(href(collection+"/"+name, false)) + "</d:href>\n")
+	b.WriteString("  <d:propstat>\n   <d:prop>\n")
+	b.WriteString("    <d:getlastmodified>" + version.modified.UTC().Format(http.TimeFormat) + "</d:getlastmodified>\n")
+	b.WriteString("    <d:getetag>\"" + name + "\"</d:getetag>\n")
+	b.WriteString(fmt.Sprintf("    <d:getcontentlength>%d</d:getcontentlength>\n", len(version.content)))
+	b.WriteString("    <d:getcontenttype>" + escapeXML(contentType(filePath)) + "</d:getcontenttype>\n")
+	b.WriteString("    <d:resourcetype/>\n")
+	b.WriteString("   </d:prop>\n   <d:status>HTTP/1.1 200 OK</d:status>\n  </d:propstat>\n")
+	b.WriteString(" </d:response>\n")
+	return b.String()
+}
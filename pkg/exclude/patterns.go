@@ -221,6 +221,7 @@ func LoadDefaultPatterns() *PatternSet {
 		"*.swp",
 		"*.swo",
 		"*~",
+		"*.nextcloud-sync.part", // Downloads in progress
 	}
 
 	set := NewPatternSet()
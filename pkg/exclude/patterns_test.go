@@ -275,6 +275,15 @@ func TestNewMatcher(t *testing.T) {
 	assert.Equal(t, "", matcher.GetRootDir())
 }
 
+func TestDefaultPatternsPartialDownloads(t *testing.T) {
+	matcher := NewMatcher(LoadDefaultPatterns())
+
+	// Only the partial downloads of the client itself are left out
+	assert.True(t, matcher.ShouldExclude("docs/report.pdf.nextcloud-sync.part", false))
+	assert.False(t, matcher.ShouldExclude("docs/archive.part", false))
+	assert.False(t, matcher.ShouldExclude("video.mkv.part", false))
+}
+
 func TestNewMatcherWithRoot(t *testing.T) {
 	patternSet := LoadDefaultPatterns()
 	rootDir := "/test/path"